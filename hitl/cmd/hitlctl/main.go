@@ -0,0 +1,296 @@
+// hitlctl manages HITL checkpoints directly in the configured store.
+//
+// The store is selected with -dir and the same HITL_STORE_*, HITL_COMPRESSION
+// and HITL_ENCRYPTION_KEYS environment variables the web server reads. Bundles
+// are checked against the graph definition given with -graph or
+// HITL_GRAPH_FILE, or the default graph. The token command signs tokens for
+// the server's hmac authentication with HITL_AUTH_HMAC_SECRET.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"eino_testing/hitl/pkg/auth"
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/graph"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, store *checkpoint.Store, args []string) error
+	// offline commands do not open the store and are passed nil
+	offline bool
+}
+
+// graphInfo describes the graph bundles are exported from and imported into
+var graphInfo = graph.Info(graph.Config{})
+
+var commands = []command{
+	{"list", "list [-graph name] [-tool name] [-label key:value] [-pending] [-sort field] [-asc] [-limit n]", runList, false},
+	{"export", "export [-o file] <checkpoint-id>", runExport, false},
+	{"import", "import [-id new-id] [-overwrite] <bundle>", runImport, false},
+	{"diff", "diff [-against ref] <checkpoint-id>", runDiff, false},
+	{"verify", "verify [-mode report|repair|quarantine]", runVerify, false},
+	{"token", "token [-role viewer|approver|admin] [-ttl duration] <subject>", runToken, true},
+}
+
+func main() {
+	dir := flag.String("dir", "./checkpoints_data", "checkpoint directory used by the file backend")
+	graphFile := flag.String("graph", os.Getenv("HITL_GRAPH_FILE"), "graph definition file (default: the built-in graph)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flag.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	if *graphFile != "" {
+		def, err := graph.LoadDefinition(*graphFile)
+		if err != nil {
+			fatal(err)
+		}
+		graphInfo = graph.Info(graph.Config{Definition: def})
+	}
+
+	if cmd.offline {
+		if err := cmd.run(context.Background(), nil, flag.Args()[1:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	cfg := checkpoint.BackendConfigFromEnv()
+	cfg.Dir = *dir
+	store, err := checkpoint.OpenStore(cfg, checkpoint.CodecConfigFromEnv())
+	if err != nil {
+		fatal(err)
+	}
+	defer store.Close()
+
+	if err := cmd.run(context.Background(), store, flag.Args()[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: hitlctl [-dir dir] [-graph file] <command> [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", c.usage)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "hitlctl: %v\n", err)
+	os.Exit(1)
+}
+
+// labelFlags collects repeated -label key:value flags
+type labelFlags map[string]string
+
+func (l labelFlags) String() string { return fmt.Sprint(map[string]string(l)) }
+
+func (l labelFlags) Set(v string) error {
+	key, value, _ := strings.Cut(v, ":")
+	l[key] = value
+	return nil
+}
+
+// runList prints the checkpoints matching the filters with their index metadata as JSON
+func runList(ctx context.Context, store *checkpoint.Store, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var q checkpoint.Query
+	labels := labelFlags{}
+	fs.StringVar(&q.GraphName, "graph", "", "graph name")
+	fs.StringVar(&q.LastNode, "node", "", "last node that ran")
+	fs.StringVar(&q.InterruptedBefore, "interrupted-before", "", "node the graph is interrupted before")
+	fs.StringVar(&q.Tool, "tool", "", "pending tool call")
+	fs.StringVar(&q.ContextKey, "context-key", "", "input context key")
+	fs.Var(labels, "label", "label key:value, or key alone (repeatable)")
+	pending := fs.Bool("pending", false, "only checkpoints with a pending overlay")
+	fs.StringVar(&q.SortBy, "sort", checkpoint.SortUpdatedAt, "sort field")
+	asc := fs.Bool("asc", false, "sort in ascending order")
+	fs.IntVar(&q.Offset, "offset", 0, "skip this many results")
+	fs.IntVar(&q.Limit, "limit", 0, "return at most this many results")
+	fs.Parse(args)
+
+	q.Labels = labels
+	q.Desc = !*asc
+	if *pending {
+		q.HasPendingState = pending
+	}
+
+	page, err := store.Query(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(page)
+}
+
+// runExport writes a checkpoint bundle to a file, or stdout with -o -
+func runExport(ctx context.Context, store *checkpoint.Store, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "", "output file (default <checkpoint-id>.hitl.tar.gz, - for stdout)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: hitlctl export [-o file] <checkpoint-id>")
+	}
+	id := fs.Arg(0)
+
+	bundle, err := store.Export(ctx, id, graphInfo, nil)
+	if err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		_, err := bundle.WriteTo(os.Stdout)
+		return err
+	}
+	if *out == "" {
+		*out = id + ".hitl.tar.gz"
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := bundle.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("exported %s to %s\n", id, *out)
+	return nil
+}
+
+// runImport validates a bundle against the local graph and stores it
+func runImport(ctx context.Context, store *checkpoint.Store, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	newID := fs.String("id", "", "store the checkpoint under this ID instead of the exported one")
+	overwrite := fs.Bool("overwrite", false, "replace an existing checkpoint")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: hitlctl import [-id new-id] [-overwrite] <bundle>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bundle, err := checkpoint.ReadBundle(f)
+	if err != nil {
+		return err
+	}
+
+	id, err := store.Import(ctx, bundle, graphInfo, *newID, *overwrite)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %s as %s (graph %s, interrupted before %v)\n",
+		bundle.Manifest.CheckpointID, id, bundle.Manifest.Graph.Name, bundle.Manifest.InterruptedNodes)
+	return nil
+}
+
+// runDiff prints the difference between a checkpoint and another state as JSON
+func runDiff(ctx context.Context, store *checkpoint.Store, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	against := fs.String("against", "", "revision number, pending, checkpoint ID or <id>@<rev> (default previous revision)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: hitlctl diff [-against ref] <checkpoint-id>")
+	}
+
+	diff, err := store.Diff(ctx, fs.Arg(0), *against)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diff)
+}
+
+// runVerify checks checkpoint integrity and prints the report as JSON. It
+// fails when problems are left unhandled.
+func runVerify(ctx context.Context, store *checkpoint.Store, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	mode := fs.String("mode", string(checkpoint.VerifyModeReport), "report, repair or quarantine")
+	fs.Parse(args)
+
+	report, err := store.Verify(ctx, checkpoint.VerifyMode(*mode))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	unhandled := 0
+	for _, issue := range report.Issues {
+		if issue.Action == "" {
+			unhandled++
+		}
+	}
+	if unhandled > 0 {
+		return fmt.Errorf("%d problems found", unhandled)
+	}
+	return nil
+}
+
+// runToken prints a token for the subject signed with HITL_AUTH_HMAC_SECRET
+func runToken(_ context.Context, _ *checkpoint.Store, args []string) error {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	role := fs.String("role", string(auth.RoleViewer), "role of the subject")
+	ttl := fs.Duration("ttl", 24*time.Hour, "lifetime of the token")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("token: subject required")
+	}
+
+	secret := os.Getenv("HITL_AUTH_HMAC_SECRET")
+	if secret == "" {
+		return fmt.Errorf("token: HITL_AUTH_HMAC_SECRET is not set")
+	}
+	r, err := auth.ParseRole(*role)
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.NewHMAC([]byte(secret)).Sign(auth.Principal{Subject: fs.Arg(0), Role: r}, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
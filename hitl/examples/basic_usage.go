@@ -49,6 +49,10 @@ func BasicExample() {
 		"location": "Beijing",
 	}
 
+	// Tool calls are decided on the terminal; swap in an interaction.Policy,
+	// Script or Webhook to decide them without one
+	approver := interaction.NewTerminal(os.Stdin, os.Stdout)
+
 	for {
 		result, err := runner.Invoke(ctx, input, compose.WithCheckPointID("example-1"))
 		if err == nil {
@@ -66,7 +70,7 @@ func BasicExample() {
 
 		// Display state and handle user confirmation
 		interaction.DisplayState(state)
-		if err := interaction.HandleToolCalls(state); err != nil {
+		if _, err := interaction.Confirm(ctx, approver, "example-1", state); err != nil {
 			log.Fatal(err)
 		}
 
@@ -0,0 +1,179 @@
+// Package auth authenticates the users of the HITL web server and assigns
+// them roles. Credentials are checked by an Authenticator: static API keys,
+// HMAC-signed tokens or JWTs verified against a local JWKS file.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials is returned for requests without credentials
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned for credentials no authenticator accepts
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Role is what a principal may do. Each role may do everything the roles
+// before it may.
+type Role string
+
+const (
+	// RoleViewer may watch executions and read checkpoints
+	RoleViewer Role = "viewer"
+	// RoleApprover may also start, resume and cancel executions and decide
+	// their tool calls
+	RoleApprover Role = "approver"
+	// RoleAdmin may also change and delete checkpoints, run the admin
+	// endpoints and read the audit log
+	RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleApprover: 2, RoleAdmin: 3}
+
+// ParseRole parses the name of a role
+func ParseRole(s string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return role, nil
+}
+
+// Allows reports whether r may do what required may
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
+// Principal is an authenticated user or service
+type Principal struct {
+	Subject string `json:"sub"`
+	Role    Role   `json:"role"`
+}
+
+// Authenticator checks the credentials of a request: an API key or a token
+type Authenticator interface {
+	// Authenticate returns the principal of credentials, or an error wrapping
+	// ErrInvalidCredentials
+	Authenticate(ctx context.Context, credentials string) (*Principal, error)
+}
+
+// Chain accepts credentials any of its authenticators accepts
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, credentials string) (*Principal, error) {
+	if credentials == "" {
+		return nil, ErrNoCredentials
+	}
+	err := ErrInvalidCredentials
+	for _, a := range c {
+		p, aerr := a.Authenticate(ctx, credentials)
+		if aerr == nil {
+			return p, nil
+		}
+		if !errors.Is(aerr, ErrInvalidCredentials) {
+			err = aerr
+		}
+	}
+	return nil, err
+}
+
+// APIKeys accepts static API keys
+type APIKeys struct {
+	// keys holds the principals by the SHA-256 of their key, so that a lookup
+	// does not compare keys byte by byte
+	keys map[[sha256.Size]byte]Principal
+}
+
+// NewAPIKeys accepts the given keys
+func NewAPIKeys(keys map[string]Principal) *APIKeys {
+	a := &APIKeys{keys: make(map[[sha256.Size]byte]Principal, len(keys))}
+	for key, p := range keys {
+		a.keys[sha256.Sum256([]byte(key))] = p
+	}
+	return a
+}
+
+// ParseAPIKeys parses a comma-separated list of key:subject:role entries
+func ParseAPIKeys(s string) (*APIKeys, error) {
+	keys := make(map[string]Principal)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid API key entry %q, want key:subject:role", entry)
+		}
+		role, err := ParseRole(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("API key of %s: %w", parts[1], err)
+		}
+		keys[parts[0]] = Principal{Subject: parts[1], Role: role}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no API keys")
+	}
+	return NewAPIKeys(keys), nil
+}
+
+func (a *APIKeys) Authenticate(_ context.Context, credentials string) (*Principal, error) {
+	p, ok := a.keys[sha256.Sum256([]byte(credentials))]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return &p, nil
+}
+
+// FromEnv builds the authenticator selected by HITL_AUTH, a comma-separated
+// list of apikey, hmac and jwt, each configured by its own variables:
+//
+//	apikey: HITL_API_KEYS (key:subject:role,...)
+//	hmac:   HITL_AUTH_HMAC_SECRET
+//	jwt:    HITL_AUTH_JWKS, HITL_AUTH_JWT_ISSUER, HITL_AUTH_JWT_AUDIENCE and
+//	        HITL_AUTH_JWT_ROLE_CLAIM
+//
+// It returns nil when HITL_AUTH is empty or "none".
+func FromEnv() (Authenticator, error) {
+	var chain Chain
+	for _, name := range strings.Split(os.Getenv("HITL_AUTH"), ",") {
+		switch strings.TrimSpace(name) {
+		case "", "none":
+		case "apikey":
+			keys, err := ParseAPIKeys(os.Getenv("HITL_API_KEYS"))
+			if err != nil {
+				return nil, fmt.Errorf("HITL_API_KEYS: %w", err)
+			}
+			chain = append(chain, keys)
+		case "hmac":
+			secret := os.Getenv("HITL_AUTH_HMAC_SECRET")
+			if secret == "" {
+				return nil, errors.New("HITL_AUTH_HMAC_SECRET is required for hmac authentication")
+			}
+			chain = append(chain, NewHMAC([]byte(secret)))
+		case "jwt":
+			jwt, err := LoadJWKS(os.Getenv("HITL_AUTH_JWKS"), JWTOptions{
+				Issuer:    os.Getenv("HITL_AUTH_JWT_ISSUER"),
+				Audience:  os.Getenv("HITL_AUTH_JWT_AUDIENCE"),
+				RoleClaim: os.Getenv("HITL_AUTH_JWT_ROLE_CLAIM"),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("HITL_AUTH_JWKS: %w", err)
+			}
+			chain = append(chain, jwt)
+		default:
+			return nil, fmt.Errorf("HITL_AUTH: unknown authenticator %q", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMAC(t *testing.T) {
+	ctx := context.Background()
+	h := NewHMAC([]byte("secret"))
+	now := time.Unix(1_700_000_000, 0)
+	h.now = func() time.Time { return now }
+
+	token, err := h.Sign(Principal{Subject: "ada", Role: RoleApprover}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := h.Authenticate(ctx, token)
+	if err != nil || p.Subject != "ada" || p.Role != RoleApprover {
+		t.Fatalf("Authenticate = %+v, %v, want ada as approver", p, err)
+	}
+
+	// sealed signs payload with the secret, so only its claims are wrong
+	sealed := func(payload string) string {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+		return encoded + "." + base64.RawURLEncoding.EncodeToString(h.mac(encoded))
+	}
+	encoded, sig, _ := strings.Cut(token, ".")
+	other, err := NewHMAC([]byte("other")).Sign(Principal{Subject: "ada", Role: RoleApprover}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other secret", other},
+		{"tampered payload", base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"ada","role":"admin","exp":1700003600}`)) + "." + sig},
+		{"tampered signature", encoded + "." + base64.RawURLEncoding.EncodeToString(h.mac(encoded+"x"))},
+		{"bad signature encoding", encoded + ".!!"},
+		{"no signature", encoded},
+		{"extra segment", token + ".x"},
+		{"bad payload encoding", "!!." + base64.RawURLEncoding.EncodeToString(h.mac("!!"))},
+		{"bad claims", sealed(`["ada"]`)},
+		{"expiry not a number", sealed(`{"sub":"ada","role":"admin","exp":"never"}`)},
+		{"without expiry", sealed(`{"sub":"ada","role":"admin"}`)},
+		{"without subject", sealed(`{"role":"admin","exp":1700003600}`)},
+		{"unknown role", sealed(`{"sub":"ada","role":"owner","exp":1700003600}`)},
+	}
+	for _, tt := range tests {
+		if p, err := h.Authenticate(ctx, tt.token); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: Authenticate = %+v, %v, want ErrInvalidCredentials", tt.name, p, err)
+		}
+	}
+
+	// Valid until its expiry, but not at it
+	now = now.Add(time.Hour - time.Second)
+	if _, err := h.Authenticate(ctx, token); err != nil {
+		t.Fatalf("Authenticate before expiry = %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := h.Authenticate(ctx, token); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate at expiry = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestHMACSign(t *testing.T) {
+	h := NewHMAC([]byte("secret"))
+	invalid := []struct {
+		name string
+		p    Principal
+		ttl  time.Duration
+	}{
+		{"no subject", Principal{Role: RoleViewer}, time.Hour},
+		{"unknown role", Principal{Subject: "ada", Role: "owner"}, time.Hour},
+		{"no lifetime", Principal{Subject: "ada", Role: RoleViewer}, 0},
+		{"negative lifetime", Principal{Subject: "ada", Role: RoleViewer}, -time.Hour},
+	}
+	for _, tt := range invalid {
+		if token, err := h.Sign(tt.p, tt.ttl); err == nil {
+			t.Errorf("%s: signed %s", tt.name, token)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha512" // SHA-384 and SHA-512 of RS384, ES512, ...
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWTOptions are the checks of a JWT's claims beyond its signature and its exp
+// and nbf times
+type JWTOptions struct {
+	// Issuer and Audience, when set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+	// RoleClaim names the claim holding the role: a string, or a list of
+	// strings of which the highest role counts. Defaults to "role".
+	RoleClaim string
+	// Leeway is the clock skew allowed checking exp and nbf, a minute by default
+	Leeway time.Duration
+}
+
+// JWT accepts JWTs signed with a key of a JWK set, with RS256, RS384, RS512,
+// PS256, PS384, PS512, ES256, ES384, ES512 or EdDSA (Ed25519)
+type JWT struct {
+	keys []jwk
+	opts JWTOptions
+	now  func() time.Time
+}
+
+// jwk is a public key of a JWK set
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// jsonWebKey is a JWK as serialized in a JWK set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS accepts JWTs signed with the keys of the JWK set in path
+func LoadJWKS(path string, opts JWTOptions) (*JWT, error) {
+	if path == "" {
+		return nil, errors.New("JWKS file is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j, err := ParseJWKS(data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return j, nil
+}
+
+// ParseJWKS accepts JWTs signed with the keys of a JWK set. Keys whose use is
+// not "sig" are ignored.
+func ParseJWKS(data []byte, opts JWTOptions) (*JWT, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse JWK set: %w", err)
+	}
+
+	j := &JWT{opts: opts, now: time.Now}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		j.keys = append(j.keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(j.keys) == 0 {
+		return nil, errors.New("no signing keys in JWK set")
+	}
+
+	if j.opts.RoleClaim == "" {
+		j.opts.RoleClaim = "role"
+	}
+	if j.opts.Leeway == 0 {
+		j.opts.Leeway = time.Minute
+	}
+	return j, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("invalid RSA modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var point ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, point = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, point = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, point = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC coordinates")
+		}
+		// ecdh checks the point is on the curve
+		if _, err := point.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid EC point: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func (j *JWT) Authenticate(_ context.Context, credentials string) (*Principal, error) {
+	parts := strings.Split(credentials, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalidCredentials)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad JWT header: %v", ErrInvalidCredentials, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad JWT signature encoding", ErrInvalidCredentials)
+	}
+	if err := j.verify(header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad JWT claims: %v", ErrInvalidCredentials, err)
+	}
+	if err := j.checkClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("%w: JWT without subject", ErrInvalidCredentials)
+	}
+	role, ok := highestRole(claims[j.opts.RoleClaim])
+	if !ok {
+		return nil, fmt.Errorf("%w: JWT without a known role in claim %q", ErrInvalidCredentials, j.opts.RoleClaim)
+	}
+	return &Principal{Subject: sub, Role: role}, nil
+}
+
+// verify checks sig against a key of the set matching kid and alg
+func (j *JWT) verify(alg, kid string, signed, sig []byte) error {
+	err := fmt.Errorf("no key for kid %q and alg %q", kid, alg)
+	for _, k := range j.keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+		if err = verifySignature(k.key, alg, signed, sig); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// checkClaims checks the exp, nbf, iss and aud claims
+func (j *JWT) checkClaims(claims map[string]any) error {
+	now := j.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("JWT without expiry")
+	}
+	if now.Add(-j.opts.Leeway).After(time.Unix(int64(exp), 0)) {
+		return errors.New("JWT expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(j.opts.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("JWT not valid yet")
+	}
+
+	if j.opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.opts.Issuer {
+			return fmt.Errorf("JWT issuer %q not accepted", iss)
+		}
+	}
+	if j.opts.Audience != "" && !hasAudience(claims["aud"], j.opts.Audience) {
+		return errors.New("JWT not issued for this audience")
+	}
+	return nil
+}
+
+// hasAudience reports whether the aud claim, a string or a list of strings,
+// holds audience
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// highestRole returns the highest known role of a role claim
+func highestRole(claim any) (Role, bool) {
+	var names []any
+	switch claim := claim.(type) {
+	case string:
+		names = []any{claim}
+	case []any:
+		names = claim
+	}
+
+	var best Role
+	for _, name := range names {
+		s, _ := name.(string)
+		role, err := ParseRole(s)
+		if err == nil && !best.Allows(role) {
+			best = role
+		}
+	}
+	return best, best != ""
+}
+
+// verifySignature checks the JWS signature sig of signed with key
+func verifySignature(key crypto.PublicKey, alg string, signed, sig []byte) error {
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s needs an RSA key", alg)
+		}
+		h := hashes[alg[2:]]
+		digest := h.New()
+		digest.Write(signed)
+		if alg[0] == 'R' {
+			return rsa.VerifyPKCS1v15(pub, h, digest.Sum(nil), sig)
+		}
+		return rsa.VerifyPSS(pub, h, digest.Sum(nil), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256", "ES384", "ES512":
+		pub, ok := key.(*ecdsa.PublicKey)
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+		if !ok || pub.Curve != curves[alg] {
+			return fmt.Errorf("%s needs an EC key on %s", alg, curves[alg].Params().Name)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("bad ECDSA signature length")
+		}
+		h := hashes[alg[2:]]
+		digest := h.New()
+		digest.Write(signed)
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest.Sum(nil), r, s) {
+			return errors.New("bad ECDSA signature")
+		}
+		return nil
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("EdDSA needs an Ed25519 key")
+		}
+		if !ed25519.Verify(pub, signed, sig) {
+			return errors.New("bad EdDSA signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT into v
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
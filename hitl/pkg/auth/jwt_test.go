@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKeys are the private keys of the test JWK set
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey, ed: edKey}
+}
+
+// jwks is the JWK set of the public keys: the RSA key for any alg, the EC key
+// for ES256 only
+func (k testKeys) jwks(t *testing.T) []byte {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+	ecPub := k.ec.PublicKey
+	set := map[string][]jsonWebKey{"keys": {
+		{Kty: "RSA", Kid: "rsa", Use: "sig", N: b64(k.rsa.N.Bytes()), E: b64([]byte{1, 0, 1})},
+		{Kty: "EC", Kid: "ec", Alg: "ES256", Crv: "P-256", X: b64(ecPub.X.FillBytes(make([]byte, 32))), Y: b64(ecPub.Y.FillBytes(make([]byte, 32)))},
+		{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: b64(k.ed.Public().(ed25519.PublicKey))},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// sign returns a JWT of claims signed by the key for alg, or unsigned for
+// alg none
+func (k testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	var err error
+	switch alg {
+	case "none":
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	case "PS256":
+		sig, err = rsa.SignPSS(rand.Reader, k.rsa, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case "EdDSA":
+		sig = ed25519.Sign(k.ed, []byte(signed))
+	case "HS256":
+		// The public key as an HMAC secret, as in key confusion attacks
+		pub, _ := x509.MarshalPKIXPublicKey(&k.rsa.PublicKey)
+		m := hmac.New(sha256.New, pub)
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	default:
+		t.Fatalf("cannot sign %s", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestJWT(t *testing.T) {
+	keys := newTestKeys(t)
+	j, err := ParseJWKS(keys.jwks(t), JWTOptions{Issuer: "https://issuer", Audience: "hitl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	j.now = func() time.Time { return now }
+
+	// claims are valid claims of ada, changed by the given ones; a nil value
+	// drops a claim
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{
+			"sub":  "ada",
+			"role": "approver",
+			"iss":  "https://issuer",
+			"aud":  "hitl",
+			"exp":  now.Add(time.Hour).Unix(),
+			"nbf":  now.Add(-time.Hour).Unix(),
+		}
+		for name, v := range changes {
+			if v == nil {
+				delete(c, name)
+			} else {
+				c[name] = v
+			}
+		}
+		return c
+	}
+	valid := keys.sign(t, "RS256", "rsa", claims(nil))
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		want  Role
+	}{
+		{"RS256", valid, RoleApprover},
+		{"PS256", keys.sign(t, "PS256", "rsa", claims(nil)), RoleApprover},
+		{"ES256", keys.sign(t, "ES256", "ec", claims(nil)), RoleApprover},
+		{"EdDSA", keys.sign(t, "EdDSA", "ed", claims(nil)), RoleApprover},
+		{"without kid", keys.sign(t, "EdDSA", "", claims(nil)), RoleApprover},
+		{"highest role", keys.sign(t, "RS256", "rsa", claims(map[string]any{"role": []string{"viewer", "admin"}})), RoleAdmin},
+		{"audience in a list", keys.sign(t, "RS256", "rsa", claims(map[string]any{"aud": []string{"other", "hitl"}})), RoleApprover},
+		{"expired within leeway", keys.sign(t, "RS256", "rsa", claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()})), RoleApprover},
+		{"not valid yet within leeway", keys.sign(t, "RS256", "rsa", claims(map[string]any{"nbf": now.Add(30 * time.Second).Unix()})), RoleApprover},
+
+		{"alg none", keys.sign(t, "none", "", claims(nil)), ""},
+		{"alg none with kid", keys.sign(t, "none", "rsa", claims(nil)), ""},
+		{"alg none with a signature", encodeSegment(t, map[string]string{"alg": "none", "kid": "rsa"}) + "." + parts[1] + "." + parts[2], ""},
+		{"HS256 with the public key", keys.sign(t, "HS256", "rsa", claims(nil)), ""},
+		{"EdDSA for an RSA key", keys.sign(t, "EdDSA", "rsa", claims(nil)), ""},
+		{"ES256 for an Ed25519 key", keys.sign(t, "ES256", "ed", claims(nil)), ""},
+		{"alg other than the key's", keys.sign(t, "RS256", "ec", claims(nil)), ""},
+		{"unknown kid", keys.sign(t, "RS256", "other", claims(nil)), ""},
+		{"expired", keys.sign(t, "RS256", "rsa", claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})), ""},
+		{"without expiry", keys.sign(t, "RS256", "rsa", claims(map[string]any{"exp": nil})), ""},
+		{"not valid yet", keys.sign(t, "RS256", "rsa", claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})), ""},
+		{"without audience", keys.sign(t, "RS256", "rsa", claims(map[string]any{"aud": nil})), ""},
+		{"other audience", keys.sign(t, "RS256", "rsa", claims(map[string]any{"aud": "other"})), ""},
+		{"audience not in a list", keys.sign(t, "RS256", "rsa", claims(map[string]any{"aud": []string{"other"}})), ""},
+		{"other issuer", keys.sign(t, "RS256", "rsa", claims(map[string]any{"iss": "https://other"})), ""},
+		{"without subject", keys.sign(t, "RS256", "rsa", claims(map[string]any{"sub": nil})), ""},
+		{"unknown role", keys.sign(t, "RS256", "rsa", claims(map[string]any{"role": "owner"})), ""},
+		{"tampered payload", parts[0] + "." + encodeSegment(t, claims(map[string]any{"role": "admin"})) + "." + parts[2], ""},
+		{"tampered header", encodeSegment(t, map[string]string{"alg": "RS256", "kid": "rsa", "typ": "at+jwt"}) + "." + parts[1] + "." + parts[2], ""},
+		{"truncated signature", valid[:len(valid)-4], ""},
+		{"not a JWT", parts[0] + "." + parts[1], ""},
+	}
+	for _, tt := range tests {
+		p, err := j.Authenticate(context.Background(), tt.token)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("%s: Authenticate = %+v, %v, want ErrInvalidCredentials", tt.name, p, err)
+			}
+			continue
+		}
+		if err != nil || p.Subject != "ada" || p.Role != tt.want {
+			t.Errorf("%s: Authenticate = %+v, %v, want ada as %s", tt.name, p, err, tt.want)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	b64 := base64.RawURLEncoding.EncodeToString
+	tests := []struct {
+		name string
+		set  string
+	}{
+		{"not JSON", "keys"},
+		{"no keys", `{"keys": []}`},
+		{"encryption keys only", `{"keys": [{"kty": "OKP", "use": "enc", "crv": "Ed25519", "x": "` + b64(keys.ed.Public().(ed25519.PublicKey)) + `"}]}`},
+		{"unknown key type", `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`},
+		{"unknown curve", `{"keys": [{"kty": "EC", "crv": "P-192", "x": "AA", "y": "AA"}]}`},
+		{"EC point off the curve", `{"keys": [{"kty": "EC", "crv": "P-256", "x": "` + b64(make([]byte, 32)) + `", "y": "` + b64(make([]byte, 32)) + `"}]}`},
+		{"short Ed25519 key", `{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "AAAA"}]}`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseJWKS([]byte(tt.set), JWTOptions{}); err == nil {
+			t.Errorf("%s: parsed", tt.name)
+		}
+	}
+
+	j, err := ParseJWKS(keys.jwks(t), JWTOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.opts.RoleClaim != "role" || j.opts.Leeway != time.Minute {
+		t.Fatalf("default options %+v", j.opts)
+	}
+}
+
+func TestJWTRoleClaim(t *testing.T) {
+	keys := newTestKeys(t)
+	j, err := ParseJWKS(keys.jwks(t), JWTOptions{RoleClaim: "groups"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	p, err := j.Authenticate(context.Background(), keys.sign(t, "EdDSA", "ed", map[string]any{"sub": "ada", "exp": exp, "groups": []string{"staff", "viewer"}}))
+	if err != nil || p.Role != RoleViewer {
+		t.Fatalf("Authenticate = %+v, %v, want a viewer", p, err)
+	}
+	// The role claim replaces the default one
+	if _, err := j.Authenticate(context.Background(), keys.sign(t, "EdDSA", "ed", map[string]any{"sub": "ada", "exp": exp, "role": "admin"})); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate with a role claim = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestHighestRole(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim any
+		want  Role
+	}{
+		{"string", "approver", RoleApprover},
+		{"any case", " Admin ", RoleAdmin},
+		{"list", []any{"viewer", "admin", "approver"}, RoleAdmin},
+		{"list in any order", []any{"approver", "viewer"}, RoleApprover},
+		{"unknown roles skipped", []any{"owner", 7, "viewer"}, RoleViewer},
+		{"unknown role", "owner", ""},
+		{"only unknown roles", []any{"owner", nil}, ""},
+		{"empty list", []any{}, ""},
+		{"number", 3, ""},
+		{"no claim", nil, ""},
+	}
+	for _, tt := range tests {
+		role, ok := highestRole(tt.claim)
+		if role != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: highestRole(%v) = %q, %v, want %q", tt.name, tt.claim, role, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Kind identifies the type of blob kept by a Backend
+type Kind string
+
+const (
+	// KindCheckpoint is the checkpoint blob written by compose
+	KindCheckpoint Kind = "checkpoint"
+	// KindOverlay is the pending state overlay saved on human confirmation
+	KindOverlay Kind = "overlay"
+)
+
+// Backend is the persistence layer used by Store and the overlay helpers.
+// Implementations must be safe for concurrent use.
+type Backend interface {
+	// Get returns the blob of the given kind, reporting whether it exists
+	Get(ctx context.Context, kind Kind, id string) ([]byte, bool, error)
+	// Put creates or replaces the blob of the given kind
+	Put(ctx context.Context, kind Kind, id string, data []byte) error
+	// Delete removes the blob of the given kind; missing blobs are not an error
+	Delete(ctx context.Context, kind Kind, id string) error
+	// List returns a summary of every blob of the given kind, sorted by ID
+	List(ctx context.Context, kind Kind) ([]CheckpointSummary, error)
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+const (
+	BackendFile   = "file"
+	BackendSQLite = "sqlite"
+	BackendRedis  = "redis"
+)
+
+// BackendConfig selects and configures a Backend
+type BackendConfig struct {
+	Type string `json:"type"` // "file" (default), "sqlite" or "redis"
+
+	// Dir is the directory used by the file backend
+	Dir string `json:"dir,omitempty"`
+
+	// SQLitePath is the database file used by the sqlite backend
+	SQLitePath string `json:"sqlite_path,omitempty"`
+
+	// Redis connection settings used by the redis backend
+	RedisAddr     string `json:"redis_addr,omitempty"`
+	RedisPassword string `json:"-"`
+	RedisDB       int    `json:"redis_db,omitempty"`
+	RedisPrefix   string `json:"redis_prefix,omitempty"`
+}
+
+// NewBackend creates the backend described by cfg
+func NewBackend(cfg BackendConfig) (Backend, error) {
+	switch cfg.Type {
+	case "", BackendFile:
+		return NewFileBackend(cfg.Dir)
+	case BackendSQLite:
+		return NewSQLiteBackend(cfg.SQLitePath)
+	case BackendRedis:
+		return NewRedisBackend(RedisOptions{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+			Prefix:   cfg.RedisPrefix,
+		})
+	default:
+		return nil, fmt.Errorf("unknown checkpoint backend: %s", cfg.Type)
+	}
+}
+
+// BackendConfigFromEnv reads the backend settings from the HITL_STORE_BACKEND,
+// HITL_SQLITE_PATH and HITL_REDIS_* environment variables
+func BackendConfigFromEnv() BackendConfig {
+	db, _ := strconv.Atoi(os.Getenv("HITL_REDIS_DB"))
+	return BackendConfig{
+		Type:          os.Getenv("HITL_STORE_BACKEND"),
+		SQLitePath:    os.Getenv("HITL_SQLITE_PATH"),
+		RedisAddr:     os.Getenv("HITL_REDIS_ADDR"),
+		RedisPassword: os.Getenv("HITL_REDIS_PASSWORD"),
+		RedisDB:       db,
+		RedisPrefix:   os.Getenv("HITL_REDIS_PREFIX"),
+	}
+}
@@ -0,0 +1,183 @@
+package checkpoint
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testBackend opens backends of one type for tests
+type testBackend struct {
+	name string
+	// shared creates an empty store and returns a function opening backends
+	// on it, each like a separate replica
+	shared func(t *testing.T) func() Backend
+}
+
+var testBackends = []testBackend{
+	{
+		name: BackendFile,
+		shared: func(t *testing.T) func() Backend {
+			dir := t.TempDir()
+			return func() Backend {
+				b, err := NewFileBackend(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return b
+			}
+		},
+	},
+	{
+		name: BackendSQLite,
+		shared: func(t *testing.T) func() Backend {
+			path := filepath.Join(t.TempDir(), "checkpoints.db")
+			return func() Backend {
+				b, err := NewSQLiteBackend(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { b.Close() })
+				return b
+			}
+		},
+	},
+	{
+		name: BackendRedis,
+		shared: func(t *testing.T) func() Backend {
+			server := miniredis.RunT(t)
+			return func() Backend {
+				b, err := NewRedisBackend(RedisOptions{Addr: server.Addr()})
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { b.Close() })
+				return b
+			}
+		},
+	},
+}
+
+// forEachBackend runs test against a new store of every backend type
+func forEachBackend(t *testing.T, test func(t *testing.T, open func() Backend)) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			test(t, tb.shared(t))
+		})
+	}
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		b := open()
+
+		tests := []struct {
+			name string
+			run  func(t *testing.T)
+		}{
+			{"missing key", func(t *testing.T) {
+				data, ok, err := b.Get(ctx, KindCheckpoint, "missing")
+				if err != nil || ok || data != nil {
+					t.Fatalf("Get = %q, %v, %v; want nothing", data, ok, err)
+				}
+				if err := b.Delete(ctx, KindCheckpoint, "missing"); err != nil {
+					t.Fatalf("Delete of a missing blob: %v", err)
+				}
+			}},
+			{"put get delete", func(t *testing.T) {
+				if err := b.Put(ctx, KindCheckpoint, "cp", []byte("one")); err != nil {
+					t.Fatal(err)
+				}
+				if data, ok, err := b.Get(ctx, KindCheckpoint, "cp"); err != nil || !ok || string(data) != "one" {
+					t.Fatalf("Get = %q, %v, %v; want one", data, ok, err)
+				}
+				// Kinds are separate namespaces
+				if _, ok, _ := b.Get(ctx, KindOverlay, "cp"); ok {
+					t.Fatal("overlay found for a checkpoint blob")
+				}
+
+				if err := b.Delete(ctx, KindCheckpoint, "cp"); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok, err := b.Get(ctx, KindCheckpoint, "cp"); err != nil || ok {
+					t.Fatalf("Get after Delete = %v, %v", ok, err)
+				}
+			}},
+			{"overwrite", func(t *testing.T) {
+				for _, data := range []string{"first", "second, longer"} {
+					if err := b.Put(ctx, KindOverlay, "ow", []byte(data)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if data, _, _ := b.Get(ctx, KindOverlay, "ow"); string(data) != "second, longer" {
+					t.Fatalf("Get = %q, want the second write", data)
+				}
+				list, err := b.List(ctx, KindOverlay)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(list) != 1 || list[0].ID != "ow" || list[0].Size != int64(len("second, longer")) {
+					t.Fatalf("List = %+v, want one entry of the second size", list)
+				}
+			}},
+			{"list", func(t *testing.T) {
+				// Written out of order, and with IDs whose file names sort
+				// differently from the IDs
+				for _, id := range []string{"b", "a-b", "c@2", "a", "c@10"} {
+					if err := b.Put(ctx, KindRevision, id, []byte(id)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := b.Put(ctx, KindHistory, "other", []byte("x")); err != nil {
+					t.Fatal(err)
+				}
+
+				list, err := b.List(ctx, KindRevision)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []string
+				for _, s := range list {
+					ids = append(ids, s.ID)
+					if s.Size != int64(len(s.ID)) || s.CreatedAt.IsZero() {
+						t.Errorf("summary %+v, want size %d and a time", s, len(s.ID))
+					}
+				}
+				want := []string{"a", "a-b", "b", "c@10", "c@2"}
+				if len(ids) != len(want) {
+					t.Fatalf("List = %v, want %v", ids, want)
+				}
+				for i := range want {
+					if ids[i] != want[i] {
+						t.Fatalf("List = %v, want %v", ids, want)
+					}
+				}
+
+				if list, err := b.List(ctx, KindMeta); err != nil || len(list) != 0 {
+					t.Fatalf("List of an empty kind = %v, %v", list, err)
+				}
+			}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, tt.run)
+		}
+	})
+}
+
+func TestBackendsShareStore(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		a, b := open(), open()
+		if err := a.Put(ctx, KindCheckpoint, "cp", []byte("from a")); err != nil {
+			t.Fatal(err)
+		}
+		if data, ok, err := b.Get(ctx, KindCheckpoint, "cp"); err != nil || !ok || string(data) != "from a" {
+			t.Fatalf("Get from b = %q, %v, %v", data, ok, err)
+		}
+	})
+}
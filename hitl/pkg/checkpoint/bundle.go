@@ -0,0 +1,315 @@
+package checkpoint
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// BundleVersion is the manifest version written by Export
+const BundleVersion = 1
+
+const (
+	bundleManifestFile   = "manifest.json"
+	bundleCheckpointFile = "checkpoint.json"
+	bundleOverlayFile    = "overlay.json"
+	bundleExecutionFile  = "execution.json"
+
+	// maxBundleFileSize bounds each archive entry read by ReadBundle
+	maxBundleFileSize = 64 << 20
+)
+
+var (
+	// ErrInvalidBundle is returned when an archive is not a checkpoint bundle
+	ErrInvalidBundle = errors.New("invalid checkpoint bundle")
+	// ErrGraphMismatch is returned when a bundle was exported from a different graph
+	ErrGraphMismatch = errors.New("bundle does not match target graph")
+	// ErrCheckpointExists is returned when importing over an existing checkpoint
+	ErrCheckpointExists = errors.New("checkpoint already exists")
+)
+
+// GraphInfo identifies the graph a checkpoint belongs to
+type GraphInfo struct {
+	Name  string   `json:"name"`
+	Nodes []string `json:"nodes"`
+}
+
+// Manifest describes the contents of a bundle
+type Manifest struct {
+	Version          int       `json:"version"`
+	CheckpointID     string    `json:"checkpoint_id"`
+	Graph            GraphInfo `json:"graph"`
+	InterruptedNodes []string  `json:"interrupted_nodes,omitempty"`
+	HasOverlay       bool      `json:"has_overlay"`
+	HasExecution     bool      `json:"has_execution"`
+	ExportedAt       time.Time `json:"exported_at"`
+}
+
+// Bundle is a self-contained copy of an interrupted run: the checkpoint, its
+// pending overlay and the execution metadata of the process that produced it
+type Bundle struct {
+	Manifest   Manifest
+	Checkpoint []byte
+	Overlay    []byte
+	// Execution is opaque JSON supplied by the exporter
+	Execution json.RawMessage
+}
+
+// Validate checks that the bundle was exported from the target graph: the
+// graph names must match and every node of the bundle's graph must exist in
+// the target
+func (b *Bundle) Validate(target GraphInfo) error {
+	if b.Manifest.Graph.Name != target.Name {
+		return fmt.Errorf("%w: graph %q, want %q", ErrGraphMismatch, b.Manifest.Graph.Name, target.Name)
+	}
+
+	known := make(map[string]bool, len(target.Nodes))
+	for _, n := range target.Nodes {
+		known[n] = true
+	}
+	var missing []string
+	for _, n := range b.Manifest.Graph.Nodes {
+		if !known[n] {
+			missing = append(missing, n)
+		}
+	}
+	for _, n := range b.Manifest.InterruptedNodes {
+		if !known[n] {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: unknown nodes %v", ErrGraphMismatch, missing)
+	}
+	return nil
+}
+
+// Export bundles a checkpoint, its overlay if any, and the given execution
+// metadata (may be nil)
+func (s *Store) Export(ctx context.Context, checkpointID string, graph GraphInfo, execution any) (*Bundle, error) {
+	data, ok, err := s.Get(ctx, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, checkpointID)
+	}
+
+	overlay, hasOverlay, err := s.backend.Get(ctx, KindOverlay, checkpointID)
+	if err != nil {
+		return nil, fmt.Errorf("read pending state: %w", err)
+	}
+
+	var exec json.RawMessage
+	if execution != nil {
+		if exec, err = json.Marshal(execution); err != nil {
+			return nil, fmt.Errorf("marshal execution: %w", err)
+		}
+	}
+
+	return &Bundle{
+		Manifest: Manifest{
+			Version:          BundleVersion,
+			CheckpointID:     checkpointID,
+			Graph:            graph,
+			InterruptedNodes: interruptedNodes(data),
+			HasOverlay:       hasOverlay,
+			HasExecution:     exec != nil,
+			ExportedAt:       time.Now(),
+		},
+		Checkpoint: data,
+		Overlay:    overlay,
+		Execution:  exec,
+	}, nil
+}
+
+// Import validates a bundle against the target graph and stores it under
+// checkpointID, or under the bundle's original ID when checkpointID is empty.
+// Existing checkpoints are only replaced when overwrite is set. It returns the
+// ID the checkpoint was stored under.
+func (s *Store) Import(ctx context.Context, b *Bundle, target GraphInfo, checkpointID string, overwrite bool) (string, error) {
+	if err := b.Validate(target); err != nil {
+		return "", err
+	}
+	if checkpointID == "" {
+		checkpointID = b.Manifest.CheckpointID
+	}
+	if err := ValidateID(checkpointID); err != nil {
+		return "", err
+	}
+
+	err := s.withLock(ctx, checkpointID, func() error {
+		if !overwrite {
+			_, exists, err := s.Get(ctx, checkpointID)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("%w: %s", ErrCheckpointExists, checkpointID)
+			}
+		}
+
+		if _, err := s.commit(ctx, checkpointID, b.Checkpoint, "import:"+b.Manifest.CheckpointID, AnyRevision); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+
+		if b.Overlay != nil {
+			if err := s.backend.Put(ctx, KindOverlay, checkpointID, b.Overlay); err != nil {
+				return fmt.Errorf("save pending state: %w", err)
+			}
+		} else if err := s.backend.Delete(ctx, KindOverlay, checkpointID); err != nil {
+			return fmt.Errorf("remove pending state overlay: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return checkpointID, nil
+}
+
+// WriteTo writes the bundle as a gzipped tar archive
+func (b *Bundle) WriteTo(w io.Writer) (int64, error) {
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	cw := &countingWriter{w: w}
+	zw := gzip.NewWriter(cw)
+	tw := tar.NewWriter(zw)
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{bundleManifestFile, manifest},
+		{bundleCheckpointFile, b.Checkpoint},
+		{bundleOverlayFile, b.Overlay},
+		{bundleExecutionFile, b.Execution},
+	}
+	for _, f := range files {
+		if f.data == nil {
+			continue
+		}
+		hdr := &tar.Header{
+			Name:    f.name,
+			Mode:    0644,
+			Size:    int64(len(f.data)),
+			ModTime: b.Manifest.ExportedAt,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return cw.n, fmt.Errorf("write %s: %w", f.name, err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return cw.n, fmt.Errorf("write %s: %w", f.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return cw.n, err
+	}
+	if err := zw.Close(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// Bytes returns the bundle archive
+func (b *Bundle) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadBundle reads a bundle archive written by WriteTo
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	defer zr.Close()
+
+	var (
+		b           Bundle
+		hasManifest bool
+	)
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Size > maxBundleFileSize {
+			return nil, fmt.Errorf("%w: %s is too large", ErrInvalidBundle, hdr.Name)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, maxBundleFileSize))
+		if err != nil {
+			return nil, fmt.Errorf("%w: read %s: %v", ErrInvalidBundle, hdr.Name, err)
+		}
+
+		switch hdr.Name {
+		case bundleManifestFile:
+			if err := json.Unmarshal(data, &b.Manifest); err != nil {
+				return nil, fmt.Errorf("%w: manifest: %v", ErrInvalidBundle, err)
+			}
+			hasManifest = true
+		case bundleCheckpointFile:
+			b.Checkpoint = data
+		case bundleOverlayFile:
+			b.Overlay = data
+		case bundleExecutionFile:
+			b.Execution = data
+		}
+	}
+
+	switch {
+	case !hasManifest:
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBundle, bundleManifestFile)
+	case b.Manifest.Version > BundleVersion:
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, b.Manifest.Version)
+	case b.Checkpoint == nil:
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBundle, bundleCheckpointFile)
+	case b.Manifest.CheckpointID == "":
+		return nil, fmt.Errorf("%w: manifest has no checkpoint ID", ErrInvalidBundle)
+	}
+	return &b, nil
+}
+
+// Export bundles a checkpoint stored under baseDir
+func Export(baseDir, checkpointID string, graph GraphInfo, execution any) (*Bundle, error) {
+	return fileStore(baseDir).Export(context.Background(), checkpointID, graph, execution)
+}
+
+// Import stores a bundle under baseDir using its original checkpoint ID
+func Import(baseDir string, b *Bundle, target GraphInfo) (string, error) {
+	return fileStore(baseDir).Import(context.Background(), b, target, "", false)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
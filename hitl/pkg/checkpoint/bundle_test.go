@@ -0,0 +1,285 @@
+package checkpoint
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testGraph = GraphInfo{Name: "hitl", Nodes: []string{"ChatTemplate", "ChatModel", "ToolsNode"}}
+
+// testOverlay returns a pending state overlay
+func testOverlay(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "state", "v1.overlay.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newTestStore(t)
+	data, overlay := testCheckpoint(t), testOverlay(t)
+	src.Set(ctx, "cp", data)
+	src.Backend().Put(ctx, KindOverlay, "cp", overlay)
+
+	b, err := src.Export(ctx, "cp", testGraph, map[string]string{"status": "interrupted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBundle(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := read.Manifest
+	if m.Version != BundleVersion || m.CheckpointID != "cp" || m.Graph.Name != "hitl" || !m.HasOverlay || !m.HasExecution {
+		t.Fatalf("manifest = %+v", m)
+	}
+	if len(m.InterruptedNodes) != 1 || m.InterruptedNodes[0] != "ToolsNode" {
+		t.Fatalf("interrupted nodes = %v, want ToolsNode", m.InterruptedNodes)
+	}
+	if string(read.Execution) != `{"status":"interrupted"}` {
+		t.Fatalf("execution = %s", read.Execution)
+	}
+
+	dst := newTestStore(t)
+	id, err := dst.Import(ctx, read, testGraph, "copy", false)
+	if err != nil || id != "copy" {
+		t.Fatalf("Import = %q, %v", id, err)
+	}
+	if got, _, _ := dst.Get(ctx, "copy"); !bytes.Equal(got, data) {
+		t.Fatal("imported checkpoint differs from the exported one")
+	}
+	if got, _, _ := dst.Backend().Get(ctx, KindOverlay, "copy"); !bytes.Equal(got, overlay) {
+		t.Fatal("imported overlay differs from the exported one")
+	}
+	if revs, _ := dst.ListRevisions(ctx, "copy"); len(revs) != 1 || revs[0].Source != "import:cp" {
+		t.Fatalf("revisions = %+v, want one imported from cp", revs)
+	}
+
+	// Without an ID the bundle keeps its own
+	if id, err := dst.Import(ctx, read, testGraph, "", false); err != nil || id != "cp" {
+		t.Fatalf("Import without an ID = %q, %v", id, err)
+	}
+}
+
+func TestImportExisting(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	data := testCheckpoint(t)
+	s.Set(ctx, "cp", data)
+	s.Backend().Put(ctx, KindOverlay, "cp", testOverlay(t))
+
+	edited := editedCheckpoint(t, data, "imported")
+	b := &Bundle{
+		Manifest:   Manifest{Version: BundleVersion, CheckpointID: "cp", Graph: testGraph},
+		Checkpoint: edited,
+	}
+	if _, err := s.Import(ctx, b, testGraph, "", false); !errors.Is(err, ErrCheckpointExists) {
+		t.Fatalf("Import over cp = %v, want ErrCheckpointExists", err)
+	}
+	if got, _, _ := s.Get(ctx, "cp"); !bytes.Equal(got, data) {
+		t.Fatal("refused import changed the checkpoint")
+	}
+
+	if _, err := s.Import(ctx, b, testGraph, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := s.Get(ctx, "cp"); !bytes.Equal(got, edited) {
+		t.Fatal("overwrite did not replace the checkpoint")
+	}
+	// The bundle had no overlay, so the old one must not apply to it
+	if s.HasPendingState(ctx, "cp") {
+		t.Fatal("overlay of the replaced checkpoint was kept")
+	}
+	if rev, _ := s.Revision(ctx, "cp"); rev != 2 {
+		t.Fatalf("revision %d after overwrite, want 2", rev)
+	}
+}
+
+func TestExportMissing(t *testing.T) {
+	if _, err := newTestStore(t).Export(context.Background(), "missing", testGraph, nil); !errors.Is(err, ErrCheckpointNotFound) {
+		t.Fatalf("Export = %v, want ErrCheckpointNotFound", err)
+	}
+}
+
+func TestBundleValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		graph       GraphInfo
+		interrupted []string
+		target      GraphInfo
+		ok          bool
+	}{
+		{"same graph", testGraph, []string{"ToolsNode"}, testGraph, true},
+		{"target has more nodes", GraphInfo{Name: "hitl", Nodes: []string{"ChatModel"}}, nil, testGraph, true},
+		{"other graph", GraphInfo{Name: "other", Nodes: testGraph.Nodes}, nil, testGraph, false},
+		{"unknown node", GraphInfo{Name: "hitl", Nodes: []string{"ChatModel", "Reviewer"}}, nil, testGraph, false},
+		{"unknown interrupted node", testGraph, []string{"Reviewer"}, testGraph, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bundle{Manifest: Manifest{Graph: tt.graph, InterruptedNodes: tt.interrupted}}
+			err := b.Validate(tt.target)
+			if tt.ok && err != nil {
+				t.Fatalf("Validate = %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrGraphMismatch) {
+				t.Fatalf("Validate = %v, want ErrGraphMismatch", err)
+			}
+		})
+	}
+
+	// Import validates before writing
+	s := newTestStore(t)
+	b := &Bundle{Manifest: Manifest{CheckpointID: "cp", Graph: GraphInfo{Name: "other"}}, Checkpoint: testCheckpoint(t)}
+	if _, err := s.Import(context.Background(), b, testGraph, "", false); !errors.Is(err, ErrGraphMismatch) {
+		t.Fatalf("Import = %v, want ErrGraphMismatch", err)
+	}
+	if _, ok, _ := s.Get(context.Background(), "cp"); ok {
+		t.Fatal("mismatched bundle was imported")
+	}
+}
+
+// tarGz returns an archive of the given name, content pairs
+func tarGz(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for i := 0; i+1 < len(files); i += 2 {
+		tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1]))})
+		tw.Write([]byte(files[i+1]))
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestReadBundleRejects(t *testing.T) {
+	manifest := func(m Manifest) string {
+		data, _ := json.Marshal(m)
+		return string(data)
+	}
+	valid := Manifest{Version: BundleVersion, CheckpointID: "cp", Graph: testGraph}
+	future := valid
+	future.Version = BundleVersion + 1
+	noID := valid
+	noID.CheckpointID = ""
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"not gzip", []byte("plain text")},
+		{"not tar", func() []byte {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte("not a tar archive, but long enough to need a header block"))
+			zw.Close()
+			return buf.Bytes()
+		}()},
+		{"no manifest", tarGz(t, bundleCheckpointFile, "{}")},
+		{"bad manifest", tarGz(t, bundleManifestFile, "{", bundleCheckpointFile, "{}")},
+		{"no checkpoint", tarGz(t, bundleManifestFile, manifest(valid))},
+		{"future version", tarGz(t, bundleManifestFile, manifest(future), bundleCheckpointFile, "{}")},
+		{"no checkpoint ID", tarGz(t, bundleManifestFile, manifest(noID), bundleCheckpointFile, "{}")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadBundle(bytes.NewReader(tt.archive)); !errors.Is(err, ErrInvalidBundle) {
+				t.Fatalf("ReadBundle = %v, want ErrInvalidBundle", err)
+			}
+		})
+	}
+
+	// Unknown entries are ignored
+	b, err := ReadBundle(bytes.NewReader(tarGz(t, bundleManifestFile, manifest(valid), bundleCheckpointFile, "{}", "notes.txt", "hi")))
+	if err != nil || b.Overlay != nil || b.Execution != nil {
+		t.Fatalf("ReadBundle = %+v, %v", b, err)
+	}
+}
+
+func TestImportTraversalID(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewFileBackend(filepath.Join(root, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStoreWithBackend(backend)
+
+	// A bundle naming a checkpoint outside the store, as read from an archive
+	archive, err := (&Bundle{
+		Manifest:   Manifest{Version: BundleVersion, CheckpointID: "../escaped", Graph: testGraph},
+		Checkpoint: testCheckpoint(t),
+		Overlay:    testOverlay(t),
+	}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBundle(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Import(ctx, b, testGraph, "", false); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("Import = %v, want ErrInvalidID", err)
+	}
+	for _, id := range []string{"../other", "..", "a/b", `a\b`, "/abs"} {
+		if _, err := s.Import(ctx, b, testGraph, id, true); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Import as %q = %v, want ErrInvalidID", id, err)
+		}
+	}
+
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("import wrote %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateID(t *testing.T) {
+	for _, id := range []string{"cp", "exec-1792193192660686805", "cp@3", "overlay.cp.1700000000", "a.b"} {
+		if err := ValidateID(id); err != nil {
+			t.Errorf("ValidateID(%q) = %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "..", "../cp", "cp/..", "a/b", `a\b`, "/cp", "a..b"} {
+		if err := ValidateID(id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ValidateID(%q) = %v, want ErrInvalidID", id, err)
+		}
+	}
+
+	// The file backend checks IDs however it is called
+	backend, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := backend.Put(ctx, KindMeta, "../cp", []byte("{}")); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("Put = %v, want ErrInvalidID", err)
+	}
+	if _, _, err := backend.Get(ctx, KindCheckpoint, "../cp"); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("Get = %v, want ErrInvalidID", err)
+	}
+	if err := backend.Delete(ctx, KindOverlay, "../cp"); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("Delete = %v, want ErrInvalidID", err)
+	}
+}
@@ -0,0 +1,538 @@
+package checkpoint
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec transforms blobs on their way to and from a backend
+type Codec interface {
+	// Name identifies the codec in the envelope header of encoded blobs
+	Name() string
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// BlobCodec is implemented by codecs that bind an encoded blob to its kind
+// and ID, so that it no longer decodes once moved to another blob.
+// CodecBackend uses these methods instead of Encode and Decode.
+type BlobCodec interface {
+	Codec
+	EncodeBlob(kind Kind, id string, data []byte) ([]byte, error)
+	DecodeBlob(kind Kind, id string, data []byte) ([]byte, error)
+}
+
+const (
+	CodecGzip   = "gzip"
+	CodecZstd   = "zstd"
+	CodecAESGCM = "aes-gcm"
+)
+
+// envelopeMagic prefixes every encoded blob. Blobs without it are legacy
+// plaintext and are returned as is.
+var envelopeMagic = []byte("\x00HITL1")
+
+// ErrDecryptionKey is returned when an encrypted blob names an unknown key
+var ErrDecryptionKey = errors.New("unknown encryption key")
+
+// ErrBlobTooLarge is returned when a compressed blob decompresses to more than
+// the codec's limit
+var ErrBlobTooLarge = errors.New("decompressed blob too large")
+
+// DefaultMaxDecodedSize limits the decompressed size of a blob when a codec
+// sets no limit of its own
+const DefaultMaxDecodedSize = 64 << 20
+
+// CodecBackend applies a codec chain to every blob of the wrapped backend.
+// Encoded blobs record their chain, so blobs written with an older chain (or
+// without one) can still be read after the configuration changes.
+type CodecBackend struct {
+	Backend
+	codecs []Codec
+	byName map[string]Codec
+}
+
+// NewCodecBackend wraps backend so blobs are encoded by codecs, in order, on
+// write and decoded in reverse order on read
+func NewCodecBackend(backend Backend, codecs ...Codec) *CodecBackend {
+	// Blobs compressed before the compression changed are decoded with the
+	// limit of the configured one
+	var maxSize int64
+	for _, c := range codecs {
+		switch c := c.(type) {
+		case GzipCodec:
+			maxSize = c.MaxSize
+		case ZstdCodec:
+			maxSize = c.MaxSize
+		}
+	}
+	cb := &CodecBackend{
+		Backend: backend,
+		codecs:  codecs,
+		byName: map[string]Codec{
+			CodecGzip: GzipCodec{MaxSize: maxSize},
+			CodecZstd: ZstdCodec{MaxSize: maxSize},
+		},
+	}
+	for _, c := range codecs {
+		cb.byName[c.Name()] = c
+	}
+	return cb
+}
+
+// Unwrap returns the wrapped backend
+func (b *CodecBackend) Unwrap() Backend {
+	return b.Backend
+}
+
+// Names returns the names of the codecs applied on write, in order
+func (b *CodecBackend) Names() []string {
+	names := make([]string, len(b.codecs))
+	for i, c := range b.codecs {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// Get reads and decodes a blob
+func (b *CodecBackend) Get(ctx context.Context, kind Kind, id string) ([]byte, bool, error) {
+	data, ok, err := b.Backend.Get(ctx, kind, id)
+	if err != nil || !ok {
+		return data, ok, err
+	}
+	decoded, err := b.decode(kind, id, data)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode %s %s: %w", kind, id, err)
+	}
+	return decoded, true, nil
+}
+
+// Put encodes and writes a blob
+func (b *CodecBackend) Put(ctx context.Context, kind Kind, id string, data []byte) error {
+	encoded, err := b.encode(kind, id, data)
+	if err != nil {
+		return fmt.Errorf("encode %s %s: %w", kind, id, err)
+	}
+	return b.Backend.Put(ctx, kind, id, encoded)
+}
+
+// encode applies the chain and prepends the envelope header
+// <magic><len><comma separated codec names>
+func (b *CodecBackend) encode(kind Kind, id string, data []byte) ([]byte, error) {
+	if len(b.codecs) == 0 {
+		return data, nil
+	}
+
+	for _, c := range b.codecs {
+		var err error
+		if bc, ok := c.(BlobCodec); ok {
+			data, err = bc.EncodeBlob(kind, id, data)
+		} else {
+			data, err = c.Encode(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name(), err)
+		}
+	}
+
+	header := strings.Join(b.Names(), ",")
+	if len(header) > 255 {
+		return nil, fmt.Errorf("codec chain too long")
+	}
+
+	out := make([]byte, 0, len(envelopeMagic)+1+len(header)+len(data))
+	out = append(out, envelopeMagic...)
+	out = append(out, byte(len(header)))
+	out = append(out, header...)
+	return append(out, data...), nil
+}
+
+// decode reverses the chain recorded in the envelope header
+func (b *CodecBackend) decode(kind Kind, id string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return data, nil
+	}
+
+	rest := data[len(envelopeMagic):]
+	if len(rest) == 0 || len(rest) < 1+int(rest[0]) {
+		return nil, fmt.Errorf("truncated envelope header")
+	}
+	names := strings.Split(string(rest[1:1+int(rest[0])]), ",")
+	data = rest[1+int(rest[0]):]
+
+	for i := len(names) - 1; i >= 0; i-- {
+		c, ok := b.byName[names[i]]
+		if !ok {
+			return nil, fmt.Errorf("codec %s is not configured", names[i])
+		}
+		var err error
+		if bc, ok := c.(BlobCodec); ok {
+			data, err = bc.DecodeBlob(kind, id, data)
+		} else {
+			data, err = c.Decode(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+	}
+	return data, nil
+}
+
+// GzipCodec compresses blobs with gzip
+type GzipCodec struct {
+	// MaxSize limits the decompressed size of a blob, DefaultMaxDecodedSize
+	// when 0
+	MaxSize int64
+}
+
+func (GzipCodec) Name() string { return CodecGzip }
+
+func (GzipCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c GzipCodec) Decode(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r, maxDecodedSize(c.MaxSize))
+}
+
+// maxDecodedSize is the decompression limit of a codec with MaxSize max
+func maxDecodedSize(max int64) int64 {
+	if max <= 0 {
+		return DefaultMaxDecodedSize
+	}
+	return max
+}
+
+// readLimited reads r to the end, failing with ErrBlobTooLarge after max bytes
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBlobTooLarge, max)
+	}
+	return data, nil
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+)
+
+// ZstdCodec compresses blobs with zstd
+type ZstdCodec struct {
+	// MaxSize limits the decompressed size of a blob, DefaultMaxDecodedSize
+	// when 0
+	MaxSize int64
+}
+
+func (ZstdCodec) Name() string { return CodecZstd }
+
+func (ZstdCodec) Encode(data []byte) ([]byte, error) {
+	initZstd()
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+func (c ZstdCodec) Decode(data []byte) ([]byte, error) {
+	max := maxDecodedSize(c.MaxSize)
+	// The memory limit also bounds the window a frame can ask for
+	r, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(max)))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := readLimited(r, max)
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, fmt.Errorf("%w: %v", ErrBlobTooLarge, err)
+	}
+	return out, err
+}
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		// Only fails on invalid options, none are passed here
+		zstdEncoder, _ = zstd.NewWriter(nil)
+	})
+}
+
+// AESGCMCodec encrypts blobs with AES-GCM. It holds a key ring: blobs are
+// encrypted with the primary key and decrypted with whichever key they name,
+// so keys can be rotated without rewriting existing data first. Through
+// CodecBackend the kind and ID of a blob are authenticated with it; blobs
+// written before that only authenticate the key ID until Reencode rewrites
+// them.
+type AESGCMCodec struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewAESGCMCodec creates a codec that encrypts with keys[primary]. Keys must be
+// 16, 24 or 32 bytes long.
+func NewAESGCMCodec(primary string, keys map[string][]byte) (*AESGCMCodec, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q not in key ring", primary)
+	}
+	if len(primary) > 255 {
+		return nil, fmt.Errorf("key ID too long: %q", primary)
+	}
+
+	c := &AESGCMCodec{primary: primary, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		c.aeads[id] = aead
+	}
+	return c, nil
+}
+
+func (c *AESGCMCodec) Name() string { return CodecAESGCM }
+
+// Encode outputs <len><key id><nonce><ciphertext>, authenticating the key ID
+func (c *AESGCMCodec) Encode(data []byte) ([]byte, error) {
+	return c.seal(data, nil)
+}
+
+func (c *AESGCMCodec) Decode(data []byte) ([]byte, error) {
+	return c.open(data, nil)
+}
+
+// EncodeBlob is Encode, also authenticating kind and id
+func (c *AESGCMCodec) EncodeBlob(kind Kind, id string, data []byte) ([]byte, error) {
+	return c.seal(data, blobAAD(kind, id))
+}
+
+// DecodeBlob decodes a blob encoded by EncodeBlob for kind and id, or by
+// Encode
+func (c *AESGCMCodec) DecodeBlob(kind Kind, id string, data []byte) ([]byte, error) {
+	plain, err := c.open(data, blobAAD(kind, id))
+	if err != nil && !errors.Is(err, ErrDecryptionKey) {
+		if legacy, lerr := c.open(data, nil); lerr == nil {
+			return legacy, nil
+		}
+	}
+	return plain, err
+}
+
+// seal encrypts data with the primary key, authenticating the key ID
+// followed by aad
+func (c *AESGCMCodec) seal(data, aad []byte) ([]byte, error) {
+	aead := c.aeads[c.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, 1+len(c.primary)+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, byte(len(c.primary)))
+	out = append(out, c.primary...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, append([]byte(c.primary), aad...)), nil
+}
+
+func (c *AESGCMCodec) open(data, aad []byte) ([]byte, error) {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, fmt.Errorf("truncated ciphertext")
+	}
+	id := string(data[1 : 1+int(data[0])])
+	data = data[1+int(data[0]):]
+
+	aead, ok := c.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrDecryptionKey, id)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("truncated ciphertext")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], append([]byte(id), aad...))
+}
+
+// blobAAD is the additional data binding a blob to its kind and ID
+func blobAAD(kind Kind, id string) []byte {
+	return []byte("\x00" + string(kind) + "\x00" + id)
+}
+
+// CodecConfig describes a codec chain
+type CodecConfig struct {
+	// Compression is "", "none", "gzip" or "zstd"
+	Compression string `json:"compression,omitempty"`
+	// MaxDecodedSize limits the decompressed size of a blob in bytes,
+	// DefaultMaxDecodedSize when 0
+	MaxDecodedSize int64 `json:"max_decoded_size,omitempty"`
+	// Keys is a key ring in the form "id1:base64key,id2:base64key"; the first
+	// key is used for encryption. Empty disables encryption.
+	Keys string `json:"-"`
+}
+
+// CodecConfigFromEnv reads the codec settings from the HITL_COMPRESSION,
+// HITL_MAX_DECODED_SIZE and HITL_ENCRYPTION_KEYS environment variables
+func CodecConfigFromEnv() CodecConfig {
+	maxSize, _ := strconv.ParseInt(os.Getenv("HITL_MAX_DECODED_SIZE"), 10, 64)
+	return CodecConfig{
+		Compression:    os.Getenv("HITL_COMPRESSION"),
+		MaxDecodedSize: maxSize,
+		Keys:           os.Getenv("HITL_ENCRYPTION_KEYS"),
+	}
+}
+
+// NewCodecs builds the codec chain described by cfg: compression first, then
+// encryption
+func NewCodecs(cfg CodecConfig) ([]Codec, error) {
+	var codecs []Codec
+
+	switch cfg.Compression {
+	case "", "none":
+	case CodecGzip:
+		codecs = append(codecs, GzipCodec{MaxSize: cfg.MaxDecodedSize})
+	case CodecZstd:
+		codecs = append(codecs, ZstdCodec{MaxSize: cfg.MaxDecodedSize})
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", cfg.Compression)
+	}
+
+	if cfg.Keys != "" {
+		primary, keys, err := ParseKeyRing(cfg.Keys)
+		if err != nil {
+			return nil, err
+		}
+		aes, err := NewAESGCMCodec(primary, keys)
+		if err != nil {
+			return nil, err
+		}
+		codecs = append(codecs, aes)
+	}
+
+	return codecs, nil
+}
+
+// ParseKeyRing parses "id1:base64key,id2:base64key", returning the first ID as primary
+func ParseKeyRing(s string) (string, map[string][]byte, error) {
+	var primary string
+	keys := make(map[string][]byte)
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return "", nil, fmt.Errorf("invalid key entry %q, want id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", nil, fmt.Errorf("decode key %q: %w", id, err)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+
+	if primary == "" {
+		return "", nil, fmt.Errorf("empty key ring")
+	}
+	return primary, keys, nil
+}
+
+// Reencode rewrites every blob in the store through its current codec chain,
+// e.g. to finish a key rotation or to encrypt legacy plaintext. Each blob is
+// rewritten under the lock of its checkpoint, so concurrent writes are not
+// overwritten with older data. It returns the number of blobs rewritten.
+func (s *Store) Reencode(ctx context.Context) (int, error) {
+	n := 0
+	for _, kind := range []Kind{KindCheckpoint, KindOverlay, KindRevision, KindHistory, KindMeta, KindExecution} {
+		entries, err := s.backend.List(ctx, kind)
+		if err != nil {
+			return n, fmt.Errorf("list %s: %w", kind, err)
+		}
+		for _, e := range entries {
+			checkpointID := e.ID
+			if kind == KindRevision {
+				checkpointID = revisionCheckpointID(e.ID)
+			}
+			err := s.withLock(ctx, checkpointID, func() error {
+				data, ok, err := s.backend.Get(ctx, kind, e.ID)
+				if err != nil || !ok {
+					return err
+				}
+				if err := s.backend.Put(ctx, kind, e.ID, data); err != nil {
+					return err
+				}
+				n++
+				return nil
+			})
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+var (
+	defaultCodecsMu sync.RWMutex
+	defaultCodecs   []Codec
+)
+
+// SetDefaultCodecs sets the codec chain used by NewStore and the package-level
+// helpers that take a base directory
+func SetDefaultCodecs(codecs ...Codec) {
+	defaultCodecsMu.Lock()
+	defer defaultCodecsMu.Unlock()
+	defaultCodecs = codecs
+}
+
+// withDefaultCodecs wraps backend with the default codec chain, if any
+func withDefaultCodecs(backend Backend) Backend {
+	defaultCodecsMu.RLock()
+	defer defaultCodecsMu.RUnlock()
+	if len(defaultCodecs) == 0 {
+		return backend
+	}
+	return NewCodecBackend(backend, defaultCodecs...)
+}
+
+// unwrapBackend returns the innermost backend below any wrappers
+func unwrapBackend(b Backend) Backend {
+	for {
+		u, ok := b.(interface{ Unwrap() Backend })
+		if !ok {
+			return b
+		}
+		b = u.Unwrap()
+	}
+}
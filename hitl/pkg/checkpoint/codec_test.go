@@ -0,0 +1,274 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testKey returns a 32 byte key filled with b
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func newTestAESGCM(t *testing.T, primary string, keys map[string][]byte) *AESGCMCodec {
+	t.Helper()
+	c, err := NewAESGCMCodec(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCodecBackendRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	aes := newTestAESGCM(t, "k1", map[string][]byte{"k1": testKey(1)})
+	plain := bytes.Repeat([]byte(`{"state":"some checkpoint"}`), 20)
+
+	tests := []struct {
+		name    string
+		codecs  []Codec
+		encrypt bool
+	}{
+		{"none", nil, false},
+		{"gzip", []Codec{GzipCodec{}}, false},
+		{"zstd", []Codec{ZstdCodec{}}, false},
+		{"aes-gcm", []Codec{aes}, true},
+		{"zstd and aes-gcm", []Codec{ZstdCodec{}, aes}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, _ := NewFileBackend(t.TempDir())
+			b := NewCodecBackend(raw, tt.codecs...)
+
+			if err := b.Put(ctx, KindCheckpoint, "cp", plain); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := b.Get(ctx, KindCheckpoint, "cp")
+			if err != nil || !ok || !bytes.Equal(got, plain) {
+				t.Fatalf("Get = %v, %v; want the plaintext", ok, err)
+			}
+
+			stored, _, _ := raw.Get(ctx, KindCheckpoint, "cp")
+			if len(tt.codecs) > 0 && !bytes.HasPrefix(stored, envelopeMagic) {
+				t.Fatal("stored blob has no envelope")
+			}
+			if tt.encrypt && bytes.Contains(stored, []byte("some checkpoint")) {
+				t.Fatal("stored blob holds the plaintext")
+			}
+		})
+	}
+}
+
+func TestCodecBackendReadsLegacyPlaintext(t *testing.T) {
+	ctx := context.Background()
+	raw, _ := NewFileBackend(t.TempDir())
+	raw.Put(ctx, KindOverlay, "cp", []byte(`{"legacy":true}`))
+
+	b := NewCodecBackend(raw, GzipCodec{}, newTestAESGCM(t, "k1", map[string][]byte{"k1": testKey(1)}))
+	if got, _, err := b.Get(ctx, KindOverlay, "cp"); err != nil || string(got) != `{"legacy":true}` {
+		t.Fatalf("Get = %q, %v; want the legacy plaintext", got, err)
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	ctx := context.Background()
+	plain := bytes.Repeat([]byte("a"), 1<<20)
+
+	for _, tt := range []struct {
+		name  string
+		codec func(max int64) Codec
+	}{
+		{CodecGzip, func(max int64) Codec { return GzipCodec{MaxSize: max} }},
+		{CodecZstd, func(max int64) Codec { return ZstdCodec{MaxSize: max} }},
+	} {
+		encoded, err := tt.codec(0).Encode(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := tt.codec(int64(len(plain)) - 1).Decode(encoded); !errors.Is(err, ErrBlobTooLarge) {
+			t.Errorf("%s: Decode over the limit = %d bytes, %v, want ErrBlobTooLarge", tt.name, len(got), err)
+		}
+		if got, err := tt.codec(int64(len(plain))).Decode(encoded); err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("%s: Decode at the limit = %d bytes, %v", tt.name, len(got), err)
+		}
+	}
+
+	// Blobs compressed by another codec than the configured one get its limit
+	raw, _ := NewFileBackend(t.TempDir())
+	if err := NewCodecBackend(raw, GzipCodec{}).Put(ctx, KindCheckpoint, "cp", plain); err != nil {
+		t.Fatal(err)
+	}
+	codecs, err := NewCodecs(CodecConfig{Compression: CodecZstd, MaxDecodedSize: 1 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewCodecBackend(raw, codecs...).Get(ctx, KindCheckpoint, "cp"); !errors.Is(err, ErrBlobTooLarge) {
+		t.Fatalf("Get = %v, want ErrBlobTooLarge", err)
+	}
+}
+
+func TestAESGCMWrongKey(t *testing.T) {
+	ctx := context.Background()
+	raw, _ := NewFileBackend(t.TempDir())
+	NewCodecBackend(raw, newTestAESGCM(t, "k1", map[string][]byte{"k1": testKey(1)})).
+		Put(ctx, KindCheckpoint, "cp", []byte("secret"))
+
+	// A ring without the key
+	other := NewCodecBackend(raw, newTestAESGCM(t, "k2", map[string][]byte{"k2": testKey(2)}))
+	if _, _, err := other.Get(ctx, KindCheckpoint, "cp"); !errors.Is(err, ErrDecryptionKey) {
+		t.Fatalf("Get with another ring = %v, want ErrDecryptionKey", err)
+	}
+
+	// A different key under the same ID
+	wrong := NewCodecBackend(raw, newTestAESGCM(t, "k1", map[string][]byte{"k1": testKey(9)}))
+	if _, _, err := wrong.Get(ctx, KindCheckpoint, "cp"); err == nil {
+		t.Fatal("Get with the wrong key succeeded")
+	}
+
+	// Encrypted blobs need the codec configured
+	if _, _, err := NewCodecBackend(raw).Get(ctx, KindCheckpoint, "cp"); err == nil {
+		t.Fatal("Get without the aes-gcm codec succeeded")
+	}
+}
+
+func TestAESGCMBindsBlobs(t *testing.T) {
+	ctx := context.Background()
+	raw, _ := NewFileBackend(t.TempDir())
+	aes := newTestAESGCM(t, "k1", map[string][]byte{"k1": testKey(1)})
+	b := NewCodecBackend(raw, aes)
+	b.Put(ctx, KindCheckpoint, "cp", []byte("secret"))
+	stored, _, _ := raw.Get(ctx, KindCheckpoint, "cp")
+
+	// Moved to another checkpoint or another kind, the blob no longer decodes
+	for _, to := range []struct {
+		kind Kind
+		id   string
+	}{{KindCheckpoint, "other"}, {KindOverlay, "cp"}, {KindRevision, "cp@1"}} {
+		raw.Put(ctx, to.kind, to.id, stored)
+		if _, _, err := b.Get(ctx, to.kind, to.id); err == nil {
+			t.Errorf("blob of checkpoint cp decoded as %s %s", to.kind, to.id)
+		}
+	}
+
+	// Blobs encrypted before they were bound still decode
+	legacy, err := aes.Encode([]byte("old secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := append(append(append([]byte{}, envelopeMagic...), byte(len(CodecAESGCM))), CodecAESGCM...)
+	raw.Put(ctx, KindCheckpoint, "old", append(header, legacy...))
+	if got, _, err := b.Get(ctx, KindCheckpoint, "old"); err != nil || string(got) != "old secret" {
+		t.Fatalf("Get of a legacy blob = %q, %v", got, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	raw, _ := NewFileBackend(t.TempDir())
+	k1 := base64.StdEncoding.EncodeToString(testKey(1))
+	k2 := base64.StdEncoding.EncodeToString(testKey(2))
+
+	open := func(keys string) *Store {
+		codecs, err := NewCodecs(CodecConfig{Compression: CodecGzip, Keys: keys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewStoreWithBackend(NewCodecBackend(raw, codecs...))
+	}
+
+	data := testCheckpoint(t)
+	old := open("k1:" + k1)
+	if err := old.Set(ctx, "cp", data); err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 is the new primary; k1 still reads what it wrote
+	rotated := open("k2:" + k2 + ",k1:" + k1)
+	if got, _, err := rotated.Backend().Get(ctx, KindCheckpoint, "cp"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Get after rotation = %v", err)
+	}
+	n, err := rotated.Reencode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// checkpoint, revision, history and metadata
+	if n != 4 {
+		t.Fatalf("Reencode rewrote %d blobs, want 4", n)
+	}
+
+	// Once re-encoded, k1 can be dropped
+	only := open("k2:" + k2)
+	for _, kind := range []Kind{KindCheckpoint, KindRevision, KindHistory, KindMeta} {
+		list, _ := only.Backend().List(ctx, kind)
+		for _, e := range list {
+			if _, _, err := only.Backend().Get(ctx, kind, e.ID); err != nil {
+				t.Errorf("%s %s: %v", kind, e.ID, err)
+			}
+		}
+	}
+}
+
+func TestReencodeKeepsConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	raw, _ := NewFileBackend(t.TempDir())
+	s := NewStoreWithBackend(NewCodecBackend(raw, newTestAESGCM(t, "k1", map[string][]byte{"k1": testKey(1)})))
+	data := testCheckpoint(t)
+	s.Set(ctx, "cp", data)
+
+	var (
+		wg   sync.WaitGroup
+		last []byte
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			last = editedCheckpoint(t, data, fmt.Sprint(i))
+			if err := s.Set(ctx, "cp", last); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := s.Reencode(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	got, _, _ := s.Backend().Get(ctx, KindCheckpoint, "cp")
+	if !bytes.Equal(got, last) {
+		t.Fatal("checkpoint is not the last write")
+	}
+	revs, _ := s.ListRevisions(ctx, "cp")
+	if len(revs) != 21 {
+		t.Fatalf("%d revisions, want 21", len(revs))
+	}
+}
+
+func TestParseKeyRing(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(testKey(1))
+	primary, keys, err := ParseKeyRing(" a:" + key + ", b:" + key)
+	if err != nil || primary != "a" || len(keys) != 2 {
+		t.Fatalf("ParseKeyRing = %q, %d keys, %v", primary, len(keys), err)
+	}
+
+	for _, ring := range []string{"", "a", ":" + key, "a:not base64!"} {
+		if _, _, err := ParseKeyRing(ring); err == nil {
+			t.Errorf("ParseKeyRing(%q) succeeded", ring)
+		}
+	}
+	if _, err := NewCodecs(CodecConfig{Keys: "a:" + base64.StdEncoding.EncodeToString([]byte("short"))}); err == nil || !strings.Contains(err.Error(), "key") {
+		t.Errorf("NewCodecs with a short key = %v", err)
+	}
+	if _, err := NewCodecs(CodecConfig{Compression: "lz4"}); err == nil {
+		t.Error("NewCodecs with an unknown compression succeeded")
+	}
+}
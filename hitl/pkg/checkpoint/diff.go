@@ -0,0 +1,359 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// ChangeType says how an element differs between two states
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeRemoved  ChangeType = "removed"
+	ChangeModified ChangeType = "modified"
+)
+
+// State references accepted by ResolveState besides checkpoint IDs and revisions
+const (
+	RefCurrent = "current"
+	RefPending = "pending"
+)
+
+// FieldChange is a changed scalar field
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// ValueDiff is a changed map entry
+type ValueDiff struct {
+	Key    string     `json:"key"`
+	Change ChangeType `json:"change"`
+	Old    any        `json:"old,omitempty"`
+	New    any        `json:"new,omitempty"`
+}
+
+// MessageDiff is a changed entry of the message history, compared by index
+type MessageDiff struct {
+	Index   int           `json:"index"`
+	Role    string        `json:"role"`
+	Change  ChangeType    `json:"change"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// ToolCallDiff is a changed tool call, matched by ID across the history
+type ToolCallDiff struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	MessageIndex int           `json:"message_index"`
+	Change       ChangeType    `json:"change"`
+	Changes      []FieldChange `json:"changes,omitempty"`
+	// Arguments lists changed keys when both argument strings are JSON objects
+	Arguments []ValueDiff `json:"arguments,omitempty"`
+}
+
+// StateDiff lists the differences between two UniversalStates
+type StateDiff struct {
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Equal     bool           `json:"equal"`
+	Messages  []MessageDiff  `json:"messages"`
+	ToolCalls []ToolCallDiff `json:"tool_calls"`
+	Context   []ValueDiff    `json:"context"`
+	NodeLog   []ValueDiff    `json:"node_log"`
+}
+
+// DiffStates compares two states message by message, tool call by tool call
+// and context key by key. Values are compared by their JSON form, so a state
+// loaded from a checkpoint and one loaded from an overlay compare equal.
+func DiffStates(from, to *types.UniversalState) *StateDiff {
+	if from == nil {
+		from = &types.UniversalState{}
+	}
+	if to == nil {
+		to = &types.UniversalState{}
+	}
+
+	d := &StateDiff{
+		Messages:  diffMessages(from.MessageHistory, to.MessageHistory),
+		ToolCalls: diffToolCalls(from.MessageHistory, to.MessageHistory),
+		Context:   diffMaps(from.Context, to.Context),
+		NodeLog:   diffEvents(from.NodeExecutionLog, to.NodeExecutionLog),
+	}
+	d.Equal = len(d.Messages) == 0 && len(d.ToolCalls) == 0 && len(d.Context) == 0 && len(d.NodeLog) == 0
+	return d
+}
+
+func diffMessages(from, to []*schema.Message) []MessageDiff {
+	diffs := []MessageDiff{}
+	for i := 0; i < len(from) || i < len(to); i++ {
+		switch {
+		case i >= len(to):
+			diffs = append(diffs, MessageDiff{Index: i, Role: roleOf(from[i]), Change: ChangeRemoved})
+		case i >= len(from):
+			diffs = append(diffs, MessageDiff{Index: i, Role: roleOf(to[i]), Change: ChangeAdded})
+		default:
+			if changes := diffMessage(from[i], to[i]); len(changes) > 0 {
+				diffs = append(diffs, MessageDiff{Index: i, Role: roleOf(to[i]), Change: ChangeModified, Changes: changes})
+			}
+		}
+	}
+	return diffs
+}
+
+// diffMessage compares the fields of two messages; tool calls are diffed separately
+func diffMessage(a, b *schema.Message) []FieldChange {
+	if a == nil {
+		a = &schema.Message{}
+	}
+	if b == nil {
+		b = &schema.Message{}
+	}
+
+	var changes []FieldChange
+	add := func(field string, before, after any) {
+		if !jsonEqual(before, after) {
+			changes = append(changes, FieldChange{Field: field, Old: before, New: after})
+		}
+	}
+	add("role", string(a.Role), string(b.Role))
+	add("content", a.Content, b.Content)
+	add("name", a.Name, b.Name)
+	add("tool_call_id", a.ToolCallID, b.ToolCallID)
+	add("tool_call_count", len(a.ToolCalls), len(b.ToolCalls))
+	return changes
+}
+
+type locatedToolCall struct {
+	schema.ToolCall
+	messageIndex int
+}
+
+func diffToolCalls(from, to []*schema.Message) []ToolCallDiff {
+	before, beforeKeys := indexToolCalls(from)
+	after, afterKeys := indexToolCalls(to)
+
+	diffs := []ToolCallDiff{}
+	for _, key := range beforeKeys {
+		a := before[key]
+		b, ok := after[key]
+		if !ok {
+			diffs = append(diffs, ToolCallDiff{ID: a.ID, Name: a.Function.Name, MessageIndex: a.messageIndex, Change: ChangeRemoved})
+			continue
+		}
+
+		var changes []FieldChange
+		if a.Function.Name != b.Function.Name {
+			changes = append(changes, FieldChange{Field: "name", Old: a.Function.Name, New: b.Function.Name})
+		}
+		if a.Function.Arguments != b.Function.Arguments {
+			changes = append(changes, FieldChange{Field: "arguments", Old: a.Function.Arguments, New: b.Function.Arguments})
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		diffs = append(diffs, ToolCallDiff{
+			ID:           b.ID,
+			Name:         b.Function.Name,
+			MessageIndex: b.messageIndex,
+			Change:       ChangeModified,
+			Changes:      changes,
+			Arguments:    diffArguments(a.Function.Arguments, b.Function.Arguments),
+		})
+	}
+	for _, key := range afterKeys {
+		if _, ok := before[key]; !ok {
+			b := after[key]
+			diffs = append(diffs, ToolCallDiff{ID: b.ID, Name: b.Function.Name, MessageIndex: b.messageIndex, Change: ChangeAdded})
+		}
+	}
+	return diffs
+}
+
+// indexToolCalls maps tool calls by ID, or by position when they have none,
+// returning the keys in history order
+func indexToolCalls(msgs []*schema.Message) (map[string]locatedToolCall, []string) {
+	calls := make(map[string]locatedToolCall)
+	var keys []string
+	for i, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		for j, tc := range msg.ToolCalls {
+			key := tc.ID
+			if key == "" {
+				key = fmt.Sprintf("#%d.%d", i, j)
+			}
+			if _, dup := calls[key]; !dup {
+				keys = append(keys, key)
+			}
+			calls[key] = locatedToolCall{ToolCall: tc, messageIndex: i}
+		}
+	}
+	return calls, keys
+}
+
+// diffArguments diffs two JSON object argument strings key by key
+func diffArguments(a, b string) []ValueDiff {
+	var before, after map[string]any
+	if json.Unmarshal([]byte(a), &before) != nil || json.Unmarshal([]byte(b), &after) != nil {
+		return nil
+	}
+	return diffMaps(before, after)
+}
+
+// diffMaps compares two maps key by key, in key order
+func diffMaps(a, b map[string]any) []ValueDiff {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := []ValueDiff{}
+	for _, k := range keys {
+		before, inA := a[k]
+		after, inB := b[k]
+		switch {
+		case !inB:
+			diffs = append(diffs, ValueDiff{Key: k, Change: ChangeRemoved, Old: before})
+		case !inA:
+			diffs = append(diffs, ValueDiff{Key: k, Change: ChangeAdded, New: after})
+		case !jsonEqual(before, after):
+			diffs = append(diffs, ValueDiff{Key: k, Change: ChangeModified, Old: before, New: after})
+		}
+	}
+	return diffs
+}
+
+// diffEvents compares two execution logs event by event, matched by sequence
+// number. Keys are "<seq>:<node>".
+func diffEvents(a, b []types.ExecutionEvent) []ValueDiff {
+	diffs := []ValueDiff{}
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i >= len(b):
+			diffs = append(diffs, ValueDiff{Key: eventKey(a[i]), Change: ChangeRemoved, Old: a[i]})
+		case i >= len(a):
+			diffs = append(diffs, ValueDiff{Key: eventKey(b[i]), Change: ChangeAdded, New: b[i]})
+		case !jsonEqual(a[i], b[i]):
+			diffs = append(diffs, ValueDiff{Key: eventKey(b[i]), Change: ChangeModified, Old: a[i], New: b[i]})
+		}
+	}
+	return diffs
+}
+
+func eventKey(ev types.ExecutionEvent) string {
+	return strconv.Itoa(ev.Seq) + ":" + ev.Node
+}
+
+// jsonEqual compares two values by their JSON form
+func jsonEqual(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	var va, vb any
+	if json.Unmarshal(ja, &va) != nil || json.Unmarshal(jb, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func roleOf(msg *schema.Message) string {
+	if msg == nil {
+		return ""
+	}
+	return string(msg.Role)
+}
+
+// ResolveState loads the state a reference points at, relative to checkpointID:
+//
+//	"" or "current"  the current checkpoint
+//	"pending"        the pending overlay saved on confirmation
+//	"<n>"            revision n
+//	"<id>@<n>"       revision n of another checkpoint
+//	"<id>"           the current state of another checkpoint
+func (s *Store) ResolveState(ctx context.Context, checkpointID, ref string) (*types.UniversalState, error) {
+	switch ref {
+	case "", RefCurrent:
+		cp, err := s.LoadCheckpoint(ctx, checkpointID)
+		if err != nil {
+			return nil, err
+		}
+		return cp.State, nil
+	case RefPending:
+		return s.LoadPendingState(ctx, checkpointID)
+	}
+
+	if rev, err := strconv.Atoi(ref); err == nil {
+		return s.revisionState(ctx, checkpointID, rev)
+	}
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		if rev, err := strconv.Atoi(ref[i+1:]); err == nil {
+			return s.revisionState(ctx, ref[:i], rev)
+		}
+	}
+	return s.ResolveState(ctx, ref, RefCurrent)
+}
+
+func (s *Store) revisionState(ctx context.Context, checkpointID string, rev int) (*types.UniversalState, error) {
+	data, err := s.GetRevision(ctx, checkpointID, rev)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := DecodeCheckpoint(data)
+	if err != nil {
+		return nil, err
+	}
+	return cp.State, nil
+}
+
+// Diff compares the current state of a checkpoint against another state (see
+// ResolveState). An empty against compares with the previous revision.
+func (s *Store) Diff(ctx context.Context, checkpointID, against string) (*StateDiff, error) {
+	if against == "" {
+		head, err := s.Revision(ctx, checkpointID)
+		if err != nil {
+			return nil, err
+		}
+		if head < 2 {
+			return nil, fmt.Errorf("%w: %s has no previous revision", ErrRevisionNotFound, checkpointID)
+		}
+		against = strconv.Itoa(head - 1)
+	}
+
+	from, err := s.ResolveState(ctx, checkpointID, against)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", against, err)
+	}
+	to, err := s.ResolveState(ctx, checkpointID, RefCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	d := DiffStates(from, to)
+	d.From = against
+	d.To = checkpointID
+	return d, nil
+}
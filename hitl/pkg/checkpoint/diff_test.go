@@ -0,0 +1,175 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// testState is a conversation with one BookTicket call
+func testState() *types.UniversalState {
+	return &types.UniversalState{
+		MessageHistory: []*schema.Message{
+			schema.SystemMessage("You are a travel assistant."),
+			schema.UserMessage("Book me a ticket to Tokyo."),
+			schema.AssistantMessage("", []schema.ToolCall{{
+				ID:       "call_1",
+				Function: schema.FunctionCall{Name: "BookTicket", Arguments: `{"location":"Tokyo","seats":1}`},
+			}}),
+		},
+		Context:          map[string]any{"user": "Megumin", "retries": 1},
+		NodeExecutionLog: []types.ExecutionEvent{{Seq: 1, Node: "ChatModel", Phase: "end"}},
+	}
+}
+
+func TestDiffStates(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *types.UniversalState)
+		check  func(t *testing.T, d *StateDiff)
+	}{
+		{"equal", func(s *types.UniversalState) {
+			// Numbers compare by their JSON form
+			s.Context["retries"] = float64(1)
+		}, func(t *testing.T, d *StateDiff) {
+			if !d.Equal {
+				t.Fatalf("diff = %+v, want equal", d)
+			}
+		}},
+		{"message modified", func(s *types.UniversalState) {
+			s.MessageHistory[1] = schema.UserMessage("Book me a ticket to Rome.")
+		}, func(t *testing.T, d *StateDiff) {
+			if len(d.Messages) != 1 || d.Messages[0].Index != 1 || d.Messages[0].Change != ChangeModified {
+				t.Fatalf("messages = %+v, want message 1 modified", d.Messages)
+			}
+			c := d.Messages[0].Changes
+			if len(c) != 1 || c[0].Field != "content" || c[0].New != "Book me a ticket to Rome." {
+				t.Fatalf("changes = %+v, want the content", c)
+			}
+		}},
+		{"message added", func(s *types.UniversalState) {
+			s.MessageHistory = append(s.MessageHistory, schema.ToolMessage("booked", "call_1"))
+		}, func(t *testing.T, d *StateDiff) {
+			if len(d.Messages) != 1 || d.Messages[0].Index != 3 || d.Messages[0].Change != ChangeAdded || d.Messages[0].Role != "tool" {
+				t.Fatalf("messages = %+v, want a tool message added", d.Messages)
+			}
+		}},
+		{"tool call arguments", func(s *types.UniversalState) {
+			s.MessageHistory[2] = schema.AssistantMessage("", []schema.ToolCall{{
+				ID:       "call_1",
+				Function: schema.FunctionCall{Name: "BookTicket", Arguments: `{"location":"Rome","class":"first","seats":1.0}`},
+			}})
+		}, func(t *testing.T, d *StateDiff) {
+			// The message itself only differs in its tool call
+			if len(d.Messages) != 0 {
+				t.Fatalf("messages = %+v, want none", d.Messages)
+			}
+			if len(d.ToolCalls) != 1 || d.ToolCalls[0].ID != "call_1" || d.ToolCalls[0].MessageIndex != 2 || d.ToolCalls[0].Change != ChangeModified {
+				t.Fatalf("tool calls = %+v, want call_1 modified", d.ToolCalls)
+			}
+			args := d.ToolCalls[0].Arguments
+			if len(args) != 2 || args[0].Key != "class" || args[0].Change != ChangeAdded ||
+				args[1].Key != "location" || args[1].Old != "Tokyo" || args[1].New != "Rome" {
+				t.Fatalf("arguments = %+v, want class added and location modified", args)
+			}
+		}},
+		{"tool call replaced", func(s *types.UniversalState) {
+			s.MessageHistory[2].ToolCalls = []schema.ToolCall{{
+				ID:       "call_2",
+				Function: schema.FunctionCall{Name: "BookTicket", Arguments: "not json"},
+			}}
+		}, func(t *testing.T, d *StateDiff) {
+			if len(d.ToolCalls) != 2 || d.ToolCalls[0].ID != "call_1" || d.ToolCalls[0].Change != ChangeRemoved ||
+				d.ToolCalls[1].ID != "call_2" || d.ToolCalls[1].Change != ChangeAdded {
+				t.Fatalf("tool calls = %+v, want call_1 removed and call_2 added", d.ToolCalls)
+			}
+		}},
+		{"context and log", func(s *types.UniversalState) {
+			delete(s.Context, "user")
+			s.Context["retries"] = 2
+			s.Context["approved"] = true
+			s.NodeExecutionLog = append(s.NodeExecutionLog, types.ExecutionEvent{Seq: 2, Node: "ToolsNode", Phase: "start"})
+		}, func(t *testing.T, d *StateDiff) {
+			c := d.Context
+			if len(c) != 3 || c[0].Key != "approved" || c[0].Change != ChangeAdded ||
+				c[1].Key != "retries" || c[1].Change != ChangeModified || c[2].Key != "user" || c[2].Change != ChangeRemoved {
+				t.Fatalf("context = %+v", c)
+			}
+			if len(d.NodeLog) != 1 || d.NodeLog[0].Key != "2:ToolsNode" || d.NodeLog[0].Change != ChangeAdded {
+				t.Fatalf("node log = %+v, want 2:ToolsNode added", d.NodeLog)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to := testState()
+			tt.change(to)
+			d := DiffStates(testState(), to)
+			if tt.name != "equal" && d.Equal {
+				t.Fatal("diff is equal")
+			}
+			tt.check(t, d)
+		})
+	}
+
+	// A missing state diffs like an empty one
+	d := DiffStates(nil, testState())
+	if d.Equal || len(d.Messages) != 3 || len(d.ToolCalls) != 1 || len(d.Context) != 2 {
+		t.Fatalf("diff from nil = %+v", d)
+	}
+}
+
+func TestStoreDiff(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	first := testCheckpoint(t)
+
+	s.Set(ctx, "cp", first)
+	if _, err := s.Diff(ctx, "cp", ""); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("Diff of a first revision = %v, want ErrRevisionNotFound", err)
+	}
+
+	s.Set(ctx, "cp", editedCheckpoint(t, first, "second"))
+	s.Set(ctx, "other", first)
+
+	for _, against := range []string{"", "1", "cp@1", "other"} {
+		d, err := s.Diff(ctx, "cp", against)
+		if err != nil {
+			t.Fatalf("Diff against %q: %v", against, err)
+		}
+		if len(d.Context) != 1 || d.Context[0].Key != "edit" || d.Context[0].Change != ChangeAdded || d.To != "cp" {
+			t.Fatalf("Diff against %q = %+v, want the edit added", against, d)
+		}
+	}
+	if d, err := s.Diff(ctx, "cp", "2"); err != nil || !d.Equal {
+		t.Fatalf("Diff against the current revision = %+v, %v", d, err)
+	}
+
+	// The pending overlay, as saved on confirmation
+	cp, _ := s.LoadCheckpoint(ctx, "cp")
+	pending := *cp.State
+	pending.Context = map[string]any{"approved": true}
+	for k, v := range cp.State.Context {
+		pending.Context[k] = v
+	}
+	if err := s.SavePendingState(ctx, "cp", &pending); err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.Diff(ctx, "cp", RefPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Context) != 1 || d.Context[0].Key != "approved" || d.Context[0].Change != ChangeRemoved {
+		t.Fatalf("Diff against pending = %+v, want approved removed", d.Context)
+	}
+
+	for _, against := range []string{"9", "cp@9", "missing"} {
+		if _, err := s.Diff(ctx, "cp", against); err == nil {
+			t.Errorf("Diff against %q succeeded", against)
+		}
+	}
+}
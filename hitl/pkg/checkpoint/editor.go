@@ -0,0 +1,241 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// Checkpoint is a decoded compose checkpoint. State is the typed
+// UniversalState it carries, embedded in the custom state of a typed graph
+// (see TypedState); everything else is kept in its serialized form and
+// written back untouched by Encode.
+type Checkpoint struct {
+	State *types.UniversalState
+
+	value    types.State
+	root     *serialValue
+	revision int
+}
+
+// DecodeCheckpoint decodes checkpoint data written by compose's default serializer
+func DecodeCheckpoint(data []byte) (*Checkpoint, error) {
+	var root serialValue
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("unmarshal checkpoint json: %w", err)
+	}
+	if _, err := migrateRoot(&root); err != nil {
+		return nil, err
+	}
+
+	sv, ok := root.MapValues["State"]
+	if !ok || sv == nil || sv.Type == nil {
+		return nil, fmt.Errorf("%w: checkpoint has no state", ErrUnsupportedFormat)
+	}
+
+	value, err := decodeValue(sv)
+	if err != nil {
+		return nil, fmt.Errorf("decode checkpoint state: %w", err)
+	}
+	state, ok := value.(types.State)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected state type %T", ErrUnsupportedFormat, value)
+	}
+
+	return &Checkpoint{State: state.Universal(), value: state, root: &root}, nil
+}
+
+// TypedState returns the state of a checkpoint saved by a graph running with
+// the custom state type S. Changes to it are saved by EditCheckpoint.
+func TypedState[S types.State](cp *Checkpoint) (S, error) {
+	st, ok := cp.value.(S)
+	if !ok {
+		var zero S
+		return zero, fmt.Errorf("%w: state is %T, not %T", ErrUnsupportedFormat, cp.value, zero)
+	}
+	return st, nil
+}
+
+// Revision returns the revision the checkpoint was loaded at, 0 when it was
+// decoded from raw data or has no revision history
+func (c *Checkpoint) Revision() int {
+	return c.revision
+}
+
+// Encode re-encodes the checkpoint with its (possibly edited) state
+func (c *Checkpoint) Encode() ([]byte, error) {
+	c.State.SchemaVersion = types.CurrentSchemaVersion
+	sv, err := encodeValue(c.value)
+	if err != nil {
+		return nil, fmt.Errorf("encode checkpoint state: %w", err)
+	}
+	c.root.MapValues["State"] = sv
+
+	b, err := json.Marshal(c.root)
+	if err != nil {
+		return nil, fmt.Errorf("marshal checkpoint json: %w", err)
+	}
+	return b, nil
+}
+
+// Message returns the message at index i of the message history
+func (c *Checkpoint) Message(i int) (*schema.Message, error) {
+	if i < 0 || i >= len(c.State.MessageHistory) {
+		return nil, fmt.Errorf("message index out of range: %d", i)
+	}
+	return c.State.MessageHistory[i], nil
+}
+
+// SetMessage replaces the message at index i of the message history
+func (c *Checkpoint) SetMessage(i int, msg *schema.Message) error {
+	if _, err := c.Message(i); err != nil {
+		return err
+	}
+	c.State.MessageHistory[i] = msg
+	return nil
+}
+
+// SetMessageContent replaces the content of the message at index i
+func (c *Checkpoint) SetMessageContent(i int, content string) error {
+	msg, err := c.Message(i)
+	if err != nil {
+		return err
+	}
+	msg.Content = content
+	return nil
+}
+
+// ToolCall returns the tool call with the given ID
+func (c *Checkpoint) ToolCall(id string) (*schema.ToolCall, error) {
+	if tc := c.State.FindToolCall(id); tc != nil {
+		return tc, nil
+	}
+	return nil, fmt.Errorf("tool call not found: %s", id)
+}
+
+// LastToolCall returns the most recent tool call in the message history
+func (c *Checkpoint) LastToolCall() (*schema.ToolCall, error) {
+	if tc := c.State.LastToolCall(); tc != nil {
+		return tc, nil
+	}
+	return nil, fmt.Errorf("no tool call found")
+}
+
+// SetToolCallArguments replaces the arguments of the tool call with the given ID
+func (c *Checkpoint) SetToolCallArguments(id, args string) error {
+	tc, err := c.ToolCall(id)
+	if err != nil {
+		return err
+	}
+	tc.Function.Arguments = args
+	return nil
+}
+
+// ApplyToolDecisions approves, edits or rejects pending tool calls by ID
+func (c *Checkpoint) ApplyToolDecisions(decisions []types.ToolDecision) error {
+	return c.State.ApplyToolDecisions(decisions)
+}
+
+// SetContext sets a context entry; the value must be a serializable type
+func (c *Checkpoint) SetContext(key string, value any) {
+	if c.State.Context == nil {
+		c.State.Context = make(map[string]any)
+	}
+	c.State.Context[key] = value
+}
+
+// DeleteContext removes a context entry
+func (c *Checkpoint) DeleteContext(key string) {
+	delete(c.State.Context, key)
+}
+
+// AppendEvent appends an execution event, numbered after the last one
+func (c *Checkpoint) AppendEvent(ev types.ExecutionEvent) {
+	c.State.AppendEvent(ev)
+}
+
+// DeleteEvent removes the execution event with sequence number seq
+func (c *Checkpoint) DeleteEvent(seq int) error {
+	for i, ev := range c.State.NodeExecutionLog {
+		if ev.Seq == seq {
+			c.State.NodeExecutionLog = append(c.State.NodeExecutionLog[:i], c.State.NodeExecutionLog[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("execution event %d not found", seq)
+}
+
+// LoadCheckpoint loads and decodes the current checkpoint
+func (s *Store) LoadCheckpoint(ctx context.Context, checkpointID string) (*Checkpoint, error) {
+	var (
+		data []byte
+		rev  int
+	)
+	// Read the blob and its revision number under the lock so they match
+	err := s.withLock(ctx, checkpointID, func() error {
+		var (
+			ok  bool
+			err error
+		)
+		if rev, err = s.Revision(ctx, checkpointID); err != nil {
+			return err
+		}
+		if data, ok, err = s.Get(ctx, checkpointID); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrCheckpointNotFound, checkpointID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := DecodeCheckpoint(data)
+	if err != nil {
+		return nil, err
+	}
+	cp.revision = rev
+	return cp, nil
+}
+
+// EditCheckpoint decodes a checkpoint, applies edit to it and saves the
+// result as a new revision. It fails with ErrConflict if the checkpoint is
+// written by someone else in the meantime.
+func (s *Store) EditCheckpoint(ctx context.Context, checkpointID string, edit func(cp *Checkpoint) error) error {
+	return s.EditCheckpointAt(ctx, checkpointID, AnyRevision, edit)
+}
+
+// EditCheckpointAt is EditCheckpoint for a caller that last saw the checkpoint
+// at the expected revision; it fails with ErrConflict if the checkpoint has
+// moved on since. AnyRevision accepts whatever revision is loaded.
+func (s *Store) EditCheckpointAt(ctx context.Context, checkpointID string, expected int, edit func(cp *Checkpoint) error) error {
+	cp, err := s.LoadCheckpoint(ctx, checkpointID)
+	if err != nil {
+		return err
+	}
+	if expected != AnyRevision && cp.revision != expected {
+		return fmt.Errorf("%w: %s is at revision %d, expected %d", ErrConflict, checkpointID, cp.revision, expected)
+	}
+
+	if err := edit(cp); err != nil {
+		return err
+	}
+
+	data, err := cp.Encode()
+	if err != nil {
+		return err
+	}
+
+	return s.withLock(ctx, checkpointID, func() error {
+		if _, err := s.commit(ctx, checkpointID, data, "edit", cp.revision); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+)
+
+// KindExecution holds the record of the execution running a checkpoint,
+// opaque JSON kept by its runner so executions survive restarts
+const KindExecution Kind = "execution"
+
+// SaveExecution creates or replaces the execution record of a checkpoint
+func (s *Store) SaveExecution(ctx context.Context, checkpointID string, record []byte) error {
+	return s.withLock(ctx, checkpointID, func() error {
+		if err := s.backend.Put(ctx, KindExecution, checkpointID, record); err != nil {
+			return fmt.Errorf("save execution: %w", err)
+		}
+		return nil
+	})
+}
+
+// LoadExecutions returns every execution record by checkpoint ID
+func (s *Store) LoadExecutions(ctx context.Context) (map[string][]byte, error) {
+	summaries, err := s.backend.List(ctx, KindExecution)
+	if err != nil {
+		return nil, fmt.Errorf("list executions: %w", err)
+	}
+
+	records := make(map[string][]byte, len(summaries))
+	for _, sum := range summaries {
+		data, ok, err := s.backend.Get(ctx, KindExecution, sum.ID)
+		if err != nil {
+			return nil, fmt.Errorf("read execution %s: %w", sum.ID, err)
+		}
+		if ok {
+			records[sum.ID] = data
+		}
+	}
+	return records, nil
+}
+
+// DeleteExecution removes the execution record of a checkpoint
+func (s *Store) DeleteExecution(ctx context.Context, checkpointID string) error {
+	return s.withLock(ctx, checkpointID, func() error {
+		if err := s.backend.Delete(ctx, KindExecution, checkpointID); err != nil {
+			return fmt.Errorf("delete execution: %w", err)
+		}
+		return nil
+	})
+}
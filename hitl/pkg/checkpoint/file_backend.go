@@ -0,0 +1,174 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileBackend stores blobs as files under a base directory.
+// Checkpoints are kept as <id>.json and overlays as <id>.confirm.json.
+type FileBackend struct {
+	dir string
+}
+
+// NewFileBackend creates a file backend rooted at dir
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if dir == "" {
+		dir = defaultBaseDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create checkpoints directory: %w", err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// Dir returns the base directory of the backend
+func (b *FileBackend) Dir() string {
+	return b.dir
+}
+
+// Get reads a blob from disk
+func (b *FileBackend) Get(ctx context.Context, kind Kind, id string) ([]byte, bool, error) {
+	path, err := b.path(kind, id)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("read %s file: %w", kind, err)
+	}
+	return data, true, nil
+}
+
+// Put writes a blob to disk atomically
+func (b *FileBackend) Put(ctx context.Context, kind Kind, id string, data []byte) error {
+	path, err := b.path(kind, id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create %s directory: %w", kind, err)
+	}
+	return atomicWriteFile(path, data)
+}
+
+// Delete removes a blob from disk
+func (b *FileBackend) Delete(ctx context.Context, kind Kind, id string) error {
+	path, err := b.path(kind, id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete %s file: %w", kind, err)
+	}
+	return nil
+}
+
+// List lists all blobs of the given kind
+func (b *FileBackend) List(ctx context.Context, kind Kind) ([]CheckpointSummary, error) {
+	var summaries []CheckpointSummary
+
+	dir, suffix := b.dir, checkpointSuffix
+	if kind == KindOverlay {
+		suffix = overlaySuffix
+	} else if kind != KindCheckpoint {
+		dir = filepath.Join(b.dir, string(kind))
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return summaries, nil
+		}
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		name := file.Name()
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		if kind == KindCheckpoint && hasOverlaySuffix(name) {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, CheckpointSummary{
+			ID:        strings.TrimSuffix(name, suffix),
+			CreatedAt: info.ModTime(),
+			Size:      info.Size(),
+		})
+	}
+
+	// File names sort differently from IDs once the suffix is added
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries, nil
+}
+
+// CleanTempFiles removes .tmp files left behind by interrupted atomic writes
+// that are older than olderThan, returning their paths
+func (b *FileBackend) CleanTempFiles(ctx context.Context, olderThan time.Duration, dryRun bool) ([]string, error) {
+	var removed []string
+	cutoff := time.Now().Add(-olderThan)
+
+	err := filepath.WalkDir(b.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	return removed, err
+}
+
+// Close is a no-op for the file backend
+func (b *FileBackend) Close() error {
+	return nil
+}
+
+// path returns the file path of a blob, rejecting IDs that would name a file
+// outside the directory of its kind
+func (b *FileBackend) path(kind Kind, id string) (string, error) {
+	if err := ValidateID(id); err != nil {
+		return "", err
+	}
+	switch kind {
+	case KindCheckpoint:
+		return filepath.Join(b.dir, id+checkpointSuffix), nil
+	case KindOverlay:
+		return filepath.Join(b.dir, id+overlaySuffix), nil
+	default:
+		return filepath.Join(b.dir, string(kind), id+checkpointSuffix), nil
+	}
+}
@@ -0,0 +1,100 @@
+//go:build unix
+
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Lock takes an advisory flock on <dir>/locks/<id>.lock, so processes sharing
+// the directory do not interleave writes to the same checkpoint. It waits
+// until the lock is free or ctx is done.
+func (b *FileBackend) Lock(ctx context.Context, checkpointID string) (func(), error) {
+	if err := ValidateID(checkpointID); err != nil {
+		return nil, err
+	}
+	path := b.lockPath(checkpointID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create lock directory: %w", err)
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open lock file: %w", err)
+		}
+		if err := flock(ctx, f); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		// The holder we waited for may have removed the file; its lock
+		// no longer excludes anyone, so take the lock of the new one
+		if held, err := f.Stat(); err == nil {
+			if current, err := os.Stat(path); err == nil && os.SameFile(held, current) {
+				return func() {
+					syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+					f.Close()
+				}, nil
+			}
+		}
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}
+}
+
+// flock waits for an exclusive flock on f
+func flock(ctx context.Context, f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			return fmt.Errorf("flock: %w", err)
+		}
+		if err := waitLock(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// RemoveLock removes the lock file of a deleted checkpoint. The caller must
+// hold the lock, so processes waiting on the file take a new one instead.
+func (b *FileBackend) RemoveLock(ctx context.Context, checkpointID string) error {
+	if err := ValidateID(checkpointID); err != nil {
+		return err
+	}
+	if err := os.Remove(b.lockPath(checkpointID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove lock file: %w", err)
+	}
+	return nil
+}
+
+// LockIDs lists the checkpoints that have a lock file
+func (b *FileBackend) LockIDs(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(b.dir, "locks"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read lock directory: %w", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".lock"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (b *FileBackend) lockPath(checkpointID string) string {
+	return filepath.Join(b.dir, "locks", checkpointID+".lock")
+}
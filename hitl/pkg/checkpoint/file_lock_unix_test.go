@@ -0,0 +1,113 @@
+//go:build unix
+
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRemovedLockFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	open := func() *FileBackend {
+		b, err := NewFileBackend(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	a, b, c := open(), open(), open()
+
+	unlock, err := a.Lock(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan func())
+	go func() {
+		unlock, err := b.Lock(ctx, "cp")
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	// The holder removes the file b waits on, then unlocks
+	if err := a.RemoveLock(ctx, "cp"); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	var unlockB func()
+	select {
+	case unlockB = <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock was not handed over after unlock")
+	}
+
+	// b holds the lock of the new file, so c still waits
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Lock(short, "cp"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock after the file was replaced = %v, want DeadlineExceeded", err)
+	}
+	unlockB()
+}
+
+func TestLockFilesRemoved(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	backend := s.backend.(*FileBackend)
+	lockIDs := func() string {
+		ids, err := backend.LockIDs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	s.Set(ctx, "live", testCheckpoint(t))
+	s.Set(ctx, "deleted", testCheckpoint(t))
+	if got := lockIDs(); got != "[deleted live]" {
+		t.Fatalf("lock files = %s, want deleted and live", got)
+	}
+
+	// Delete removes the checkpoint's lock file
+	if err := s.Delete(ctx, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lockIDs(); got != "[live]" {
+		t.Fatalf("lock files after Delete = %s, want live", got)
+	}
+
+	// Sweep removes lock files left without a checkpoint, and the ones it
+	// takes to check orphans
+	if err := os.WriteFile(backend.lockPath("stale"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.backend.Put(ctx, KindOverlay, "gone", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		dryRun bool
+		left   string
+	}{
+		{dryRun: true, left: "[live stale]"},
+		{dryRun: false, left: "[live]"},
+	} {
+		report, err := s.Sweep(ctx, tt.dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(report.OrphanLocks, report.OrphanOverlays) != "[stale] [gone]" {
+			t.Fatalf("dry run %v: report %+v, want stale's lock and gone's overlay", tt.dryRun, report)
+		}
+		if got := lockIDs(); got != tt.left {
+			t.Fatalf("dry run %v: lock files = %s, want %s", tt.dryRun, got, tt.left)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// Fixture files in testdata/state hold states saved by earlier versions:
+// compose checkpoint data in "v<version>-<name>.checkpoint.json", overlays in
+// "v<version>-<name>.overlay.json". Each has the state it must migrate to next
+// to it, "<name>.<kind>.expected.json". Add a fixture saved by the old version
+// with each new schema version.
+const (
+	fixtureDir        = "testdata/state"
+	fixtureCheckpoint = ".checkpoint.json"
+	fixtureOverlay    = ".overlay.json"
+	fixtureExpected   = ".expected.json"
+)
+
+var update = flag.Bool("update", false, "write the expected states of the state fixtures instead of checking them")
+
+// TestFixtures migrates every fixture to the current schema and compares the
+// result with its expected state. Run with -update to rewrite the expected
+// states, and review the diff.
+func TestFixtures(t *testing.T) {
+	entries, err := os.ReadDir(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checked := 0
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasSuffix(name, fixtureExpected) ||
+			!strings.HasSuffix(name, fixtureCheckpoint) && !strings.HasSuffix(name, fixtureOverlay) {
+			continue
+		}
+		checked++
+		t.Run(name, func(t *testing.T) {
+			checkFixture(t, filepath.Join(fixtureDir, name))
+		})
+	}
+	if checked == 0 {
+		t.Fatal("no fixtures")
+	}
+}
+
+func checkFixture(t *testing.T, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var st *types.UniversalState
+	var from int
+	if strings.HasSuffix(path, fixtureCheckpoint) {
+		st, from, err = migrateCheckpointFixture(data)
+	} else {
+		st, from, err = migrateOverlayFixture(data)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fixtureNameVersion(t, path); from != want {
+		t.Fatalf("saved with version %d, but named for version %d", from, want)
+	}
+	if st.SchemaVersion != types.CurrentSchemaVersion {
+		t.Fatalf("migrated to version %d, want %d", st.SchemaVersion, types.CurrentSchemaVersion)
+	}
+
+	got, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPath := strings.TrimSuffix(path, ".json") + fixtureExpected
+	if *update {
+		if err := os.WriteFile(expectedPath, append(got, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(expectedPath)
+	if err != nil {
+		t.Fatalf("read expected state: %v (run with -update to create it)", err)
+	}
+	var gotValue, wantValue any
+	if err := json.Unmarshal(want, &wantValue); err != nil {
+		t.Fatalf("unmarshal expected state: %v", err)
+	}
+	_ = json.Unmarshal(got, &gotValue)
+	if !jsonEqual(gotValue, wantValue) {
+		t.Fatalf("migrated state differs from %s:\n%s", expectedPath, got)
+	}
+}
+
+// fixtureNameVersion reads the version a fixture is named for
+func fixtureNameVersion(t *testing.T, path string) int {
+	prefix, _, _ := strings.Cut(filepath.Base(path), "-")
+	prefix, _, _ = strings.Cut(prefix, ".")
+	version, err := strconv.Atoi(strings.TrimPrefix(prefix, "v"))
+	if err != nil || !strings.HasPrefix(prefix, "v") {
+		t.Fatalf("fixture name does not start with v<version>")
+	}
+	return version
+}
+
+// migrateCheckpointFixture migrates checkpoint data and checks that it
+// decodes and survives re-encoding
+func migrateCheckpointFixture(data []byte) (*types.UniversalState, int, error) {
+	var root serialValue
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, 0, fmt.Errorf("unmarshal checkpoint json: %w", err)
+	}
+	from := fixtureVersion(universalState(root.MapValues["State"]))
+
+	migrated, err := migrateCheckpoint(data)
+	if err != nil {
+		return nil, from, err
+	}
+	cp, err := DecodeCheckpoint(migrated)
+	if err != nil {
+		return nil, from, err
+	}
+
+	encoded, err := cp.Encode()
+	if err != nil {
+		return nil, from, err
+	}
+	again, err := DecodeCheckpoint(encoded)
+	if err != nil {
+		return nil, from, fmt.Errorf("decode re-encoded checkpoint: %w", err)
+	}
+	if !jsonEqual(cp.State, again.State) {
+		return nil, from, fmt.Errorf("state changed when re-encoded")
+	}
+	return cp.State, from, nil
+}
+
+// migrateOverlayFixture migrates overlay JSON and decodes it, rejecting
+// fields UniversalState no longer has
+func migrateOverlayFixture(data []byte) (*types.UniversalState, int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, 0, fmt.Errorf("unmarshal overlay json: %w", err)
+	}
+	var from int
+	_ = json.Unmarshal(fields["schema_version"], &from)
+
+	migrated, err := migrateOverlay(data)
+	if err != nil {
+		return nil, from, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(migrated))
+	dec.DisallowUnknownFields()
+	var st types.UniversalState
+	if err := dec.Decode(&st); err != nil {
+		return nil, from, fmt.Errorf("decode migrated overlay: %w", err)
+	}
+	return &st, from, nil
+}
+
+// fixtureVersion reads the schema version of a serialized state, 0 when it
+// has none
+func fixtureVersion(state *serialValue) int {
+	if state == nil {
+		return 0
+	}
+	var version int
+	_, _ = serialDocument(state.MapValues).Field("SchemaVersion", &version)
+	return version
+}
+
+func TestStoreMigratesOnLoad(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	checkpointData, _ := os.ReadFile(filepath.Join(fixtureDir, "v0-map-log.checkpoint.json"))
+	overlayData, _ := os.ReadFile(filepath.Join(fixtureDir, "v0-map-log.overlay.json"))
+	s.Backend().Put(ctx, KindCheckpoint, "cp", checkpointData)
+	s.Backend().Put(ctx, KindOverlay, "cp", overlayData)
+
+	cp, err := s.LoadCheckpoint(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.State.SchemaVersion != types.CurrentSchemaVersion || len(cp.State.NodeExecutionLog) == 0 {
+		t.Fatalf("checkpoint state at version %d with log %+v", cp.State.SchemaVersion, cp.State.NodeExecutionLog)
+	}
+	// Compose resumes from the migrated form
+	data, ok, err := s.Get(ctx, "cp")
+	if err != nil || !ok {
+		t.Fatalf("Get = %v, %v", ok, err)
+	}
+	if decoded, err := DecodeCheckpoint(data); err != nil || decoded.State.SchemaVersion != types.CurrentSchemaVersion {
+		t.Fatalf("Get returned data at an old version: %v", err)
+	}
+
+	st, err := s.LoadPendingState(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.SchemaVersion != types.CurrentSchemaVersion || len(st.NodeExecutionLog) == 0 {
+		t.Fatalf("overlay state at version %d with log %+v", st.SchemaVersion, st.NodeExecutionLog)
+	}
+}
+
+func TestStoreRejectsFutureSchema(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	future := types.CurrentSchemaVersion + 1
+
+	var overlay map[string]any
+	json.Unmarshal(testOverlay(t), &overlay)
+	overlay["schema_version"] = future
+	data, _ := json.Marshal(overlay)
+	s.Set(ctx, "cp", testCheckpoint(t))
+	s.Backend().Put(ctx, KindOverlay, "cp", data)
+	if _, err := s.LoadPendingState(ctx, "cp"); !errors.Is(err, types.ErrFutureSchema) {
+		t.Fatalf("LoadPendingState = %v, want ErrFutureSchema", err)
+	}
+
+	// Encode stamps the current version, so set it in the serialized state
+	var root serialValue
+	json.Unmarshal(testCheckpoint(t), &root)
+	if err := serialDocument(universalState(root.MapValues["State"]).MapValues).SetField("SchemaVersion", future); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = json.Marshal(&root)
+	s.Backend().Put(ctx, KindCheckpoint, "new", data)
+	if _, _, err := s.Get(ctx, "new"); !errors.Is(err, types.ErrFutureSchema) {
+		t.Fatalf("Get = %v, want ErrFutureSchema", err)
+	}
+	if _, err := s.LoadCheckpoint(ctx, "new"); !errors.Is(err, types.ErrFutureSchema) {
+		t.Fatalf("LoadCheckpoint = %v, want ErrFutureSchema", err)
+	}
+}
@@ -0,0 +1,333 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// KindMeta holds the searchable metadata of a checkpoint
+const KindMeta Kind = "meta"
+
+// ErrInvalidQuery is returned for a Query with an unknown sort field
+var ErrInvalidQuery = errors.New("invalid checkpoint query")
+
+// Metadata is the index entry of a checkpoint, updated on every write
+type Metadata struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Size      int64     `json:"size"`
+	Revision  int       `json:"revision"`
+
+	GraphName string `json:"graph_name,omitempty"`
+	// LastNode is the node that ran most recently before the checkpoint was saved
+	LastNode          string   `json:"last_node,omitempty"`
+	InterruptedBefore []string `json:"interrupted_before,omitempty"`
+	// PendingTools are the tools called by the last message, awaiting execution
+	PendingTools    []string          `json:"pending_tools,omitempty"`
+	MessageCount    int               `json:"message_count"`
+	ContextKeys     []string          `json:"context_keys,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	HasPendingState bool              `json:"has_pending_state"`
+}
+
+// Query filters, sorts and paginates checkpoints. Zero values match everything.
+type Query struct {
+	GraphName         string
+	LastNode          string
+	InterruptedBefore string
+	// Tool matches checkpoints with a pending call to this tool
+	Tool       string
+	ContextKey string
+	// Labels must all match; an empty value only requires the key
+	Labels          map[string]string
+	HasPendingState *bool
+	// IDContains matches a substring of the checkpoint ID
+	IDContains string
+
+	// SortBy is one of the Sort* constants, default SortUpdatedAt
+	SortBy string
+	// Desc sorts in descending order
+	Desc bool
+
+	Offset int
+	// Limit caps the number of results; 0 returns all
+	Limit int
+}
+
+// Sort fields accepted by Query.SortBy
+const (
+	SortUpdatedAt    = "updated_at"
+	SortCreatedAt    = "created_at"
+	SortID           = "id"
+	SortSize         = "size"
+	SortMessageCount = "message_count"
+	SortGraphName    = "graph_name"
+	SortLastNode     = "last_node"
+)
+
+// Page is one page of query results
+type Page struct {
+	Items []Metadata `json:"items"`
+	// Total is the number of matches before pagination
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type graphNameKey struct{}
+
+// WithGraphName records the graph name in ctx so checkpoints saved with it are
+// indexed under that graph
+func WithGraphName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, graphNameKey{}, name)
+}
+
+// ForGraph wraps a compose checkpoint store so every checkpoint it saves is
+// indexed under the given graph name
+func ForGraph(store compose.CheckPointStore, name string) compose.CheckPointStore {
+	return &graphStore{CheckPointStore: store, name: name}
+}
+
+type graphStore struct {
+	compose.CheckPointStore
+	name string
+}
+
+func (g *graphStore) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	return g.CheckPointStore.Set(WithGraphName(ctx, g.name), checkPointID, checkPoint)
+}
+
+// GetMetadata returns the index entry of a checkpoint, building it if the
+// checkpoint predates the index
+func (s *Store) GetMetadata(ctx context.Context, checkpointID string) (*Metadata, error) {
+	return s.metadata(ctx, checkpointID, time.Time{})
+}
+
+// metadata returns the index entry of a checkpoint, building it if needed
+// with modTime as its times when it has no revision history
+func (s *Store) metadata(ctx context.Context, checkpointID string, modTime time.Time) (*Metadata, error) {
+	meta, ok, err := s.loadMetadata(ctx, checkpointID)
+	if err != nil || ok {
+		return meta, err
+	}
+
+	err = s.withLock(ctx, checkpointID, func() error {
+		meta, err = s.reindex(ctx, checkpointID, modTime)
+		return err
+	})
+	return meta, err
+}
+
+// SetLabels replaces the labels of a checkpoint
+func (s *Store) SetLabels(ctx context.Context, checkpointID string, labels map[string]string) error {
+	if _, err := s.GetMetadata(ctx, checkpointID); err != nil {
+		return err
+	}
+	return s.withLock(ctx, checkpointID, func() error {
+		return s.patchMetadata(ctx, checkpointID, func(m *Metadata) {
+			m.Labels = labels
+		})
+	})
+}
+
+// Query returns the checkpoints matching q
+func (s *Store) Query(ctx context.Context, q Query) (*Page, error) {
+	checkpoints, err := s.backend.List(ctx, KindCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []Metadata{}
+	for _, cp := range checkpoints {
+		meta, err := s.metadata(ctx, cp.ID, cp.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %w", cp.ID, err)
+		}
+		if q.matches(meta) {
+			matches = append(matches, *meta)
+		}
+	}
+
+	less, err := metadataLess(q.SortBy)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if q.Desc {
+			return less(&matches[j], &matches[i])
+		}
+		return less(&matches[i], &matches[j])
+	})
+
+	page := &Page{Total: len(matches), Offset: q.Offset, Limit: q.Limit}
+	start := min(max(q.Offset, 0), len(matches))
+	end := len(matches)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	page.Items = matches[start:end]
+	return page, nil
+}
+
+func (q *Query) matches(m *Metadata) bool {
+	switch {
+	case q.GraphName != "" && m.GraphName != q.GraphName,
+		q.LastNode != "" && m.LastNode != q.LastNode,
+		q.InterruptedBefore != "" && !contains(m.InterruptedBefore, q.InterruptedBefore),
+		q.Tool != "" && !contains(m.PendingTools, q.Tool),
+		q.ContextKey != "" && !contains(m.ContextKeys, q.ContextKey),
+		q.HasPendingState != nil && m.HasPendingState != *q.HasPendingState,
+		q.IDContains != "" && !strings.Contains(m.ID, q.IDContains):
+		return false
+	}
+	for k, v := range q.Labels {
+		got, ok := m.Labels[k]
+		if !ok || (v != "" && got != v) {
+			return false
+		}
+	}
+	return true
+}
+
+func metadataLess(field string) (func(a, b *Metadata) bool, error) {
+	switch field {
+	case "", SortUpdatedAt:
+		return func(a, b *Metadata) bool { return a.UpdatedAt.Before(b.UpdatedAt) }, nil
+	case SortCreatedAt:
+		return func(a, b *Metadata) bool { return a.CreatedAt.Before(b.CreatedAt) }, nil
+	case SortID:
+		return func(a, b *Metadata) bool { return a.ID < b.ID }, nil
+	case SortSize:
+		return func(a, b *Metadata) bool { return a.Size < b.Size }, nil
+	case SortMessageCount:
+		return func(a, b *Metadata) bool { return a.MessageCount < b.MessageCount }, nil
+	case SortGraphName:
+		return func(a, b *Metadata) bool { return a.GraphName < b.GraphName }, nil
+	case SortLastNode:
+		return func(a, b *Metadata) bool { return a.LastNode < b.LastNode }, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown sort field %s", ErrInvalidQuery, field)
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) loadMetadata(ctx context.Context, checkpointID string) (*Metadata, bool, error) {
+	data, ok, err := s.backend.Get(ctx, KindMeta, checkpointID)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, false, fmt.Errorf("unmarshal metadata: %w", err)
+	}
+	return &meta, true, nil
+}
+
+func (s *Store) saveMetadata(ctx context.Context, meta *Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("marshal metadata: %w", err)
+	}
+	if err := s.backend.Put(ctx, KindMeta, meta.ID, data); err != nil {
+		return fmt.Errorf("save metadata: %w", err)
+	}
+	return nil
+}
+
+// patchMetadata applies fn to an existing index entry. Callers must hold the
+// checkpoint lock.
+func (s *Store) patchMetadata(ctx context.Context, checkpointID string, fn func(m *Metadata)) error {
+	meta, ok, err := s.loadMetadata(ctx, checkpointID)
+	if err != nil || !ok {
+		return err
+	}
+	fn(meta)
+	return s.saveMetadata(ctx, meta)
+}
+
+// reindex builds the index entry of a checkpoint from its current data, taking
+// its times from the revision history or else modTime. Callers must hold the
+// checkpoint lock.
+func (s *Store) reindex(ctx context.Context, checkpointID string, modTime time.Time) (*Metadata, error) {
+	data, ok, err := s.backend.Get(ctx, KindCheckpoint, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, checkpointID)
+	}
+
+	rev, err := s.Revision(ctx, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.indexCheckpoint(ctx, checkpointID, data, rev)
+	if err != nil {
+		return nil, err
+	}
+	if revs, err := s.ListRevisions(ctx, checkpointID); err == nil && len(revs) > 0 {
+		meta.CreatedAt, meta.UpdatedAt = revs[0].SavedAt, revs[len(revs)-1].SavedAt
+	} else if !modTime.IsZero() {
+		meta.CreatedAt, meta.UpdatedAt = modTime, modTime
+	} else {
+		return meta, nil
+	}
+	return meta, s.saveMetadata(ctx, meta)
+}
+
+// indexCheckpoint updates the index entry of a checkpoint after data was saved
+// as revision rev, keeping its creation time, graph name and labels. Callers
+// must hold the checkpoint lock.
+func (s *Store) indexCheckpoint(ctx context.Context, checkpointID string, data []byte, rev int) (*Metadata, error) {
+	now := time.Now()
+	meta, ok, err := s.loadMetadata(ctx, checkpointID)
+	if err != nil || !ok {
+		meta = &Metadata{ID: checkpointID, CreatedAt: now}
+	}
+
+	meta.UpdatedAt = now
+	meta.Size = int64(len(data))
+	meta.Revision = rev
+	meta.InterruptedBefore = interruptedNodes(data)
+	if name, ok := ctx.Value(graphNameKey{}).(string); ok && name != "" {
+		meta.GraphName = name
+	}
+	_, meta.HasPendingState, _ = s.backend.Get(ctx, KindOverlay, checkpointID)
+
+	meta.LastNode, meta.PendingTools, meta.MessageCount, meta.ContextKeys = "", nil, 0, nil
+	if cp, err := DecodeCheckpoint(data); err == nil {
+		st := cp.State
+		meta.MessageCount = len(st.MessageHistory)
+		if ev := st.LastEvent(); ev != nil {
+			meta.LastNode = ev.Node
+		}
+		for k := range st.Context {
+			meta.ContextKeys = append(meta.ContextKeys, k)
+		}
+		sort.Strings(meta.ContextKeys)
+		if n := len(st.MessageHistory); n > 0 && st.MessageHistory[n-1] != nil && st.MessageHistory[n-1].Role == schema.Assistant {
+			for _, tc := range st.MessageHistory[n-1].ToolCalls {
+				meta.PendingTools = append(meta.PendingTools, tc.Function.Name)
+			}
+		}
+	}
+
+	return meta, s.saveMetadata(ctx, meta)
+}
@@ -0,0 +1,164 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	data := testCheckpoint(t)
+
+	if err := ForGraph(s, "booking").Set(ctx, "cp", data); err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.GetMetadata(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.GraphName != "booking" || m.Revision != 1 || m.LastNode != "ChatModel" || m.MessageCount != 8 || m.Size != int64(len(data)) {
+		t.Fatalf("metadata = %+v", m)
+	}
+	if strings.Join(m.InterruptedBefore, ",") != "ToolsNode" || strings.Join(m.PendingTools, ",") != "BookTicket" ||
+		strings.Join(m.ContextKeys, ",") != "location,name" {
+		t.Fatalf("metadata = %+v", m)
+	}
+
+	if err := s.SetLabels(ctx, "cp", map[string]string{"env": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	// Later writes keep the graph, the labels and the creation time
+	if err := s.Set(ctx, "cp", editedCheckpoint(t, data, "second")); err != nil {
+		t.Fatal(err)
+	}
+	m2, _ := s.GetMetadata(ctx, "cp")
+	if m2.GraphName != "booking" || m2.Labels["env"] != "prod" || !m2.CreatedAt.Equal(m.CreatedAt) || m2.Revision != 2 {
+		t.Fatalf("metadata after a write = %+v", m2)
+	}
+	if strings.Join(m2.ContextKeys, ",") != "edit,location,name" {
+		t.Fatalf("context keys = %v", m2.ContextKeys)
+	}
+
+	if err := s.SetLabels(ctx, "missing", nil); !errors.Is(err, ErrCheckpointNotFound) {
+		t.Fatalf("SetLabels of a missing checkpoint = %v, want ErrCheckpointNotFound", err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	data := testCheckpoint(t)
+
+	ForGraph(s, "booking").Set(ctx, "run-a", data)
+	ForGraph(s, "refunds").Set(ctx, "run-b", editedCheckpoint(t, data, "b"))
+	ForGraph(s, "booking").Set(ctx, "job-c", data)
+	s.SetLabels(ctx, "run-a", map[string]string{"env": "prod", "team": "travel"})
+	s.SetLabels(ctx, "run-b", map[string]string{"env": "dev"})
+	cp, _ := s.LoadCheckpoint(ctx, "job-c")
+	s.SavePendingState(ctx, "job-c", cp.State)
+
+	yes, no := true, false
+	tests := []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"all", Query{}, "run-a,run-b,job-c"},
+		{"graph", Query{GraphName: "booking"}, "run-a,job-c"},
+		{"last node", Query{LastNode: "ChatModel"}, "run-a,run-b,job-c"},
+		{"interrupted before", Query{InterruptedBefore: "ToolsNode"}, "run-a,run-b,job-c"},
+		{"other node", Query{InterruptedBefore: "ChatModel"}, ""},
+		{"tool", Query{Tool: "BookTicket"}, "run-a,run-b,job-c"},
+		{"context key", Query{ContextKey: "edit"}, "run-b"},
+		{"label value", Query{Labels: map[string]string{"env": "prod"}}, "run-a"},
+		{"label key", Query{Labels: map[string]string{"env": ""}}, "run-a,run-b"},
+		{"labels", Query{Labels: map[string]string{"env": "prod", "team": "ops"}}, ""},
+		{"pending", Query{HasPendingState: &yes}, "job-c"},
+		{"not pending", Query{HasPendingState: &no}, "run-a,run-b"},
+		{"id", Query{IDContains: "run-"}, "run-a,run-b"},
+		{"combined", Query{GraphName: "booking", IDContains: "run"}, "run-a"},
+		{"by id", Query{SortBy: SortID}, "job-c,run-a,run-b"},
+		{"by id desc", Query{SortBy: SortID, Desc: true}, "run-b,run-a,job-c"},
+		// Ties keep ID order
+		{"by graph", Query{SortBy: SortGraphName, Desc: true}, "run-b,job-c,run-a"},
+		{"by size", Query{SortBy: SortSize, Desc: true}, "run-b,job-c,run-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.Query(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pageIDs(page); got != tt.want {
+				t.Fatalf("Query = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryPagination(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		s.Set(ctx, id, testCheckpoint(t))
+	}
+
+	tests := []struct {
+		offset, limit int
+		want          string
+	}{
+		{0, 2, "a,b"},
+		{2, 2, "c,d"},
+		{4, 2, "e"},
+		{9, 2, ""},
+		{-1, 0, "a,b,c,d,e"},
+		{3, 0, "d,e"},
+	}
+	for _, tt := range tests {
+		page, err := s.Query(ctx, Query{SortBy: SortID, Offset: tt.offset, Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pageIDs(page); got != tt.want || page.Total != 5 {
+			t.Errorf("offset %d limit %d = %s of %d, want %s of 5", tt.offset, tt.limit, got, page.Total, tt.want)
+		}
+	}
+
+	if _, err := s.Query(ctx, Query{SortBy: "colour"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("Query by an unknown field = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestQueryIndexesOldCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	// Saved before the index existed: no metadata, no revisions
+	s.Backend().Put(ctx, KindCheckpoint, "old", testCheckpoint(t))
+	ageCheckpoint(t, s, "old", time.Hour)
+
+	page, err := s.Query(ctx, Query{Tool: "BookTicket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != "old" {
+		t.Fatalf("Query = %+v, want old", page.Items)
+	}
+	if age := time.Since(page.Items[0].CreatedAt); age < 59*time.Minute || age > 61*time.Minute {
+		t.Fatalf("created %v ago, want the file time an hour ago", age)
+	}
+	if _, ok, _ := s.Backend().Get(ctx, KindMeta, "old"); !ok {
+		t.Fatal("metadata was not saved")
+	}
+}
+
+func pageIDs(p *Page) string {
+	ids := make([]string, len(p.Items))
+	for i, m := range p.Items {
+		ids[i] = m.ID
+	}
+	return strings.Join(ids, ",")
+}
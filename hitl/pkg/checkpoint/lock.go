@@ -0,0 +1,150 @@
+package checkpoint
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AnyRevision disables the revision check of a conditional write
+const AnyRevision = -1
+
+const (
+	// lockPollInterval is how often a backend retries a held lock
+	lockPollInterval = 10 * time.Millisecond
+	// lockLease is how long a backend lock outlives a process that died
+	// holding it. Writes under the lock are a few blob puts, far shorter.
+	lockLease = 30 * time.Second
+)
+
+// ErrConflict is returned when a conditional write finds that the checkpoint
+// moved on to another revision since it was read
+var ErrConflict = errors.New("checkpoint was modified concurrently")
+
+// Locker is implemented by backends that can lock a checkpoint across
+// processes. The returned function releases the lock.
+type Locker interface {
+	Lock(ctx context.Context, checkpointID string) (unlock func(), err error)
+}
+
+// lockRemover is implemented by backends that keep state for each lock, such
+// as a lock file, after it is released. The store removes it when the
+// checkpoint is deleted, holding the lock.
+type lockRemover interface {
+	RemoveLock(ctx context.Context, checkpointID string) error
+	// LockIDs lists the checkpoints that have lock state
+	LockIDs(ctx context.Context) ([]string, error)
+}
+
+// lockToken returns a random token identifying one holder of a backend lock,
+// so a holder whose lease expired cannot release the next holder's lock
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// waitLock waits one poll interval before retrying a held lock
+func waitLock(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(lockPollInterval):
+		return nil
+	}
+}
+
+// keyedMutex hands out one mutex per key, dropping it once unused
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+func (k *keyedMutex) lock(key string) (unlock func()) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*refMutex)
+	}
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		k.mu.Lock()
+		if m.refs--; m.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// withLock runs fn holding the checkpoint's in-process lock and, when the
+// backend supports it, its cross-process lock
+func (s *Store) withLock(ctx context.Context, checkpointID string, fn func() error) error {
+	unlock := s.locks.lock(checkpointID)
+	defer unlock()
+
+	if locker, ok := unwrapBackend(s.backend).(Locker); ok {
+		unlockBackend, err := locker.Lock(ctx, checkpointID)
+		if err != nil {
+			return fmt.Errorf("lock checkpoint %s: %w", checkpointID, err)
+		}
+		defer unlockBackend()
+	}
+
+	return fn()
+}
+
+// removeLock removes the backend's lock state of a deleted checkpoint.
+// Callers must hold the checkpoint lock.
+func (s *Store) removeLock(ctx context.Context, checkpointID string) error {
+	if remover, ok := unwrapBackend(s.backend).(lockRemover); ok {
+		if err := remover.RemoveLock(ctx, checkpointID); err != nil {
+			return fmt.Errorf("remove lock: %w", err)
+		}
+	}
+	return nil
+}
+
+// Revision returns the current revision number of a checkpoint, 0 if it has
+// no revision history
+func (s *Store) Revision(ctx context.Context, checkpointID string) (int, error) {
+	revs, err := s.ListRevisions(ctx, checkpointID)
+	if err != nil {
+		return 0, err
+	}
+	if len(revs) == 0 {
+		return 0, nil
+	}
+	return revs[len(revs)-1].Number, nil
+}
+
+// SetIfRevision saves checkpoint data only if the checkpoint is still at the
+// expected revision, returning ErrConflict otherwise. AnyRevision makes the
+// write unconditional.
+func (s *Store) SetIfRevision(ctx context.Context, checkpointID string, data []byte, expected int) (*Revision, error) {
+	var rev *Revision
+	err := s.withLock(ctx, checkpointID, func() error {
+		var err error
+		rev, err = s.commit(ctx, checkpointID, data, "", expected)
+		return err
+	})
+	return rev, err
+}
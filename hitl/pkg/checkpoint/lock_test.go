@@ -0,0 +1,237 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var k keyedMutex
+
+	unlockA := k.lock("a")
+	// Other keys are not blocked
+	done := make(chan struct{})
+	go func() {
+		k.lock("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock of b waited for a")
+	}
+
+	// The same key is
+	var held atomic.Bool
+	acquired := make(chan struct{})
+	go func() {
+		unlock := k.lock("a")
+		if held.Load() {
+			t.Error("a locked twice")
+		}
+		unlock()
+		close(acquired)
+	}()
+	held.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	held.Store(false)
+	unlockA()
+	<-acquired
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.locks) != 0 {
+		t.Fatalf("%d mutexes left after unlocking", len(k.locks))
+	}
+}
+
+func TestBackendLock(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		a, b := open().(Locker), open().(Locker)
+
+		unlock, err := a.Lock(ctx, "cp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Another process waits for the lock
+		short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if _, err := b.Lock(short, "cp"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Lock of a held checkpoint = %v, want DeadlineExceeded", err)
+		}
+		// but not for other checkpoints
+		unlockOther, err := b.Lock(ctx, "other")
+		if err != nil {
+			t.Fatal(err)
+		}
+		unlockOther()
+
+		locked := make(chan func())
+		go func() {
+			unlock, err := b.Lock(ctx, "cp")
+			if err != nil {
+				t.Error(err)
+			}
+			locked <- unlock
+		}()
+		time.Sleep(30 * time.Millisecond)
+		unlock()
+
+		select {
+		case unlock := <-locked:
+			unlock()
+		case <-time.After(5 * time.Second):
+			t.Fatal("lock was not handed over after unlock")
+		}
+	})
+}
+
+func TestRedisLockExpires(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	b, err := NewRedisBackend(RedisOptions{Addr: server.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	stale, err := b.Lock(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The holder died; its lease runs out
+	server.FastForward(lockLease + time.Second)
+
+	unlock, err := b.Lock(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A late unlock of the expired holder leaves the new lock alone
+	stale()
+	if !server.Exists(defaultRedisPrefix + "lock:cp") {
+		t.Fatal("expired holder released the new lock")
+	}
+	unlock()
+	if server.Exists(defaultRedisPrefix + "lock:cp") {
+		t.Fatal("lock left after unlock")
+	}
+}
+
+func TestSQLiteLockExpires(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewSQLiteBackend(t.TempDir() + "/checkpoints.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	stale, err := b.Lock(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The holder died; its lease runs out
+	b.db.Exec(`UPDATE locks SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Second).UnixNano(), "cp")
+
+	unlock, err := b.Lock(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale()
+	var n int
+	b.db.QueryRow(`SELECT count(*) FROM locks WHERE id = ?`, "cp").Scan(&n)
+	if n != 1 {
+		t.Fatal("expired holder released the new lock")
+	}
+	unlock()
+}
+
+func TestSetIfRevision(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	data := testCheckpoint(t)
+
+	if _, err := s.SetIfRevision(ctx, "cp", data, 1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("write at revision 1 of a new checkpoint = %v, want ErrConflict", err)
+	}
+	rev, err := s.SetIfRevision(ctx, "cp", data, 0)
+	if err != nil || rev.Number != 1 {
+		t.Fatalf("first write = %+v, %v; want revision 1", rev, err)
+	}
+	if _, err := s.SetIfRevision(ctx, "cp", editedCheckpoint(t, data, "stale"), 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale write = %v, want ErrConflict", err)
+	}
+	if r, _ := s.Revision(ctx, "cp"); r != 1 {
+		t.Fatalf("revision %d after a stale write, want 1", r)
+	}
+
+	rev, err = s.SetIfRevision(ctx, "cp", data, AnyRevision)
+	if err != nil || rev.Number != 2 {
+		t.Fatalf("unconditional write = %+v, %v; want revision 2", rev, err)
+	}
+
+	// Edits check against the revision they were given
+	edit := func(cp *Checkpoint) error {
+		cp.SetContext("edit", "conditional")
+		return nil
+	}
+	if err := s.EditCheckpointAt(ctx, "cp", 1, edit); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale edit = %v, want ErrConflict", err)
+	}
+	if err := s.EditCheckpointAt(ctx, "cp", 2, edit); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentSetIfRevision(t *testing.T) {
+	ctx := context.Background()
+	data := testCheckpoint(t)
+
+	forEachBackend(t, func(t *testing.T, open func() Backend) {
+		// Two stores share nothing but the backend, like two processes
+		stores := []*Store{NewStoreWithBackend(open()), NewStoreWithBackend(open())}
+		if _, err := stores[0].SetIfRevision(ctx, "cp", data, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		const writers = 8
+		var (
+			wg        sync.WaitGroup
+			won       atomic.Int32
+			conflicts atomic.Int32
+		)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := stores[i%2].SetIfRevision(ctx, "cp", editedCheckpoint(t, data, fmt.Sprint(i)), 1)
+				switch {
+				case err == nil:
+					won.Add(1)
+				case errors.Is(err, ErrConflict):
+					conflicts.Add(1)
+				default:
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if won.Load() != 1 || conflicts.Load() != writers-1 {
+			t.Fatalf("%d writes won and %d conflicted, want 1 and %d", won.Load(), conflicts.Load(), writers-1)
+		}
+		revs, err := stores[1].ListRevisions(ctx, "cp")
+		if err != nil || len(revs) != 2 {
+			t.Fatalf("revisions = %+v, %v; want 2", revs, err)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// States are migrated to types.CurrentSchemaVersion on the read path, so
+// compose resumes from and the editor decodes the current layout; the new
+// form is written back by the next save. See types.MigrateState.
+
+// migrateCheckpoint returns data with its state migrated to the current
+// schema. Data it cannot parse is returned unchanged.
+func migrateCheckpoint(data []byte) ([]byte, error) {
+	var root serialValue
+	if err := json.Unmarshal(data, &root); err != nil {
+		return data, nil
+	}
+	migrated, err := migrateRoot(&root)
+	if err != nil || !migrated {
+		return data, err
+	}
+
+	b, err := json.Marshal(&root)
+	if err != nil {
+		return nil, fmt.Errorf("marshal migrated checkpoint: %w", err)
+	}
+	return b, nil
+}
+
+// migrateRoot migrates the State of a decoded checkpoint root, reporting
+// whether it changed
+func migrateRoot(root *serialValue) (bool, error) {
+	sv := universalState(root.MapValues["State"])
+	if sv == nil || sv.MapValues == nil {
+		return false, nil
+	}
+
+	from, err := types.MigrateState(serialDocument(sv.MapValues))
+	if err != nil {
+		return false, err
+	}
+	return from != types.CurrentSchemaVersion, nil
+}
+
+// universalState finds the serialized UniversalState in a checkpoint state:
+// the state itself, or the UniversalState a custom state embeds
+func universalState(sv *serialValue) *serialValue {
+	if sv == nil || sv.Type == nil || sv.Type.StructType == "" {
+		return nil
+	}
+	if sv.Type.StructType == "universal_state" {
+		return sv
+	}
+	return universalState(sv.MapValues["UniversalState"])
+}
+
+// migrateOverlay returns overlay JSON with its state migrated to the current
+// schema
+func migrateOverlay(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return data, nil
+	}
+
+	from, err := types.MigrateState(jsonDocument(fields))
+	if err != nil {
+		return nil, err
+	}
+	if from == types.CurrentSchemaVersion {
+		return data, nil
+	}
+	return json.MarshalIndent(fields, "", "  ")
+}
+
+// serialDocument is the State of a checkpoint in compose's serialized form
+type serialDocument map[string]*serialValue
+
+func (d serialDocument) Field(name string, v any) (bool, error) {
+	sv, ok := d[name]
+	if !ok {
+		return false, nil
+	}
+	value, err := decodeValue(sv)
+	if err != nil {
+		return true, err
+	}
+	return true, assign(reflect.ValueOf(v).Elem(), value)
+}
+
+func (d serialDocument) SetField(name string, v any) error {
+	sv, err := encodeValue(v)
+	if err != nil {
+		return err
+	}
+	d[name] = sv
+	return nil
+}
+
+func (d serialDocument) DeleteField(name string) {
+	delete(d, name)
+}
+
+// assign sets dst to value, leaving dst zero for nil
+func assign(dst reflect.Value, value any) error {
+	if value == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.Type().AssignableTo(dst.Type()) {
+		return fmt.Errorf("%w: cannot assign %s to %s", ErrUnsupportedFormat, rv.Type(), dst.Type())
+	}
+	dst.Set(rv)
+	return nil
+}
+
+// jsonDocument is an overlay state, keyed by JSON field names
+type jsonDocument map[string]json.RawMessage
+
+func (d jsonDocument) Field(name string, v any) (bool, error) {
+	raw, ok := d[jsonFieldName(name)]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (d jsonDocument) SetField(name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	d[jsonFieldName(name)] = b
+	return nil
+}
+
+func (d jsonDocument) DeleteField(name string) {
+	delete(d, jsonFieldName(name))
+}
+
+// jsonFieldName maps a Go field name of UniversalState to its JSON name: the
+// json tag of a current field, or the snake_case form the tags follow for
+// fields that no longer exist
+func jsonFieldName(name string) string {
+	if f, ok := reflect.TypeOf(types.UniversalState{}).FieldByName(name); ok {
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag != "" {
+			return tag
+		}
+	}
+
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -1,10 +1,11 @@
 package checkpoint
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"eino_testing/hitl/pkg/types"
 )
@@ -13,208 +14,160 @@ const (
 	overlaySuffix = ".confirm.json"
 )
 
-// SavePendingState saves the pending state as an overlay
-func SavePendingState(baseDir, checkpointID string, s *types.UniversalState) error {
-	path := filepath.Join(baseDir, checkpointID+overlaySuffix)
-	b, err := json.MarshalIndent(s, "", "  ")
+// ErrPendingStateNotFound is returned when a checkpoint has no overlay
+var ErrPendingStateNotFound = errors.New("pending state overlay not found")
+
+// SavePendingState saves the pending state as an overlay, stamped with the
+// current schema version. Custom states are saved whole, see
+// LoadPendingStateInto.
+func (s *Store) SavePendingState(ctx context.Context, checkpointID string, st types.State) error {
+	st.Universal().SchemaVersion = types.CurrentSchemaVersion
+	b, err := json.MarshalIndent(st, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal pending state: %w", err)
 	}
 
-	return atomicWriteFile(path, b)
+	return s.withLock(ctx, checkpointID, func() error {
+		if err := s.backend.Put(ctx, KindOverlay, checkpointID, b); err != nil {
+			return err
+		}
+		return s.patchMetadata(ctx, checkpointID, func(m *Metadata) { m.HasPendingState = true })
+	})
 }
 
 // LoadPendingState loads the pending state from an overlay
-func LoadPendingState(baseDir, checkpointID string) (*types.UniversalState, error) {
-	path := filepath.Join(baseDir, checkpointID+overlaySuffix)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, fmt.Errorf("pending state overlay not found")
+func (s *Store) LoadPendingState(ctx context.Context, checkpointID string) (*types.UniversalState, error) {
+	var st types.UniversalState
+	if err := s.LoadPendingStateInto(ctx, checkpointID, &st); err != nil {
+		return nil, err
 	}
+	return &st, nil
+}
 
-	b, err := os.ReadFile(path)
+// LoadPendingStateInto loads the pending state from an overlay into st, which
+// may be a custom state
+func (s *Store) LoadPendingStateInto(ctx context.Context, checkpointID string, st types.State) error {
+	b, ok, err := s.backend.Get(ctx, KindOverlay, checkpointID)
 	if err != nil {
-		return nil, fmt.Errorf("read pending state: %w", err)
+		return fmt.Errorf("read pending state: %w", err)
 	}
-
-	var s types.UniversalState
-	if err := json.Unmarshal(b, &s); err != nil {
-		return nil, fmt.Errorf("unmarshal pending state: %w", err)
+	if !ok {
+		return ErrPendingStateNotFound
 	}
-	return &s, nil
+	return decodePendingState(b, st)
 }
 
-// RemovePendingState removes the pending state overlay
-func RemovePendingState(baseDir, checkpointID string) error {
-	path := filepath.Join(baseDir, checkpointID+overlaySuffix)
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("remove pending state overlay: %w", err)
+// decodePendingState decodes an overlay into st, migrating it from the schema
+// version it was saved with
+func decodePendingState(b []byte, st types.State) error {
+	b, err := migrateOverlay(b)
+	if err != nil {
+		return fmt.Errorf("migrate pending state: %w", err)
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return fmt.Errorf("unmarshal pending state: %w", err)
 	}
 	return nil
 }
 
+// RemovePendingState removes the pending state overlay
+func (s *Store) RemovePendingState(ctx context.Context, checkpointID string) error {
+	return s.withLock(ctx, checkpointID, func() error {
+		if err := s.backend.Delete(ctx, KindOverlay, checkpointID); err != nil {
+			return fmt.Errorf("remove pending state overlay: %w", err)
+		}
+		return s.patchMetadata(ctx, checkpointID, func(m *Metadata) { m.HasPendingState = false })
+	})
+}
+
 // HasPendingState checks if a pending state overlay exists
-func HasPendingState(baseDir, checkpointID string) bool {
-	path := filepath.Join(baseDir, checkpointID+overlaySuffix)
-	_, err := os.Stat(path)
-	return err == nil
+func (s *Store) HasPendingState(ctx context.Context, checkpointID string) bool {
+	_, ok, err := s.backend.Get(ctx, KindOverlay, checkpointID)
+	return err == nil && ok
 }
 
 // UpdateCheckpointArguments updates the last tool call arguments in the checkpoint
-func UpdateCheckpointArguments(baseDir, checkpointID, newArgs string) error {
-	path := filepath.Join(baseDir, checkpointID+checkpointSuffix)
-
-	root, err := readCheckpointJSON(path)
-	if err != nil {
-		return err
-	}
-
-	if err := updateLastToolCallArguments(root, newArgs); err != nil {
-		return err
-	}
+//
+// Deprecated: with several pending tool calls only the last is updated; use
+// ApplyToolDecisions, which addresses calls by ID
+func (s *Store) UpdateCheckpointArguments(ctx context.Context, checkpointID, newArgs string) error {
+	return s.UpdateCheckpointArgumentsAt(ctx, checkpointID, newArgs, AnyRevision)
+}
 
-	b, err := json.MarshalIndent(root, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal checkpoint json: %w", err)
-	}
+// UpdateCheckpointArgumentsAt updates the last tool call arguments if the
+// checkpoint is still at the expected revision, returning ErrConflict otherwise
+//
+// Deprecated: use ApplyToolDecisions
+func (s *Store) UpdateCheckpointArgumentsAt(ctx context.Context, checkpointID, newArgs string, expected int) error {
+	return s.EditCheckpointAt(ctx, checkpointID, expected, func(cp *Checkpoint) error {
+		tc, err := cp.LastToolCall()
+		if err != nil {
+			return err
+		}
+		tc.Function.Arguments = newArgs
+		return nil
+	})
+}
 
-	return atomicWriteFile(path, b)
+// ApplyToolDecisions applies per-call decisions to the pending tool calls of
+// the checkpoint if it is still at the expected revision (AnyRevision skips
+// the check), returning ErrConflict otherwise. See
+// types.UniversalState.ApplyToolDecisions.
+func (s *Store) ApplyToolDecisions(ctx context.Context, checkpointID string, decisions []types.ToolDecision, expected int) error {
+	return s.EditCheckpointAt(ctx, checkpointID, expected, func(cp *Checkpoint) error {
+		return cp.ApplyToolDecisions(decisions)
+	})
 }
 
-// atomicWriteFile writes data to a file atomically
-func atomicWriteFile(path string, data []byte) error {
-	temp := path + ".tmp"
-	if err := os.WriteFile(temp, data, 0644); err != nil {
-		return fmt.Errorf("write temp file: %w", err)
-	}
-	if err := os.Rename(temp, path); err != nil {
-		_ = os.Remove(temp)
-		return fmt.Errorf("rename temp file: %w", err)
-	}
-	return nil
+// SavePendingState saves the pending state as an overlay under baseDir
+func SavePendingState(baseDir, checkpointID string, s types.State) error {
+	return fileStore(baseDir).SavePendingState(context.Background(), checkpointID, s)
 }
 
-// readCheckpointJSON reads and parses a checkpoint JSON file
-func readCheckpointJSON(path string) (map[string]any, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read checkpoint file: %w", err)
-	}
+// LoadPendingState loads the pending state from an overlay under baseDir
+func LoadPendingState(baseDir, checkpointID string) (*types.UniversalState, error) {
+	return fileStore(baseDir).LoadPendingState(context.Background(), checkpointID)
+}
 
-	var root map[string]any
-	if err := json.Unmarshal(b, &root); err != nil {
-		return nil, fmt.Errorf("unmarshal checkpoint json: %w", err)
-	}
-	return root, nil
+// RemovePendingState removes the pending state overlay under baseDir
+func RemovePendingState(baseDir, checkpointID string) error {
+	return fileStore(baseDir).RemovePendingState(context.Background(), checkpointID)
 }
 
-// updateLastToolCallArguments updates the arguments of the last tool call in the checkpoint
-func updateLastToolCallArguments(root map[string]any, newArgs string) error {
-	getMap := func(m map[string]any, key string) (map[string]any, error) {
-		v, ok := m[key]
-		if !ok {
-			return nil, fmt.Errorf("invalid checkpoint format: %s missing", key)
-		}
-		mm, ok := v.(map[string]any)
-		if !ok {
-			return nil, fmt.Errorf("invalid checkpoint format: %s is not an object", key)
-		}
-		return mm, nil
-	}
+// HasPendingState checks if a pending state overlay exists under baseDir
+func HasPendingState(baseDir, checkpointID string) bool {
+	return fileStore(baseDir).HasPendingState(context.Background(), checkpointID)
+}
 
-	getSlice := func(m map[string]any, key string) ([]any, error) {
-		v, ok := m[key]
-		if !ok {
-			return nil, fmt.Errorf("invalid checkpoint format: %s missing", key)
-		}
-		s, ok := v.([]any)
-		if !ok {
-			return nil, fmt.Errorf("invalid checkpoint format: %s is not a slice", key)
-		}
-		return s, nil
-	}
+// UpdateCheckpointArguments updates the last tool call arguments in the checkpoint under baseDir
+//
+// Deprecated: use Store.ApplyToolDecisions
+func UpdateCheckpointArguments(baseDir, checkpointID, newArgs string) error {
+	return fileStore(baseDir).UpdateCheckpointArguments(context.Background(), checkpointID, newArgs)
+}
 
-	mv, err := getMap(root, "MapValues")
+// atomicWriteFile writes data to a file atomically
+func atomicWriteFile(path string, data []byte) error {
+	temp := path + ".tmp"
+	f, err := os.OpenFile(temp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
-		return err
+		return fmt.Errorf("write temp file: %w", err)
 	}
-	state, err := getMap(mv, "State")
-	if err != nil {
-		return err
+	// Sync before renaming so a crash cannot leave a renamed but empty file
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
 	}
-	sv, err := getMap(state, "MapValues")
-	if err != nil {
-		return err
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	mh, err := getMap(sv, "MessageHistory")
 	if err != nil {
-		return err
-	}
-
-	slice, err := getSlice(mh, "SliceValues")
-	if err != nil || len(slice) == 0 {
-		return fmt.Errorf("no messages in message history")
+		_ = os.Remove(temp)
+		return fmt.Errorf("write temp file: %w", err)
 	}
-
-	for i := len(slice) - 1; i >= 0; i-- {
-		if updateToolCallInMessage(slice[i], newArgs) {
-			return nil
-		}
+	if err := os.Rename(temp, path); err != nil {
+		_ = os.Remove(temp)
+		return fmt.Errorf("rename temp file: %w", err)
 	}
-
-	return fmt.Errorf("no tool call found to update")
+	return nil
 }
-
-// updateToolCallInMessage updates tool call arguments in a message
-func updateToolCallInMessage(msg any, newArgs string) bool {
-	msgMap, ok := msg.(map[string]any)
-	if !ok {
-		return false
-	}
-
-	mapvals, ok := msgMap["MapValues"].(map[string]any)
-	if !ok {
-		return false
-	}
-
-	toolCalls, ok := mapvals["ToolCalls"].(map[string]any)
-	if !ok {
-		return false
-	}
-
-	sv2, ok := toolCalls["SliceValues"].([]any)
-	if !ok || len(sv2) == 0 {
-		return false
-	}
-
-	for j := len(sv2) - 1; j >= 0; j-- {
-		first, ok := sv2[j].(map[string]any)
-		if !ok {
-			continue
-		}
-
-		fmap, ok := first["MapValues"].(map[string]any)
-		if !ok {
-			continue
-		}
-
-		function, ok := fmap["Function"].(map[string]any)
-		if !ok {
-			continue
-		}
-
-		fmap2, ok := function["MapValues"].(map[string]any)
-		if !ok {
-			continue
-		}
-
-		arguments, ok := fmap2["Arguments"].(map[string]any)
-		if !ok {
-			continue
-		}
-
-		arguments["JSONValue"] = newArgs
-		return true
-	}
-
-	return false
-}
\ No newline at end of file
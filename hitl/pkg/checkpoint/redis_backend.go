@@ -0,0 +1,185 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisAddr   = "localhost:6379"
+	defaultRedisPrefix = "hitl:"
+)
+
+// RedisOptions configures a RedisBackend
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	// Prefix is prepended to every key so several deployments can share a server
+	Prefix string
+}
+
+// RedisBackend stores blobs in any server speaking the Redis protocol.
+// Each blob lives under <prefix><kind>:<id>, and a sorted set per kind
+// (<prefix>index:<kind>, scored by update time) backs List. Checkpoint locks
+// are held under <prefix>lock:<id>.
+type RedisBackend struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisBackend connects to the Redis server described by opts
+func NewRedisBackend(opts RedisOptions) (*RedisBackend, error) {
+	if opts.Addr == "" {
+		opts.Addr = defaultRedisAddr
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Password: opts.Password,
+		DB:       opts.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("connect redis %s: %w", opts.Addr, err)
+	}
+
+	return NewRedisBackendWithClient(client, opts.Prefix), nil
+}
+
+// NewRedisBackendWithClient wraps an existing client
+func NewRedisBackendWithClient(client redis.UniversalClient, prefix string) *RedisBackend {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &RedisBackend{client: client, prefix: prefix}
+}
+
+// Get reads a blob from Redis
+func (b *RedisBackend) Get(ctx context.Context, kind Kind, id string) ([]byte, bool, error) {
+	data, err := b.client.Get(ctx, b.key(kind, id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get %s: %w", kind, err)
+	}
+	return data, true, nil
+}
+
+// Put writes a blob and records it in the kind index
+func (b *RedisBackend) Put(ctx context.Context, kind Kind, id string, data []byte) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, b.key(kind, id), data, 0)
+		pipe.ZAdd(ctx, b.indexKey(kind), redis.Z{Score: float64(time.Now().UnixNano()), Member: id})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("save %s: %w", kind, err)
+	}
+	return nil
+}
+
+// Delete removes a blob and its index entry
+func (b *RedisBackend) Delete(ctx context.Context, kind Kind, id string) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, b.key(kind, id))
+		pipe.ZRem(ctx, b.indexKey(kind), id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", kind, err)
+	}
+	return nil
+}
+
+// List lists all blobs of the given kind
+func (b *RedisBackend) List(ctx context.Context, kind Kind) ([]CheckpointSummary, error) {
+	members, err := b.client.ZRangeWithScores(ctx, b.indexKey(kind), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", kind, err)
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	pipe := b.client.Pipeline()
+	sizes := make([]*redis.IntCmd, len(members))
+	for i, m := range members {
+		sizes[i] = pipe.StrLen(ctx, b.key(kind, m.Member.(string)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("list %s sizes: %w", kind, err)
+	}
+
+	summaries := make([]CheckpointSummary, 0, len(members))
+	for i, m := range members {
+		summaries = append(summaries, CheckpointSummary{
+			ID:        m.Member.(string),
+			CreatedAt: time.Unix(0, int64(m.Score)),
+			Size:      sizes[i].Val(),
+		})
+	}
+	// The index is ordered by update time
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries, nil
+}
+
+// unlockScript deletes a lock only if it still holds the caller's token
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Lock takes <prefix>lock:<id> with SET NX, so every process sharing the
+// server serializes its writes to the checkpoint. It waits until the lock is
+// free or ctx is done. The lock expires after lockLease if its holder dies.
+func (b *RedisBackend) Lock(ctx context.Context, checkpointID string) (func(), error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	key := b.prefix + "lock:" + checkpointID
+
+	for {
+		ok, err := b.client.SetNX(ctx, key, token, lockLease).Result()
+		if err != nil {
+			return nil, fmt.Errorf("lock: %w", err)
+		}
+		if ok {
+			break
+		}
+		if err := waitLock(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		// Released even when the writer's context was cancelled
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		unlockScript.Run(ctx, b.client, []string{key}, token)
+	}, nil
+}
+
+// Close closes the Redis client
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
+
+func (b *RedisBackend) key(kind Kind, id string) string {
+	return b.prefix + string(kind) + ":" + id
+}
+
+func (b *RedisBackend) indexKey(kind Kind) string {
+	return b.prefix + "index:" + string(kind)
+}
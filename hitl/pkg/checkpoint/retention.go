@@ -0,0 +1,319 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultTempFileAge = 10 * time.Minute
+
+// RetentionPolicy controls which checkpoints Sweep removes. Zero values
+// disable the corresponding limit.
+type RetentionPolicy struct {
+	// MaxAge removes checkpoints not updated for longer than this
+	MaxAge time.Duration `json:"max_age"`
+	// MaxCount keeps at most this many checkpoints, removing the oldest first
+	MaxCount int `json:"max_count"`
+	// MaxTotalBytes caps the space used by checkpoints, their overlays and
+	// revisions, removing the oldest first
+	MaxTotalBytes int64 `json:"max_total_bytes"`
+	// MaxRevisions keeps at most this many revisions of each checkpoint,
+	// removing the oldest first; the current revision is always kept
+	MaxRevisions int `json:"max_revisions"`
+	// KeepInterrupted never removes checkpoints still waiting for a human
+	KeepInterrupted bool `json:"keep_interrupted"`
+	// TempFileAge is how old a leftover .tmp file must be before it is
+	// removed; defaults to 10 minutes so in-flight writes are not touched
+	TempFileAge time.Duration `json:"temp_file_age"`
+
+	// IsInterrupted reports whether a checkpoint is waiting for a human.
+	// When nil, a checkpoint is interrupted if it has a pending overlay.
+	IsInterrupted func(ctx context.Context, checkpointID string) bool `json:"-"`
+}
+
+// SweepReport lists what a sweep removed, or would remove on a dry run
+type SweepReport struct {
+	DryRun          bool      `json:"dry_run"`
+	StartedAt       time.Time `json:"started_at"`
+	Checkpoints     []string  `json:"checkpoints"`
+	PrunedRevisions []string  `json:"pruned_revisions"`
+	OrphanOverlays  []string  `json:"orphan_overlays"`
+	OrphanHistories []string  `json:"orphan_histories"`
+	OrphanRevisions []string  `json:"orphan_revisions"`
+	OrphanMetadata  []string  `json:"orphan_metadata"`
+	OrphanLocks     []string  `json:"orphan_locks"`
+	TempFiles       []string  `json:"temp_files"`
+	KeptInterrupted []string  `json:"kept_interrupted"`
+	FreedBytes      int64     `json:"freed_bytes"`
+}
+
+// tempFileCleaner is implemented by backends that can leave partially written
+// temporary files behind
+type tempFileCleaner interface {
+	CleanTempFiles(ctx context.Context, olderThan time.Duration, dryRun bool) ([]string, error)
+}
+
+// SetRetentionPolicy sets the policy used by Sweep
+func (s *Store) SetRetentionPolicy(p RetentionPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = p
+}
+
+// RetentionPolicy returns the policy used by Sweep
+func (s *Store) RetentionPolicy() RetentionPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retention
+}
+
+// Sweep applies the retention policy. With dryRun set nothing is deleted and
+// the report lists what would have been.
+func (s *Store) Sweep(ctx context.Context, dryRun bool) (*SweepReport, error) {
+	policy := s.RetentionPolicy()
+	report := &SweepReport{DryRun: dryRun, StartedAt: time.Now()}
+
+	checkpoints, err := s.backend.List(ctx, KindCheckpoint)
+	if err != nil {
+		return nil, fmt.Errorf("list checkpoints: %w", err)
+	}
+	overlays, err := s.backend.List(ctx, KindOverlay)
+	if err != nil {
+		return nil, fmt.Errorf("list overlays: %w", err)
+	}
+
+	// Footprint of every checkpoint, including overlay and revisions
+	exists := make(map[string]bool, len(checkpoints))
+	for _, cp := range checkpoints {
+		exists[cp.ID] = true
+	}
+	overlaySize := make(map[string]int64, len(overlays))
+	for _, o := range overlays {
+		overlaySize[o.ID] = o.Size
+	}
+
+	type candidate struct {
+		CheckpointSummary
+		footprint int64
+	}
+	var (
+		candidates []candidate
+		total      int64
+	)
+	for _, cp := range checkpoints {
+		footprint := cp.Size + overlaySize[cp.ID]
+		revs, err := s.ListRevisions(ctx, cp.ID)
+		if err != nil {
+			return nil, err
+		}
+		if policy.MaxRevisions > 0 && len(revs) > policy.MaxRevisions {
+			if revs, err = s.pruneRevisions(ctx, cp.ID, policy.MaxRevisions, dryRun, report); err != nil {
+				return report, fmt.Errorf("prune revisions of %s: %w", cp.ID, err)
+			}
+		}
+		for _, rev := range revs {
+			footprint += rev.Size
+		}
+		total += footprint
+		candidates = append(candidates, candidate{CheckpointSummary: cp, footprint: footprint})
+	}
+
+	// Oldest first
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.Before(candidates[j].CreatedAt)
+	})
+
+	remaining := len(candidates)
+	for _, c := range candidates {
+		expired := policy.MaxAge > 0 && report.StartedAt.Sub(c.CreatedAt) > policy.MaxAge
+		overCount := policy.MaxCount > 0 && remaining > policy.MaxCount
+		overBytes := policy.MaxTotalBytes > 0 && total > policy.MaxTotalBytes
+		if !expired && !overCount && !overBytes {
+			continue
+		}
+
+		if policy.KeepInterrupted && s.isInterrupted(ctx, policy, c.ID) {
+			report.KeptInterrupted = append(report.KeptInterrupted, c.ID)
+			continue
+		}
+
+		if !dryRun {
+			if err := s.Delete(ctx, c.ID); err != nil {
+				return report, fmt.Errorf("delete checkpoint %s: %w", c.ID, err)
+			}
+		}
+		report.Checkpoints = append(report.Checkpoints, c.ID)
+		report.FreedBytes += c.footprint
+		remaining--
+		total -= c.footprint
+	}
+
+	if err := s.sweepOrphans(ctx, exists, dryRun, report); err != nil {
+		return report, err
+	}
+
+	if cleaner, ok := unwrapBackend(s.backend).(tempFileCleaner); ok {
+		age := policy.TempFileAge
+		if age <= 0 {
+			age = defaultTempFileAge
+		}
+		files, err := cleaner.CleanTempFiles(ctx, age, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("clean temp files: %w", err)
+		}
+		report.TempFiles = files
+	}
+
+	return report, nil
+}
+
+// StartSweeper runs Sweep every interval until the returned stop function is called
+func (s *Store) StartSweeper(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := s.Sweep(ctx, false)
+				if err != nil {
+					log.Printf("[Sweeper] Sweep failed: %v", err)
+					continue
+				}
+				orphans := len(report.OrphanOverlays) + len(report.OrphanHistories) + len(report.OrphanRevisions) + len(report.OrphanMetadata) + len(report.OrphanLocks)
+				if n := len(report.Checkpoints) + len(report.PrunedRevisions) + orphans + len(report.TempFiles); n > 0 {
+					log.Printf("[Sweeper] Removed %d checkpoints, %d old revisions, %d orphan blobs, %d temp files (%d bytes)",
+						len(report.Checkpoints), len(report.PrunedRevisions), orphans, len(report.TempFiles), report.FreedBytes)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// isInterrupted applies the policy's interrupted check
+func (s *Store) isInterrupted(ctx context.Context, policy RetentionPolicy, checkpointID string) bool {
+	if policy.IsInterrupted != nil {
+		return policy.IsInterrupted(ctx, checkpointID)
+	}
+	return s.HasPendingState(ctx, checkpointID)
+}
+
+// orphanKinds are the kinds of blob kept for a checkpoint that sweepOrphans
+// removes once the checkpoint is gone, in the order they are removed.
+// Execution records are left to their runner: an execution saves its record
+// before its first checkpoint.
+var orphanKinds = []Kind{KindOverlay, KindRevision, KindHistory, KindMeta}
+
+// sweepOrphans removes the blobs and lock files of checkpoints that do not
+// exist. Each checkpoint is checked again under its lock, since commit writes
+// the revision and history of a new checkpoint before the checkpoint itself.
+func (s *Store) sweepOrphans(ctx context.Context, exists map[string]bool, dryRun bool, report *SweepReport) error {
+	orphans := make(map[string]map[Kind][]CheckpointSummary)
+	for _, kind := range orphanKinds {
+		blobs, err := s.backend.List(ctx, kind)
+		if err != nil {
+			return fmt.Errorf("list %s: %w", kind, err)
+		}
+		for _, b := range blobs {
+			id := b.ID
+			if kind == KindRevision {
+				id = revisionCheckpointID(b.ID)
+			}
+			if exists[id] {
+				continue
+			}
+			if orphans[id] == nil {
+				orphans[id] = make(map[Kind][]CheckpointSummary)
+			}
+			orphans[id][kind] = append(orphans[id][kind], b)
+		}
+	}
+
+	// Taking the lock of an orphan creates its lock file, so the file is
+	// removed even on a dry run unless it was there before
+	locked := make(map[string]bool)
+	if remover, ok := unwrapBackend(s.backend).(lockRemover); ok {
+		lockIDs, err := remover.LockIDs(ctx)
+		if err != nil {
+			return fmt.Errorf("list locks: %w", err)
+		}
+		for _, id := range lockIDs {
+			if exists[id] {
+				continue
+			}
+			locked[id] = true
+			if orphans[id] == nil {
+				orphans[id] = make(map[Kind][]CheckpointSummary)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(orphans))
+	for id := range orphans {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		err := s.withLock(ctx, id, func() error {
+			if _, ok, err := s.backend.Get(ctx, KindCheckpoint, id); err != nil || ok {
+				return err
+			}
+			for _, kind := range orphanKinds {
+				for _, b := range orphans[id][kind] {
+					if !dryRun {
+						if err := s.backend.Delete(ctx, kind, b.ID); err != nil {
+							return fmt.Errorf("delete %s: %w", kind, err)
+						}
+					}
+					report.FreedBytes += b.Size
+					switch kind {
+					case KindOverlay:
+						report.OrphanOverlays = append(report.OrphanOverlays, b.ID)
+					case KindRevision:
+						report.OrphanRevisions = append(report.OrphanRevisions, b.ID)
+					case KindHistory:
+						report.OrphanHistories = append(report.OrphanHistories, b.ID)
+					case KindMeta:
+						report.OrphanMetadata = append(report.OrphanMetadata, b.ID)
+					}
+				}
+			}
+			if locked[id] {
+				report.OrphanLocks = append(report.OrphanLocks, id)
+			}
+			if !dryRun || !locked[id] {
+				return s.removeLock(ctx, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("sweep orphans of %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// revisionCheckpointID is the checkpoint ID of a revision blob ID
+func revisionCheckpointID(id string) string {
+	if i := strings.LastIndexByte(id, '@'); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
@@ -0,0 +1,255 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ageCheckpoint makes the checkpoint file of id look last written age ago
+func ageCheckpoint(t *testing.T, s *Store, id string, age time.Duration) {
+	t.Helper()
+	when := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(s.GetBaseDir(), id+checkpointSuffix), when, when); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepRetention(t *testing.T) {
+	ctx := context.Background()
+	data := testCheckpoint(t)
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		// pending checkpoints have an overlay
+		pending []string
+		removed []string
+		kept    []string
+	}{
+		{
+			name:    "max age",
+			policy:  RetentionPolicy{MaxAge: 90 * time.Minute},
+			removed: []string{"a", "b"},
+		},
+		{
+			name:    "max count removes the oldest",
+			policy:  RetentionPolicy{MaxCount: 1},
+			removed: []string{"a", "b"},
+		},
+		{
+			name:    "max bytes removes the oldest",
+			policy:  RetentionPolicy{MaxTotalBytes: int64(len(data)) * 3},
+			removed: []string{"a", "b"},
+		},
+		{
+			// a still counts, so both others go
+			name:    "keep interrupted",
+			policy:  RetentionPolicy{MaxCount: 1, KeepInterrupted: true},
+			pending: []string{"a"},
+			removed: []string{"b", "c"},
+			kept:    []string{"a"},
+		},
+		{
+			name:   "no limits",
+			policy: RetentionPolicy{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			// a is 3h old, b 2h and c 1h; each has two revisions
+			for i, id := range []string{"a", "b", "c"} {
+				s.Set(ctx, id, data)
+				s.Set(ctx, id, data)
+				ageCheckpoint(t, s, id, time.Duration(3-i)*time.Hour)
+			}
+			for _, id := range tt.pending {
+				if err := s.backend.Put(ctx, KindOverlay, id, []byte(`{}`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.SetRetentionPolicy(tt.policy)
+
+			for _, dryRun := range []bool{true, false} {
+				report, err := s.Sweep(ctx, dryRun)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(report.Checkpoints) != fmt.Sprint(tt.removed) || fmt.Sprint(report.KeptInterrupted) != fmt.Sprint(tt.kept) {
+					t.Fatalf("dry run %v: removed %v and kept %v, want %v and %v",
+						dryRun, report.Checkpoints, report.KeptInterrupted, tt.removed, tt.kept)
+				}
+				if len(report.OrphanOverlays)+len(report.OrphanRevisions)+len(report.OrphanHistories)+len(report.OrphanMetadata) != 0 {
+					t.Fatalf("dry run %v: reported orphans of removed checkpoints: %+v", dryRun, report)
+				}
+
+				list, _ := s.List(ctx)
+				want := 3
+				if !dryRun {
+					want -= len(tt.removed)
+				}
+				if len(list) != want {
+					t.Fatalf("dry run %v: %d checkpoints left, want %d", dryRun, len(list), want)
+				}
+			}
+			for _, id := range tt.removed {
+				if revs, _ := s.ListRevisions(ctx, id); len(revs) != 0 {
+					t.Errorf("revisions of %s left: %v", id, revs)
+				}
+			}
+		})
+	}
+}
+
+func TestSweepMaxRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	data := testCheckpoint(t)
+	for i := 0; i < 4; i++ {
+		if err := s.Set(ctx, "a", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Set(ctx, "b", data)
+	s.SetRetentionPolicy(RetentionPolicy{MaxRevisions: 2})
+
+	// Only the oldest revisions go, and checkpoints with few are untouched
+	for _, dryRun := range []bool{true, false} {
+		report, err := s.Sweep(ctx, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(report.PrunedRevisions) != "[a@1 a@2]" || len(report.Checkpoints) != 0 {
+			t.Fatalf("dry run %v: report %+v, want a@1 and a@2 pruned", dryRun, report)
+		}
+		if report.FreedBytes != 2*int64(len(data)) {
+			t.Fatalf("dry run %v: freed %d bytes", dryRun, report.FreedBytes)
+		}
+	}
+
+	revs, err := s.ListRevisions(ctx, "a")
+	if err != nil || len(revs) != 2 || revs[0].Number != 3 || revs[1].Number != 4 {
+		t.Fatalf("revisions = %+v, %v, want 3 and 4", revs, err)
+	}
+	if _, err := s.GetRevision(ctx, "a", 2); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("GetRevision(2) = %v, want ErrRevisionNotFound", err)
+	}
+	if report, err := s.Verify(ctx, VerifyModeReport); err != nil || !report.OK() {
+		t.Fatalf("Verify = %+v, %v", report, err)
+	}
+
+	// Numbering continues after the pruned revisions
+	if err := s.Set(ctx, "a", data); err != nil {
+		t.Fatal(err)
+	}
+	if revs, _ := s.ListRevisions(ctx, "a"); revs[len(revs)-1].Number != 5 {
+		t.Fatalf("next revision = %d, want 5", revs[len(revs)-1].Number)
+	}
+	if report, _ := s.Sweep(ctx, false); fmt.Sprint(report.PrunedRevisions) != "[a@3]" {
+		t.Fatalf("second sweep pruned %v, want a@3", report.PrunedRevisions)
+	}
+}
+
+func TestSweepOrphans(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	s.Set(ctx, "live", testCheckpoint(t))
+
+	// The blobs of a checkpoint removed behind the store's back
+	for kind, id := range map[Kind]string{
+		KindOverlay:   "gone",
+		KindRevision:  "gone@1",
+		KindHistory:   "gone",
+		KindMeta:      "gone",
+		KindExecution: "gone",
+	} {
+		if err := s.backend.Put(ctx, kind, id, []byte(`[]`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		report, err := s.Sweep(ctx, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(report.OrphanOverlays, report.OrphanRevisions, report.OrphanHistories, report.OrphanMetadata) != "[gone] [gone@1] [gone] [gone]" {
+			t.Fatalf("dry run %v: report %+v, want every orphan of gone", dryRun, report)
+		}
+		if report.FreedBytes != 4*int64(len(`[]`)) {
+			t.Fatalf("dry run %v: freed %d bytes", dryRun, report.FreedBytes)
+		}
+	}
+
+	for _, kind := range orphanKinds {
+		list, _ := s.backend.List(ctx, kind)
+		for _, b := range list {
+			if b.ID != "live" && b.ID != "live@1" {
+				t.Errorf("%s %s left", kind, b.ID)
+			}
+		}
+	}
+	// Execution records are not swept
+	if _, ok, _ := s.backend.Get(ctx, KindExecution, "gone"); !ok {
+		t.Error("execution record removed")
+	}
+}
+
+func TestSweepDoesNotRaceNewCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	data := testCheckpoint(t)
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := s.Sweep(ctx, false); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	var ids []string
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("cp-%d", i)
+		ids = append(ids, id)
+		if err := s.Set(ctx, id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	for _, id := range ids {
+		revs, err := s.ListRevisions(ctx, id)
+		if err != nil || len(revs) != 1 {
+			t.Fatalf("revisions of %s = %v, %v; want the one written", id, revs, err)
+		}
+		if _, err := s.GetRevision(ctx, id, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetMetadata(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list, _ := s.List(ctx); len(list) != len(ids) {
+		t.Fatalf("%d checkpoints, want %d", len(list), len(ids))
+	}
+}
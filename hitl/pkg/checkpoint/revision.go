@@ -0,0 +1,244 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// KindRevision holds the checkpoint blob of every numbered revision
+	KindRevision Kind = "revision"
+	// KindHistory holds the revision list of a checkpoint
+	KindHistory Kind = "history"
+)
+
+// ErrRevisionNotFound is returned when a checkpoint has no such revision
+var ErrRevisionNotFound = errors.New("checkpoint revision not found")
+
+// Revision describes one saved version of a checkpoint
+type Revision struct {
+	Number  int       `json:"number"`
+	SavedAt time.Time `json:"saved_at"`
+	// Node is the node(s) the graph was interrupted before when the revision was saved
+	Node string `json:"node"`
+	Size int64  `json:"size"`
+	// Checksum is the sha256 of the checkpoint data, checked by Verify
+	Checksum string `json:"checksum,omitempty"`
+	// Source records where the revision came from when it was not written by
+	// the graph, e.g. "fork:<id>@<rev>" or "rollback:<rev>"
+	Source string `json:"source,omitempty"`
+}
+
+// ListRevisions returns the revisions of a checkpoint, oldest first
+func (s *Store) ListRevisions(ctx context.Context, checkpointID string) ([]Revision, error) {
+	data, ok, err := s.backend.Get(ctx, KindHistory, checkpointID)
+	if err != nil {
+		return nil, fmt.Errorf("read revision history: %w", err)
+	}
+	if !ok {
+		return []Revision{}, nil
+	}
+
+	var revs []Revision
+	if err := json.Unmarshal(data, &revs); err != nil {
+		return nil, fmt.Errorf("unmarshal revision history: %w", err)
+	}
+	return revs, nil
+}
+
+// GetRevision loads the checkpoint blob saved as the given revision
+func (s *Store) GetRevision(ctx context.Context, checkpointID string, rev int) ([]byte, error) {
+	data, ok, err := s.backend.Get(ctx, KindRevision, revisionID(checkpointID, rev))
+	if err != nil {
+		return nil, fmt.Errorf("read revision: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s@%d", ErrRevisionNotFound, checkpointID, rev)
+	}
+	return data, nil
+}
+
+// Fork copies a revision into a new checkpoint ID so it can be resumed
+// independently of the original. The new checkpoint starts at revision 1.
+func (s *Store) Fork(ctx context.Context, checkpointID string, rev int, newID string) (*Revision, error) {
+	if newID == "" || newID == checkpointID {
+		return nil, fmt.Errorf("fork needs a new checkpoint ID")
+	}
+
+	data, err := s.GetRevision(ctx, checkpointID, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var forked *Revision
+	err = s.withLock(ctx, newID, func() error {
+		if _, ok, err := s.backend.Get(ctx, KindCheckpoint, newID); err != nil {
+			return fmt.Errorf("check fork target: %w", err)
+		} else if ok {
+			return fmt.Errorf("%w: %s", ErrCheckpointExists, newID)
+		}
+
+		forked, err = s.commit(ctx, newID, data, fmt.Sprintf("fork:%s", revisionID(checkpointID, rev)), AnyRevision)
+		return err
+	})
+	return forked, err
+}
+
+// Rollback makes an earlier revision the current checkpoint again. The
+// rollback is recorded as a new revision, so nothing is lost.
+func (s *Store) Rollback(ctx context.Context, checkpointID string, rev int) (*Revision, error) {
+	data, err := s.GetRevision(ctx, checkpointID, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored *Revision
+	err = s.withLock(ctx, checkpointID, func() error {
+		restored, err = s.commit(ctx, checkpointID, data, fmt.Sprintf("rollback:%d", rev), AnyRevision)
+		return err
+	})
+	return restored, err
+}
+
+// commit stores data as the next revision of a checkpoint and as its current
+// blob, failing with ErrConflict unless the checkpoint is at the expected
+// revision. Callers must hold the checkpoint lock.
+func (s *Store) commit(ctx context.Context, checkpointID string, data []byte, source string, expected int) (*Revision, error) {
+	revs, err := s.ListRevisions(ctx, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	head := 0
+	if len(revs) > 0 {
+		head = revs[len(revs)-1].Number
+	}
+	if expected != AnyRevision && expected != head {
+		return nil, fmt.Errorf("%w: %s is at revision %d, expected %d", ErrConflict, checkpointID, head, expected)
+	}
+
+	rev := Revision{
+		Number:   head + 1,
+		SavedAt:  time.Now(),
+		Node:     strings.Join(interruptedNodes(data), ","),
+		Size:     int64(len(data)),
+		Checksum: checksum(data),
+		Source:   source,
+	}
+
+	if err := s.backend.Put(ctx, KindRevision, revisionID(checkpointID, rev.Number), data); err != nil {
+		return nil, fmt.Errorf("save revision: %w", err)
+	}
+
+	history, err := json.Marshal(append(revs, rev))
+	if err != nil {
+		return nil, fmt.Errorf("marshal revision history: %w", err)
+	}
+	if err := s.backend.Put(ctx, KindHistory, checkpointID, history); err != nil {
+		return nil, fmt.Errorf("save revision history: %w", err)
+	}
+
+	if err := s.backend.Put(ctx, KindCheckpoint, checkpointID, data); err != nil {
+		return nil, err
+	}
+	if _, err := s.indexCheckpoint(ctx, checkpointID, data, rev.Number); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// deleteRevisions removes every revision and the history of a checkpoint
+func (s *Store) deleteRevisions(ctx context.Context, checkpointID string) error {
+	revs, err := s.ListRevisions(ctx, checkpointID)
+	if err != nil {
+		return err
+	}
+	for _, rev := range revs {
+		if err := s.backend.Delete(ctx, KindRevision, revisionID(checkpointID, rev.Number)); err != nil {
+			return fmt.Errorf("delete revision: %w", err)
+		}
+	}
+	if err := s.backend.Delete(ctx, KindHistory, checkpointID); err != nil {
+		return fmt.Errorf("delete revision history: %w", err)
+	}
+	return nil
+}
+
+// pruneRevisions removes all but the newest keep revisions of a checkpoint,
+// returning the revisions left. The history is rewritten before the blobs are
+// deleted, so an interrupted prune leaves unlisted blobs rather than listed
+// revisions that cannot be read.
+func (s *Store) pruneRevisions(ctx context.Context, checkpointID string, keep int, dryRun bool, report *SweepReport) ([]Revision, error) {
+	var kept []Revision
+	err := s.withLock(ctx, checkpointID, func() error {
+		revs, err := s.ListRevisions(ctx, checkpointID)
+		if err != nil {
+			return err
+		}
+		if len(revs) <= keep {
+			kept = revs
+			return nil
+		}
+		pruned := revs[:len(revs)-keep]
+		kept = revs[len(revs)-keep:]
+
+		if !dryRun {
+			history, err := json.Marshal(kept)
+			if err != nil {
+				return fmt.Errorf("marshal revision history: %w", err)
+			}
+			if err := s.backend.Put(ctx, KindHistory, checkpointID, history); err != nil {
+				return fmt.Errorf("save revision history: %w", err)
+			}
+		}
+		for _, rev := range pruned {
+			id := revisionID(checkpointID, rev.Number)
+			if !dryRun {
+				if err := s.backend.Delete(ctx, KindRevision, id); err != nil {
+					return fmt.Errorf("delete revision: %w", err)
+				}
+			}
+			report.PrunedRevisions = append(report.PrunedRevisions, id)
+			report.FreedBytes += rev.Size
+		}
+		return nil
+	})
+	return kept, err
+}
+
+// revisionID is the backend ID of a revision blob
+func revisionID(checkpointID string, rev int) string {
+	return fmt.Sprintf("%s@%d", checkpointID, rev)
+}
+
+// interruptedNodes reads the node keys a serialized compose checkpoint will
+// run next (its Inputs map), which are the nodes it was interrupted before.
+func interruptedNodes(data []byte) []string {
+	var root struct {
+		MapValues struct {
+			Inputs struct {
+				MapValues map[string]json.RawMessage
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil
+	}
+
+	var nodes []string
+	for key := range root.MapValues.Inputs.MapValues {
+		// map keys are stored JSON encoded
+		var node string
+		if err := json.Unmarshal([]byte(key), &node); err != nil {
+			node = key
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
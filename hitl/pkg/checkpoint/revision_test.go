@@ -0,0 +1,126 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSetRecordsRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	first := testCheckpoint(t)
+	second := editedCheckpoint(t, first, "second")
+
+	for _, data := range [][]byte{first, second} {
+		if err := s.Set(ctx, "cp", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	revs, err := s.ListRevisions(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 2 || revs[0].Number != 1 || revs[1].Number != 2 {
+		t.Fatalf("revisions = %+v, want 1 and 2", revs)
+	}
+	if revs[1].Node != "ToolsNode" || revs[1].Size != int64(len(second)) || revs[1].Checksum != checksum(second) {
+		t.Fatalf("revision 2 = %+v, want ToolsNode, the size and checksum of the second write", revs[1])
+	}
+	if rev, _ := s.Revision(ctx, "cp"); rev != 2 {
+		t.Fatalf("Revision = %d, want 2", rev)
+	}
+
+	data, err := s.GetRevision(ctx, "cp", 1)
+	if err != nil || !bytes.Equal(data, first) {
+		t.Fatalf("GetRevision(1) = %v, want the first write", err)
+	}
+	if _, err := s.GetRevision(ctx, "cp", 3); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("GetRevision(3) = %v, want ErrRevisionNotFound", err)
+	}
+	if revs, err := s.ListRevisions(ctx, "missing"); err != nil || len(revs) != 0 {
+		t.Fatalf("ListRevisions of a missing checkpoint = %v, %v", revs, err)
+	}
+}
+
+func TestFork(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	first := testCheckpoint(t)
+	s.Set(ctx, "cp", first)
+	s.Set(ctx, "cp", editedCheckpoint(t, first, "second"))
+
+	rev, err := s.Fork(ctx, "cp", 1, "fork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Number != 1 || rev.Source != "fork:cp@1" {
+		t.Fatalf("fork revision = %+v, want revision 1 from cp@1", rev)
+	}
+	cp, err := s.LoadCheckpoint(ctx, "fork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cp.State.Context["edit"]; ok || cp.Revision() != 1 {
+		t.Fatalf("fork is at revision %d with context %v, want revision 1 of cp", cp.Revision(), cp.State.Context)
+	}
+	// The original is untouched
+	if r, _ := s.Revision(ctx, "cp"); r != 2 {
+		t.Fatalf("cp is at revision %d, want 2", r)
+	}
+
+	if _, err := s.Fork(ctx, "cp", 2, "fork"); !errors.Is(err, ErrCheckpointExists) {
+		t.Fatalf("fork onto an existing checkpoint = %v, want ErrCheckpointExists", err)
+	}
+	if _, err := s.Fork(ctx, "cp", 1, "cp"); err == nil {
+		t.Fatal("fork onto itself succeeded")
+	}
+	if _, err := s.Fork(ctx, "cp", 9, "other"); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("fork of a missing revision = %v, want ErrRevisionNotFound", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	first := testCheckpoint(t)
+	s.Set(ctx, "cp", first)
+	s.Set(ctx, "cp", editedCheckpoint(t, first, "second"))
+
+	rev, err := s.Rollback(ctx, "cp", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Number != 3 || rev.Source != "rollback:1" {
+		t.Fatalf("rollback revision = %+v, want revision 3 from rollback:1", rev)
+	}
+	data, _, _ := s.Backend().Get(ctx, KindCheckpoint, "cp")
+	if !bytes.Equal(data, first) {
+		t.Fatal("checkpoint is not the data of revision 1")
+	}
+	// Nothing is lost: revision 2 can still be restored
+	if _, err := s.GetRevision(ctx, "cp", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Rollback(ctx, "cp", 7); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("rollback to a missing revision = %v, want ErrRevisionNotFound", err)
+	}
+}
+
+func TestDeleteRemovesRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	s.Set(ctx, "cp", testCheckpoint(t))
+	s.Set(ctx, "cp", testCheckpoint(t))
+
+	if err := s.Delete(ctx, "cp"); err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []Kind{KindCheckpoint, KindRevision, KindHistory, KindMeta} {
+		if list, _ := s.Backend().List(ctx, kind); len(list) != 0 {
+			t.Errorf("%s left after Delete: %+v", kind, list)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/eino/compose"
+)
+
+// ErrUnsupportedFormat is returned when checkpoint data does not look like
+// the layout written by compose's default serializer
+var ErrUnsupportedFormat = errors.New("unsupported checkpoint format")
+
+// serialValue is the part of compose's checkpoint format the store reads:
+// every value carries its registered type name, structs and maps are stored
+// in MapValues (struct fields by Go name), slices in SliceValues and
+// everything else as plain JSON. The store only walks this tree to find the
+// state and the fields migrations rewrite; values are encoded and decoded by
+// compose itself (see encodeValue), so a new eino version can only change
+// the layout described here. TestEinoFormat checks it against a checkpoint
+// saved by the pinned eino version.
+type serialValue struct {
+	Type        *serialType             `json:",omitempty"`
+	JSONValue   json.RawMessage         `json:",omitempty"`
+	MapValues   map[string]*serialValue `json:",omitempty"`
+	SliceValues []*serialValue          `json:",omitempty"`
+}
+
+type serialType struct {
+	PointerNum     uint32      `json:",omitempty"`
+	SimpleType     string      `json:",omitempty"`
+	StructType     string      `json:",omitempty"`
+	MapKeyType     *serialType `json:",omitempty"`
+	MapValueType   *serialType `json:",omitempty"`
+	SliceValueType *serialType `json:",omitempty"`
+}
+
+// RegisterSerializableType registers T with compose, so values of T stored
+// in state survive checkpoints and can be decoded and edited
+func RegisterSerializableType[T any](name string) error {
+	return compose.RegisterSerializableType[T](name)
+}
+
+// encodeValue converts v to compose's serialized form
+func encodeValue(v any) (*serialValue, error) {
+	if v == nil {
+		return nil, nil
+	}
+	c, err := valueCodec()
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.checkpoint(v)
+	if err != nil {
+		return nil, err
+	}
+	return root.MapValues["State"], nil
+}
+
+// decodeValue converts compose's serialized form back to a Go value
+func decodeValue(sv *serialValue) (any, error) {
+	if sv == nil {
+		return nil, nil
+	}
+	if sv.Type == nil {
+		return nil, fmt.Errorf("%w: value without type", ErrUnsupportedFormat)
+	}
+	c, err := valueCodec()
+	if err != nil {
+		return nil, err
+	}
+	return c.state(sv)
+}
+
+// errDecoded stops the codec graph once its state is decoded
+var errDecoded = errors.New("decoded")
+
+// codecState carries the value to encode to the codec graph's state
+type codecState struct{}
+
+// stateCodec encodes and decodes values with compose's own serializer: a
+// value is encoded by interrupting a one-node graph running with it as its
+// state, and decoded by resuming that graph from a checkpoint holding it
+type stateCodec struct {
+	runner compose.Runnable[string, string]
+	store  sync.Map // checkpoint ID → []byte
+	next   atomic.Int64
+	// blank is a checkpoint of the graph, its state replaced to decode
+	blank *serialValue
+}
+
+var valueCodec = sync.OnceValues(func() (*stateCodec, error) {
+	ctx := context.Background()
+	c := &stateCodec{}
+
+	g := compose.NewGraph[string, string](compose.WithGenLocalState(func(ctx context.Context) any {
+		return ctx.Value(codecState{})
+	}))
+	err := g.AddLambdaNode("value", compose.InvokableLambda(func(_ context.Context, in string) (string, error) {
+		return in, nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if err := g.AddEdge(compose.START, "value"); err != nil {
+		return nil, err
+	}
+	if err := g.AddEdge("value", compose.END); err != nil {
+		return nil, err
+	}
+	c.runner, err = g.Compile(ctx,
+		compose.WithGraphName("checkpoint_codec"),
+		compose.WithCheckPointStore(c),
+		compose.WithInterruptBeforeNodes([]string{"value"}))
+	if err != nil {
+		return nil, fmt.Errorf("compile checkpoint codec: %w", err)
+	}
+
+	if c.blank, err = c.checkpoint(0); err != nil {
+		return nil, err
+	}
+	return c, nil
+})
+
+func (c *stateCodec) Get(_ context.Context, id string) ([]byte, bool, error) {
+	data, ok := c.store.Load(id)
+	if !ok {
+		return nil, false, nil
+	}
+	return data.([]byte), true, nil
+}
+
+func (c *stateCodec) Set(_ context.Context, id string, data []byte) error {
+	c.store.Store(id, data)
+	return nil
+}
+
+// checkpoint returns the root of a checkpoint of the graph with state v
+func (c *stateCodec) checkpoint(v any) (*serialValue, error) {
+	id := strconv.FormatInt(c.next.Add(1), 10)
+	defer c.store.Delete(id)
+
+	ctx := context.WithValue(context.Background(), codecState{}, v)
+	_, err := c.runner.Invoke(ctx, "", compose.WithCheckPointID(id))
+	if _, ok := compose.ExtractInterruptInfo(err); !ok {
+		return nil, fmt.Errorf("encode %T: %w", v, err)
+	}
+	data, _, _ := c.Get(ctx, id)
+
+	var root serialValue
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("encode %T: %w", v, err)
+	}
+	return &root, nil
+}
+
+// state decodes sv as the state of a checkpoint of the graph
+func (c *stateCodec) state(sv *serialValue) (any, error) {
+	root := *c.blank
+	root.MapValues = make(map[string]*serialValue, len(c.blank.MapValues))
+	for k, v := range c.blank.MapValues {
+		root.MapValues[k] = v
+	}
+	root.MapValues["State"] = sv
+	data, err := json.Marshal(&root)
+	if err != nil {
+		return nil, err
+	}
+
+	id := strconv.FormatInt(c.next.Add(1), 10)
+	c.store.Store(id, data)
+	defer c.store.Delete(id)
+
+	// The modifier gets the decoded state and stops the run; a run that
+	// completes had a nil state
+	var value any
+	_, err = c.runner.Invoke(context.Background(), "", compose.WithCheckPointID(id),
+		compose.WithStateModifier(func(_ context.Context, _ compose.NodePath, st any) error {
+			value = st
+			return errDecoded
+		}))
+	if value == nil && err != nil {
+		return nil, fmt.Errorf("decode value: %w", err)
+	}
+	return value, nil
+}
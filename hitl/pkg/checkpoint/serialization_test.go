@@ -0,0 +1,195 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// Checkpoints saved by each eino version the store has run with are kept in
+// testdata/eino as "<version>.checkpoint.json": a graph interrupted before
+// its tools node with formatState as its state.
+const einoFixtureDir = "testdata/eino"
+
+// formatState is a state using every kind of value compose serializes
+func formatState() *types.UniversalState {
+	index := 0
+	return &types.UniversalState{
+		MessageHistory: []*schema.Message{
+			schema.UserMessage("Book a ticket to Paris"),
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					Index:    &index,
+					ID:       "call_1",
+					Type:     "function",
+					Function: schema.FunctionCall{Name: "BookTicket", Arguments: `{"location":"Paris"}`},
+				}},
+				ResponseMeta: &schema.ResponseMeta{FinishReason: "tool_calls", Usage: &schema.TokenUsage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19}},
+			},
+		},
+		Context: map[string]any{
+			"seats":    2,
+			"price":    99.5,
+			"vip":      true,
+			"location": "Paris",
+			"tags":     []any{"direct", 1},
+			"nested":   map[string]any{"window": true},
+		},
+		NodeExecutionLog: []types.ExecutionEvent{{
+			Seq:       1,
+			Node:      "ChatModel",
+			Phase:     types.PhaseCompleted,
+			StartedAt: 1_700_000_000_000_000_000,
+			EndedAt:   1_700_000_001_000_000_000,
+			Duration:  1_000_000_000,
+			Usage:     &schema.TokenUsage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19},
+			Tools:     []string{"BookTicket"},
+		}},
+		SavedAt:       1_700_000_001_000_000_000,
+		SchemaVersion: types.CurrentSchemaVersion,
+	}
+}
+
+// formatCheckpoint saves the checkpoint of the fixtures with the eino
+// version in go.mod
+func formatCheckpoint(t *testing.T) []byte {
+	t.Helper()
+	ctx := context.Background()
+
+	g := compose.NewGraph[*schema.Message, *schema.Message](compose.WithGenLocalState(func(context.Context) *types.UniversalState {
+		return formatState()
+	}))
+	reply := compose.InvokableLambda(func(_ context.Context, in *schema.Message) (*schema.Message, error) {
+		return formatState().MessageHistory[1], nil
+	})
+	if err := g.AddLambdaNode("ChatModel", reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddLambdaNode("ToolsNode", reply); err != nil {
+		t.Fatal(err)
+	}
+	_ = g.AddEdge(compose.START, "ChatModel")
+	_ = g.AddEdge("ChatModel", "ToolsNode")
+	_ = g.AddEdge("ToolsNode", compose.END)
+
+	store := &memoryStore{}
+	r, err := g.Compile(ctx, compose.WithCheckPointStore(store), compose.WithInterruptBeforeNodes([]string{"ToolsNode"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Invoke(ctx, schema.UserMessage("Book a ticket to Paris"), compose.WithCheckPointID("cp"))
+	if _, ok := compose.ExtractInterruptInfo(err); !ok {
+		t.Fatalf("Invoke = %v, want an interrupt", err)
+	}
+	return store.data
+}
+
+type memoryStore struct{ data []byte }
+
+func (s *memoryStore) Get(context.Context, string) ([]byte, bool, error) {
+	return s.data, s.data != nil, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, _ string, data []byte) error {
+	s.data = data
+	return nil
+}
+
+// einoVersion is the eino version the tests are built with
+func einoVersion(t *testing.T) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("no build info")
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/cloudwego/eino" {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	t.Fatal("eino is not a dependency")
+	return ""
+}
+
+// TestEinoFormat checks that compose still writes the checkpoint format the
+// store reads, and that checkpoints saved by earlier eino versions still load.
+// Upgrading eino fails it until the new version's checkpoint is saved with
+// -update; review the diff against the previous one first.
+func TestEinoFormat(t *testing.T) {
+	version := einoVersion(t)
+	current := filepath.Join(einoFixtureDir, version+fixtureCheckpoint)
+	if *update {
+		if err := os.WriteFile(current, formatCheckpoint(t), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(current)
+	if err != nil {
+		t.Fatalf("no checkpoint saved by eino %s: %v; check the store against its format and run with -update", version, err)
+	}
+	if got := formatCheckpoint(t); !jsonEqual(jsonValue(t, got), jsonValue(t, want)) {
+		t.Fatalf("eino %s writes checkpoints differently from %s:\n%s", version, current, got)
+	}
+
+	entries, err := os.ReadDir(einoFixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Run(e.Name(), func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(einoFixtureDir, e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cp, err := DecodeCheckpoint(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(cp.State, formatState()) {
+				got, _ := json.MarshalIndent(cp.State, "", "  ")
+				t.Fatalf("decoded state differs from formatState:\n%s", got)
+			}
+			// Context values keep their Go types
+			for key, want := range formatState().Context {
+				if got := cp.State.Context[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("context %s = %#v, want %#v", key, got, want)
+				}
+			}
+			if nodes := interruptedNodes(data); len(nodes) != 1 || nodes[0] != "ToolsNode" {
+				t.Fatalf("interrupted nodes = %v, want ToolsNode", nodes)
+			}
+
+			// An unedited checkpoint is re-encoded as it was saved
+			encoded, err := cp.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(jsonValue(t, encoded), jsonValue(t, data)) {
+				t.Fatalf("re-encoded checkpoint differs:\n%s", encoded)
+			}
+		})
+	}
+}
+
+func jsonValue(t *testing.T, data []byte) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("unmarshal %s: %v", strings.TrimSpace(string(data)), err)
+	}
+	return v
+}
@@ -0,0 +1,172 @@
+package checkpoint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultSQLitePath = "./checkpoints_data/checkpoints.db"
+
+	sqliteSchema = `
+CREATE TABLE IF NOT EXISTS blobs (
+	kind       TEXT    NOT NULL,
+	id         TEXT    NOT NULL,
+	data       BLOB    NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (kind, id)
+);
+CREATE TABLE IF NOT EXISTS locks (
+	id         TEXT    PRIMARY KEY,
+	token      TEXT    NOT NULL,
+	expires_at INTEGER NOT NULL
+)`
+)
+
+// SQLiteBackend stores blobs in an embedded SQLite database
+type SQLiteBackend struct {
+	db *sql.DB
+}
+
+// NewSQLiteBackend opens (or creates) the SQLite database at path
+func NewSQLiteBackend(path string) (*SQLiteBackend, error) {
+	if path == "" {
+		path = defaultSQLitePath
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create sqlite directory: %w", err)
+	}
+
+	// WAL and a busy timeout let several processes share the same file
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create sqlite schema: %w", err)
+	}
+
+	return &SQLiteBackend{db: db}, nil
+}
+
+// Get reads a blob from the database
+func (b *SQLiteBackend) Get(ctx context.Context, kind Kind, id string) ([]byte, bool, error) {
+	var data []byte
+	err := b.db.QueryRowContext(ctx,
+		`SELECT data FROM blobs WHERE kind = ? AND id = ?`, string(kind), id,
+	).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("query %s: %w", kind, err)
+	}
+	return data, true, nil
+}
+
+// Put inserts or replaces a blob in the database
+func (b *SQLiteBackend) Put(ctx context.Context, kind Kind, id string, data []byte) error {
+	_, err := b.db.ExecContext(ctx,
+		`INSERT INTO blobs (kind, id, data, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (kind, id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		string(kind), id, data, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("save %s: %w", kind, err)
+	}
+	return nil
+}
+
+// Delete removes a blob from the database
+func (b *SQLiteBackend) Delete(ctx context.Context, kind Kind, id string) error {
+	if _, err := b.db.ExecContext(ctx, `DELETE FROM blobs WHERE kind = ? AND id = ?`, string(kind), id); err != nil {
+		return fmt.Errorf("delete %s: %w", kind, err)
+	}
+	return nil
+}
+
+// List lists all blobs of the given kind
+func (b *SQLiteBackend) List(ctx context.Context, kind Kind) ([]CheckpointSummary, error) {
+	rows, err := b.db.QueryContext(ctx,
+		`SELECT id, updated_at, length(data) FROM blobs WHERE kind = ? ORDER BY id`, string(kind),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", kind, err)
+	}
+	defer rows.Close()
+
+	var summaries []CheckpointSummary
+	for rows.Next() {
+		var (
+			id        string
+			updatedAt int64
+			size      int64
+		)
+		if err := rows.Scan(&id, &updatedAt, &size); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", kind, err)
+		}
+		summaries = append(summaries, CheckpointSummary{
+			ID:        id,
+			CreatedAt: time.Unix(0, updatedAt),
+			Size:      size,
+		})
+	}
+	return summaries, rows.Err()
+}
+
+// Lock takes the checkpoint's row in the locks table, so every process
+// sharing the database serializes its writes to the checkpoint. The row is
+// claimed in a single upsert, which SQLite runs under its write lock; it is
+// not held in a transaction, since that would block the writes it guards. It
+// waits until the lock is free or ctx is done, and a row left by a process
+// that died expires after lockLease.
+func (b *SQLiteBackend) Lock(ctx context.Context, checkpointID string) (func(), error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		now := time.Now()
+		res, err := b.db.ExecContext(ctx,
+			`INSERT INTO locks (id, token, expires_at) VALUES (?, ?, ?)
+			 ON CONFLICT (id) DO UPDATE SET token = excluded.token, expires_at = excluded.expires_at
+			 WHERE locks.expires_at < ?`,
+			checkpointID, token, now.Add(lockLease).UnixNano(), now.UnixNano(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("lock: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("lock: %w", err)
+		}
+		if n == 1 {
+			break
+		}
+		if err := waitLock(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		// Released even when the writer's context was cancelled
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		b.db.ExecContext(ctx, `DELETE FROM locks WHERE id = ? AND token = ?`, checkpointID, token)
+	}, nil
+}
+
+// Close closes the database
+func (b *SQLiteBackend) Close() error {
+	return b.db.Close()
+}
@@ -2,75 +2,133 @@ package checkpoint
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/cloudwego/eino/compose"
 )
 
 const (
-	defaultBaseDir    = "./checkpoints_data"
-	checkpointSuffix  = ".json"
+	defaultBaseDir   = "./checkpoints_data"
+	checkpointSuffix = ".json"
 )
 
+// ErrCheckpointNotFound is returned when a checkpoint does not exist
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// ErrInvalidID is returned for checkpoint IDs that could name a file outside
+// the store
+var ErrInvalidID = errors.New("invalid checkpoint ID")
+
+// ValidateID rejects empty checkpoint IDs and those that are not a single
+// local path element
+func ValidateID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") || !filepath.IsLocal(id) {
+		return fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+	return nil
+}
+
 // Store implements compose.CheckPointStore interface
 type Store struct {
-	baseDir string
+	backend Backend
+
+	// locks serializes writers of the same checkpoint
+	locks keyedMutex
+
+	mu        sync.RWMutex
+	retention RetentionPolicy
 }
 
-// NewStore creates a new checkpoint store
+// NewStore creates a new checkpoint store backed by files under baseDir
 func NewStore(baseDir string) *Store {
-	if baseDir == "" {
-		baseDir = defaultBaseDir
-	}
-
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
+	backend, err := NewFileBackend(baseDir)
+	if err != nil {
 		panic(fmt.Sprintf("Failed to create checkpoints directory: %v", err))
 	}
 
-	return &Store{baseDir: baseDir}
+	return &Store{backend: withDefaultCodecs(backend)}
 }
 
-// Get retrieves checkpoint data by ID
-func (s *Store) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
-	filePath := filepath.Join(s.baseDir, checkPointID+checkpointSuffix)
+// NewStoreWithBackend creates a new checkpoint store on top of an arbitrary backend
+func NewStoreWithBackend(backend Backend) *Store {
+	return &Store{backend: backend}
+}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil, false, nil
+// OpenStore creates the backend described by cfg and wraps it with the codecs
+// described by codecCfg
+func OpenStore(cfg BackendConfig, codecCfg CodecConfig) (*Store, error) {
+	codecs, err := NewCodecs(codecCfg)
+	if err != nil {
+		return nil, fmt.Errorf("configure codecs: %w", err)
 	}
 
-	data, err := os.ReadFile(filePath)
+	backend, err := NewBackend(cfg)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to read checkpoint file: %w", err)
+		return nil, err
+	}
+	if len(codecs) > 0 {
+		backend = NewCodecBackend(backend, codecs...)
 	}
 
-	return data, true, nil
+	return NewStoreWithBackend(backend), nil
 }
 
-// Set saves checkpoint data by ID
-func (s *Store) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
-	filePath := filepath.Join(s.baseDir, checkPointID+checkpointSuffix)
-
-	tempFilePath := filePath + ".tmp"
-	if err := os.WriteFile(tempFilePath, checkPoint, 0644); err != nil {
-		return fmt.Errorf("failed to write checkpoint data: %w", err)
+// Get retrieves checkpoint data by ID, migrating states saved with an older
+// schema version so compose can resume from them
+func (s *Store) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
+	data, ok, err := s.backend.Get(ctx, KindCheckpoint, checkPointID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read checkpoint: %w", err)
 	}
-
-	if err := os.Rename(tempFilePath, filePath); err != nil {
-		_ = os.Remove(tempFilePath)
-		return fmt.Errorf("failed to save checkpoint file: %w", err)
+	if !ok {
+		return nil, false, nil
+	}
+	if data, err = migrateCheckpoint(data); err != nil {
+		return nil, false, fmt.Errorf("failed to migrate checkpoint: %w", err)
 	}
+	return data, true, nil
+}
 
+// Set saves checkpoint data by ID as a new revision
+func (s *Store) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	if _, err := s.SetIfRevision(ctx, checkPointID, checkPoint, AnyRevision); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
 	return nil
 }
 
-// GetBaseDir returns the base directory path
+// Backend returns the underlying persistence backend
+func (s *Store) Backend() Backend {
+	return s.backend
+}
+
+// GetBaseDir returns the base directory path, or "" if the store is not file backed
 func (s *Store) GetBaseDir() string {
-	return s.baseDir
+	if fb, ok := unwrapBackend(s.backend).(*FileBackend); ok {
+		return fb.Dir()
+	}
+	return ""
+}
+
+// Close releases the underlying backend
+func (s *Store) Close() error {
+	return s.backend.Close()
 }
 
 // ToComposeStore converts to compose.CheckPointStore interface
 func (s *Store) ToComposeStore() compose.CheckPointStore {
 	return s
-}
\ No newline at end of file
+}
+
+// fileStore returns a store over an existing directory without creating it,
+// used by the package-level helpers that take a base directory.
+func fileStore(baseDir string) *Store {
+	if baseDir == "" {
+		baseDir = defaultBaseDir
+	}
+	return &Store{backend: withDefaultCodecs(&FileBackend{dir: baseDir})}
+}
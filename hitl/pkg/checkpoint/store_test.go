@@ -0,0 +1,43 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStore returns a store over files in a temporary directory
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	backend, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStoreWithBackend(backend)
+}
+
+// testCheckpoint returns the data of a checkpoint compose saved before its
+// ToolsNode, with one pending tool call
+func testCheckpoint(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "state", "v1.checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// editedCheckpoint returns data with its context key "edit" set to value
+func editedCheckpoint(t *testing.T, data []byte, value string) []byte {
+	t.Helper()
+	cp, err := DecodeCheckpoint(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.SetContext("edit", value)
+	edited, err := cp.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return edited
+}
@@ -1,8 +1,8 @@
 package checkpoint
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 	"time"
 )
@@ -14,57 +14,58 @@ type CheckpointSummary struct {
 	Size      int64     `json:"size"`
 }
 
-// ListCheckpoints lists all checkpoints in the base directory
-func ListCheckpoints(baseDir string) ([]CheckpointSummary, error) {
-	var checkpoints []CheckpointSummary
-
-	files, err := os.ReadDir(baseDir)
+// List lists all checkpoints in the store
+func (s *Store) List(ctx context.Context) ([]CheckpointSummary, error) {
+	checkpoints, err := s.backend.List(ctx, KindCheckpoint)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return checkpoints, nil
-		}
 		return nil, err
 	}
+	if checkpoints == nil {
+		checkpoints = []CheckpointSummary{}
+	}
+	return checkpoints, nil
+}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+// Delete deletes a checkpoint, its overlay, its revision history, its
+// metadata, its execution record and its lock file
+func (s *Store) Delete(ctx context.Context, id string) error {
+	return s.withLock(ctx, id, func() error {
+		if err := s.backend.Delete(ctx, KindCheckpoint, id); err != nil {
+			return fmt.Errorf("delete checkpoint: %w", err)
 		}
-
-		name := file.Name()
-		if filepath.Ext(name) == checkpointSuffix && !hasOverlaySuffix(name) {
-			info, _ := file.Info()
-			checkpointID := name[:len(name)-len(checkpointSuffix)]
-			checkpoints = append(checkpoints, CheckpointSummary{
-				ID:        checkpointID,
-				CreatedAt: info.ModTime(),
-				Size:      info.Size(),
-			})
+		if err := s.backend.Delete(ctx, KindOverlay, id); err != nil {
+			return fmt.Errorf("delete overlay: %w", err)
 		}
-	}
-
-	return checkpoints, nil
+		if err := s.deleteRevisions(ctx, id); err != nil {
+			return fmt.Errorf("delete revisions: %w", err)
+		}
+		if err := s.backend.Delete(ctx, KindMeta, id); err != nil {
+			return fmt.Errorf("delete metadata: %w", err)
+		}
+		if err := s.backend.Delete(ctx, KindExecution, id); err != nil {
+			return fmt.Errorf("delete execution: %w", err)
+		}
+		return s.removeLock(ctx, id)
+	})
 }
 
-// DeleteCheckpoint deletes a checkpoint and its overlay
-func DeleteCheckpoint(baseDir, id string) error {
-	// Delete checkpoint file
-	checkpointPath := filepath.Join(baseDir, id+checkpointSuffix)
-	if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("delete checkpoint file: %w", err)
-	}
+// ListCheckpoints lists all checkpoints in the base directory
+func ListCheckpoints(baseDir string) ([]CheckpointSummary, error) {
+	return fileStore(baseDir).List(context.Background())
+}
 
-	// Delete overlay file if exists
-	overlayPath := filepath.Join(baseDir, id+overlaySuffix)
-	if err := os.Remove(overlayPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("delete overlay file: %w", err)
-	}
+// QueryCheckpoints filters, sorts and paginates the checkpoints in the base directory
+func QueryCheckpoints(baseDir string, q Query) (*Page, error) {
+	return fileStore(baseDir).Query(context.Background(), q)
+}
 
-	return nil
+// DeleteCheckpoint deletes a checkpoint, its overlay and its revision history
+func DeleteCheckpoint(baseDir, id string) error {
+	return fileStore(baseDir).Delete(context.Background(), id)
 }
 
 // hasOverlaySuffix checks if a filename has the overlay suffix
 func hasOverlaySuffix(name string) bool {
 	baseName := filepath.Base(name)
 	return len(baseName) > len(overlaySuffix) && baseName[len(baseName)-len(overlaySuffix):] == overlaySuffix
-}
\ No newline at end of file
+}
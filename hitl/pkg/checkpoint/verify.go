@@ -0,0 +1,343 @@
+package checkpoint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// KindQuarantine holds blobs moved aside by Verify, under
+// "<kind>.<id>.<unix time>". They are kept as stored, so an encrypted one
+// only decrypts under its original kind and ID.
+const KindQuarantine Kind = "quarantine"
+
+// VerifyMode selects what Verify does about the problems it finds
+type VerifyMode string
+
+const (
+	// VerifyModeReport only reports problems
+	VerifyModeReport VerifyMode = "report"
+	// VerifyModeRepair restores checkpoints from their last intact revision and
+	// removes stale overlays, quarantining what cannot be repaired
+	VerifyModeRepair VerifyMode = "repair"
+	// VerifyModeQuarantine moves every damaged blob to the quarantine
+	VerifyModeQuarantine VerifyMode = "quarantine"
+)
+
+// Problem names a kind of inconsistency found by Verify
+type Problem string
+
+const (
+	ProblemCorrupt         Problem = "corrupt"
+	ProblemChecksum        Problem = "checksum_mismatch"
+	ProblemCorruptRevision Problem = "corrupt_revision"
+	ProblemCorruptOverlay  Problem = "corrupt_overlay"
+	ProblemOrphanOverlay   Problem = "orphan_overlay"
+	ProblemOverlayMismatch Problem = "overlay_mismatch"
+	ProblemTempFile        Problem = "temp_file"
+)
+
+// Issue is a problem found by Verify and what was done about it
+type Issue struct {
+	CheckpointID string  `json:"checkpoint_id"`
+	Kind         Kind    `json:"kind"`
+	Problem      Problem `json:"problem"`
+	Detail       string  `json:"detail,omitempty"`
+	// Action is empty in report mode or when nothing could be done
+	Action string `json:"action,omitempty"`
+}
+
+// VerifyReport lists the problems found by Verify
+type VerifyReport struct {
+	Mode      VerifyMode `json:"mode"`
+	StartedAt time.Time  `json:"started_at"`
+	Checked   int        `json:"checked"`
+	Issues    []Issue    `json:"issues"`
+}
+
+// OK reports whether no problems were found
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// checksum returns the sha256 of data as stored in Revision.Checksum
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Verify checks every checkpoint against the checksum of its latest
+// revision, every revision against its own checksum, and every overlay
+// against its checkpoint, handling problems according to mode
+func (s *Store) Verify(ctx context.Context, mode VerifyMode) (*VerifyReport, error) {
+	switch mode {
+	case "":
+		mode = VerifyModeReport
+	case VerifyModeReport, VerifyModeRepair, VerifyModeQuarantine:
+	default:
+		return nil, fmt.Errorf("unknown verify mode: %s", mode)
+	}
+	report := &VerifyReport{Mode: mode, StartedAt: time.Now(), Issues: []Issue{}}
+
+	checkpoints, err := s.backend.List(ctx, KindCheckpoint)
+	if err != nil {
+		return nil, fmt.Errorf("list checkpoints: %w", err)
+	}
+	overlays, err := s.backend.List(ctx, KindOverlay)
+	if err != nil {
+		return nil, fmt.Errorf("list overlays: %w", err)
+	}
+
+	exists := make(map[string]bool, len(checkpoints))
+	for _, cp := range checkpoints {
+		exists[cp.ID] = true
+		err := s.withLock(ctx, cp.ID, func() error {
+			return s.verifyCheckpoint(ctx, cp.ID, mode, report)
+		})
+		if err != nil {
+			return report, err
+		}
+		report.Checked++
+	}
+
+	for _, o := range overlays {
+		if exists[o.ID] {
+			continue
+		}
+		issue := Issue{CheckpointID: o.ID, Kind: KindOverlay, Problem: ProblemOrphanOverlay}
+		if err := s.removeOrQuarantine(ctx, mode, KindOverlay, o.ID, &issue); err != nil {
+			return report, err
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	if cleaner, ok := unwrapBackend(s.backend).(tempFileCleaner); ok {
+		files, err := cleaner.CleanTempFiles(ctx, defaultTempFileAge, mode == VerifyModeReport)
+		if err != nil {
+			return report, fmt.Errorf("clean temp files: %w", err)
+		}
+		for _, f := range files {
+			issue := Issue{Kind: "file", Problem: ProblemTempFile, Detail: f}
+			if mode != VerifyModeReport {
+				issue.Action = "removed"
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	return report, nil
+}
+
+// verifyCheckpoint checks one checkpoint, its revisions and its overlay.
+// Callers must hold the checkpoint lock.
+func (s *Store) verifyCheckpoint(ctx context.Context, id string, mode VerifyMode, report *VerifyReport) error {
+	revs, err := s.ListRevisions(ctx, id)
+	if err != nil {
+		report.Issues = append(report.Issues, Issue{CheckpointID: id, Kind: KindHistory, Problem: ProblemCorrupt, Detail: err.Error()})
+		revs = nil
+	}
+
+	// Revisions, remembering the newest intact one for repairs
+	var (
+		intact     *Revision
+		intactData []byte
+		bad        = make(map[int]bool)
+	)
+	for i := range revs {
+		rev := revs[i]
+		data, ok, err := s.backend.Get(ctx, KindRevision, revisionID(id, rev.Number))
+		detail := ""
+		switch {
+		case err != nil:
+			detail = err.Error()
+		case !ok:
+			detail = "revision blob is missing"
+		case rev.Checksum != "" && checksum(data) != rev.Checksum:
+			detail = "checksum does not match history"
+		case rev.Checksum == "" && !json.Valid(data):
+			detail = "invalid json"
+		default:
+			intact, intactData = &rev, data
+			continue
+		}
+
+		issue := Issue{CheckpointID: id, Kind: KindRevision, Problem: ProblemCorruptRevision, Detail: fmt.Sprintf("revision %d: %s", rev.Number, detail)}
+		if mode != VerifyModeReport {
+			if ok {
+				if err := s.quarantine(ctx, KindRevision, revisionID(id, rev.Number)); err != nil {
+					return err
+				}
+				issue.Action = "quarantined"
+			} else {
+				issue.Action = "removed from history"
+			}
+			bad[rev.Number] = true
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	// Drop handled revisions from the history
+	if len(bad) > 0 {
+		kept := make([]Revision, 0, len(revs))
+		for _, rev := range revs {
+			if !bad[rev.Number] {
+				kept = append(kept, rev)
+			}
+		}
+		history, err := json.Marshal(kept)
+		if err != nil {
+			return fmt.Errorf("marshal revision history: %w", err)
+		}
+		if err := s.backend.Put(ctx, KindHistory, id, history); err != nil {
+			return fmt.Errorf("save revision history: %w", err)
+		}
+		revs = kept
+	}
+
+	// Current checkpoint
+	data, _, err := s.backend.Get(ctx, KindCheckpoint, id)
+	var issue *Issue
+	switch {
+	case err != nil:
+		issue = &Issue{Problem: ProblemCorrupt, Detail: err.Error()}
+	case !json.Valid(data):
+		issue = &Issue{Problem: ProblemCorrupt, Detail: "invalid json"}
+	case len(revs) > 0 && revs[len(revs)-1].Checksum != "" && checksum(data) != revs[len(revs)-1].Checksum:
+		issue = &Issue{Problem: ProblemChecksum, Detail: fmt.Sprintf("does not match revision %d", revs[len(revs)-1].Number)}
+	}
+	if issue != nil {
+		issue.CheckpointID, issue.Kind = id, KindCheckpoint
+		if err := s.repairCheckpoint(ctx, id, mode, intact, intactData, issue); err != nil {
+			return err
+		}
+		report.Issues = append(report.Issues, *issue)
+		if issue.Action == "" || issue.Action == "quarantined" {
+			return nil
+		}
+		data = intactData
+	}
+
+	// Overlay against the checkpoint's tool calls
+	raw, ok, err := s.backend.Get(ctx, KindOverlay, id)
+	if !ok && err == nil {
+		return nil
+	}
+	var pending types.UniversalState
+	if err == nil {
+		err = decodePendingState(raw, &pending)
+	}
+	if err != nil {
+		issue := Issue{CheckpointID: id, Kind: KindOverlay, Problem: ProblemCorruptOverlay, Detail: err.Error()}
+		if mode != VerifyModeReport {
+			if err := s.quarantine(ctx, KindOverlay, id); err != nil {
+				return err
+			}
+			issue.Action = "quarantined"
+		}
+		report.Issues = append(report.Issues, issue)
+		return nil
+	}
+
+	cp, err := DecodeCheckpoint(data)
+	if err != nil {
+		// Not a UniversalState checkpoint, nothing to compare against
+		return nil
+	}
+	var ids []string
+	for _, tc := range DiffStates(&pending, cp.State).ToolCalls {
+		// Overlays saved before decisions were written to the checkpoint hold
+		// edited arguments only; those are the human's edits, not a mismatch
+		if tc.Change == ChangeModified && !changesName(tc) {
+			continue
+		}
+		ids = append(ids, fmt.Sprintf("%s (%s)", tc.ID, tc.Change))
+	}
+	if len(ids) > 0 {
+		issue := Issue{CheckpointID: id, Kind: KindOverlay, Problem: ProblemOverlayMismatch, Detail: "tool calls differ: " + strings.Join(ids, ", ")}
+		if err := s.removeOrQuarantine(ctx, mode, KindOverlay, id, &issue); err != nil {
+			return err
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	return nil
+}
+
+// changesName reports whether a modified tool call calls another tool
+func changesName(tc ToolCallDiff) bool {
+	for _, c := range tc.Changes {
+		if c.Field == "name" {
+			return true
+		}
+	}
+	return false
+}
+
+// repairCheckpoint restores a damaged checkpoint from its newest intact
+// revision in repair mode, keeping the damaged copy in the quarantine.
+// Callers must hold the checkpoint lock.
+// Without an intact revision, or in quarantine mode, it is only quarantined.
+func (s *Store) repairCheckpoint(ctx context.Context, id string, mode VerifyMode, intact *Revision, intactData []byte, issue *Issue) error {
+	if mode == VerifyModeReport {
+		return nil
+	}
+
+	if err := s.quarantine(ctx, KindCheckpoint, id); err != nil {
+		return err
+	}
+	if mode == VerifyModeQuarantine || intact == nil {
+		issue.Action = "quarantined"
+		return nil
+	}
+
+	// Recorded as a new revision so the history matches the restored data
+	if _, err := s.commit(ctx, id, intactData, fmt.Sprintf("repair:%d", intact.Number), AnyRevision); err != nil {
+		return fmt.Errorf("restore checkpoint %s: %w", id, err)
+	}
+	issue.Action = fmt.Sprintf("restored from revision %d", intact.Number)
+	return nil
+}
+
+// removeOrQuarantine deletes a stale blob in repair mode and quarantines it
+// in quarantine mode
+func (s *Store) removeOrQuarantine(ctx context.Context, mode VerifyMode, kind Kind, id string, issue *Issue) error {
+	switch mode {
+	case VerifyModeRepair:
+		if err := s.backend.Delete(ctx, kind, id); err != nil {
+			return fmt.Errorf("remove %s %s: %w", kind, id, err)
+		}
+		issue.Action = "removed"
+	case VerifyModeQuarantine:
+		if err := s.quarantine(ctx, kind, id); err != nil {
+			return err
+		}
+		issue.Action = "quarantined"
+	}
+	return nil
+}
+
+// quarantine moves a blob, as stored, out of the way so it no longer affects
+// the store but can still be inspected
+func (s *Store) quarantine(ctx context.Context, kind Kind, id string) error {
+	raw := unwrapBackend(s.backend)
+
+	data, ok, err := raw.Get(ctx, kind, id)
+	if err != nil {
+		return fmt.Errorf("read %s %s: %w", kind, id, err)
+	}
+	if ok {
+		qid := fmt.Sprintf("%s.%s.%d", kind, id, time.Now().Unix())
+		if err := raw.Put(ctx, KindQuarantine, qid, data); err != nil {
+			return fmt.Errorf("quarantine %s %s: %w", kind, id, err)
+		}
+	}
+	if err := raw.Delete(ctx, kind, id); err != nil {
+		return fmt.Errorf("remove %s %s: %w", kind, id, err)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		damage  func(t *testing.T, s *Store)
+		kind    Kind
+		problem Problem
+		// actions by mode
+		actions map[VerifyMode]string
+		check   func(t *testing.T, s *Store, mode VerifyMode)
+	}{
+		{
+			name: "corrupt checkpoint",
+			damage: func(t *testing.T, s *Store) {
+				s.Backend().Put(ctx, KindCheckpoint, "cp", []byte("{broken"))
+			},
+			kind:    KindCheckpoint,
+			problem: ProblemCorrupt,
+			actions: map[VerifyMode]string{VerifyModeRepair: "restored from revision 2", VerifyModeQuarantine: "quarantined"},
+			check:   checkRestored,
+		},
+		{
+			name: "checksum mismatch",
+			damage: func(t *testing.T, s *Store) {
+				s.Backend().Put(ctx, KindCheckpoint, "cp", editedCheckpoint(t, testCheckpoint(t), "unrecorded"))
+			},
+			kind:    KindCheckpoint,
+			problem: ProblemChecksum,
+			actions: map[VerifyMode]string{VerifyModeRepair: "restored from revision 2", VerifyModeQuarantine: "quarantined"},
+			check:   checkRestored,
+		},
+		{
+			name: "corrupt revision",
+			damage: func(t *testing.T, s *Store) {
+				s.Backend().Put(ctx, KindRevision, "cp@1", []byte("{broken"))
+			},
+			kind:    KindRevision,
+			problem: ProblemCorruptRevision,
+			actions: map[VerifyMode]string{VerifyModeRepair: "quarantined", VerifyModeQuarantine: "quarantined"},
+			check:   checkHistoryDropped,
+		},
+		{
+			name: "missing revision",
+			damage: func(t *testing.T, s *Store) {
+				s.Backend().Delete(ctx, KindRevision, "cp@1")
+			},
+			kind:    KindRevision,
+			problem: ProblemCorruptRevision,
+			actions: map[VerifyMode]string{VerifyModeRepair: "removed from history", VerifyModeQuarantine: "removed from history"},
+			check:   checkHistoryDropped,
+		},
+		{
+			name: "orphan overlay",
+			damage: func(t *testing.T, s *Store) {
+				s.Backend().Put(ctx, KindOverlay, "gone", testOverlay(t))
+			},
+			kind:    KindOverlay,
+			problem: ProblemOrphanOverlay,
+			actions: map[VerifyMode]string{VerifyModeRepair: "removed", VerifyModeQuarantine: "quarantined"},
+			check: func(t *testing.T, s *Store, mode VerifyMode) {
+				_, ok, _ := s.Backend().Get(ctx, KindOverlay, "gone")
+				if ok != (mode == VerifyModeReport) {
+					t.Fatalf("overlay present = %v in %s mode", ok, mode)
+				}
+			},
+		},
+		{
+			name: "corrupt overlay",
+			damage: func(t *testing.T, s *Store) {
+				s.Backend().Put(ctx, KindOverlay, "cp", []byte("{broken"))
+			},
+			kind:    KindOverlay,
+			problem: ProblemCorruptOverlay,
+			actions: map[VerifyMode]string{VerifyModeRepair: "quarantined", VerifyModeQuarantine: "quarantined"},
+			check:   checkOverlayGone,
+		},
+		{
+			name: "overlay of other tool calls",
+			damage: func(t *testing.T, s *Store) {
+				cp, err := s.LoadCheckpoint(ctx, "cp")
+				if err != nil {
+					t.Fatal(err)
+				}
+				msgs := cp.State.MessageHistory
+				msgs[len(msgs)-1].ToolCalls[0].ID = "call_other"
+				if err := s.SavePendingState(ctx, "cp", cp.State); err != nil {
+					t.Fatal(err)
+				}
+			},
+			kind:    KindOverlay,
+			problem: ProblemOverlayMismatch,
+			actions: map[VerifyMode]string{VerifyModeRepair: "removed", VerifyModeQuarantine: "quarantined"},
+			check:   checkOverlayGone,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range []VerifyMode{VerifyModeReport, VerifyModeRepair, VerifyModeQuarantine} {
+			t.Run(tt.name+"/"+string(mode), func(t *testing.T) {
+				s := newTestStore(t)
+				first := testCheckpoint(t)
+				s.Set(ctx, "cp", first)
+				s.Set(ctx, "cp", editedCheckpoint(t, first, "second"))
+
+				if report, err := s.Verify(ctx, mode); err != nil || !report.OK() || report.Checked != 1 {
+					t.Fatalf("Verify before damage = %+v, %v", report, err)
+				}
+				tt.damage(t, s)
+
+				report, err := s.Verify(ctx, mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(report.Issues) != 1 {
+					t.Fatalf("issues = %+v, want one", report.Issues)
+				}
+				issue := report.Issues[0]
+				if issue.Kind != tt.kind || issue.Problem != tt.problem || issue.Action != tt.actions[mode] {
+					t.Fatalf("issue = %+v, want %s %s with action %q", issue, tt.kind, tt.problem, tt.actions[mode])
+				}
+
+				quarantined, _ := s.Backend().List(ctx, KindQuarantine)
+				// Restored checkpoints keep their damaged copy too
+				want := tt.actions[mode] == "quarantined" || strings.HasPrefix(tt.actions[mode], "restored")
+				if (len(quarantined) == 1) != want {
+					t.Fatalf("quarantine = %+v, want an entry: %v", quarantined, want)
+				}
+				tt.check(t, s, mode)
+
+				// Whatever was done leaves a consistent store
+				if mode != VerifyModeReport {
+					if report, err := s.Verify(ctx, VerifyModeReport); err != nil || !report.OK() {
+						t.Fatalf("Verify after %s = %+v, %v", mode, report.Issues, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// checkRestored checks a damaged checkpoint after Verify
+func checkRestored(t *testing.T, s *Store, mode VerifyMode) {
+	ctx := context.Background()
+	data, ok, _ := s.Backend().Get(ctx, KindCheckpoint, "cp")
+	switch mode {
+	case VerifyModeReport:
+		if !ok {
+			t.Fatal("report mode removed the checkpoint")
+		}
+	case VerifyModeRepair:
+		second, _ := s.GetRevision(ctx, "cp", 2)
+		if !bytes.Equal(data, second) {
+			t.Fatal("checkpoint is not revision 2")
+		}
+		revs, _ := s.ListRevisions(ctx, "cp")
+		if len(revs) != 3 || revs[2].Source != "repair:2" {
+			t.Fatalf("revisions = %+v, want a repair revision", revs)
+		}
+	case VerifyModeQuarantine:
+		if ok {
+			t.Fatal("checkpoint was not quarantined")
+		}
+	}
+}
+
+// checkHistoryDropped checks the history after revision 1 was damaged
+func checkHistoryDropped(t *testing.T, s *Store, mode VerifyMode) {
+	revs, err := s.ListRevisions(context.Background(), "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 1
+	if mode == VerifyModeReport {
+		want = 2
+	}
+	if len(revs) != want || revs[len(revs)-1].Number != 2 {
+		t.Fatalf("revisions = %+v, want %d ending at 2", revs, want)
+	}
+}
+
+// checkOverlayGone checks that a bad overlay of cp was handled
+func checkOverlayGone(t *testing.T, s *Store, mode VerifyMode) {
+	_, ok, _ := s.Backend().Get(context.Background(), KindOverlay, "cp")
+	if ok != (mode == VerifyModeReport) {
+		t.Fatalf("overlay present = %v in %s mode", ok, mode)
+	}
+	// The checkpoint itself is fine
+	if _, ok, _ := s.Get(context.Background(), "cp"); !ok {
+		t.Fatal("checkpoint removed")
+	}
+}
+
+func TestVerifyTempFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	backend, _ := NewFileBackend(dir)
+	s := NewStoreWithBackend(backend)
+
+	stale := filepath.Join(dir, "cp.json.tmp")
+	fresh := filepath.Join(dir, "other.json.tmp")
+	os.WriteFile(stale, []byte("{"), 0644)
+	os.WriteFile(fresh, []byte("{"), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(stale, old, old)
+
+	for _, mode := range []VerifyMode{VerifyModeReport, VerifyModeRepair} {
+		report, err := s.Verify(ctx, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Issues) != 1 || report.Issues[0].Problem != ProblemTempFile || report.Issues[0].Detail != stale {
+			t.Fatalf("%s: issues = %+v, want the stale temp file", mode, report.Issues)
+		}
+		_, err = os.Stat(stale)
+		if removed := os.IsNotExist(err); removed != (mode == VerifyModeRepair) {
+			t.Fatalf("%s: stale temp file removed = %v", mode, removed)
+		}
+	}
+	// Writes may still be in flight
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatal("fresh temp file removed")
+	}
+}
+
+func TestVerifyLegacyOverlay(t *testing.T) {
+	ctx := context.Background()
+	for _, fixture := range []string{"v0-map-log", "v0-event-log"} {
+		t.Run(fixture, func(t *testing.T) {
+			s := newTestStore(t)
+			checkpointData, err := os.ReadFile(filepath.Join(fixtureDir, fixture+".checkpoint.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			overlayData, err := os.ReadFile(filepath.Join(fixtureDir, fixture+".overlay.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Backend().Put(ctx, KindCheckpoint, "cp", checkpointData)
+			s.Backend().Put(ctx, KindOverlay, "cp", overlayData)
+
+			// A pending state saved at an older schema version, with edits the
+			// checkpoint lacks, is valid, and repair keeps it
+			report, err := s.Verify(ctx, VerifyModeRepair)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Fatalf("issues = %+v, want none", report.Issues)
+			}
+			if !s.HasPendingState(ctx, "cp") {
+				t.Fatal("repair removed the pending state")
+			}
+			// The overlay holds the human's edit of the last tool call
+			st, err := s.LoadPendingState(ctx, "cp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs := st.MessageHistory
+			if args := msgs[len(msgs)-1].ToolCalls[0].Function.Arguments; !strings.Contains(args, "Kyoto") {
+				t.Fatalf("pending tool call arguments %s, want the edit", args)
+			}
+		})
+	}
+}
+
+func TestVerifyUnknownMode(t *testing.T) {
+	if _, err := newTestStore(t).Verify(context.Background(), "fix-everything"); err == nil {
+		t.Fatal("Verify with an unknown mode succeeded")
+	}
+}
@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// askHumanInfo describes the ask_human tool to the model
+var askHumanInfo = &schema.ToolInfo{
+	Name: types.AskHumanToolName,
+	Desc: "Ask the user a question when information needed to continue is missing " +
+		"(for example a passenger's phone number) or when the user should choose " +
+		"between options. The result is the user's answer.",
+	ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+		"question": {
+			Type:     schema.String,
+			Desc:     "The question to ask the user",
+			Required: true,
+		},
+		"options": {
+			Type:     schema.Array,
+			ElemInfo: &schema.ParameterInfo{Type: schema.String},
+			Desc:     "Choices to offer, if the answer should be one of them",
+		},
+	}),
+}
+
+// AskHumanTool returns the ask_human tool, which lets a model ask the human
+// a question. Bind it to the chat model; the tools nodes built by this
+// package interrupt on its calls before running any tool, and a human
+// answers them with a types.DecisionAnswer. NewRegistry registers it, so
+// definitions can list it in a node's tools.
+func AskHumanTool() tool.InvokableTool {
+	return askHumanTool{}
+}
+
+type askHumanTool struct{}
+
+func (askHumanTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return askHumanInfo, nil
+}
+
+// InvokableRun interrupts: answers are injected as tool messages, so the tool
+// only runs in a tools node that does not know about it
+func (askHumanTool) InvokableRun(_ context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	q, _ := types.QuestionFromToolCall(schema.ToolCall{Function: schema.FunctionCall{
+		Name: types.AskHumanToolName, Arguments: argumentsInJSON,
+	}})
+	return "", compose.NewInterruptAndRerunErr([]types.Question{q})
+}
+
+// pendingQuestions returns the questions among the calls a tools node is
+// about to run
+func pendingQuestions(calls []schema.ToolCall) []types.Question {
+	var questions []types.Question
+	for _, tc := range calls {
+		if q, ok := types.QuestionFromToolCall(tc); ok {
+			questions = append(questions, q)
+		}
+	}
+	return questions
+}
@@ -0,0 +1,104 @@
+package graph
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/types"
+)
+
+func TestAskHumanTool(t *testing.T) {
+	ctx := context.Background()
+	at := AskHumanTool()
+	if info, err := at.Info(ctx); err != nil || info.Name != types.AskHumanToolName {
+		t.Fatalf("Info = %+v, %v", info, err)
+	}
+
+	// Run by a tools node that does not know about it, it interrupts
+	_, err := at.InvokableRun(ctx, `{"question": "Which class?", "options": ["economy", "business"]}`)
+	extra, ok := compose.IsInterruptRerunError(err)
+	if !ok {
+		t.Fatalf("InvokableRun = %v, want an interrupt", err)
+	}
+	want := []types.Question{{Question: "Which class?", Options: []string{"economy", "business"}}}
+	if !reflect.DeepEqual(extra, want) {
+		t.Fatalf("questions = %+v, want %+v", extra, want)
+	}
+}
+
+// askCalls asks which class to book while booking a ticket
+var askCalls = []string{
+	"call-1", types.AskHumanToolName, `{"question": "Which class?", "options": ["economy", "business"]}`,
+	"call-2", "BookTicket", `{"location":"Paris"}`,
+}
+
+// askConfig lets the calls run without approval, so only the question stops
+// the graph
+var askConfig = Config{Interrupts: []InterruptRule{{Node: "ToolsNode", When: ToolIn("Refund")}}}
+
+func TestAskHuman(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRun(t, askConfig, []*schema.Message{toolCallReply(askCalls...)}, "BookTicket")
+	want := []types.Question{{ToolCallID: "call-1", Question: "Which class?", Options: []string{"economy", "business"}}}
+
+	// Unanswered, the question stops the tools node before any tool runs,
+	// however often the run is resumed
+	for i := 0; i < 2; i++ {
+		_, info := r.run(t, "cp")
+		if info == nil || len(info.RerunNodes) != 1 || info.RerunNodes[0] != "ToolsNode" {
+			t.Fatalf("run %d: interrupt = %+v, want a rerun of ToolsNode", i, info)
+		}
+		if got := info.RerunNodesExtra["ToolsNode"]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: questions = %+v, want %+v", i, got, want)
+		}
+		if ran := r.tools["BookTicket"].ranWith(); len(ran) > 0 {
+			t.Fatalf("run %d: BookTicket ran with %v", i, ran)
+		}
+	}
+
+	cp, err := r.store.LoadCheckpoint(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cp.State.PendingQuestions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending questions = %+v, want %+v", got, want)
+	}
+
+	answer := []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionAnswer, Answer: "business"}}
+	if err := r.store.ApplyToolDecisions(ctx, "cp", answer, checkpoint.AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+	out, info := r.run(t, "cp")
+	if info != nil || out.Content != "done" {
+		t.Fatalf("resume = %v, %+v", out, info)
+	}
+	if ran := r.tools["BookTicket"].ranWith(); len(ran) != 1 {
+		t.Fatalf("BookTicket ran with %v, want once", ran)
+	}
+	results := toolResults(t, r)
+	if results["call-1"] != "business" || results["call-2"] != `BookTicket ran with {"location":"Paris"}` {
+		t.Fatalf("model saw results %v", results)
+	}
+}
+
+func TestAskHumanStream(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRun(t, askConfig, []*schema.Message{toolCallReply(askCalls...)}, "BookTicket")
+
+	_, err := r.runner.Stream(ctx, map[string]any{"name": "Ada"}, compose.WithCheckPointID("cp"))
+	info, ok := compose.ExtractInterruptInfo(err)
+	if !ok || len(info.RerunNodes) != 1 || info.RerunNodes[0] != "ToolsNode" {
+		t.Fatalf("Stream = %v, want a rerun of ToolsNode", err)
+	}
+	if questions, _ := info.RerunNodesExtra["ToolsNode"].([]types.Question); len(questions) != 1 || questions[0].ToolCallID != "call-1" {
+		t.Fatalf("questions = %+v", info.RerunNodesExtra["ToolsNode"])
+	}
+	if ran := r.tools["BookTicket"].ranWith(); len(ran) > 0 {
+		t.Fatalf("BookTicket ran with %v", ran)
+	}
+}
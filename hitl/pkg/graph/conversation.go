@@ -0,0 +1,162 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"eino_testing/hitl/pkg/types"
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// UserMessageKey is the input variable carrying the user's message of a
+// follow-up turn; see WithHistory
+const UserMessageKey = "user_message"
+
+// summaryPrefix starts the system message replacing the messages a
+// HistoryWindow drops
+const summaryPrefix = "Summary of the earlier conversation: "
+
+type historyKey struct{}
+
+// WithHistory returns a context whose graph runs continue a conversation:
+// the state of a new run starts with history, and the chat template node adds
+// the user message in the input's UserMessageKey instead of its formatted
+// prompt (or its prompt without system messages when there is none). The
+// input still needs the template's variables. Resumed runs keep the state of
+// their checkpoint.
+func WithHistory(ctx context.Context, history []*schema.Message) context.Context {
+	return context.WithValue(ctx, historyKey{}, history)
+}
+
+func historyFromContext(ctx context.Context) []*schema.Message {
+	history, _ := ctx.Value(historyKey{}).([]*schema.Message)
+	return history
+}
+
+// continueConversation replaces the output of a chat template in a later turn
+// of a conversation, whose history holds the prompt already
+func continueConversation(out []*schema.Message, vars map[string]any) []*schema.Message {
+	if msg, _ := vars[UserMessageKey].(string); msg != "" {
+		return []*schema.Message{schema.UserMessage(msg)}
+	}
+	msgs := make([]*schema.Message, 0, len(out))
+	for _, m := range out {
+		if m.Role != schema.System {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// appendNew appends the messages the history does not end with already: the
+// chat template and tools nodes record their output, which is the input of
+// the next chat model
+func appendNew(history, msgs []*schema.Message) []*schema.Message {
+	n := len(msgs)
+	if n == 0 || n > len(history) {
+		return append(history, msgs...)
+	}
+	for i, m := range history[len(history)-n:] {
+		o := msgs[i]
+		if m.Role != o.Role || m.Content != o.Content || m.ToolCallID != o.ToolCallID {
+			return append(history, msgs...)
+		}
+	}
+	return history
+}
+
+// WithCompletionHandler reports the state of a run to fn when the graph
+// completes, e.g. to keep its conversation for the next turn. Interrupted
+// runs are not reported.
+func WithCompletionHandler(fn func(ctx context.Context, st types.State)) compose.Option {
+	report := func(ctx context.Context, info *callbacks.RunInfo) context.Context {
+		if info.Component != compose.ComponentOfGraph {
+			return ctx
+		}
+		_ = compose.ProcessState(ctx, func(ctx context.Context, st types.State) error {
+			fn(ctx, st)
+			return nil
+		})
+		return ctx
+	}
+
+	handler := callbacks.NewHandlerBuilder().
+		OnEndFn(func(ctx context.Context, info *callbacks.RunInfo, _ callbacks.CallbackOutput) context.Context {
+			return report(ctx, info)
+		}).
+		OnEndWithStreamOutputFn(func(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+			output.Close()
+			return report(ctx, info)
+		}).
+		Build()
+	return compose.WithCallbacks(handler)
+}
+
+// Summarizer condenses the messages a HistoryWindow drops into a text
+type Summarizer func(ctx context.Context, msgs []*schema.Message) (string, error)
+
+// HistoryWindow bounds the history a conversation carries into its next turn
+type HistoryWindow struct {
+	// MaxMessages is the number of messages kept after the leading system
+	// messages, 0 for no limit. Tool results are kept with their calls, so
+	// fewer may be kept.
+	MaxMessages int
+	// Summarize, when set, replaces the dropped messages with a system
+	// message summarizing them, which a later window summarizes again
+	Summarize Summarizer
+}
+
+// Apply returns the history to continue the conversation with
+func (w HistoryWindow) Apply(ctx context.Context, history []*schema.Message) ([]*schema.Message, error) {
+	head := 0
+	for head < len(history) && history[head].Role == schema.System && !strings.HasPrefix(history[head].Content, summaryPrefix) {
+		head++
+	}
+	rest := history[head:]
+	if w.MaxMessages <= 0 || len(rest) <= w.MaxMessages {
+		return history, nil
+	}
+
+	cut := len(rest) - w.MaxMessages
+	for cut < len(rest) && rest[cut].Role == schema.Tool {
+		cut++
+	}
+
+	windowed := make([]*schema.Message, 0, head+1+len(rest)-cut)
+	windowed = append(windowed, history[:head]...)
+	if w.Summarize != nil {
+		summary, err := w.Summarize(ctx, rest[:cut])
+		if err != nil {
+			return nil, fmt.Errorf("summarize history: %w", err)
+		}
+		windowed = append(windowed, schema.SystemMessage(summaryPrefix+summary))
+	}
+	return append(windowed, rest[cut:]...), nil
+}
+
+// ModelSummarizer summarizes with a chat model
+func ModelSummarizer(cm model.BaseChatModel) Summarizer {
+	return func(ctx context.Context, msgs []*schema.Message) (string, error) {
+		var b strings.Builder
+		for _, m := range msgs {
+			fmt.Fprintf(&b, "%s: %s\n", m.Role, m.Content)
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&b, "%s called %s(%s)\n", m.Role, tc.Function.Name, tc.Function.Arguments)
+			}
+		}
+
+		out, err := cm.Generate(ctx, []*schema.Message{
+			schema.SystemMessage("Summarize the conversation below in a few sentences. " +
+				"Keep the names, numbers and decisions needed to continue it."),
+			schema.UserMessage(b.String()),
+		})
+		if err != nil {
+			return "", err
+		}
+		return out.Content, nil
+	}
+}
@@ -0,0 +1,156 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// twoBookings is a conversation of two turns, the second calling two tools
+func twoBookings() []*schema.Message {
+	return []*schema.Message{
+		schema.SystemMessage("You book tickets."),
+		schema.SystemMessage("Be brief."),
+		schema.UserMessage("Book Paris"),
+		toolCallReply("c1", "BookTicket", `{"location":"Paris"}`),
+		schema.ToolMessage("booked Paris", "c1"),
+		schema.AssistantMessage("Booked Paris", nil),
+		schema.UserMessage("And Rome and Oslo?"),
+		toolCallReply("c2", "BookTicket", `{"location":"Rome"}`, "c3", "BookTicket", `{"location":"Oslo"}`),
+		schema.ToolMessage("booked Rome", "c2"),
+		schema.ToolMessage("booked Oslo", "c3"),
+		schema.AssistantMessage("Booked both", nil),
+	}
+}
+
+// describe lists the roles and contents of msgs, tool calls by ID
+func describe(msgs []*schema.Message) string {
+	var parts []string
+	for _, m := range msgs {
+		switch {
+		case len(m.ToolCalls) > 0:
+			var ids []string
+			for _, tc := range m.ToolCalls {
+				ids = append(ids, tc.ID)
+			}
+			parts = append(parts, "calls "+strings.Join(ids, "+"))
+		case m.Role == schema.Tool:
+			parts = append(parts, "result "+m.ToolCallID)
+		default:
+			parts = append(parts, string(m.Role)+" "+m.Content)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestHistoryWindow(t *testing.T) {
+	ctx := context.Background()
+	system := "system You book tickets. | system Be brief. | "
+
+	tests := []struct {
+		name string
+		max  int
+		want string
+	}{
+		{"no limit", 0, describe(twoBookings())},
+		{"within limit", 9, describe(twoBookings())},
+		{"cut at a turn", 5, system + "user And Rome and Oslo? | calls c2+c3 | result c2 | result c3 | assistant Booked both"},
+		{"cut at calls", 4, system + "calls c2+c3 | result c2 | result c3 | assistant Booked both"},
+		// Results are not kept without their calls, so fewer messages are kept
+		{"cut in results", 3, system + "assistant Booked both"},
+		{"cut at the last result", 2, system + "assistant Booked both"},
+		{"cut after a result", 6, system + "assistant Booked Paris | user And Rome and Oslo? | calls c2+c3 | result c2 | result c3 | assistant Booked both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HistoryWindow{MaxMessages: tt.max}.Apply(ctx, twoBookings())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if describe(got) != tt.want {
+				t.Fatalf("window =\n%s\nwant\n%s", describe(got), tt.want)
+			}
+			checkToolResults(t, got)
+		})
+	}
+}
+
+// checkToolResults fails unless every tool result follows its call
+func checkToolResults(t *testing.T, msgs []*schema.Message) {
+	t.Helper()
+	called := make(map[string]bool)
+	for _, m := range msgs {
+		for _, tc := range m.ToolCalls {
+			called[tc.ID] = true
+		}
+		if m.Role == schema.Tool && !called[m.ToolCallID] {
+			t.Fatalf("result %s without its call in %s", m.ToolCallID, describe(msgs))
+		}
+	}
+}
+
+func TestHistoryWindowSummarizes(t *testing.T) {
+	ctx := context.Background()
+	var summarized []string
+	w := HistoryWindow{MaxMessages: 4, Summarize: func(_ context.Context, msgs []*schema.Message) (string, error) {
+		summarized = append(summarized, describe(msgs))
+		return "turn " + string(rune('0'+len(summarized))), nil
+	}}
+
+	first, err := w.Apply(ctx, twoBookings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "system You book tickets. | system Be brief. | system " + summaryPrefix + "turn 1 | calls c2+c3 | result c2 | result c3 | assistant Booked both"
+	if describe(first) != want {
+		t.Fatalf("window =\n%s\nwant\n%s", describe(first), want)
+	}
+	if want := "user Book Paris | calls c1 | result c1 | assistant Booked Paris | user And Rome and Oslo?"; summarized[0] != want {
+		t.Fatalf("summarized %s, want %s", summarized[0], want)
+	}
+
+	// The next turn summarizes the earlier summary with what it drops,
+	// keeping only the leading system messages of the prompt
+	next := append(first, schema.UserMessage("Thanks"), schema.AssistantMessage("You're welcome", nil))
+	second, err := w.Apply(ctx, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "system You book tickets. | system Be brief. | system " + summaryPrefix + "turn 2 | assistant Booked both | user Thanks | assistant You're welcome"
+	if describe(second) != want {
+		t.Fatalf("window =\n%s\nwant\n%s", describe(second), want)
+	}
+	if want := "system " + summaryPrefix + "turn 1 | calls c2+c3 | result c2 | result c3"; summarized[1] != want {
+		t.Fatalf("summarized %s, want %s", summarized[1], want)
+	}
+}
+
+func TestHistoryWindowSummarizeError(t *testing.T) {
+	failed := errors.New("model down")
+	w := HistoryWindow{MaxMessages: 2, Summarize: func(context.Context, []*schema.Message) (string, error) {
+		return "", failed
+	}}
+	if _, err := w.Apply(context.Background(), twoBookings()); !errors.Is(err, failed) {
+		t.Fatalf("Apply = %v, want the summarizer's error", err)
+	}
+}
+
+func TestModelSummarizer(t *testing.T) {
+	cm := &fakeChatModel{replies: []*schema.Message{schema.AssistantMessage("Paris is booked.", nil)}}
+	summary, err := ModelSummarizer(cm)(context.Background(), twoBookings()[2:6])
+	if err != nil || summary != "Paris is booked." {
+		t.Fatalf("summary = %q, %v", summary, err)
+	}
+	in := cm.lastInput()
+	if len(in) != 2 || in[0].Role != schema.System {
+		t.Fatalf("model input = %s", describe(in))
+	}
+	for _, want := range []string{"user: Book Paris", `assistant called BookTicket({"location":"Paris"})`, "tool: booked Paris"} {
+		if !strings.Contains(in[1].Content, want) {
+			t.Errorf("transcript lacks %q:\n%s", want, in[1].Content)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/types"
+)
+
+// threeCalls is a model turn booking two tickets and refunding one
+var threeCalls = []string{
+	"call-1", "BookTicket", `{"location":"Paris"}`,
+	"call-2", "BookTicket", `{"location":"Rome"}`,
+	"call-3", "Refund", `{"amount":900}`,
+}
+
+// interruptedRun runs until the graph stops before ToolsNode with calls pending
+func interruptedRun(t *testing.T, calls ...string) *testRun {
+	t.Helper()
+	r := newTestRun(t, Config{}, []*schema.Message{toolCallReply(calls...)}, "BookTicket", "Refund", types.AskHumanToolName)
+	if _, info := r.run(t, "cp"); stoppedAt(info) != "before ToolsNode" {
+		t.Fatalf("stopped at %q, want before ToolsNode", stoppedAt(info))
+	}
+	return r
+}
+
+// toolResults maps the tool call IDs answered in the model's last input to
+// their results
+func toolResults(t *testing.T, r *testRun) map[string]string {
+	t.Helper()
+	results := make(map[string]string)
+	for _, msg := range r.model.lastInput() {
+		if msg.Role != schema.Tool {
+			continue
+		}
+		if _, dup := results[msg.ToolCallID]; dup {
+			t.Fatalf("tool call %s answered twice", msg.ToolCallID)
+		}
+		results[msg.ToolCallID] = msg.Content
+	}
+	return results
+}
+
+func TestToolDecisions(t *testing.T) {
+	tests := []struct {
+		name      string
+		decisions []types.ToolDecision
+		// ran lists the arguments each tool ran with
+		ran map[string][]string
+		// results are the tool results the model saw, by call ID
+		results map[string]string
+	}{
+		{
+			name: "no decisions",
+			ran:  map[string][]string{"BookTicket": {`{"location":"Paris"}`, `{"location":"Rome"}`}, "Refund": {`{"amount":900}`}},
+			results: map[string]string{
+				"call-1": `BookTicket ran with {"location":"Paris"}`,
+				"call-2": `BookTicket ran with {"location":"Rome"}`,
+				"call-3": `Refund ran with {"amount":900}`,
+			},
+		},
+		{
+			name: "approve, edit and reject",
+			decisions: []types.ToolDecision{
+				{ToolCallID: "call-1", Action: types.DecisionApprove},
+				{ToolCallID: "call-2", Action: types.DecisionEdit, Arguments: `{"location":"Oslo"}`},
+				{ToolCallID: "call-3", Action: types.DecisionReject, Reason: "refunds need a manager"},
+			},
+			ran: map[string][]string{"BookTicket": {`{"location":"Paris"}`, `{"location":"Oslo"}`}},
+			results: map[string]string{
+				"call-1": `BookTicket ran with {"location":"Paris"}`,
+				"call-2": `BookTicket ran with {"location":"Oslo"}`,
+				"call-3": "The user rejected this tool call: refunds need a manager",
+			},
+		},
+		{
+			name: "reject all",
+			decisions: []types.ToolDecision{
+				{ToolCallID: "call-3", Action: types.DecisionReject},
+				{ToolCallID: "call-1", Action: types.DecisionReject},
+				{ToolCallID: "call-2", Action: types.DecisionReject},
+			},
+			ran: map[string][]string{},
+			results: map[string]string{
+				"call-1": "The user rejected this tool call.",
+				"call-2": "The user rejected this tool call.",
+				"call-3": "The user rejected this tool call.",
+			},
+		},
+		{
+			name: "answer",
+			decisions: []types.ToolDecision{
+				{ToolCallID: "call-2", Action: types.DecisionAnswer, Answer: "Already booked"},
+			},
+			ran: map[string][]string{"BookTicket": {`{"location":"Paris"}`}, "Refund": {`{"amount":900}`}},
+			results: map[string]string{
+				"call-1": `BookTicket ran with {"location":"Paris"}`,
+				"call-2": "Already booked",
+				"call-3": `Refund ran with {"amount":900}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := interruptedRun(t, threeCalls...)
+
+			if tt.decisions != nil {
+				if err := r.store.ApplyToolDecisions(ctx, "cp", tt.decisions, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			out, info := r.run(t, "cp")
+			if info != nil || out.Content != "done" {
+				t.Fatalf("resume = %v, %+v", out, info)
+			}
+
+			for name, ft := range r.tools {
+				got, want := ft.ranWith(), tt.ran[name]
+				if strings.Join(got, " ") != strings.Join(want, " ") {
+					t.Errorf("%s ran with %v, want %v", name, got, want)
+				}
+			}
+			results := toolResults(t, r)
+			if len(results) != len(tt.results) {
+				t.Fatalf("model saw results %v, want %v", results, tt.results)
+			}
+			for id, want := range tt.results {
+				if results[id] != want {
+					t.Errorf("result of %s = %q, want %q", id, results[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidToolDecisions(t *testing.T) {
+	ask := append([]string{"call-4", types.AskHumanToolName, `{"question":"Which class?"}`}, threeCalls...)
+
+	tests := []struct {
+		name      string
+		calls     []string
+		decisions []types.ToolDecision
+	}{
+		{"unknown ID", threeCalls, []types.ToolDecision{
+			{ToolCallID: "call-1", Action: types.DecisionApprove},
+			{ToolCallID: "call-9", Action: types.DecisionReject},
+		}},
+		{"duplicate ID", threeCalls, []types.ToolDecision{
+			{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":"Oslo"}`},
+			{ToolCallID: "call-1", Action: types.DecisionReject},
+		}},
+		{"unknown action", threeCalls, []types.ToolDecision{{ToolCallID: "call-1", Action: "postpone"}}},
+		{"edit to invalid JSON", threeCalls, []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":`}}},
+		{"approve ask_human", ask, []types.ToolDecision{{ToolCallID: "call-4", Action: types.DecisionApprove}}},
+		{"edit ask_human", ask, []types.ToolDecision{{ToolCallID: "call-4", Action: types.DecisionEdit, Arguments: `{}`}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := interruptedRun(t, tt.calls...)
+			before, _, _ := r.store.Get(ctx, "cp")
+
+			if err := r.store.ApplyToolDecisions(ctx, "cp", tt.decisions, checkpoint.AnyRevision); !errors.Is(err, types.ErrInvalidDecision) {
+				t.Fatalf("ApplyToolDecisions = %v, want ErrInvalidDecision", err)
+			}
+			// Nothing was applied, not even the valid decisions
+			after, _, _ := r.store.Get(ctx, "cp")
+			if string(after) != string(before) {
+				t.Fatal("checkpoint changed")
+			}
+			if rev, _ := r.store.Revision(ctx, "cp"); rev != 1 {
+				t.Fatalf("revision %d, want 1", rev)
+			}
+		})
+	}
+}
+
+func TestToolDecisionsConflict(t *testing.T) {
+	ctx := context.Background()
+	r := interruptedRun(t, threeCalls...)
+	reject := []types.ToolDecision{{ToolCallID: "call-3", Action: types.DecisionReject}}
+
+	if err := r.store.ApplyToolDecisions(ctx, "cp", reject, 1); err != nil {
+		t.Fatal(err)
+	}
+	// A second reviewer decided on the revision the first one replaced
+	approve := []types.ToolDecision{{ToolCallID: "call-3", Action: types.DecisionApprove}}
+	if err := r.store.ApplyToolDecisions(ctx, "cp", approve, 1); !errors.Is(err, checkpoint.ErrConflict) {
+		t.Fatalf("stale decision = %v, want ErrConflict", err)
+	}
+	// Once answered, a call is no longer pending
+	if err := r.store.ApplyToolDecisions(ctx, "cp", approve, 2); !errors.Is(err, types.ErrInvalidDecision) {
+		t.Fatalf("decision on an answered call = %v, want ErrInvalidDecision", err)
+	}
+}
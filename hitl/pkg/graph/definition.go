@@ -0,0 +1,249 @@
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/cloudwego/eino/compose"
+	"gopkg.in/yaml.v3"
+
+	"eino_testing/hitl/pkg/checkpoint"
+)
+
+// Node types accepted in a Definition
+const (
+	NodeChatTemplate = "chat_template"
+	NodeChatModel    = "chat_model"
+	NodeTools        = "tools"
+	NodeLambda       = "lambda"
+)
+
+// Definition describes a graph declaratively, with its components resolved
+// by name from a Registry. It is usually loaded from YAML or JSON:
+//
+//	name: booking
+//	nodes:
+//	  - {name: ChatTemplate, type: chat_template, component: booking}
+//	  - {name: ChatModel, type: chat_model, component: openai, tools: [BookTicket]}
+//	  - {name: ToolsNode, type: tools, tools: [BookTicket]}
+//	edges:
+//	  - {from: start, to: ChatTemplate}
+//	  - {from: ChatTemplate, to: ChatModel}
+//	  - {from: ToolsNode, to: ChatModel}
+//	branches:
+//	  - from: ChatModel
+//	    cases:
+//	      - {when: has_tool_calls, to: ToolsNode}
+//	    default: end
+//	interrupt_before: [ToolsNode]
+//	tool_approval:
+//	  tools: {get_game: skip}
+type Definition struct {
+	Name            string      `json:"name" yaml:"name"`
+	Nodes           []NodeDef   `json:"nodes" yaml:"nodes"`
+	Edges           []EdgeDef   `json:"edges" yaml:"edges"`
+	Branches        []BranchDef `json:"branches,omitempty" yaml:"branches,omitempty"`
+	InterruptBefore []string    `json:"interrupt_before,omitempty" yaml:"interrupt_before,omitempty"`
+	InterruptAfter  []string    `json:"interrupt_after,omitempty" yaml:"interrupt_after,omitempty"`
+	// Interrupts are conditional interrupt points, see InterruptRule
+	Interrupts []InterruptDef `json:"interrupts,omitempty" yaml:"interrupts,omitempty"`
+	// ToolApproval decides per tool whether tools nodes in InterruptBefore stop
+	ToolApproval *ToolPolicy `json:"tool_approval,omitempty" yaml:"tool_approval,omitempty"`
+}
+
+// NodeDef is a node of a Definition
+type NodeDef struct {
+	Name string `json:"name" yaml:"name"`
+	// Type is one of the Node* constants
+	Type string `json:"type" yaml:"type"`
+	// Component is the registry name of the node's component. Tools nodes may
+	// list Tools instead.
+	Component string `json:"component,omitempty" yaml:"component,omitempty"`
+	// Tools are registry tool names, bound to a chat model or run by a tools node
+	Tools []string `json:"tools,omitempty" yaml:"tools,omitempty"`
+}
+
+// EdgeDef connects two nodes; "start" and "end" are the graph's entry and exit
+type EdgeDef struct {
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+}
+
+// BranchDef routes the output of a node to the first case whose predicate
+// matches its (last) message, or to Default, which is "end" when empty
+type BranchDef struct {
+	From    string       `json:"from" yaml:"from"`
+	Cases   []BranchCase `json:"cases" yaml:"cases"`
+	Default string       `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// BranchCase is a predicate and the node it routes to. See Registry.Predicate
+// for the predicates available.
+type BranchCase struct {
+	When string `json:"when" yaml:"when"`
+	To   string `json:"to" yaml:"to"`
+}
+
+// InterruptDef is a conditional interrupt point. It matches when the When
+// predicate (see Registry.Predicate) and, if given, the Arguments JSON schema
+// for calls to Tool both match.
+type InterruptDef struct {
+	Node      string         `json:"node" yaml:"node"`
+	After     bool           `json:"after,omitempty" yaml:"after,omitempty"`
+	When      string         `json:"when,omitempty" yaml:"when,omitempty"`
+	Tool      string         `json:"tool,omitempty" yaml:"tool,omitempty"`
+	Arguments map[string]any `json:"arguments,omitempty" yaml:"arguments,omitempty"`
+}
+
+// DefaultDefinition is the ChatTemplate → ChatModel → ToolsNode loop built by
+// NewGraph when no Definition is configured, using the components registered
+// as "default"
+func DefaultDefinition() *Definition {
+	return &Definition{
+		Name: DefaultName,
+		Nodes: []NodeDef{
+			{Name: "ChatTemplate", Type: NodeChatTemplate, Component: "default"},
+			{Name: "ChatModel", Type: NodeChatModel, Component: "default"},
+			{Name: "ToolsNode", Type: NodeTools, Component: "default"},
+		},
+		Edges: []EdgeDef{
+			{From: compose.START, To: "ChatTemplate"},
+			{From: "ChatTemplate", To: "ChatModel"},
+			{From: "ToolsNode", To: "ChatModel"},
+		},
+		Branches: []BranchDef{{
+			From:    "ChatModel",
+			Cases:   []BranchCase{{When: PredicateHasToolCalls, To: "ToolsNode"}},
+			Default: compose.END,
+		}},
+		InterruptBefore: []string{"ToolsNode"},
+	}
+}
+
+// LoadDefinition reads a YAML or JSON graph definition from a file
+func LoadDefinition(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read graph definition: %w", err)
+	}
+	def, err := ParseDefinition(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// ParseDefinition parses and validates a YAML or JSON graph definition
+func ParseDefinition(data []byte) (*Definition, error) {
+	var def Definition
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&def); err != nil {
+		return nil, fmt.Errorf("parse graph definition: %w", err)
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// Validate checks that the definition is well formed: node names are unique,
+// types are known, and edges, branches and interrupt points name existing
+// nodes. Components and predicates are checked when the graph is built.
+func (d *Definition) Validate() error {
+	if len(d.Nodes) == 0 {
+		return fmt.Errorf("graph definition has no nodes")
+	}
+
+	nodes := make(map[string]bool, len(d.Nodes))
+	for _, n := range d.Nodes {
+		switch {
+		case n.Name == "":
+			return fmt.Errorf("node without a name")
+		case n.Name == compose.START || n.Name == compose.END:
+			return fmt.Errorf("node name %q is reserved", n.Name)
+		case nodes[n.Name]:
+			return fmt.Errorf("duplicate node %q", n.Name)
+		}
+		nodes[n.Name] = true
+
+		switch n.Type {
+		case NodeChatTemplate, NodeChatModel, NodeLambda:
+			if n.Component == "" {
+				return fmt.Errorf("node %q: %s needs a component", n.Name, n.Type)
+			}
+		case NodeTools:
+			if n.Component == "" && len(n.Tools) == 0 {
+				return fmt.Errorf("node %q: tools needs a component or a tool list", n.Name)
+			}
+		default:
+			return fmt.Errorf("node %q: unknown type %q", n.Name, n.Type)
+		}
+	}
+
+	from := func(name string) bool { return name == compose.START || nodes[name] }
+	to := func(name string) bool { return name == compose.END || nodes[name] }
+
+	for _, e := range d.Edges {
+		if !from(e.From) || !to(e.To) {
+			return fmt.Errorf("edge %s -> %s: unknown node", e.From, e.To)
+		}
+	}
+	for _, b := range d.Branches {
+		if !nodes[b.From] {
+			return fmt.Errorf("branch from %q: unknown node", b.From)
+		}
+		if len(b.Cases) == 0 {
+			return fmt.Errorf("branch from %q has no cases", b.From)
+		}
+		for _, c := range b.Cases {
+			if c.When == "" {
+				return fmt.Errorf("branch from %q: case without a predicate", b.From)
+			}
+			if !to(c.To) {
+				return fmt.Errorf("branch from %q: unknown node %q", b.From, c.To)
+			}
+		}
+		if b.Default != "" && !to(b.Default) {
+			return fmt.Errorf("branch from %q: unknown default node %q", b.From, b.Default)
+		}
+	}
+	for _, name := range d.InterruptBefore {
+		if !nodes[name] {
+			return fmt.Errorf("interrupt before %q: unknown node", name)
+		}
+	}
+	for _, name := range d.InterruptAfter {
+		if !nodes[name] {
+			return fmt.Errorf("interrupt after %q: unknown node", name)
+		}
+	}
+	for _, i := range d.Interrupts {
+		if !nodes[i.Node] {
+			return fmt.Errorf("interrupt at %q: unknown node", i.Node)
+		}
+		if i.When == "" && i.Arguments == nil {
+			return fmt.Errorf("interrupt at %q needs when or arguments", i.Node)
+		}
+	}
+	if d.ToolApproval != nil {
+		if err := d.ToolApproval.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Info describes the graph built from the definition
+func (d *Definition) Info() checkpoint.GraphInfo {
+	name := d.Name
+	if name == "" {
+		name = DefaultName
+	}
+	nodes := make([]string, 0, len(d.Nodes))
+	for _, n := range d.Nodes {
+		nodes = append(nodes, n.Name)
+	}
+	return checkpoint.GraphInfo{Name: name, Nodes: nodes}
+}
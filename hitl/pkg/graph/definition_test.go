@@ -0,0 +1,239 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+)
+
+const bookingYAML = `
+name: booking
+nodes:
+  - {name: Prompt, type: chat_template, component: default}
+  - {name: Agent, type: chat_model, component: default, tools: [BookTicket]}
+  - {name: Tools, type: tools, tools: [BookTicket]}
+edges:
+  - {from: start, to: Prompt}
+  - {from: Prompt, to: Agent}
+  - {from: Tools, to: Agent}
+branches:
+  - from: Agent
+    cases:
+      - {when: has_tool_calls, to: Tools}
+    default: end
+interrupt_before: [Tools]
+tool_approval:
+  tools: {get_weather: skip}
+`
+
+const bookingJSON = `{
+  "name": "booking",
+  "nodes": [
+    {"name": "Prompt", "type": "chat_template", "component": "default"},
+    {"name": "Agent", "type": "chat_model", "component": "default", "tools": ["BookTicket"]},
+    {"name": "Tools", "type": "tools", "tools": ["BookTicket"]}
+  ],
+  "edges": [
+    {"from": "start", "to": "Prompt"},
+    {"from": "Prompt", "to": "Agent"},
+    {"from": "Tools", "to": "Agent"}
+  ],
+  "branches": [{"from": "Agent", "cases": [{"when": "has_tool_calls", "to": "Tools"}], "default": "end"}],
+  "interrupt_before": ["Tools"],
+  "tool_approval": {"tools": {"get_weather": "skip"}}
+}`
+
+func TestParseDefinition(t *testing.T) {
+	fromYAML, err := ParseDefinition([]byte(bookingYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ParseDefinition([]byte(bookingJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Fatalf("YAML and JSON differ:\n%+v\n%+v", fromYAML, fromJSON)
+	}
+
+	info := fromYAML.Info()
+	if info.Name != "booking" || strings.Join(info.Nodes, ",") != "Prompt,Agent,Tools" {
+		t.Fatalf("Info = %+v", info)
+	}
+	if fromYAML.ToolApproval.RequiresApproval("get_weather") || !fromYAML.ToolApproval.RequiresApproval("BookTicket") {
+		t.Fatalf("tool approval = %+v", fromYAML.ToolApproval)
+	}
+
+	// Typos are errors rather than silently ignored
+	if _, err := ParseDefinition([]byte(strings.Replace(bookingYAML, "interrupt_before", "interupt_before", 1))); err == nil {
+		t.Fatal("unknown field accepted")
+	}
+	if _, err := ParseDefinition([]byte("nodes: [")); err == nil {
+		t.Fatal("invalid YAML accepted")
+	}
+
+	// The default loop is a valid definition of the default nodes
+	def := DefaultDefinition()
+	if err := def.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if info := def.Info(); info.Name != DefaultName || !reflect.DeepEqual(info.Nodes, Nodes()) {
+		t.Fatalf("default Info = %+v", info)
+	}
+}
+
+func TestLoadDefinition(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "booking.yaml")
+	os.WriteFile(path, []byte(bookingYAML), 0644)
+
+	def, err := LoadDefinition(path)
+	if err != nil || def.Name != "booking" {
+		t.Fatalf("LoadDefinition = %+v, %v", def, err)
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	os.WriteFile(bad, []byte("name: bad\nnodes: []\n"), 0644)
+	if _, err := LoadDefinition(bad); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Fatalf("LoadDefinition of an invalid file = %v, want an error naming it", err)
+	}
+	if _, err := LoadDefinition(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Fatal("LoadDefinition of a missing file succeeded")
+	}
+}
+
+func TestValidateDefinition(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(d *Definition)
+		want   string
+	}{
+		{"no nodes", func(d *Definition) { d.Nodes = nil }, "no nodes"},
+		{"unnamed node", func(d *Definition) { d.Nodes[0].Name = "" }, "without a name"},
+		{"reserved name", func(d *Definition) { d.Nodes[0].Name = "end" }, "reserved"},
+		{"duplicate node", func(d *Definition) { d.Nodes[1].Name = "Prompt" }, "duplicate node"},
+		{"unknown type", func(d *Definition) { d.Nodes[0].Type = "retriever" }, "unknown type"},
+		{"no component", func(d *Definition) { d.Nodes[1].Component = "" }, "needs a component"},
+		{"empty tools node", func(d *Definition) { d.Nodes[2].Tools = nil }, "component or a tool list"},
+		{"edge to unknown node", func(d *Definition) { d.Edges[1].To = "Agnet" }, "unknown node"},
+		{"edge into start", func(d *Definition) { d.Edges[1].To = "start" }, "unknown node"},
+		{"edge from end", func(d *Definition) { d.Edges[1].From = "end" }, "unknown node"},
+		{"branch from unknown node", func(d *Definition) { d.Branches[0].From = "Agnet" }, "unknown node"},
+		{"branch without cases", func(d *Definition) { d.Branches[0].Cases = nil }, "no cases"},
+		{"case without predicate", func(d *Definition) { d.Branches[0].Cases[0].When = "" }, "without a predicate"},
+		{"case to unknown node", func(d *Definition) { d.Branches[0].Cases[0].To = "Toolz" }, "unknown node"},
+		{"unknown default", func(d *Definition) { d.Branches[0].Default = "Toolz" }, "unknown default"},
+		{"interrupt before unknown node", func(d *Definition) { d.InterruptBefore = []string{"Toolz"} }, "interrupt before"},
+		{"interrupt after unknown node", func(d *Definition) { d.InterruptAfter = []string{"Toolz"} }, "interrupt after"},
+		{"rule at unknown node", func(d *Definition) { d.Interrupts = []InterruptDef{{Node: "Toolz", When: "has_tool_calls"}} }, "unknown node"},
+		{"rule without condition", func(d *Definition) { d.Interrupts = []InterruptDef{{Node: "Tools"}} }, "needs when or arguments"},
+		{"unknown approval", func(d *Definition) { d.ToolApproval.Default = "maybe" }, "unknown tool approval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := ParseDefinition([]byte(bookingYAML))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(def)
+			if err := def.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefinitionGraph(t *testing.T) {
+	def, err := ParseDefinition([]byte(bookingYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRun(t, Config{Definition: def},
+		[]*schema.Message{toolCallReply("call-1", "BookTicket", `{"location":"Paris"}`)},
+		"BookTicket")
+
+	_, info := r.run(t, "cp")
+	if info == nil || len(info.BeforeNodes) != 1 || info.BeforeNodes[0] != "Tools" {
+		t.Fatalf("interrupt = %+v, want before Tools", info)
+	}
+	// Checkpoints are indexed under the definition's name
+	if m, err := r.store.GetMetadata(context.Background(), "cp"); err != nil || m.GraphName != "booking" {
+		t.Fatalf("metadata = %+v, %v", m, err)
+	}
+
+	out, info := r.run(t, "cp")
+	if info != nil || out.Content != "done" {
+		t.Fatalf("resume = %v, %+v", out, info)
+	}
+	if got := r.tools["BookTicket"].ranWith(); len(got) != 1 || got[0] != `{"location":"Paris"}` {
+		t.Fatalf("tool ran with %v", got)
+	}
+}
+
+func TestDefinitionUnknownComponent(t *testing.T) {
+	def, err := ParseDefinition([]byte(strings.Replace(bookingYAML, "tools: [BookTicket]}\n  - {name: Tools", "tools: [CancelTicket]}\n  - {name: Tools", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{Definition: def, Registry: NewRegistry()}
+	cfg.Registry.RegisterChatTemplate("default", prompt.FromMessages(schema.FString, schema.UserMessage("hi")))
+	cfg.Registry.RegisterChatModel("default", &fakeChatModel{})
+	// BookTicket is registered, but the model is bound to CancelTicket
+	cfg.Registry.RegisterTool(context.Background(), &fakeTool{name: "BookTicket"})
+	if _, err := NewGraph[map[string]any, *schema.Message](context.Background(), cfg); !errors.Is(err, ErrUnknownComponent) {
+		t.Fatalf("NewGraph = %v, want ErrUnknownComponent", err)
+	}
+}
+
+func TestRegistryPredicate(t *testing.T) {
+	ctx := context.Background()
+	reg := NewRegistry()
+	reg.RegisterPredicate("long", func(_ context.Context, msg *schema.Message) (bool, error) {
+		return len(msg.Content) > 10, nil
+	})
+
+	booking := toolCallReply("call-1", "BookTicket", `{}`)
+	booking.Content = "Booking it NOW"
+	answer := schema.AssistantMessage("Done", nil)
+
+	tests := []struct {
+		expr            string
+		booking, answer bool
+	}{
+		{"has_tool_calls", true, false},
+		{"!has_tool_calls", false, true},
+		{"tool:BookTicket", true, false},
+		{"tool:CancelTicket", false, false},
+		{"role:assistant", true, true},
+		{"role:user", false, false},
+		{"contains:now", true, false},
+		{"!contains:now", false, true},
+		{"long", true, false},
+		{"!long", false, true},
+	}
+	for _, tt := range tests {
+		p, err := reg.Predicate(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got, _ := p(ctx, booking); got != tt.booking {
+			t.Errorf("%s(booking) = %v", tt.expr, got)
+		}
+		if got, _ := p(ctx, answer); got != tt.answer {
+			t.Errorf("%s(answer) = %v", tt.expr, got)
+		}
+	}
+
+	for _, expr := range []string{"short", "!short"} {
+		if _, err := reg.Predicate(expr); !errors.Is(err, ErrUnknownComponent) {
+			t.Errorf("Predicate(%s) = %v, want ErrUnknownComponent", expr, err)
+		}
+	}
+}
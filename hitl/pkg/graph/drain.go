@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+type drainKey struct{}
+
+// drained is the interrupt extra of a node stopped by a drain
+type drained struct{}
+
+// WithDrain returns a ctx under which a run stops at its next chat model or
+// tools node once drain is closed, and interrupts a chat model call that is
+// still waiting for the model. The interrupt saves a checkpoint the node
+// reruns from when the run is resumed, e.g. after a server restart; see
+// IsDrained.
+func WithDrain(ctx context.Context, drain <-chan struct{}) context.Context {
+	return context.WithValue(ctx, drainKey{}, drain)
+}
+
+// IsDrained reports whether an interrupt was raised by the drain of WithDrain
+// rather than for a human
+func IsDrained(info *compose.InterruptInfo) bool {
+	for _, extra := range info.RerunNodesExtra {
+		if _, ok := extra.(drained); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// drainFrom returns the drain of ctx, nil when there is none
+func drainFrom(ctx context.Context) <-chan struct{} {
+	drain, _ := ctx.Value(drainKey{}).(<-chan struct{})
+	return drain
+}
+
+// checkDrain returns the interrupt stopping a node once the drain of ctx is
+// closed
+func checkDrain(ctx context.Context) error {
+	select {
+	case <-drainFrom(ctx):
+		return compose.NewInterruptAndRerunErr(drained{})
+	default:
+		return nil
+	}
+}
+
+// drainingModel stops a chat model node when the drain of its ctx closes,
+// without waiting for the model to answer
+type drainingModel struct {
+	model.ToolCallingChatModel
+}
+
+func (m *drainingModel) Generate(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	drain := drainFrom(ctx)
+	if drain == nil {
+		return m.ToolCallingChatModel.Generate(ctx, in, opts...)
+	}
+	if err := checkDrain(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		msg *schema.Message
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		msg, err := m.ToolCallingChatModel.Generate(ctx, in, opts...)
+		done <- result{msg, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.msg, r.err
+	case <-drain:
+		return nil, compose.NewInterruptAndRerunErr(drained{})
+	}
+}
+
+func (m *drainingModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if err := checkDrain(ctx); err != nil {
+		return nil, err
+	}
+	return m.ToolCallingChatModel.Stream(ctx, in, opts...)
+}
+
+func (m *drainingModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	cm, err := m.ToolCallingChatModel.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &drainingModel{cm}, nil
+}
+
+// GetType and IsCallbacksEnabled keep the callbacks of the wrapped model: the
+// graph would otherwise run them a second time around the wrapper
+
+func (m *drainingModel) GetType() string {
+	typ, _ := components.GetType(m.ToolCallingChatModel)
+	return typ
+}
+
+func (m *drainingModel) IsCallbacksEnabled() bool {
+	return components.IsCallbacksEnabled(m.ToolCallingChatModel)
+}
@@ -2,72 +2,398 @@ package graph
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/types"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
-	"eino_testing/hitl/pkg/types"
 )
 
+// DefaultName is the graph name used when Config.Name is empty
+const DefaultName = "hitl"
+
 // Config holds configuration for graph creation
 type Config struct {
-	ChatTemplate prompt.ChatTemplate
-	ChatModel    model.ToolCallingChatModel
-	ToolsNode    *compose.ToolsNode
-	CheckPointStore compose.CheckPointStore
+	ChatTemplate         prompt.ChatTemplate
+	ChatModel            model.ToolCallingChatModel
+	ToolsNode            *compose.ToolsNode
+	CheckPointStore      compose.CheckPointStore
 	InterruptBeforeNodes []string
+	InterruptAfterNodes  []string
+	// Interrupts are conditional interrupt points added to the definition's.
+	// A node with rules stops only when one of them matches, even if it is also
+	// listed in InterruptBeforeNodes or InterruptAfterNodes.
+	Interrupts []InterruptRule
+	// ToolPolicy lets tools nodes interrupt only for tools that need approval,
+	// overriding the definition's tool_approval
+	ToolPolicy *ToolPolicy
+	// Name identifies the graph in checkpoint bundles and the checkpoint index
+	Name string
+	// Definition, when set, replaces the built-in ChatTemplate → ChatModel →
+	// ToolsNode loop; its components are resolved from Registry and the
+	// components above are ignored
+	Definition *Definition
+	Registry   *Registry
+}
+
+// Nodes returns the names of the nodes added by NewGraph
+func Nodes() []string {
+	return []string{"ChatTemplate", "ChatModel", "ToolsNode"}
+}
+
+// Info describes the graph NewGraph builds for cfg
+func Info(cfg Config) checkpoint.GraphInfo {
+	info := checkpoint.GraphInfo{Name: DefaultName, Nodes: Nodes()}
+	if cfg.Definition != nil {
+		info = cfg.Definition.Info()
+	}
+	if cfg.Name != "" {
+		info.Name = cfg.Name
+	}
+	return info
 }
 
-// NewGraph creates a new workflow graph
+// NewGraph creates a new workflow graph running with a UniversalState
 func NewGraph[I, O any](ctx context.Context, cfg Config) (compose.Runnable[I, O], error) {
-	g := compose.NewGraph[I, O](compose.WithGenLocalState(func(ctx context.Context) *types.UniversalState {
+	return NewTypedGraph[I, O](ctx, cfg, func(context.Context) *types.UniversalState {
 		return types.NewUniversalState()
-	}))
+	})
+}
 
-	if err := AddChatTemplateNode(g, cfg.ChatTemplate); err != nil {
+// NewTypedGraph creates a workflow graph running with the custom state type S,
+// created by newState for every run; the UniversalState it embeds is
+// initialized with Init. The built-in nodes keep the conversation in the
+// embedded state, custom nodes and tools reach the rest with
+// compose.ProcessState[S]. S and the types of its fields must be registered
+// with checkpoint.RegisterSerializableType to survive interrupts.
+func NewTypedGraph[I, O any, S types.State](ctx context.Context, cfg Config, newState func(ctx context.Context) S) (compose.Runnable[I, O], error) {
+	def, reg := cfg.Definition, cfg.Registry
+	if def == nil {
+		def, reg = DefaultDefinition(), NewRegistry()
+		reg.RegisterChatTemplate("default", cfg.ChatTemplate)
+		reg.RegisterChatModel("default", cfg.ChatModel)
+		reg.RegisterToolsNode("default", cfg.ToolsNode)
+	} else if err := def.Validate(); err != nil {
 		return nil, err
 	}
-	if err := AddChatModelNode(g, cfg.ChatModel); err != nil {
+	if reg == nil {
+		reg = NewRegistry()
+	}
+
+	g := compose.NewGraph[I, O](compose.WithGenLocalState(func(ctx context.Context) S {
+		st := newState(ctx)
+		u := st.Universal().Init()
+		u.MessageHistory = append(u.MessageHistory, historyFromContext(ctx)...)
+		return st
+	}))
+
+	if err := addNodes[I, O, S](ctx, g, def, reg); err != nil {
 		return nil, err
 	}
-	if err := AddToolsNode(g, cfg.ToolsNode); err != nil {
+	if err := addDefinitionEdges(g, def, reg); err != nil {
 		return nil, err
 	}
-	if err := AddEdges(g); err != nil {
+
+	policy, before, after, err := newInterruptPolicy(cfg, def, reg)
+	if err != nil {
 		return nil, err
 	}
 
-	interruptNodes := cfg.InterruptBeforeNodes
-	if len(interruptNodes) == 0 {
-		interruptNodes = []string{"ToolsNode"}
+	name := Info(cfg).Name
+	store := cfg.CheckPointStore
+	if store != nil {
+		// Index the checkpoints this graph saves under its name
+		store = checkpoint.ForGraph(store, name)
+		if policy.conditional() {
+			store = &recordingStore{CheckPointStore: store}
+		}
 	}
 
-	return g.Compile(
+	r, err := g.Compile(
 		ctx,
-		compose.WithCheckPointStore(cfg.CheckPointStore),
-		compose.WithInterruptBeforeNodes(interruptNodes),
+		compose.WithGraphName(name),
+		compose.WithCheckPointStore(store),
+		compose.WithInterruptBeforeNodes(before),
+		compose.WithInterruptAfterNodes(after),
 	)
+	if err != nil || !policy.conditional() {
+		return r, err
+	}
+	return &policyRunnable[I, O]{Runnable: r, policy: policy}, nil
+}
+
+// newInterruptPolicy combines the interrupt points of cfg and def, returning
+// the policy and every node eino must interrupt before and after
+func newInterruptPolicy(cfg Config, def *Definition, reg *Registry) (*interruptPolicy, []string, []string, error) {
+	p := &interruptPolicy{
+		static:     make(map[interruptPoint]bool),
+		rules:      make(map[interruptPoint][]Predicate),
+		tools:      cfg.ToolPolicy,
+		toolsNodes: make(map[string]bool),
+	}
+	if p.tools == nil {
+		p.tools = def.ToolApproval
+	}
+	for _, n := range def.Nodes {
+		if n.Type == NodeTools {
+			p.toolsNodes[n.Name] = true
+		}
+	}
+
+	rules := append([]InterruptRule(nil), cfg.Interrupts...)
+	for _, i := range def.Interrupts {
+		when, err := interruptPredicate(i, reg)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("interrupt at %s: %w", i.Node, err)
+		}
+		rules = append(rules, InterruptRule{Node: i.Node, After: i.After, When: when})
+	}
+	for _, r := range rules {
+		when := r.When
+		if when == nil {
+			when = func(context.Context, *schema.Message) (bool, error) { return true, nil }
+		}
+		pt := interruptPoint{node: r.Node, after: r.After}
+		p.rules[pt] = append(p.rules[pt], when)
+	}
+
+	before, after := cfg.InterruptBeforeNodes, cfg.InterruptAfterNodes
+	if len(before) == 0 {
+		before = def.InterruptBefore
+	}
+	if len(after) == 0 {
+		after = def.InterruptAfter
+	}
+	for _, n := range before {
+		if pt := (interruptPoint{node: n}); p.rules[pt] == nil {
+			p.static[pt] = true
+		}
+	}
+	for _, n := range after {
+		if pt := (interruptPoint{node: n, after: true}); p.rules[pt] == nil {
+			p.static[pt] = true
+		}
+	}
+
+	// eino interrupts at every point; the policy decides which ones stop
+	var beforeNodes, afterNodes []string
+	for pt := range p.static {
+		if pt.after {
+			afterNodes = append(afterNodes, pt.node)
+		} else {
+			beforeNodes = append(beforeNodes, pt.node)
+		}
+	}
+	for pt := range p.rules {
+		if pt.after {
+			afterNodes = append(afterNodes, pt.node)
+		} else {
+			beforeNodes = append(beforeNodes, pt.node)
+		}
+	}
+	sort.Strings(beforeNodes)
+	sort.Strings(afterNodes)
+	return p, beforeNodes, afterNodes, nil
+}
+
+// interruptPredicate resolves the predicate of a declarative interrupt point
+func interruptPredicate(i InterruptDef, reg *Registry) (Predicate, error) {
+	var preds []Predicate
+	if i.When != "" {
+		p, err := reg.Predicate(i.When)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, p)
+	}
+	if i.Arguments != nil {
+		raw, err := json.Marshal(i.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("marshal arguments schema: %w", err)
+		}
+		p, err := ArgumentsMatch(i.Tool, raw)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, p)
+	}
+
+	return func(ctx context.Context, msg *schema.Message) (bool, error) {
+		for _, p := range preds {
+			if ok, err := p(ctx, msg); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}, nil
+}
+
+// addNodes adds the nodes of a definition with their components resolved from reg
+func addNodes[I, O any, S types.State](ctx context.Context, g *compose.Graph[I, O], def *Definition, reg *Registry) error {
+	for _, n := range def.Nodes {
+		var err error
+		switch n.Type {
+		case NodeChatTemplate:
+			var tpl prompt.ChatTemplate
+			if tpl, err = reg.ChatTemplate(n.Component); err == nil {
+				err = addChatTemplateNode[I, O, S](g, n.Name, tpl)
+			}
+		case NodeChatModel:
+			var cm model.ToolCallingChatModel
+			if cm, err = reg.ChatModel(n.Component); err == nil {
+				if cm, err = bindTools(ctx, cm, n.Tools, reg); err == nil {
+					err = addChatModelNode[I, O, S](g, n.Name, cm)
+				}
+			}
+		case NodeTools:
+			var tn *compose.ToolsNode
+			if tn, err = newToolsNode(ctx, n, reg); err == nil {
+				err = addToolsNode[I, O, S](g, n.Name, tn)
+			}
+		case NodeLambda:
+			var l *compose.Lambda
+			if l, err = reg.Lambda(n.Component); err == nil {
+				err = g.AddLambdaNode(n.Name, l, compose.WithNodeName(n.Name))
+			}
+		default:
+			err = fmt.Errorf("unknown node type %q", n.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("node %s: %w", n.Name, err)
+		}
+	}
+	return nil
+}
+
+// bindTools binds the named registry tools to a chat model
+func bindTools(ctx context.Context, cm model.ToolCallingChatModel, names []string, reg *Registry) (model.ToolCallingChatModel, error) {
+	if len(names) == 0 {
+		return cm, nil
+	}
+	infos := make([]*schema.ToolInfo, 0, len(names))
+	for _, name := range names {
+		t, err := reg.Tool(name)
+		if err != nil {
+			return nil, err
+		}
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tool info: %w", err)
+		}
+		infos = append(infos, info)
+	}
+	return cm.WithTools(infos)
+}
+
+// newToolsNode resolves the registered tools node of a definition node, or
+// builds one from its tool list
+func newToolsNode(ctx context.Context, n NodeDef, reg *Registry) (*compose.ToolsNode, error) {
+	if n.Component != "" {
+		return reg.ToolsNode(n.Component)
+	}
+	tools := make([]tool.BaseTool, 0, len(n.Tools))
+	for _, name := range n.Tools {
+		t, err := reg.Tool(name)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, t)
+	}
+	return compose.NewToolNode(ctx, &compose.ToolsNodeConfig{Tools: tools})
+}
+
+// addDefinitionEdges adds the edges and branches of a definition
+func addDefinitionEdges[I, O any](g *compose.Graph[I, O], def *Definition, reg *Registry) error {
+	for _, e := range def.Edges {
+		if err := g.AddEdge(e.From, e.To); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range def.Branches {
+		type route struct {
+			when Predicate
+			to   string
+		}
+		routes := make([]route, 0, len(b.Cases))
+		endNodes := make(map[string]bool)
+		for _, c := range b.Cases {
+			p, err := reg.Predicate(c.When)
+			if err != nil {
+				return fmt.Errorf("branch from %s: %w", b.From, err)
+			}
+			routes = append(routes, route{when: p, to: c.To})
+			endNodes[c.To] = true
+		}
+		fallback := b.Default
+		if fallback == "" {
+			fallback = compose.END
+		}
+		endNodes[fallback] = true
+
+		// Nodes emit a message or a message list; predicates see the last message
+		condition := func(ctx context.Context, in any) (string, error) {
+			var msg *schema.Message
+			switch v := in.(type) {
+			case *schema.Message:
+				msg = v
+			case []*schema.Message:
+				if len(v) > 0 {
+					msg = v[len(v)-1]
+				}
+			}
+			for _, r := range routes {
+				ok, err := r.when(ctx, msg)
+				if err != nil {
+					return "", err
+				}
+				if ok {
+					return r.to, nil
+				}
+			}
+			return fallback, nil
+		}
+
+		if err := g.AddBranch(b.From, compose.NewGraphBranch(condition, endNodes)); err != nil {
+			return fmt.Errorf("branch from %s: %w", b.From, err)
+		}
+	}
+	return nil
 }
 
 // AddChatTemplateNode adds a chat template node to the graph
 func AddChatTemplateNode[I, O any](g *compose.Graph[I, O], tpl prompt.ChatTemplate) error {
+	return addChatTemplateNode[I, O, *types.UniversalState](g, "ChatTemplate", tpl)
+}
+
+func addChatTemplateNode[I, O any, S types.State](g *compose.Graph[I, O], name string, tpl prompt.ChatTemplate) error {
 	return g.AddChatTemplateNode(
-		"ChatTemplate",
+		name,
 		tpl,
-		compose.WithStatePreHandler(func(ctx context.Context, in map[string]any, state *types.UniversalState) (map[string]any, error) {
+		compose.WithNodeName(name),
+		compose.WithStatePreHandler(func(ctx context.Context, in map[string]any, s S) (map[string]any, error) {
+			state := s.Universal()
 			for k, v := range in {
 				state.Context[k] = v
 			}
-			state.NodeExecutionLog["ChatTemplate"] = map[string]any{
-				"input": in,
-				"time":  time.Now().UnixNano(),
-			}
+			state.StartEvent(name)
 			return in, nil
 		}),
-		compose.WithStatePostHandler(func(ctx context.Context, out []*schema.Message, state *types.UniversalState) ([]*schema.Message, error) {
+		compose.WithStatePostHandler(func(ctx context.Context, out []*schema.Message, s S) ([]*schema.Message, error) {
+			state := s.Universal()
+			if len(state.MessageHistory) > 0 {
+				// A later turn of a conversation started WithHistory
+				out = continueConversation(out, state.Context)
+			}
 			state.MessageHistory = append(state.MessageHistory, out...)
+			state.EndEvent(name, nil)
 			state.SavedAt = time.Now().UnixNano()
 			return out, nil
 		}),
@@ -76,24 +402,29 @@ func AddChatTemplateNode[I, O any](g *compose.Graph[I, O], tpl prompt.ChatTempla
 
 // AddChatModelNode adds a chat model node to the graph
 func AddChatModelNode[I, O any](g *compose.Graph[I, O], cm model.ToolCallingChatModel) error {
+	return addChatModelNode[I, O, *types.UniversalState](g, "ChatModel", cm)
+}
+
+func addChatModelNode[I, O any, S types.State](g *compose.Graph[I, O], name string, cm model.ToolCallingChatModel) error {
 	return g.AddChatModelNode(
-		"ChatModel",
-		cm,
-		compose.WithStatePreHandler(func(ctx context.Context, in []*schema.Message, state *types.UniversalState) ([]*schema.Message, error) {
-			state.MessageHistory = append(state.MessageHistory, in...)
-			state.NodeExecutionLog["ChatModel_input"] = map[string]any{
-				"message_count": len(in),
-				"time":          time.Now().UnixNano(),
-			}
+		name,
+		&drainingModel{cm},
+		compose.WithNodeName(name),
+		compose.WithStatePreHandler(func(ctx context.Context, in []*schema.Message, s S) ([]*schema.Message, error) {
+			state := s.Universal()
+			state.MessageHistory = appendNew(state.MessageHistory, in)
+			state.StartEvent(name)
 			return state.MessageHistory, nil
 		}),
-		compose.WithStatePostHandler(func(ctx context.Context, out *schema.Message, state *types.UniversalState) (*schema.Message, error) {
+		compose.WithStatePostHandler(func(ctx context.Context, out *schema.Message, s S) (*schema.Message, error) {
+			state := s.Universal()
 			state.MessageHistory = append(state.MessageHistory, out)
-			state.NodeExecutionLog["ChatModel_output"] = map[string]any{
-				"message_role":    out.Role,
-				"has_tool_calls":  len(out.ToolCalls) > 0,
-				"tool_call_count": len(out.ToolCalls),
-				"time":            time.Now().UnixNano(),
+			if ev := state.EndEvent(name, nil); ev != nil {
+				if out.ResponseMeta != nil && out.ResponseMeta.Usage != nil {
+					usage := *out.ResponseMeta.Usage
+					ev.Usage = &usage
+				}
+				ev.Tools = toolNames(out.ToolCalls)
 			}
 			state.SavedAt = time.Now().UnixNano()
 			return out, nil
@@ -103,36 +434,106 @@ func AddChatModelNode[I, O any](g *compose.Graph[I, O], cm model.ToolCallingChat
 
 // AddToolsNode adds a tools node to the graph
 func AddToolsNode[I, O any](g *compose.Graph[I, O], tn *compose.ToolsNode) error {
-	return g.AddToolsNode(
-		"ToolsNode",
-		tn,
-		compose.WithStatePreHandler(func(ctx context.Context, in *schema.Message, state *types.UniversalState) (*schema.Message, error) {
-			if len(state.MessageHistory) > 0 {
-				lastMsg := state.MessageHistory[len(state.MessageHistory)-1]
-				state.NodeExecutionLog["ToolsNode_input"] = map[string]any{
-					"tool_call_count": len(lastMsg.ToolCalls),
-					"time":            time.Now().UnixNano(),
-				}
-				return lastMsg, nil
+	return addToolsNode[I, O, *types.UniversalState](g, "ToolsNode", tn)
+}
+
+func addToolsNode[I, O any, S types.State](g *compose.Graph[I, O], name string, tn *compose.ToolsNode) error {
+	l, err := pendingToolsLambda[S](name, tn)
+	if err != nil {
+		return err
+	}
+	return g.AddLambdaNode(
+		name,
+		l,
+		compose.WithNodeName(name),
+		compose.WithStatePreHandler(func(ctx context.Context, in *schema.Message, s S) (*schema.Message, error) {
+			state := s.Universal()
+			// Run only the calls no tool message answers yet; rejected calls
+			// were answered when the decision was applied
+			msg, pending := state.PendingToolCalls()
+			ev := state.StartEvent(name)
+			if msg == nil {
+				return in, nil
 			}
-			return in, nil
+			ev.Tools = toolNames(pending)
+			approved := *msg
+			approved.ToolCalls = pending
+			return &approved, nil
 		}),
-		compose.WithStatePostHandler(func(ctx context.Context, out []*schema.Message, state *types.UniversalState) ([]*schema.Message, error) {
-			if len(out) > 0 {
-				state.MessageHistory = append(state.MessageHistory, out...)
-				first := out[0]
-				state.NodeExecutionLog["ToolsNode_output"] = map[string]any{
-					"message_role": first.Role,
-					"has_content":  len(first.Content) > 0,
-					"time":         time.Now().UnixNano(),
-				}
-			}
+		compose.WithStatePostHandler(func(ctx context.Context, out []*schema.Message, s S) ([]*schema.Message, error) {
+			state := s.Universal()
+			state.MessageHistory = append(state.MessageHistory, out...)
+			state.EndEvent(name, nil)
 			state.SavedAt = time.Now().UnixNano()
 			return out, nil
 		}),
 	)
 }
 
+// pendingToolsLambda runs a tools node, answering nothing when every call of
+// its input was rejected, which the tools node itself refuses. Unanswered
+// ask_human calls interrupt before any tool runs, with the questions as the
+// interrupt's extra, and so does a drain (see WithDrain). Tool errors fail the
+// node's execution event.
+func pendingToolsLambda[S types.State](name string, tn *compose.ToolsNode) (*compose.Lambda, error) {
+	return compose.AnyLambda(
+		func(ctx context.Context, in *schema.Message, opts ...compose.ToolsNodeOption) ([]*schema.Message, error) {
+			if len(in.ToolCalls) == 0 {
+				return []*schema.Message{}, nil
+			}
+			if q := pendingQuestions(in.ToolCalls); len(q) > 0 {
+				return nil, compose.NewInterruptAndRerunErr(q)
+			}
+			if err := checkDrain(ctx); err != nil {
+				return nil, err
+			}
+			out, err := tn.Invoke(ctx, in, opts...)
+			if err != nil {
+				failEvent[S](ctx, name, err)
+			}
+			return out, err
+		},
+		func(ctx context.Context, in *schema.Message, opts ...compose.ToolsNodeOption) (*schema.StreamReader[[]*schema.Message], error) {
+			if len(in.ToolCalls) == 0 {
+				return schema.StreamReaderFromArray([][]*schema.Message{{}}), nil
+			}
+			if q := pendingQuestions(in.ToolCalls); len(q) > 0 {
+				return nil, compose.NewInterruptAndRerunErr(q)
+			}
+			if err := checkDrain(ctx); err != nil {
+				return nil, err
+			}
+			sr, err := tn.Stream(ctx, in, opts...)
+			if err != nil {
+				failEvent[S](ctx, name, err)
+			}
+			return sr, err
+		},
+		nil, nil,
+	)
+}
+
+// failEvent records err on the running execution event of node. Interrupts
+// are not failures: the event is closed as interrupted when the node reruns.
+func failEvent[S types.State](ctx context.Context, node string, err error) {
+	if _, ok := compose.IsInterruptRerunError(err); ok {
+		return
+	}
+	_ = compose.ProcessState(ctx, func(_ context.Context, s S) error {
+		s.Universal().EndEvent(node, err)
+		return nil
+	})
+}
+
+// toolNames lists the function names of tool calls
+func toolNames(calls []schema.ToolCall) []string {
+	var names []string
+	for _, tc := range calls {
+		names = append(names, tc.Function.Name)
+	}
+	return names
+}
+
 // AddEdges adds edges to the graph
 func AddEdges[I, O any](g *compose.Graph[I, O]) error {
 	edges := []struct {
@@ -158,4 +559,4 @@ func AddEdges[I, O any](g *compose.Graph[I, O]) error {
 		},
 		map[string]bool{"ToolsNode": true, compose.END: true},
 	))
-}
\ No newline at end of file
+}
@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/types"
+)
+
+// finish resumes the checkpoint id to completion, returning the final state
+func (r *testRun) finish(t *testing.T, id string) *types.UniversalState {
+	t.Helper()
+	var final *types.UniversalState
+	_, err := r.runner.Invoke(context.Background(), map[string]any{"name": "Ada"}, compose.WithCheckPointID(id),
+		WithCompletionHandler(func(_ context.Context, st types.State) {
+			final = st.Universal()
+		}))
+	if err != nil || final == nil {
+		t.Fatalf("resume %s = %v, want completion", id, err)
+	}
+	return final
+}
+
+// describeLog lists the events of a log as "seq node phase"
+func describeLog(t *testing.T, log []types.ExecutionEvent) []string {
+	t.Helper()
+	var events []string
+	for _, ev := range log {
+		if ev.StartedAt == 0 || ev.Phase != types.PhaseRunning && ev.EndedAt < ev.StartedAt {
+			t.Errorf("event %d has times %d to %d", ev.Seq, ev.StartedAt, ev.EndedAt)
+		}
+		events = append(events, fmt.Sprintf("%d %s %s", ev.Seq, ev.Node, ev.Phase))
+	}
+	return events
+}
+
+func checkLog(t *testing.T, what string, log []types.ExecutionEvent, want ...string) {
+	t.Helper()
+	got := describeLog(t, log)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("%s log = %q, want %q", what, got, want)
+	}
+}
+
+func TestExecutionLogAcrossInterrupts(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRun(t, Config{InterruptBeforeNodes: []string{"ToolsNode"}},
+		[]*schema.Message{toolCallReply("call-1", "BookTicket", `{"location":"Paris"}`)},
+		"BookTicket")
+
+	// Interrupted before it starts, the tools node has no event yet
+	if _, info := r.run(t, "cp"); info == nil {
+		t.Fatal("run completed, want an interrupt")
+	}
+	cp, err := r.store.LoadCheckpoint(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLog(t, "interrupted", cp.State.NodeExecutionLog,
+		"1 ChatTemplate completed", "2 ChatModel completed")
+
+	// Resuming adds one event per node run, and repeats none
+	checkLog(t, "resumed", r.finish(t, "cp").NodeExecutionLog,
+		"1 ChatTemplate completed", "2 ChatModel completed", "3 ToolsNode completed", "4 ChatModel completed")
+}
+
+func TestExecutionLogAcrossReruns(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRun(t, askConfig, []*schema.Message{toolCallReply(askCalls...)}, "BookTicket")
+
+	// A question interrupts the tools node while it runs
+	if _, info := r.run(t, "cp"); info == nil {
+		t.Fatal("run completed, want an interrupt")
+	}
+	cp, err := r.store.LoadCheckpoint(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLog(t, "interrupted", cp.State.NodeExecutionLog,
+		"1 ChatTemplate completed", "2 ChatModel completed", "3 ToolsNode running")
+
+	// Its interrupted run is closed when it runs again
+	answer := []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionAnswer, Answer: "business"}}
+	if err := r.store.ApplyToolDecisions(ctx, "cp", answer, checkpoint.AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+	checkLog(t, "resumed", r.finish(t, "cp").NodeExecutionLog,
+		"1 ChatTemplate completed", "2 ChatModel completed", "3 ToolsNode interrupted", "4 ToolsNode completed", "5 ChatModel completed")
+}
@@ -0,0 +1,309 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// InterruptRule makes a node a conditional interrupt point: the graph stops
+// before (or, with After, after) the node only when When matches the last
+// message of the state. Before a tools node that is the assistant message
+// with the pending tool calls; after a chat model it is the model's output.
+type InterruptRule struct {
+	Node  string
+	After bool
+	When  Predicate
+}
+
+// Approval says whether calls to a tool wait for a human
+type Approval string
+
+const (
+	// ApprovalRequired stops before the tools node (the default)
+	ApprovalRequired Approval = "required"
+	// ApprovalSkip runs the tool without stopping, e.g. for read-only tools
+	ApprovalSkip Approval = "skip"
+)
+
+// ToolPolicy decides per tool whether the graph stops before a tools node
+// interrupt point. The graph stops when any pending call needs approval.
+type ToolPolicy struct {
+	// Default applies to tools not listed; empty means ApprovalRequired
+	Default Approval            `json:"default,omitempty" yaml:"default,omitempty"`
+	Tools   map[string]Approval `json:"tools,omitempty" yaml:"tools,omitempty"`
+}
+
+// RequiresApproval reports whether calls to the named tool wait for a human.
+// ask_human calls always do.
+func (p *ToolPolicy) RequiresApproval(name string) bool {
+	if name == types.AskHumanToolName {
+		return true
+	}
+	approval, ok := p.Tools[name]
+	if !ok {
+		approval = p.Default
+	}
+	return approval != ApprovalSkip
+}
+
+// Validate checks that every approval is known
+func (p *ToolPolicy) Validate() error {
+	check := func(a Approval) error {
+		switch a {
+		case "", ApprovalRequired, ApprovalSkip:
+			return nil
+		}
+		return fmt.Errorf("unknown tool approval %q", a)
+	}
+	if err := check(p.Default); err != nil {
+		return err
+	}
+	for name, a := range p.Tools {
+		if err := check(a); err != nil {
+			return fmt.Errorf("tool %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ToolIn matches messages calling any of the named tools, e.g. a list of
+// sensitive tools
+func ToolIn(names ...string) Predicate {
+	return func(_ context.Context, msg *schema.Message) (bool, error) {
+		if msg == nil {
+			return false, nil
+		}
+		for _, tc := range msg.ToolCalls {
+			for _, name := range names {
+				if tc.Function.Name == name {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+}
+
+// ContentContains matches messages whose content contains any of the
+// keywords, ignoring case
+func ContentContains(keywords ...string) Predicate {
+	return func(_ context.Context, msg *schema.Message) (bool, error) {
+		if msg == nil {
+			return false, nil
+		}
+		content := strings.ToLower(msg.Content)
+		for _, k := range keywords {
+			if strings.Contains(content, strings.ToLower(k)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// ArgumentsMatch matches messages with a call to tool (any tool when empty)
+// whose arguments validate against a JSON schema, e.g.
+//
+//	{"properties": {"amount": {"type": "number", "minimum": 1000}}, "required": ["amount"]}
+func ArgumentsMatch(tool string, jsonSchema []byte) (Predicate, error) {
+	var s openapi3.Schema
+	if err := json.Unmarshal(jsonSchema, &s); err != nil {
+		return nil, fmt.Errorf("parse arguments schema: %w", err)
+	}
+
+	return func(_ context.Context, msg *schema.Message) (bool, error) {
+		if msg == nil {
+			return false, nil
+		}
+		for _, tc := range msg.ToolCalls {
+			if tool != "" && tc.Function.Name != tool {
+				continue
+			}
+			var args any
+			if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+				continue
+			}
+			if s.VisitJSON(args, openapi3.MultiErrors()) == nil {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, nil
+}
+
+// interruptPolicy decides whether an interrupt raised by eino stops the run
+// or is continued automatically
+type interruptPolicy struct {
+	// static interrupt points always stop, except tools nodes under tools
+	static     map[interruptPoint]bool
+	rules      map[interruptPoint][]Predicate
+	tools      *ToolPolicy
+	toolsNodes map[string]bool
+}
+
+type interruptPoint struct {
+	node  string
+	after bool
+}
+
+// conditional reports whether any interrupt point depends on the state
+func (p *interruptPolicy) conditional() bool {
+	return len(p.rules) > 0 || p.tools != nil
+}
+
+// stops reports whether an interrupt needs a human
+func (p *interruptPolicy) stops(ctx context.Context, info *compose.InterruptInfo) (bool, error) {
+	if len(info.RerunNodes) > 0 || len(info.SubGraphs) > 0 {
+		return true, nil
+	}
+
+	var msg *schema.Message
+	if st, ok := info.State.(types.State); ok {
+		if h := st.Universal().MessageHistory; len(h) > 0 {
+			msg = h[len(h)-1]
+		}
+	}
+
+	points := make([]interruptPoint, 0, len(info.BeforeNodes)+len(info.AfterNodes))
+	for _, n := range info.BeforeNodes {
+		points = append(points, interruptPoint{node: n})
+	}
+	for _, n := range info.AfterNodes {
+		points = append(points, interruptPoint{node: n, after: true})
+	}
+
+	for _, pt := range points {
+		if p.static[pt] {
+			if pt.after || p.tools == nil || !p.toolsNodes[pt.node] || p.toolsPending(msg) {
+				return true, nil
+			}
+			continue
+		}
+		for _, when := range p.rules[pt] {
+			ok, err := when(ctx, msg)
+			if err != nil {
+				return false, fmt.Errorf("interrupt rule for %s: %w", pt.node, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// toolsPending reports whether a pending tool call needs approval
+func (p *interruptPolicy) toolsPending(msg *schema.Message) bool {
+	if msg == nil {
+		return false
+	}
+	for _, tc := range msg.ToolCalls {
+		if p.tools.RequiresApproval(tc.Function.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyRunnable continues interrupts that the policy does not stop at by
+// resuming from the checkpoint the interrupt saved
+type policyRunnable[I, O any] struct {
+	compose.Runnable[I, O]
+	policy *interruptPolicy
+}
+
+func (r *policyRunnable[I, O]) Invoke(ctx context.Context, input I, opts ...compose.Option) (O, error) {
+	ctx, saved := recordCheckpoints(ctx)
+	for {
+		out, err := r.Runnable.Invoke(ctx, input, opts...)
+		if cont, perr := r.resume(ctx, err, saved); perr != nil || !cont {
+			return out, firstErr(perr, err)
+		}
+	}
+}
+
+func (r *policyRunnable[I, O]) Stream(ctx context.Context, input I, opts ...compose.Option) (*schema.StreamReader[O], error) {
+	ctx, saved := recordCheckpoints(ctx)
+	for {
+		out, err := r.Runnable.Stream(ctx, input, opts...)
+		if cont, perr := r.resume(ctx, err, saved); perr != nil || !cont {
+			return out, firstErr(perr, err)
+		}
+	}
+}
+
+func (r *policyRunnable[I, O]) Collect(ctx context.Context, input *schema.StreamReader[I], opts ...compose.Option) (O, error) {
+	ctx, saved := recordCheckpoints(ctx)
+	for {
+		out, err := r.Runnable.Collect(ctx, input, opts...)
+		if cont, perr := r.resume(ctx, err, saved); perr != nil || !cont {
+			return out, firstErr(perr, err)
+		}
+		// Resuming restores the inputs from the checkpoint
+		input = schema.StreamReaderFromArray[I](nil)
+	}
+}
+
+func (r *policyRunnable[I, O]) Transform(ctx context.Context, input *schema.StreamReader[I], opts ...compose.Option) (*schema.StreamReader[O], error) {
+	ctx, saved := recordCheckpoints(ctx)
+	for {
+		out, err := r.Runnable.Transform(ctx, input, opts...)
+		if cont, perr := r.resume(ctx, err, saved); perr != nil || !cont {
+			return out, firstErr(perr, err)
+		}
+		input = schema.StreamReaderFromArray[I](nil)
+	}
+}
+
+// resume reports whether err is an interrupt to continue automatically. Only
+// interrupts that saved a checkpoint can be continued.
+func (r *policyRunnable[I, O]) resume(ctx context.Context, err error, saved *string) (bool, error) {
+	info, ok := compose.ExtractInterruptInfo(err)
+	if !ok || *saved == "" {
+		return false, nil
+	}
+	stop, err := r.policy.stops(ctx, info)
+	return !stop, err
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type checkpointRecorderKey struct{}
+
+// recordCheckpoints returns a ctx under which checkpoint IDs saved through a
+// recordingStore are written to the returned string
+func recordCheckpoints(ctx context.Context) (context.Context, *string) {
+	saved := new(string)
+	return context.WithValue(ctx, checkpointRecorderKey{}, saved), saved
+}
+
+// recordingStore notes the IDs of the checkpoints it saves in the ctx set up
+// by recordCheckpoints
+type recordingStore struct {
+	compose.CheckPointStore
+}
+
+func (s *recordingStore) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	if err := s.CheckPointStore.Set(ctx, checkPointID, checkPoint); err != nil {
+		return err
+	}
+	if saved, ok := ctx.Value(checkpointRecorderKey{}).(*string); ok {
+		*saved = checkPointID
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+func TestToolPolicy(t *testing.T) {
+	p := &ToolPolicy{Default: ApprovalSkip, Tools: map[string]Approval{"Refund": ApprovalRequired}}
+	for name, want := range map[string]bool{"Refund": true, "get_weather": false, types.AskHumanToolName: true} {
+		if got := p.RequiresApproval(name); got != want {
+			t.Errorf("RequiresApproval(%s) = %v, want %v", name, got, want)
+		}
+	}
+	// Unlisted tools need approval unless the default says otherwise
+	if !(&ToolPolicy{}).RequiresApproval("get_weather") {
+		t.Error("empty policy skips approval")
+	}
+
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&ToolPolicy{Tools: map[string]Approval{"Refund": "ask"}}).Validate(); err == nil || !strings.Contains(err.Error(), "Refund") {
+		t.Fatalf("Validate = %v, want an error naming the tool", err)
+	}
+}
+
+func TestArgumentsMatch(t *testing.T) {
+	ctx := context.Background()
+	p, err := ArgumentsMatch("Refund", []byte(`{"properties": {"amount": {"type": "number", "minimum": 1000}}, "required": ["amount"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		msg  *schema.Message
+		want bool
+	}{
+		{"large refund", toolCallReply("c1", "Refund", `{"amount": 2500}`), true},
+		{"small refund", toolCallReply("c1", "Refund", `{"amount": 20}`), false},
+		{"no amount", toolCallReply("c1", "Refund", `{}`), false},
+		{"other tool", toolCallReply("c1", "BookTicket", `{"amount": 2500}`), false},
+		{"one of several calls", toolCallReply("c1", "Refund", `{"amount": 5}`, "c2", "Refund", `{"amount": 5000}`), true},
+		{"arguments not json", toolCallReply("c1", "Refund", `amount=2500`), false},
+		{"no message", nil, false},
+	}
+	for _, tt := range tests {
+		if got, err := p(ctx, tt.msg); err != nil || got != tt.want {
+			t.Errorf("%s: = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := ArgumentsMatch("", []byte(`{"properties": `)); err == nil {
+		t.Fatal("invalid schema accepted")
+	}
+}
+
+func TestInterruptRules(t *testing.T) {
+	refund := toolCallReply("c1", "Refund", `{"amount": 2500}`)
+	smallRefund := toolCallReply("c1", "Refund", `{"amount": 20}`)
+	weather := toolCallReply("c1", "get_weather", `{"city": "Paris"}`)
+	book := toolCallReply("c1", "BookTicket", `{"location": "Paris"}`)
+	bookAndRefund := toolCallReply("c1", "BookTicket", `{"location": "Paris"}`)
+	bookAndRefund.Content = "Booking now, REFUND later"
+
+	rulesYAML := `
+name: refunds
+nodes:
+  - {name: ChatTemplate, type: chat_template, component: default}
+  - {name: ChatModel, type: chat_model, component: default}
+  - {name: ToolsNode, type: tools, component: default}
+edges:
+  - {from: start, to: ChatTemplate}
+  - {from: ChatTemplate, to: ChatModel}
+  - {from: ToolsNode, to: ChatModel}
+branches:
+  - from: ChatModel
+    cases: [{when: has_tool_calls, to: ToolsNode}]
+interrupts:
+  - node: ToolsNode
+    tool: Refund
+    arguments: {properties: {amount: {type: number, minimum: 1000}}, required: [amount]}
+`
+	rules, err := ParseDefinition([]byte(rulesYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		cfg   Config
+		reply *schema.Message
+		// stop is where the run stops, "" when it runs to the end
+		stop string
+	}{
+		{"static", Config{}, book, "before ToolsNode"},
+		{"rule matches", Config{Interrupts: []InterruptRule{{Node: "ToolsNode", When: ToolIn("Refund")}}}, refund, "before ToolsNode"},
+		// A rule replaces the unconditional interrupt before the same node
+		{"rule does not match", Config{Interrupts: []InterruptRule{{Node: "ToolsNode", When: ToolIn("Refund")}}}, book, ""},
+		// eino interrupts after a node only when the run goes on, so these
+		// replies call a tool, which the tool policy lets run. The interrupt
+		// after ChatModel is also the one before ToolsNode.
+		{"after rule matches", Config{
+			Interrupts: []InterruptRule{{Node: "ChatModel", After: true, When: ContentContains("refund")}},
+			ToolPolicy: &ToolPolicy{Default: ApprovalSkip},
+		}, bookAndRefund, "before ToolsNode and after ChatModel"},
+		{"after rule does not match", Config{
+			Interrupts: []InterruptRule{{Node: "ChatModel", After: true, When: ContentContains("refund")}},
+			ToolPolicy: &ToolPolicy{Default: ApprovalSkip},
+		}, book, ""},
+		{"skipped tool", Config{ToolPolicy: &ToolPolicy{Tools: map[string]Approval{"get_weather": ApprovalSkip}}}, weather, ""},
+		{"approved tool", Config{ToolPolicy: &ToolPolicy{Tools: map[string]Approval{"get_weather": ApprovalSkip}}}, book, "before ToolsNode"},
+		{"definition arguments match", Config{Definition: rules}, refund, "before ToolsNode"},
+		{"definition arguments do not match", Config{Definition: rules}, smallRefund, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRun(t, tt.cfg, []*schema.Message{tt.reply}, "Refund", "get_weather", "BookTicket")
+			out, info := r.run(t, "cp")
+			if got := stoppedAt(info); got != tt.stop {
+				t.Fatalf("stopped at %q, want %q", got, tt.stop)
+			}
+			if tt.stop == "" && out.Content != "done" {
+				t.Fatalf("result = %q, want done", out.Content)
+			}
+
+			// The tool runs only if the run did not stop before it
+			for _, tc := range tt.reply.ToolCalls {
+				if ran := len(r.tools[tc.Function.Name].ranWith()) > 0; ran != (tt.stop == "") {
+					t.Fatalf("%s ran = %v", tc.Function.Name, ran)
+				}
+			}
+		})
+	}
+}
+
+// stoppedAt describes where a run stopped, "" if it did not
+func stoppedAt(info *compose.InterruptInfo) string {
+	if info == nil {
+		return ""
+	}
+	var points []string
+	if len(info.BeforeNodes) > 0 {
+		points = append(points, "before "+strings.Join(info.BeforeNodes, ","))
+	}
+	if len(info.AfterNodes) > 0 {
+		points = append(points, "after "+strings.Join(info.AfterNodes, ","))
+	}
+	return strings.Join(points, " and ")
+}
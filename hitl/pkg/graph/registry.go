@@ -0,0 +1,178 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// ErrUnknownComponent is returned when a definition names a component that is
+// not registered
+var ErrUnknownComponent = errors.New("unknown component")
+
+// Predicate decides whether a branch case matches the message a node produced
+type Predicate func(ctx context.Context, msg *schema.Message) (bool, error)
+
+// Built-in predicates. Predicates taking an argument are written
+// "<name>:<arg>", and any predicate can be negated with a leading "!".
+const (
+	// PredicateHasToolCalls matches messages that call at least one tool
+	PredicateHasToolCalls = "has_tool_calls"
+	// PredicateTool matches messages calling the tool given as argument
+	PredicateTool = "tool"
+	// PredicateRole matches messages with the role given as argument
+	PredicateRole = "role"
+	// PredicateContains matches messages whose content contains the argument,
+	// ignoring case
+	PredicateContains = "contains"
+)
+
+// Registry holds the components graph definitions refer to by name
+type Registry struct {
+	mu         sync.RWMutex
+	templates  map[string]prompt.ChatTemplate
+	models     map[string]model.ToolCallingChatModel
+	toolsNodes map[string]*compose.ToolsNode
+	tools      map[string]tool.BaseTool
+	lambdas    map[string]*compose.Lambda
+	predicates map[string]Predicate
+}
+
+// NewRegistry creates a registry holding only the built-in ask_human tool
+func NewRegistry() *Registry {
+	return &Registry{
+		templates:  make(map[string]prompt.ChatTemplate),
+		models:     make(map[string]model.ToolCallingChatModel),
+		toolsNodes: make(map[string]*compose.ToolsNode),
+		tools:      map[string]tool.BaseTool{types.AskHumanToolName: AskHumanTool()},
+		lambdas:    make(map[string]*compose.Lambda),
+		predicates: make(map[string]Predicate),
+	}
+}
+
+// RegisterChatTemplate registers a chat template for chat_template nodes
+func (r *Registry) RegisterChatTemplate(name string, tpl prompt.ChatTemplate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates[name] = tpl
+}
+
+// RegisterChatModel registers a chat model for chat_model nodes
+func (r *Registry) RegisterChatModel(name string, cm model.ToolCallingChatModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[name] = cm
+}
+
+// RegisterToolsNode registers a ready-made tools node for tools nodes
+func (r *Registry) RegisterToolsNode(name string, tn *compose.ToolsNode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.toolsNodes[name] = tn
+}
+
+// RegisterTool registers a tool under its own name, for the tool lists of
+// chat_model and tools nodes
+func (r *Registry) RegisterTool(ctx context.Context, t tool.BaseTool) error {
+	info, err := t.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("tool info: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[info.Name] = t
+	return nil
+}
+
+// RegisterLambda registers a lambda for lambda nodes
+func (r *Registry) RegisterLambda(name string, l *compose.Lambda) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lambdas[name] = l
+}
+
+// RegisterPredicate registers a custom branch predicate
+func (r *Registry) RegisterPredicate(name string, p Predicate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.predicates[name] = p
+}
+
+// ChatTemplate looks up a registered chat template
+func (r *Registry) ChatTemplate(name string) (prompt.ChatTemplate, error) {
+	return lookup(r, r.templates, "chat template", name)
+}
+
+// ChatModel looks up a registered chat model
+func (r *Registry) ChatModel(name string) (model.ToolCallingChatModel, error) {
+	return lookup(r, r.models, "chat model", name)
+}
+
+// ToolsNode looks up a registered tools node
+func (r *Registry) ToolsNode(name string) (*compose.ToolsNode, error) {
+	return lookup(r, r.toolsNodes, "tools node", name)
+}
+
+// Tool looks up a registered tool
+func (r *Registry) Tool(name string) (tool.BaseTool, error) {
+	return lookup(r, r.tools, "tool", name)
+}
+
+// Lambda looks up a registered lambda
+func (r *Registry) Lambda(name string) (*compose.Lambda, error) {
+	return lookup(r, r.lambdas, "lambda", name)
+}
+
+// Predicate resolves a branch predicate expression: a built-in predicate
+// (has_tool_calls, tool:<name>, role:<role>, contains:<text>) or a registered
+// one, optionally negated with a leading "!"
+func (r *Registry) Predicate(expr string) (Predicate, error) {
+	if rest, ok := strings.CutPrefix(expr, "!"); ok {
+		p, err := r.Predicate(rest)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, msg *schema.Message) (bool, error) {
+			ok, err := p(ctx, msg)
+			return !ok, err
+		}, nil
+	}
+
+	name, arg, _ := strings.Cut(expr, ":")
+	switch name {
+	case PredicateHasToolCalls:
+		return func(_ context.Context, msg *schema.Message) (bool, error) {
+			return msg != nil && len(msg.ToolCalls) > 0, nil
+		}, nil
+	case PredicateTool:
+		return ToolIn(arg), nil
+	case PredicateRole:
+		return func(_ context.Context, msg *schema.Message) (bool, error) {
+			return msg != nil && string(msg.Role) == arg, nil
+		}, nil
+	case PredicateContains:
+		return ContentContains(arg), nil
+	}
+	return lookup(r, r.predicates, "predicate", expr)
+}
+
+func lookup[T any](r *Registry, m map[string]T, kind, name string) (T, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := m[name]
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w: %s %q", ErrUnknownComponent, kind, name)
+	}
+	return v, nil
+}
@@ -0,0 +1,247 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/types"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeChatModel answers with its replies in order, then with "done"
+type fakeChatModel struct {
+	mu      sync.Mutex
+	replies []*schema.Message
+	// streams are streamed before the replies, each in its chunks
+	streams [][]*schema.Message
+	// inputs are the messages of every call
+	inputs [][]*schema.Message
+}
+
+func (m *fakeChatModel) Generate(_ context.Context, in []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inputs = append(m.inputs, in)
+	if len(m.replies) == 0 {
+		return schema.AssistantMessage("done", nil), nil
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	return reply, nil
+}
+
+func (m *fakeChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	m.mu.Lock()
+	if len(m.streams) > 0 {
+		defer m.mu.Unlock()
+		m.inputs = append(m.inputs, in)
+		chunks := m.streams[0]
+		m.streams = m.streams[1:]
+		return schema.StreamReaderFromArray(chunks), nil
+	}
+	m.mu.Unlock()
+
+	msg, err := m.Generate(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+func (m *fakeChatModel) WithTools([]*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+// lastInput returns the messages of the model's last call
+func (m *fakeChatModel) lastInput() []*schema.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.inputs) == 0 {
+		return nil
+	}
+	return m.inputs[len(m.inputs)-1]
+}
+
+// fakeTool records the arguments it runs with
+type fakeTool struct {
+	name string
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (t *fakeTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name, Desc: "records its calls"}, nil
+}
+
+func (t *fakeTool) InvokableRun(_ context.Context, args string, _ ...tool.Option) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, args)
+	return t.name + " ran with " + args, nil
+}
+
+func (t *fakeTool) ranWith() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.calls...)
+}
+
+// toolCallReply is an assistant message calling tool with args under id, for
+// each of its id, tool, args triples
+func toolCallReply(calls ...string) *schema.Message {
+	msg := schema.AssistantMessage("", nil)
+	for i := 0; i+2 < len(calls); i += 3 {
+		msg.ToolCalls = append(msg.ToolCalls, schema.ToolCall{
+			ID:       calls[i],
+			Type:     "function",
+			Function: schema.FunctionCall{Name: calls[i+1], Arguments: calls[i+2]},
+		})
+	}
+	return msg
+}
+
+// testRun is a graph over a fake chat model and tools, checkpointed to a
+// store in a temporary directory
+type testRun struct {
+	store  *checkpoint.Store
+	model  *fakeChatModel
+	tools  map[string]*fakeTool
+	runner compose.Runnable[map[string]any, *schema.Message]
+}
+
+// newTestRun builds the graph of cfg completed by a fake chat model answering
+// replies and fake tools named tools
+func newTestRun(t *testing.T, cfg Config, replies []*schema.Message, tools ...string) *testRun {
+	t.Helper()
+	ctx := context.Background()
+
+	backend, err := checkpoint.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRun{
+		store: checkpoint.NewStoreWithBackend(backend),
+		model: &fakeChatModel{replies: replies},
+		tools: make(map[string]*fakeTool),
+	}
+
+	var baseTools []tool.BaseTool
+	for _, name := range tools {
+		ft := &fakeTool{name: name}
+		r.tools[name] = ft
+		baseTools = append(baseTools, ft)
+	}
+	tn, err := compose.NewToolNode(ctx, &compose.ToolsNodeConfig{Tools: baseTools})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.ChatTemplate = prompt.FromMessages(schema.FString, schema.UserMessage("Book a ticket for {name}"))
+	cfg.ChatModel = r.model
+	cfg.ToolsNode = tn
+	cfg.CheckPointStore = r.store
+	if cfg.Definition != nil && cfg.Registry == nil {
+		// Definitions find the same components as "default" and the tools by name
+		cfg.Registry = NewRegistry()
+		cfg.Registry.RegisterChatTemplate("default", cfg.ChatTemplate)
+		cfg.Registry.RegisterChatModel("default", cfg.ChatModel)
+		cfg.Registry.RegisterToolsNode("default", cfg.ToolsNode)
+		for _, ft := range baseTools {
+			cfg.Registry.RegisterTool(ctx, ft)
+		}
+	}
+	if r.runner, err = NewGraph[map[string]any, *schema.Message](ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// run runs or resumes the checkpoint id, returning the interrupt info when
+// it interrupts
+func (r *testRun) run(t *testing.T, id string) (*schema.Message, *compose.InterruptInfo) {
+	t.Helper()
+	out, err := r.runner.Invoke(context.Background(), map[string]any{"name": "Ada"}, compose.WithCheckPointID(id))
+	if info, ok := compose.ExtractInterruptInfo(err); ok {
+		return nil, info
+	}
+	if err != nil {
+		t.Fatalf("run %s: %v", id, err)
+	}
+	return out, nil
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRun(t, Config{InterruptBeforeNodes: []string{"ToolsNode"}},
+		[]*schema.Message{toolCallReply("call-1", "BookTicket", `{"location":"Paris"}`)},
+		"BookTicket")
+
+	if _, info := r.run(t, "cp"); info == nil || len(info.BeforeNodes) != 1 || info.BeforeNodes[0] != "ToolsNode" {
+		t.Fatalf("interrupt = %+v, want before ToolsNode", info)
+	}
+
+	// The checkpoint compose saved decodes, and survives re-encoding untouched
+	data, ok, err := r.store.Get(ctx, "cp")
+	if err != nil || !ok {
+		t.Fatalf("checkpoint not saved: %v", err)
+	}
+	cp, err := checkpoint.DecodeCheckpoint(data)
+	if err != nil {
+		t.Fatalf("decode a checkpoint of this eino version: %v", err)
+	}
+	if tc, err := cp.ToolCall("call-1"); err != nil || tc.Function.Arguments != `{"location":"Paris"}` {
+		t.Fatalf("decoded tool call = %+v, %v", tc, err)
+	}
+	if ev := cp.State.LastEvent(); ev == nil || ev.Node != "ChatModel" {
+		t.Fatalf("last event = %+v, want ChatModel", ev)
+	}
+	if cp.State.SchemaVersion != types.CurrentSchemaVersion {
+		t.Fatalf("schema version %d, want %d", cp.State.SchemaVersion, types.CurrentSchemaVersion)
+	}
+
+	err = r.store.EditCheckpoint(ctx, "cp", func(cp *checkpoint.Checkpoint) error {
+		cp.SetContext("edited", true)
+		return cp.SetToolCallArguments("call-1", `{"location":"Rome"}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// compose resumes from the re-encoded checkpoint and runs the edit
+	out, info := r.run(t, "cp")
+	if info != nil {
+		t.Fatalf("resume interrupted again: %+v", info)
+	}
+	if out.Content != "done" {
+		t.Fatalf("result = %q, want done", out.Content)
+	}
+	if got := r.tools["BookTicket"].ranWith(); len(got) != 1 || got[0] != `{"location":"Rome"}` {
+		t.Fatalf("tool ran with %v, want the edited arguments", got)
+	}
+
+	// The model saw the edited call and its result
+	in := r.model.lastInput()
+	if len(in) != 3 || in[1].ToolCalls[0].Function.Arguments != `{"location":"Rome"}` || in[2].ToolCallID != "call-1" {
+		t.Fatalf("model input = %v, want the edited call and its result", in)
+	}
+}
+
+func TestDecodeCheckpointRejectsOtherFormats(t *testing.T) {
+	for _, data := range []string{`{}`, `{"MapValues":{}}`, `not json`} {
+		if _, err := checkpoint.DecodeCheckpoint([]byte(data)); err == nil {
+			t.Errorf("DecodeCheckpoint(%s) succeeded", data)
+		} else if data != "not json" && !errors.Is(err, checkpoint.ErrUnsupportedFormat) {
+			t.Errorf("DecodeCheckpoint(%s) = %v, want ErrUnsupportedFormat", data, err)
+		}
+	}
+}
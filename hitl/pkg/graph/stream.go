@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	template "github.com/cloudwego/eino/utils/callbacks"
+)
+
+// Kinds of StreamEvent
+const (
+	// StreamToken carries a chunk of the message content
+	StreamToken = "token"
+	// StreamToolCallDelta carries a chunk of a tool call; ID and name arrive
+	// with the first chunk of a call, its arguments across all of them
+	StreamToolCallDelta = "tool_call_delta"
+)
+
+// StreamEvent is an incremental piece of a chat model's streamed output
+type StreamEvent struct {
+	Kind string `json:"kind"`
+	// Node is the chat model node producing the output
+	Node    string `json:"node"`
+	Content string `json:"content,omitempty"`
+	// Index identifies the tool call a delta belongs to within the message
+	Index      int    `json:"index,omitempty"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
+	Arguments  string `json:"arguments,omitempty"`
+}
+
+// WithStreamHandler reports the token chunks and tool call deltas of every
+// chat model in the graph to fn as they arrive. It only has an effect when
+// the graph runs with Stream or Transform; interrupts and checkpoints work
+// the same as with Invoke.
+func WithStreamHandler(fn func(ctx context.Context, ev StreamEvent)) compose.Option {
+	handler := template.NewHandlerHelper().ChatModel(&template.ModelCallbackHandler{
+		OnEndWithStreamOutput: func(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[*model.CallbackOutput]) context.Context {
+			// Read the copy of the stream here: the node's own copy is
+			// buffered meanwhile, and events arrive before the node completes
+			defer output.Close()
+			for {
+				chunk, err := output.Recv()
+				if errors.Is(err, io.EOF) {
+					return ctx
+				}
+				if err != nil {
+					log.Printf("[Stream] %s: %v", info.Name, err)
+					return ctx
+				}
+				if chunk == nil || chunk.Message == nil {
+					continue
+				}
+				emitChunk(ctx, info.Name, chunk.Message, fn)
+			}
+		},
+	}).Handler()
+	return compose.WithCallbacks(handler)
+}
+
+// emitChunk turns a streamed message chunk into stream events
+func emitChunk(ctx context.Context, node string, msg *schema.Message, fn func(ctx context.Context, ev StreamEvent)) {
+	if msg.Content != "" {
+		fn(ctx, StreamEvent{Kind: StreamToken, Node: node, Content: msg.Content})
+	}
+	for i, tc := range msg.ToolCalls {
+		index := i
+		if tc.Index != nil {
+			index = *tc.Index
+		}
+		fn(ctx, StreamEvent{
+			Kind:       StreamToolCallDelta,
+			Node:       node,
+			Index:      index,
+			ToolCallID: tc.ID,
+			ToolName:   tc.Function.Name,
+			Arguments:  tc.Function.Arguments,
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package graph
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// streamRecorder collects the stream events of a run
+type streamRecorder struct {
+	mu     sync.Mutex
+	events []StreamEvent
+}
+
+func (r *streamRecorder) option() compose.Option {
+	return WithStreamHandler(func(_ context.Context, ev StreamEvent) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.events = append(r.events, ev)
+	})
+}
+
+func (r *streamRecorder) take() []StreamEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// toolCallChunk is a streamed chunk of the tool call at index
+func toolCallChunk(index int, id, name, args string) *schema.Message {
+	return &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{
+		Index:    &index,
+		ID:       id,
+		Type:     "function",
+		Function: schema.FunctionCall{Name: name, Arguments: args},
+	}}}
+}
+
+func TestStreamHandler(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRun(t, Config{InterruptBeforeNodes: []string{"ToolsNode"}}, nil, "BookTicket")
+	r.model.streams = [][]*schema.Message{{
+		schema.AssistantMessage("Booking ", nil),
+		schema.AssistantMessage("for Ada", nil),
+		toolCallChunk(0, "call-1", "BookTicket", `{"loc`),
+		toolCallChunk(0, "", "", `ation":"Paris"}`),
+		toolCallChunk(1, "call-2", "BookTicket", `{}`),
+	}}
+	rec := &streamRecorder{}
+
+	// Every chunk arrives as an event, in order, before the interrupt
+	_, err := r.runner.Stream(ctx, map[string]any{"name": "Ada"}, compose.WithCheckPointID("cp"), rec.option())
+	if info, ok := compose.ExtractInterruptInfo(err); !ok || len(info.BeforeNodes) != 1 || info.BeforeNodes[0] != "ToolsNode" {
+		t.Fatalf("Stream = %v, want an interrupt before ToolsNode", err)
+	}
+	want := []StreamEvent{
+		{Kind: StreamToken, Node: "ChatModel", Content: "Booking "},
+		{Kind: StreamToken, Node: "ChatModel", Content: "for Ada"},
+		{Kind: StreamToolCallDelta, Node: "ChatModel", Index: 0, ToolCallID: "call-1", ToolName: "BookTicket", Arguments: `{"loc`},
+		{Kind: StreamToolCallDelta, Node: "ChatModel", Index: 0, Arguments: `ation":"Paris"}`},
+		{Kind: StreamToolCallDelta, Node: "ChatModel", Index: 1, ToolCallID: "call-2", ToolName: "BookTicket", Arguments: `{}`},
+	}
+	if got := rec.take(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %+v\nwant %+v", got, want)
+	}
+
+	// The checkpoint holds the concatenated message
+	cp, err := r.store.LoadCheckpoint(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc, err := cp.ToolCall("call-1"); err != nil || tc.Function.Arguments != `{"location":"Paris"}` {
+		t.Fatalf("checkpointed call-1 = %+v, %v, want the joined arguments", tc, err)
+	}
+	if msg := cp.State.MessageHistory[len(cp.State.MessageHistory)-1]; msg.Content != "Booking for Ada" {
+		t.Fatalf("checkpointed content = %q", msg.Content)
+	}
+
+	// The resumed run streams the final answer
+	sr, err := r.runner.Stream(ctx, map[string]any{"name": "Ada"}, compose.WithCheckPointID("cp"), rec.option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := schema.ConcatMessageStream(sr)
+	if err != nil || out.Content != "done" {
+		t.Fatalf("result = %+v, %v, want done", out, err)
+	}
+	if got := r.tools["BookTicket"].ranWith(); len(got) != 2 || got[0] != `{"location":"Paris"}` || got[1] != `{}` {
+		t.Fatalf("tool ran with %v", got)
+	}
+	want = []StreamEvent{{Kind: StreamToken, Node: "ChatModel", Content: "done"}}
+	if got := rec.take(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resumed events = %+v, want %+v", got, want)
+	}
+}
+
+func TestStreamHandlerInvoke(t *testing.T) {
+	r := newTestRun(t, Config{}, nil)
+	r.model.streams = [][]*schema.Message{{schema.AssistantMessage("unused", nil)}}
+	rec := &streamRecorder{}
+
+	// Invoke does not stream the model, so there are no events
+	out, err := r.runner.Invoke(context.Background(), map[string]any{"name": "Ada"}, rec.option())
+	if err != nil || out.Content != "done" {
+		t.Fatalf("Invoke = %+v, %v", out, err)
+	}
+	if got := rec.take(); len(got) != 0 {
+		t.Fatalf("events = %+v, want none", got)
+	}
+}
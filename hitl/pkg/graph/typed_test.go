@@ -0,0 +1,178 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/types"
+
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+type booking struct {
+	Location string
+	Seats    int
+}
+
+// bookingState is a custom state next to the conversation
+type bookingState struct {
+	types.UniversalState
+	Booking *booking
+	Notes   []string
+}
+
+func init() {
+	for _, err := range []error{
+		checkpoint.RegisterSerializableType[bookingState]("graph_test_booking_state"),
+		checkpoint.RegisterSerializableType[booking]("graph_test_booking"),
+	} {
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// seatsTool books the seats of the bookingState it runs in and notes them
+type seatsTool struct {
+	mu    sync.Mutex
+	seats []int
+}
+
+func (t *seatsTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: "BookSeats", Desc: "books the seats of the state"}, nil
+}
+
+func (t *seatsTool) InvokableRun(ctx context.Context, args string, _ ...tool.Option) (string, error) {
+	var seats int
+	err := compose.ProcessState(ctx, func(_ context.Context, st *bookingState) error {
+		seats = st.Booking.Seats
+		st.Notes = append(st.Notes, fmt.Sprintf("booked %d in %s", seats, st.Booking.Location))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seats = append(t.seats, seats)
+	return fmt.Sprintf("booked %d seats", seats), nil
+}
+
+func (t *seatsTool) booked() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]int(nil), t.seats...)
+}
+
+func TestTypedState(t *testing.T) {
+	ctx := context.Background()
+	backend, err := checkpoint.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := checkpoint.NewStoreWithBackend(backend)
+	seats := &seatsTool{}
+	tn, err := compose.NewToolNode(ctx, &compose.ToolsNodeConfig{Tools: []tool.BaseTool{seats}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewTypedGraph[map[string]any, *schema.Message](ctx, Config{
+		ChatTemplate: prompt.FromMessages(schema.FString, schema.UserMessage("Book a ticket for {name}")),
+		ChatModel: &fakeChatModel{replies: []*schema.Message{
+			toolCallReply("call-1", "BookSeats", `{}`),
+			toolCallReply("call-2", "BookSeats", `{}`),
+		}},
+		ToolsNode:            tn,
+		CheckPointStore:      store,
+		InterruptBeforeNodes: []string{"ToolsNode"},
+	}, func(context.Context) *bookingState {
+		return &bookingState{Booking: &booking{Location: "Paris", Seats: 1}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func() *compose.InterruptInfo {
+		t.Helper()
+		_, err := runner.Invoke(ctx, map[string]any{"name": "Ada"}, compose.WithCheckPointID("cp"))
+		info, ok := compose.ExtractInterruptInfo(err)
+		if !ok {
+			t.Fatalf("run = %v, want an interrupt", err)
+		}
+		return info
+	}
+
+	// The interrupt carries the custom state, initialized by the graph
+	info := run()
+	st, ok := info.State.(*bookingState)
+	if !ok {
+		t.Fatalf("interrupt state is %T, want *bookingState", info.State)
+	}
+	if st.Booking.Seats != 1 || len(st.MessageHistory) == 0 || len(st.NodeExecutionLog) == 0 {
+		t.Fatalf("interrupt state = %+v, want one seat and the conversation", st)
+	}
+
+	// Edit the custom fields through the checkpoint
+	err = store.EditCheckpoint(ctx, "cp", func(cp *checkpoint.Checkpoint) error {
+		st, err := checkpoint.TypedState[*bookingState](cp)
+		if err != nil {
+			return err
+		}
+		st.Booking.Location = "Rome"
+		st.Booking.Seats = 3
+		cp.SetContext("edited", true)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pending state keeps the custom fields too
+	cp, err := store.LoadCheckpoint(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkpoint.TypedState[*types.UniversalState](cp); err == nil {
+		t.Fatal("TypedState of the wrong type succeeded")
+	}
+	edited, err := checkpoint.TypedState[*bookingState](cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SavePendingState(ctx, "cp", edited); err != nil {
+		t.Fatal(err)
+	}
+	var pending bookingState
+	if err := store.LoadPendingStateInto(ctx, "cp", &pending); err != nil {
+		t.Fatal(err)
+	}
+	if pending.Booking == nil || *pending.Booking != (booking{Location: "Rome", Seats: 3}) || pending.Context["edited"] != true {
+		t.Fatalf("pending state = %+v, want the edit", pending)
+	}
+
+	// The resumed run sees the edit, and its own changes are checkpointed
+	// at the next interrupt
+	run()
+	if got := seats.booked(); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("tool booked %v, want the edited 3 seats", got)
+	}
+	cp, err = store.LoadCheckpoint(ctx, "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err = checkpoint.TypedState[*bookingState](cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *st.Booking != (booking{Location: "Rome", Seats: 3}) || len(st.Notes) != 1 || st.Notes[0] != "booked 3 in Rome" {
+		t.Fatalf("checkpointed state = %+v, %v, want the edit and the tool's note", st.Booking, st.Notes)
+	}
+	if cp.State != st.Universal() || cp.State.Context["edited"] != true {
+		t.Fatalf("cp.State = %+v, want the embedded state with the edit", cp.State)
+	}
+}
@@ -0,0 +1,87 @@
+package interaction
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// Request asks for decisions on tool calls waiting for a human
+type Request struct {
+	// CheckpointID is the checkpoint the run stopped at, when known
+	CheckpointID string            `json:"checkpoint_id,omitempty"`
+	ToolCalls    []schema.ToolCall `json:"tool_calls"`
+	// State is the state of the interrupted run, for approvers that show or
+	// inspect the conversation
+	State *types.UniversalState `json:"state,omitempty"`
+}
+
+// NewRequest asks for decisions on the pending tool calls of state
+func NewRequest(checkpointID string, state *types.UniversalState) *Request {
+	_, pending := state.PendingToolCalls()
+	return &Request{CheckpointID: checkpointID, ToolCalls: pending, State: state}
+}
+
+// Approver decides pending tool calls: a human on a terminal, a replayed
+// script, a remote service or a policy. It returns at most one decision per
+// call of the request; calls it leaves undecided are up to the caller —
+// Confirm runs them as proposed, the web server waits for a human in the UI.
+type Approver interface {
+	Decide(ctx context.Context, req *Request) ([]types.ToolDecision, error)
+}
+
+// ApproverFunc adapts a function to Approver
+type ApproverFunc func(ctx context.Context, req *Request) ([]types.ToolDecision, error)
+
+// Decide calls f
+func (f ApproverFunc) Decide(ctx context.Context, req *Request) ([]types.ToolDecision, error) {
+	return f(ctx, req)
+}
+
+// Confirm asks a for decisions on the pending tool calls of state and applies
+// them; undecided calls run as proposed. It reports whether every call was
+// approved as proposed.
+func Confirm(ctx context.Context, a Approver, checkpointID string, state *types.UniversalState) (bool, error) {
+	req := NewRequest(checkpointID, state)
+	if len(req.ToolCalls) == 0 {
+		return true, nil
+	}
+
+	decisions, err := a.Decide(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("decide tool calls: %w", err)
+	}
+	if len(decisions) == 0 {
+		return true, nil
+	}
+
+	approved := true
+	for _, d := range decisions {
+		if d.Action != types.DecisionApprove {
+			approved = false
+		}
+	}
+	if err := state.ApplyToolDecisions(decisions); err != nil {
+		return false, err
+	}
+	return approved, nil
+}
+
+// Undecided returns the calls of req without a decision
+func Undecided(req *Request, decisions []types.ToolDecision) []schema.ToolCall {
+	decided := make(map[string]bool, len(decisions))
+	for _, d := range decisions {
+		decided[d.ToolCallID] = true
+	}
+
+	var calls []schema.ToolCall
+	for _, tc := range req.ToolCalls {
+		if !decided[tc.ID] {
+			calls = append(calls, tc)
+		}
+	}
+	return calls
+}
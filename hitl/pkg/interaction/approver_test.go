@@ -0,0 +1,101 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// toolCalls returns the calls of id, name, arguments triples
+func toolCalls(triples ...string) []schema.ToolCall {
+	var calls []schema.ToolCall
+	for i := 0; i+2 < len(triples); i += 3 {
+		calls = append(calls, schema.ToolCall{
+			ID:       triples[i],
+			Type:     "function",
+			Function: schema.FunctionCall{Name: triples[i+1], Arguments: triples[i+2]},
+		})
+	}
+	return calls
+}
+
+// pendingState is the state of a run interrupted before calling calls
+func pendingState(calls []schema.ToolCall) *types.UniversalState {
+	return &types.UniversalState{MessageHistory: []*schema.Message{
+		schema.UserMessage("Book Paris and Rome"),
+		schema.AssistantMessage("", calls),
+	}}
+}
+
+var twoBookings = toolCalls(
+	"call-1", "BookTicket", `{"location":"Paris"}`,
+	"call-2", "BookTicket", `{"location":"Rome"}`,
+)
+
+func TestConfirm(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		decisions []types.ToolDecision
+		approved  bool
+		args      []string
+	}{
+		{"no decisions", nil, true, []string{`{"location":"Paris"}`, `{"location":"Rome"}`}},
+		{"approved", []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionApprove}}, true, []string{`{"location":"Paris"}`, `{"location":"Rome"}`}},
+		{"edited", []types.ToolDecision{{ToolCallID: "call-2", Action: types.DecisionEdit, Arguments: `{"location":"Oslo"}`}}, false, []string{`{"location":"Paris"}`, `{"location":"Oslo"}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := pendingState(toolCalls("call-1", "BookTicket", `{"location":"Paris"}`, "call-2", "BookTicket", `{"location":"Rome"}`))
+			var asked *Request
+			a := ApproverFunc(func(_ context.Context, req *Request) ([]types.ToolDecision, error) {
+				asked = req
+				return tt.decisions, nil
+			})
+			approved, err := Confirm(ctx, a, "cp", state)
+			if err != nil || approved != tt.approved {
+				t.Fatalf("Confirm = %v, %v, want %v", approved, err, tt.approved)
+			}
+			if asked.CheckpointID != "cp" || len(asked.ToolCalls) != 2 || asked.State != state {
+				t.Fatalf("asked %+v", asked)
+			}
+			calls := state.MessageHistory[1].ToolCalls
+			for i, want := range tt.args {
+				if calls[i].Function.Arguments != want {
+					t.Fatalf("call %d arguments %s, want %s", i, calls[i].Function.Arguments, want)
+				}
+			}
+		})
+	}
+
+	// Nothing pending, nobody is asked
+	state := &types.UniversalState{MessageHistory: []*schema.Message{schema.UserMessage("Hi")}}
+	never := ApproverFunc(func(context.Context, *Request) ([]types.ToolDecision, error) {
+		t.Fatal("asked without pending calls")
+		return nil, nil
+	})
+	if approved, err := Confirm(ctx, never, "", state); err != nil || !approved {
+		t.Fatalf("Confirm without pending calls = %v, %v", approved, err)
+	}
+
+	failed := errors.New("approver down")
+	down := ApproverFunc(func(context.Context, *Request) ([]types.ToolDecision, error) { return nil, failed })
+	if _, err := Confirm(ctx, down, "", pendingState(twoBookings)); !errors.Is(err, failed) {
+		t.Fatalf("Confirm = %v, want the approver's error", err)
+	}
+}
+
+func TestUndecided(t *testing.T) {
+	req := &Request{ToolCalls: twoBookings}
+	if got := Undecided(req, nil); len(got) != 2 {
+		t.Fatalf("Undecided without decisions = %v", got)
+	}
+	got := Undecided(req, []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionReject}})
+	if len(got) != 1 || got[0].ID != "call-2" {
+		t.Fatalf("Undecided = %v, want call-2", got)
+	}
+}
@@ -0,0 +1,167 @@
+package interaction
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// ActionAsk is a policy rule action leaving the call to the policy's
+// fallback, i.e. to a human
+const ActionAsk types.DecisionAction = "ask"
+
+// Rule decides the calls it matches: calls to tools matching Tool (a
+// path.Match pattern, any tool when empty) whose arguments validate against
+// the JSON schema Arguments, when set
+type Rule struct {
+	Tool      string               `json:"tool,omitempty" yaml:"tool,omitempty"`
+	Arguments map[string]any       `json:"arguments,omitempty" yaml:"arguments,omitempty"`
+	Action    types.DecisionAction `json:"action" yaml:"action"`
+	// Reason is passed to the model with a rejection
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Policy approves or rejects tool calls automatically. Each call is decided
+// by the first rule it matches; calls matching no rule or an ActionAsk rule
+// are passed to Fallback, or left undecided when it is nil. Questions of the
+// ask_human tool always go to Fallback.
+type Policy struct {
+	Rules    []Rule   `json:"rules" yaml:"rules"`
+	Fallback Approver `json:"-" yaml:"-"`
+
+	once    sync.Once
+	schemas []*openapi3.Schema
+	err     error
+}
+
+// LoadPolicy reads a YAML or JSON policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read approval policy: %w", err)
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ParsePolicy parses and validates a YAML or JSON policy
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("parse approval policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks the actions, tool patterns and argument schemas of the
+// rules
+func (p *Policy) Validate() error {
+	p.once.Do(p.compile)
+	return p.err
+}
+
+func (p *Policy) compile() {
+	p.schemas = make([]*openapi3.Schema, len(p.Rules))
+	for i, r := range p.Rules {
+		if err := p.compileRule(i, r); err != nil {
+			p.err = fmt.Errorf("rule %d: %w", i+1, err)
+			return
+		}
+	}
+}
+
+func (p *Policy) compileRule(i int, r Rule) error {
+	switch r.Action {
+	case types.DecisionApprove, types.DecisionReject, ActionAsk:
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	if _, err := path.Match(r.Tool, ""); err != nil {
+		return fmt.Errorf("tool pattern %q: %w", r.Tool, err)
+	}
+	if r.Arguments == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(r.Arguments)
+	if err != nil {
+		return fmt.Errorf("marshal arguments schema: %w", err)
+	}
+	var s openapi3.Schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("parse arguments schema: %w", err)
+	}
+	p.schemas[i] = &s
+	return nil
+}
+
+// Decide decides the calls matched by a rule and passes the rest to the
+// fallback
+func (p *Policy) Decide(ctx context.Context, req *Request) ([]types.ToolDecision, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	var decisions []types.ToolDecision
+	var ask []schema.ToolCall
+	for _, tc := range req.ToolCalls {
+		r, ok := p.match(tc)
+		if !ok || r.Action == ActionAsk {
+			ask = append(ask, tc)
+			continue
+		}
+		decisions = append(decisions, types.ToolDecision{ToolCallID: tc.ID, Action: r.Action, Reason: r.Reason})
+	}
+
+	if len(ask) == 0 || p.Fallback == nil {
+		return decisions, nil
+	}
+	rest, err := p.Fallback.Decide(ctx, &Request{CheckpointID: req.CheckpointID, ToolCalls: ask, State: req.State})
+	if err != nil {
+		return nil, err
+	}
+	return append(decisions, rest...), nil
+}
+
+// match returns the first rule matching tc
+func (p *Policy) match(tc schema.ToolCall) (Rule, bool) {
+	if tc.Function.Name == types.AskHumanToolName {
+		return Rule{}, false
+	}
+	for i, r := range p.Rules {
+		if r.Tool != "" {
+			if ok, _ := path.Match(r.Tool, tc.Function.Name); !ok {
+				continue
+			}
+		}
+		if s := p.schemas[i]; s != nil {
+			var args any
+			if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+				continue
+			}
+			if s.VisitJSON(args, openapi3.MultiErrors()) != nil {
+				continue
+			}
+		}
+		return r, true
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,112 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+const testPolicy = `
+rules:
+  - tool: Refund
+    action: reject
+    reason: refunds need a manager
+  - tool: BookTicket
+    arguments:
+      type: object
+      required: [location]
+      properties:
+        location:
+          type: string
+          enum: [Paris, Rome]
+    action: approve
+  - tool: "Get*"
+    action: approve
+  - tool: BookTicket
+    action: ask
+`
+
+func TestPolicy(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := toolCalls(
+		"c1", "Refund", `{"amount":100}`,
+		"c2", "BookTicket", `{"location":"Paris"}`,
+		"c3", "BookTicket", `{"location":"Oslo"}`,
+		"c4", "GetWeather", `{}`,
+		"c5", "DeleteAccount", `{}`,
+		"c6", "BookTicket", `not json`,
+		"c7", types.AskHumanToolName, `{"question":"Which class?"}`,
+	)
+
+	// Without a fallback, calls left to a human stay undecided
+	got, err := p.Decide(context.Background(), &Request{ToolCalls: calls})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.ToolDecision{
+		{ToolCallID: "c1", Action: types.DecisionReject, Reason: "refunds need a manager"},
+		{ToolCallID: "c2", Action: types.DecisionApprove},
+		{ToolCallID: "c4", Action: types.DecisionApprove},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decisions = %+v, want %+v", got, want)
+	}
+
+	// The fallback gets the calls matching no rule or an ask rule, and the
+	// questions
+	var asked []string
+	p.Fallback = ApproverFunc(func(_ context.Context, req *Request) ([]types.ToolDecision, error) {
+		for _, tc := range req.ToolCalls {
+			asked = append(asked, tc.ID)
+		}
+		return []types.ToolDecision{{ToolCallID: "c3", Action: types.DecisionReject}}, nil
+	})
+	got, err = p.Decide(context.Background(), &Request{CheckpointID: "cp", ToolCalls: calls})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c3", "c5", "c6", "c7"}; !reflect.DeepEqual(asked, want) {
+		t.Fatalf("fallback asked about %v, want %v", asked, want)
+	}
+	if len(got) != 4 || got[3].ToolCallID != "c3" {
+		t.Fatalf("decisions = %+v, want the fallback's last", got)
+	}
+
+	failed := errors.New("nobody there")
+	p.Fallback = ApproverFunc(func(context.Context, *Request) ([]types.ToolDecision, error) { return nil, failed })
+	if _, err := p.Decide(context.Background(), &Request{ToolCalls: calls}); !errors.Is(err, failed) {
+		t.Fatalf("Decide = %v, want the fallback's error", err)
+	}
+}
+
+func TestParsePolicyRejects(t *testing.T) {
+	tests := map[string]string{
+		"unknown action": "rules:\n  - tool: Refund\n    action: escalate\n",
+		"edit action":    "rules:\n  - tool: Refund\n    action: edit\n",
+		"bad pattern":    "rules:\n  - tool: \"[\"\n    action: approve\n",
+		"unknown field":  "rules:\n  - tool: Refund\n    action: approve\n    when: always\n",
+		"not a policy":   "- approve\n",
+	}
+	for name, policy := range tests {
+		if _, err := ParsePolicy([]byte(policy)); err == nil {
+			t.Errorf("%s: parsed", name)
+		}
+	}
+
+	// JSON is YAML too
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"rules": [{"tool": "Refund", "action": "reject"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := LoadPolicy(path); err != nil || len(p.Rules) != 1 {
+		t.Fatalf("LoadPolicy = %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,148 @@
+package interaction
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+var (
+	// ErrScriptExhausted is returned when a script has no decision left for
+	// a pending tool call
+	ErrScriptExhausted = errors.New("script has no decisions left")
+	// ErrScriptMismatch is returned when the next decision of a script is for
+	// another tool than the pending call
+	ErrScriptMismatch = errors.New("script decision is for another tool")
+)
+
+// ScriptEntry is one decision of a script, for a call to Tool. The tool call
+// ID is recorded for reference only: model runs produce new IDs, so replayed
+// entries are matched to calls in order.
+type ScriptEntry struct {
+	Tool string `json:"tool,omitempty"`
+	types.ToolDecision
+}
+
+// Script replays recorded decisions, one entry per pending tool call in
+// order, e.g. to rerun a session or drive tests without a human
+type Script struct {
+	mu      sync.Mutex
+	entries []ScriptEntry
+	next    int
+}
+
+// NewScript creates a Script replaying entries
+func NewScript(entries []ScriptEntry) *Script {
+	return &Script{entries: entries}
+}
+
+// LoadScript reads a script file, one JSON ScriptEntry per line as written by
+// Record
+func LoadScript(path string) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open script: %w", err)
+	}
+	defer f.Close()
+
+	s, err := ParseScript(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ParseScript reads JSON lines of ScriptEntry; blank lines are skipped
+func ParseScript(r io.Reader) (*Script, error) {
+	var entries []ScriptEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		b := scanner.Bytes()
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		var e ScriptEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read script: %w", err)
+	}
+	return NewScript(entries), nil
+}
+
+// Remaining returns the number of entries not replayed yet
+func (s *Script) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries) - s.next
+}
+
+// Decide takes the next entry for each call. Nothing is consumed when any
+// call has no matching entry.
+func (s *Script) Decide(_ context.Context, req *Request) ([]types.ToolDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries)-s.next < len(req.ToolCalls) {
+		return nil, fmt.Errorf("%w: %d tool calls pending, %d decisions left",
+			ErrScriptExhausted, len(req.ToolCalls), len(s.entries)-s.next)
+	}
+
+	decisions := make([]types.ToolDecision, 0, len(req.ToolCalls))
+	for i, tc := range req.ToolCalls {
+		e := s.entries[s.next+i]
+		if e.Tool != "" && e.Tool != tc.Function.Name {
+			return nil, fmt.Errorf("%w: entry %d is for %s, pending call is %s",
+				ErrScriptMismatch, s.next+i+1, e.Tool, tc.Function.Name)
+		}
+		d := e.ToolDecision
+		d.ToolCallID = tc.ID
+		decisions = append(decisions, d)
+	}
+	s.next += len(req.ToolCalls)
+	return decisions, nil
+}
+
+// Record returns an Approver asking a and appending every decision to w as a
+// script line, so the session can be replayed with LoadScript. Calls a leaves
+// undecided are recorded as approved, as Confirm runs them.
+func Record(a Approver, w io.Writer) Approver {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return ApproverFunc(func(ctx context.Context, req *Request) ([]types.ToolDecision, error) {
+		decisions, err := a.Decide(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		byID := make(map[string]types.ToolDecision, len(decisions))
+		for _, d := range decisions {
+			byID[d.ToolCallID] = d
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, tc := range req.ToolCalls {
+			d, ok := byID[tc.ID]
+			if !ok {
+				d = types.ToolDecision{ToolCallID: tc.ID, Action: types.DecisionApprove}
+			}
+			if err := enc.Encode(ScriptEntry{Tool: tc.Function.Name, ToolDecision: d}); err != nil {
+				return nil, fmt.Errorf("record decision: %w", err)
+			}
+		}
+		return decisions, nil
+	})
+}
@@ -0,0 +1,93 @@
+package interaction
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	// A human edits the first call and leaves the second undecided
+	human := ApproverFunc(func(context.Context, *Request) ([]types.ToolDecision, error) {
+		return []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":"Oslo"}`}}, nil
+	})
+	var script bytes.Buffer
+	decisions, err := Record(human, &script).Decide(ctx, &Request{ToolCalls: twoBookings})
+	if err != nil || len(decisions) != 1 {
+		t.Fatalf("Decide = %+v, %v", decisions, err)
+	}
+	if lines := strings.Count(script.String(), "\n"); lines != 2 {
+		t.Fatalf("recorded %d lines, want 2:\n%s", lines, script.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, script.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A rerun's calls have new IDs; entries are matched in order
+	rerun := toolCalls("run2-1", "BookTicket", `{"location":"Paris"}`, "run2-2", "BookTicket", `{"location":"Rome"}`)
+	got, err := s.Decide(ctx, &Request{ToolCalls: rerun})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.ToolDecision{
+		{ToolCallID: "run2-1", Action: types.DecisionEdit, Arguments: `{"location":"Oslo"}`},
+		// Undecided calls ran as proposed, so they replay as approved
+		{ToolCallID: "run2-2", Action: types.DecisionApprove},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("replayed %+v, want %+v", got, want)
+	}
+	if s.Remaining() != 0 {
+		t.Fatalf("%d entries left", s.Remaining())
+	}
+	if _, err := s.Decide(ctx, &Request{ToolCalls: rerun[:1]}); !errors.Is(err, ErrScriptExhausted) {
+		t.Fatalf("Decide past the end = %v, want ErrScriptExhausted", err)
+	}
+
+	// Recording fails with the approver
+	failed := errors.New("approver down")
+	down := ApproverFunc(func(context.Context, *Request) ([]types.ToolDecision, error) { return nil, failed })
+	script.Reset()
+	if _, err := Record(down, &script).Decide(ctx, &Request{ToolCalls: twoBookings}); !errors.Is(err, failed) || script.Len() != 0 {
+		t.Fatalf("Decide = %v, recorded %q", err, script.String())
+	}
+}
+
+func TestScriptMismatch(t *testing.T) {
+	s, err := ParseScript(strings.NewReader(`{"tool":"BookTicket","action":"approve"}` + "\n\n" + `{"tool":"Refund","action":"reject","reason":"no"}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is consumed when a call has no matching entry
+	if _, err := s.Decide(context.Background(), &Request{ToolCalls: twoBookings}); !errors.Is(err, ErrScriptMismatch) {
+		t.Fatalf("Decide = %v, want ErrScriptMismatch", err)
+	}
+	if s.Remaining() != 2 {
+		t.Fatalf("%d entries left, want 2", s.Remaining())
+	}
+	got, err := s.Decide(context.Background(), &Request{ToolCalls: toolCalls("c1", "BookTicket", "{}", "c2", "Refund", "{}")})
+	if err != nil || len(got) != 2 || got[1].Action != types.DecisionReject || got[1].Reason != "no" {
+		t.Fatalf("Decide = %+v, %v", got, err)
+	}
+
+	if _, err := ParseScript(strings.NewReader("{\"action\":\"approve\"}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("ParseScript = %v, want an error on line 2", err)
+	}
+	if _, err := LoadScript(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Fatal("loaded a missing script")
+	}
+}
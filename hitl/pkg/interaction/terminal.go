@@ -0,0 +1,107 @@
+package interaction
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// Terminal asks a human line by line, on a terminal or any reader and writer
+type Terminal struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+// NewTerminal creates a Terminal reading answers from in and prompting on out
+func NewTerminal(in io.Reader, out io.Writer) *Terminal {
+	return &Terminal{scanner: bufio.NewScanner(in), out: out}
+}
+
+// Decide asks whether to approve, edit or reject each call, and asks the
+// questions of ask_human calls. Calls left when input ends are not decided.
+func (t *Terminal) Decide(ctx context.Context, req *Request) ([]types.ToolDecision, error) {
+	var decisions []types.ToolDecision
+	for i, tc := range req.ToolCalls {
+		if err := ctx.Err(); err != nil {
+			return decisions, err
+		}
+
+		if q, ok := types.QuestionFromToolCall(tc); ok {
+			answer, ok := t.askQuestion(i, q)
+			if !ok {
+				return decisions, t.scanner.Err()
+			}
+			decisions = append(decisions, types.ToolDecision{ToolCallID: tc.ID, Action: types.DecisionAnswer, Answer: answer})
+			continue
+		}
+
+		fmt.Fprintf(t.out, "\nTool Call [%d] %s: %s\n", i, tc.ID, tc.Function.Name)
+		fmt.Fprintf(t.out, "Arguments: %s\n", tc.Function.Arguments)
+		fmt.Fprint(t.out, "Approve, edit or reject? (a/e/r): ")
+		if !t.scanner.Scan() {
+			return decisions, t.scanner.Err()
+		}
+
+		d := types.ToolDecision{ToolCallID: tc.ID, Action: types.DecisionApprove}
+		switch strings.ToLower(strings.TrimSpace(t.scanner.Text())) {
+		case "e", "edit", "n":
+			args, ok := t.promptArguments()
+			if !ok {
+				return decisions, t.scanner.Err()
+			}
+			d.Action, d.Arguments = types.DecisionEdit, args
+			fmt.Fprintf(t.out, "Updated arguments to: %s\n", args)
+		case "r", "reject":
+			fmt.Fprint(t.out, "Reason (optional): ")
+			if !t.scanner.Scan() {
+				return decisions, t.scanner.Err()
+			}
+			d.Action, d.Reason = types.DecisionReject, strings.TrimSpace(t.scanner.Text())
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, nil
+}
+
+// promptArguments reads modified arguments until they are valid JSON
+func (t *Terminal) promptArguments() (string, bool) {
+	for {
+		fmt.Fprint(t.out, "Please enter the modified arguments: ")
+		if !t.scanner.Scan() {
+			return "", false
+		}
+		args := t.scanner.Text()
+		if json.Valid([]byte(args)) {
+			return args, true
+		}
+		fmt.Fprintln(t.out, "Arguments must be valid JSON")
+	}
+}
+
+// askQuestion reads a non-empty answer to q; with options, the number of an
+// option answers with that option
+func (t *Terminal) askQuestion(i int, q types.Question) (string, bool) {
+	fmt.Fprintf(t.out, "\nQuestion [%d] %s: %s\n", i, q.ToolCallID, q.Question)
+	for n, opt := range q.Options {
+		fmt.Fprintf(t.out, "  %d) %s\n", n+1, opt)
+	}
+	for {
+		fmt.Fprint(t.out, "Answer: ")
+		if !t.scanner.Scan() {
+			return "", false
+		}
+		answer := strings.TrimSpace(t.scanner.Text())
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(q.Options) {
+			answer = q.Options[n-1]
+		}
+		if answer != "" {
+			return answer, true
+		}
+	}
+}
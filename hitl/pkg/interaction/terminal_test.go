@@ -0,0 +1,108 @@
+package interaction
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+func TestTerminal(t *testing.T) {
+	question := toolCalls("call-q", types.AskHumanToolName, `{"question":"Which class?","options":["economy","business"]}`)
+	tests := []struct {
+		name  string
+		calls []string
+		input string
+		want  []types.ToolDecision
+	}{
+		{
+			name:  "approve",
+			input: "a\nyes\n",
+			want: []types.ToolDecision{
+				{ToolCallID: "call-1", Action: types.DecisionApprove},
+				// Anything but edit or reject approves
+				{ToolCallID: "call-2", Action: types.DecisionApprove},
+			},
+		},
+		{
+			name:  "edit",
+			input: "e\n{\"location\":\"Oslo\"}\nA\n",
+			want: []types.ToolDecision{
+				{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":"Oslo"}`},
+				{ToolCallID: "call-2", Action: types.DecisionApprove},
+			},
+		},
+		{
+			name:  "edit with invalid JSON",
+			input: "edit\n{location: Oslo}\n{\"location\":\"Oslo\"}\nr\n\n",
+			want: []types.ToolDecision{
+				{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":"Oslo"}`},
+				{ToolCallID: "call-2", Action: types.DecisionReject},
+			},
+		},
+		{
+			name:  "reject",
+			input: " R \n Too expensive \nreject\nno reason\n",
+			want: []types.ToolDecision{
+				{ToolCallID: "call-1", Action: types.DecisionReject, Reason: "Too expensive"},
+				{ToolCallID: "call-2", Action: types.DecisionReject, Reason: "no reason"},
+			},
+		},
+		{
+			name:  "input ends",
+			input: "a\n",
+			want:  []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionApprove}},
+		},
+		{
+			name:  "input ends while editing",
+			input: "e\n{\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := NewTerminal(strings.NewReader(tt.input), &out).Decide(context.Background(), &Request{ToolCalls: twoBookings})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decisions = %+v, want %+v", got, tt.want)
+			}
+			if !strings.Contains(out.String(), `Arguments: {"location":"Paris"}`) {
+				t.Fatalf("prompt lacks the arguments:\n%s", out.String())
+			}
+		})
+	}
+
+	t.Run("answer", func(t *testing.T) {
+		var out bytes.Buffer
+		// An empty answer is asked again; a number picks an option
+		in := strings.NewReader("\n2\n\nfirst class, please\n")
+		req := &Request{ToolCalls: append(question, toolCalls("call-r", types.AskHumanToolName, `{"question":"Any wishes?"}`)...)}
+		got, err := NewTerminal(in, &out).Decide(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []types.ToolDecision{
+			{ToolCallID: "call-q", Action: types.DecisionAnswer, Answer: "business"},
+			{ToolCallID: "call-r", Action: types.DecisionAnswer, Answer: "first class, please"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("decisions = %+v, want %+v", got, want)
+		}
+		if !strings.Contains(out.String(), "Which class?") || !strings.Contains(out.String(), "2) business") {
+			t.Fatalf("prompt lacks the question:\n%s", out.String())
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := NewTerminal(strings.NewReader("a\na\n"), &bytes.Buffer{}).Decide(ctx, &Request{ToolCalls: twoBookings}); err != context.Canceled {
+			t.Fatalf("Decide = %v, want context.Canceled", err)
+		}
+	})
+}
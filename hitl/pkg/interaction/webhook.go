@@ -0,0 +1,77 @@
+package interaction
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+// DefaultWebhookTimeout bounds the calls of a Webhook without a Client
+const DefaultWebhookTimeout = 30 * time.Second
+
+// defaultWebhookClient is the client of Webhooks without one
+var defaultWebhookClient = &http.Client{Timeout: DefaultWebhookTimeout}
+
+// Webhook asks a remote service: the Request is POSTed as JSON to URL and the
+// service answers with a WebhookResponse, or 204 No Content to leave every
+// call undecided. The service may hold the request while a human decides;
+// the wait is bounded by the ctx passed to Decide and the client's Timeout.
+type Webhook struct {
+	URL string
+	// Client defaults to a client timing out after DefaultWebhookTimeout
+	Client *http.Client
+	// Header is added to every request, e.g. for authorization
+	Header http.Header
+}
+
+// WebhookResponse is the body a webhook answers with
+type WebhookResponse struct {
+	Decisions []types.ToolDecision `json:"decisions"`
+}
+
+// Decide POSTs req to the webhook
+func (w *Webhook) Decide(ctx context.Context, req *Request) ([]types.ToolDecision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal webhook request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create webhook request: %w", err)
+	}
+	for k, v := range w.Header {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = defaultWebhookClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var out WebhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode webhook response: %w", err)
+	}
+	return out.Decisions, nil
+}
@@ -0,0 +1,99 @@
+package interaction
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+func TestWebhook(t *testing.T) {
+	want := []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionReject, Reason: "over budget"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CheckpointID != "cp" || len(req.ToolCalls) != 2 {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(WebhookResponse{Decisions: want})
+	}))
+	defer srv.Close()
+
+	wh := &Webhook{URL: srv.URL, Header: http.Header{"Authorization": {"Bearer token"}}}
+	got, err := wh.Decide(context.Background(), &Request{CheckpointID: "cp", ToolCalls: twoBookings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decisions = %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhookResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"no content", http.StatusNoContent, "", ""},
+		{"server error", http.StatusInternalServerError, "approvals are down\n", "500 Internal Server Error: approvals are down"},
+		{"not modified", http.StatusNotModified, "", "304"},
+		{"bad body", http.StatusOK, "{", "decode webhook response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			got, err := (&Webhook{URL: srv.URL}).Decide(context.Background(), &Request{ToolCalls: twoBookings})
+			if tt.wantErr == "" {
+				if err != nil || got != nil {
+					t.Fatalf("Decide = %+v, %v, want no decisions", got, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Decide = %v, want an error with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// Bounded by the client's timeout
+	wh := &Webhook{URL: srv.URL, Client: &http.Client{Timeout: 50 * time.Millisecond}}
+	if _, err := wh.Decide(context.Background(), &Request{ToolCalls: twoBookings}); err == nil || !strings.Contains(err.Error(), "call webhook") {
+		t.Fatalf("Decide = %v, want a timeout", err)
+	}
+
+	// And by the caller's context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := (&Webhook{URL: srv.URL}).Decide(ctx, &Request{ToolCalls: twoBookings}); err == nil || ctx.Err() == nil {
+		t.Fatalf("Decide = %v, want the context's deadline", err)
+	}
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// AskHumanToolName is the tool a model calls to ask the human a question,
+// e.g. for a missing phone number or to choose between options. Its calls are
+// never run: they interrupt the graph until a human answers them with
+// DecisionAnswer, and the answer is what the model gets as the tool result.
+const AskHumanToolName = "ask_human"
+
+// Question is what a model asked with the ask_human tool
+type Question struct {
+	ToolCallID string   `json:"tool_call_id"`
+	Question   string   `json:"question"`
+	Options    []string `json:"options,omitempty"`
+}
+
+// QuestionFromToolCall returns the question of an ask_human call. Arguments
+// that do not parse are shown as the question.
+func QuestionFromToolCall(tc schema.ToolCall) (Question, bool) {
+	if tc.Function.Name != AskHumanToolName {
+		return Question{}, false
+	}
+	var q Question
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &q); err != nil || q.Question == "" {
+		q.Question = tc.Function.Arguments
+	}
+	q.ToolCallID = tc.ID
+	return q, true
+}
+
+// PendingQuestions returns the unanswered ask_human calls
+func (s *UniversalState) PendingQuestions() []Question {
+	_, pending := s.PendingToolCalls()
+	var questions []Question
+	for _, tc := range pending {
+		if q, ok := QuestionFromToolCall(tc); ok {
+			questions = append(questions, q)
+		}
+	}
+	return questions
+}
@@ -0,0 +1,58 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestQuestionFromToolCall(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		args string
+		want Question
+		ok   bool
+	}{
+		{"question", AskHumanToolName, `{"question": "Phone number?"}`, Question{ToolCallID: "c1", Question: "Phone number?"}, true},
+		{"options", AskHumanToolName, `{"question": "Class?", "options": ["economy", "business"]}`,
+			Question{ToolCallID: "c1", Question: "Class?", Options: []string{"economy", "business"}}, true},
+		// Arguments that do not parse are shown as they are
+		{"not json", AskHumanToolName, `Phone number?`, Question{ToolCallID: "c1", Question: "Phone number?"}, true},
+		{"no question", AskHumanToolName, `{"options": ["a"]}`, Question{ToolCallID: "c1", Question: `{"options": ["a"]}`, Options: []string{"a"}}, true},
+		{"other tool", "BookTicket", `{"question": "Phone number?"}`, Question{}, false},
+	}
+	for _, tt := range tests {
+		tc := schema.ToolCall{ID: "c1", Function: schema.FunctionCall{Name: tt.tool, Arguments: tt.args}}
+		got, ok := QuestionFromToolCall(tc)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPendingQuestions(t *testing.T) {
+	s := NewUniversalState()
+	s.MessageHistory = []*schema.Message{
+		schema.UserMessage("Book a ticket"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+			{ID: "c1", Function: schema.FunctionCall{Name: AskHumanToolName, Arguments: `{"question": "Class?"}`}},
+			{ID: "c2", Function: schema.FunctionCall{Name: "BookTicket", Arguments: `{}`}},
+			{ID: "c3", Function: schema.FunctionCall{Name: AskHumanToolName, Arguments: `{"question": "Phone?"}`}},
+		}},
+	}
+	if got := s.PendingQuestions(); len(got) != 2 || got[0].ToolCallID != "c1" || got[1].ToolCallID != "c3" {
+		t.Fatalf("PendingQuestions = %+v, want c1 and c3", got)
+	}
+
+	// Answered questions are no longer pending
+	s.MessageHistory = append(s.MessageHistory, schema.ToolMessage("business", "c1"))
+	if got := s.PendingQuestions(); len(got) != 1 || got[0].ToolCallID != "c3" {
+		t.Fatalf("PendingQuestions = %+v, want c3", got)
+	}
+	s.MessageHistory = append(s.MessageHistory, schema.ToolMessage("555-0100", "c3"))
+	if got := s.PendingQuestions(); len(got) != 0 {
+		t.Fatalf("PendingQuestions = %+v, want none", got)
+	}
+}
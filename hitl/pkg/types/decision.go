@@ -0,0 +1,141 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrInvalidDecision is returned when tool decisions cannot be applied to the
+// pending tool calls
+var ErrInvalidDecision = errors.New("invalid tool decision")
+
+// DecisionAction is what a human decided for a pending tool call
+type DecisionAction string
+
+const (
+	// DecisionApprove runs the call as proposed
+	DecisionApprove DecisionAction = "approve"
+	// DecisionEdit runs the call with replaced arguments
+	DecisionEdit DecisionAction = "edit"
+	// DecisionReject skips the call and answers it with a tool message telling
+	// the model it was rejected
+	DecisionReject DecisionAction = "reject"
+	// DecisionAnswer skips the call and answers it with a tool message holding
+	// the human's answer; it is how ask_human calls are answered
+	DecisionAnswer DecisionAction = "answer"
+)
+
+// ToolDecision is the decision for one pending tool call, addressed by its ID
+type ToolDecision struct {
+	ToolCallID string         `json:"tool_call_id"`
+	Action     DecisionAction `json:"action"`
+	// Arguments are the new JSON arguments of an edit
+	Arguments string `json:"arguments,omitempty"`
+	// Reason is passed to the model with a rejection
+	Reason string `json:"reason,omitempty"`
+	// Answer is the tool result of an answer
+	Answer string `json:"answer,omitempty"`
+}
+
+// PendingToolCalls returns the last assistant message with tool calls and the
+// calls no tool message answers yet. msg is nil when the conversation has
+// moved past the last tool calls.
+func (s *UniversalState) PendingToolCalls() (msg *schema.Message, pending []schema.ToolCall) {
+	answered := make(map[string]bool)
+	for i := len(s.MessageHistory) - 1; i >= 0; i-- {
+		m := s.MessageHistory[i]
+		if m == nil {
+			continue
+		}
+		if m.Role == schema.Tool {
+			answered[m.ToolCallID] = true
+			continue
+		}
+		if m.Role != schema.Assistant || len(m.ToolCalls) == 0 {
+			return nil, nil
+		}
+		for _, tc := range m.ToolCalls {
+			if !answered[tc.ID] {
+				pending = append(pending, tc)
+			}
+		}
+		return m, pending
+	}
+	return nil, nil
+}
+
+// ApplyToolDecisions applies decisions to the pending tool calls: edits
+// replace the arguments, and rejections and answers append a tool message
+// answering the call, so it is not run. ask_human calls can only be answered
+// or rejected. Calls without a decision stay pending and run as proposed.
+// Either every decision is applied or, on error, none is.
+func (s *UniversalState) ApplyToolDecisions(decisions []ToolDecision) error {
+	msg, pending := s.PendingToolCalls()
+	if len(pending) == 0 {
+		return fmt.Errorf("%w: no pending tool calls", ErrInvalidDecision)
+	}
+
+	index := make(map[string]int, len(pending))
+	for i, tc := range msg.ToolCalls {
+		index[tc.ID] = i
+	}
+	askHuman := func(id string) bool {
+		return msg.ToolCalls[index[id]].Function.Name == AskHumanToolName
+	}
+	isPending := make(map[string]bool, len(pending))
+	for _, tc := range pending {
+		isPending[tc.ID] = true
+	}
+
+	seen := make(map[string]bool, len(decisions))
+	for _, d := range decisions {
+		switch {
+		case !isPending[d.ToolCallID]:
+			return fmt.Errorf("%w: tool call %q is not pending", ErrInvalidDecision, d.ToolCallID)
+		case seen[d.ToolCallID]:
+			return fmt.Errorf("%w: more than one decision for tool call %q", ErrInvalidDecision, d.ToolCallID)
+		}
+		seen[d.ToolCallID] = true
+
+		switch d.Action {
+		case DecisionReject, DecisionAnswer:
+		case DecisionApprove, DecisionEdit:
+			if askHuman(d.ToolCallID) {
+				return fmt.Errorf("%w: tool call %q asks the human and can only be answered or rejected", ErrInvalidDecision, d.ToolCallID)
+			}
+			if d.Action == DecisionEdit && !json.Valid([]byte(d.Arguments)) {
+				return fmt.Errorf("%w: arguments for tool call %q are not valid JSON", ErrInvalidDecision, d.ToolCallID)
+			}
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrInvalidDecision, d.Action)
+		}
+	}
+
+	for _, d := range decisions {
+		tc := &msg.ToolCalls[index[d.ToolCallID]]
+		switch d.Action {
+		case DecisionEdit:
+			tc.Function.Arguments = d.Arguments
+		case DecisionReject:
+			s.MessageHistory = append(s.MessageHistory,
+				schema.ToolMessage(rejection(d.Reason), tc.ID, schema.WithToolName(tc.Function.Name)))
+		case DecisionAnswer:
+			s.MessageHistory = append(s.MessageHistory,
+				schema.ToolMessage(d.Answer, tc.ID, schema.WithToolName(tc.Function.Name)))
+		}
+	}
+	s.SavedAt = time.Now().UnixNano()
+	return nil
+}
+
+// rejection is the tool result the model sees for a rejected call
+func rejection(reason string) string {
+	if reason == "" {
+		return "The user rejected this tool call."
+	}
+	return "The user rejected this tool call: " + reason
+}
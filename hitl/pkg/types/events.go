@@ -0,0 +1,174 @@
+package types
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Phases of an ExecutionEvent
+const (
+	// PhaseRunning is a node that started and has not finished yet
+	PhaseRunning = "running"
+	// PhaseCompleted is a node that finished
+	PhaseCompleted = "completed"
+	// PhaseFailed is a node that returned an error
+	PhaseFailed = "failed"
+	// PhaseInterrupted is a node that was interrupted while running and
+	// started again on resume
+	PhaseInterrupted = "interrupted"
+)
+
+// ExecutionEvent records one run of a graph node. Events are appended to
+// UniversalState.NodeExecutionLog in the order the nodes start, so a node
+// running once per loop iteration has one event per iteration.
+type ExecutionEvent struct {
+	// Seq numbers the events of a state from 1; numbers are not reused when
+	// an event is deleted
+	Seq   int    `json:"seq"`
+	Node  string `json:"node"`
+	Phase string `json:"phase"`
+	// StartedAt and EndedAt are unix nanoseconds; EndedAt is 0 while running
+	StartedAt int64 `json:"started_at"`
+	EndedAt   int64 `json:"ended_at,omitempty"`
+	// Duration is in nanoseconds
+	Duration int64 `json:"duration_ns,omitempty"`
+	// Usage is the token usage reported by a chat model
+	Usage *schema.TokenUsage `json:"usage,omitempty"`
+	// Tools names the tools a chat model called or a tools node ran
+	Tools []string `json:"tools,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// StartEvent appends a running event for node and returns it. A previous run
+// of node still marked running was interrupted and is closed as such.
+func (s *UniversalState) StartEvent(node string) *ExecutionEvent {
+	now := time.Now().UnixNano()
+	if ev := s.RunningEvent(node); ev != nil {
+		ev.finish(PhaseInterrupted, now)
+	}
+
+	return s.AppendEvent(ExecutionEvent{Node: node, Phase: PhaseRunning, StartedAt: now})
+}
+
+// AppendEvent appends ev to the log, numbering it after the last event, and
+// returns the appended event
+func (s *UniversalState) AppendEvent(ev ExecutionEvent) *ExecutionEvent {
+	ev.Seq = 1
+	if last := s.LastEvent(); last != nil {
+		ev.Seq = last.Seq + 1
+	}
+	s.NodeExecutionLog = append(s.NodeExecutionLog, ev)
+	return &s.NodeExecutionLog[len(s.NodeExecutionLog)-1]
+}
+
+// RunningEvent returns the latest event of node if it is still running
+func (s *UniversalState) RunningEvent(node string) *ExecutionEvent {
+	for i := len(s.NodeExecutionLog) - 1; i >= 0; i-- {
+		ev := &s.NodeExecutionLog[i]
+		if ev.Node != node {
+			continue
+		}
+		if ev.Phase != PhaseRunning {
+			return nil
+		}
+		return ev
+	}
+	return nil
+}
+
+// EndEvent completes the running event of node, or fails it when err is not
+// nil, and returns it. It returns nil if node is not running.
+func (s *UniversalState) EndEvent(node string, err error) *ExecutionEvent {
+	ev := s.RunningEvent(node)
+	if ev == nil {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	if err != nil {
+		ev.Error = err.Error()
+		ev.finish(PhaseFailed, now)
+	} else {
+		ev.finish(PhaseCompleted, now)
+	}
+	return ev
+}
+
+// LastEvent returns the most recent event, nil when the log is empty
+func (s *UniversalState) LastEvent() *ExecutionEvent {
+	if len(s.NodeExecutionLog) == 0 {
+		return nil
+	}
+	return &s.NodeExecutionLog[len(s.NodeExecutionLog)-1]
+}
+
+func (e *ExecutionEvent) finish(phase string, now int64) {
+	e.Phase = phase
+	e.EndedAt = now
+	e.Duration = now - e.StartedAt
+}
+
+// EventsFromLegacyLog converts a node execution log written before it became
+// an event list, a map keyed "<node>" or "<node>_input"/"<node>_output" whose
+// entries carry a "time" in nanoseconds. Only the last run of each node
+// survived in that form, so there is at most one event per node.
+func EventsFromLegacyLog(log map[string]any) []ExecutionEvent {
+	byNode := make(map[string]*ExecutionEvent)
+	for key, entry := range log {
+		fields, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		t := legacyTime(fields["time"])
+
+		node, isOutput := strings.CutSuffix(key, "_output")
+		if !isOutput {
+			node = strings.TrimSuffix(key, "_input")
+		}
+		ev, ok := byNode[node]
+		if !ok {
+			ev = &ExecutionEvent{Node: node, Phase: PhaseCompleted, StartedAt: t, EndedAt: t}
+			byNode[node] = ev
+		}
+		if isOutput {
+			ev.EndedAt = t
+		} else {
+			ev.StartedAt = t
+		}
+	}
+
+	events := make([]ExecutionEvent, 0, len(byNode))
+	for _, ev := range byNode {
+		if ev.EndedAt < ev.StartedAt {
+			ev.EndedAt = ev.StartedAt
+		}
+		ev.Duration = ev.EndedAt - ev.StartedAt
+		events = append(events, *ev)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].StartedAt != events[j].StartedAt {
+			return events[i].StartedAt < events[j].StartedAt
+		}
+		return events[i].Node < events[j].Node
+	})
+	for i := range events {
+		events[i].Seq = i + 1
+	}
+	return events
+}
+
+// legacyTime reads a number from a legacy log entry, whichever numeric type
+// the decoder produced
+func legacyTime(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
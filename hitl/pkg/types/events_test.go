@@ -0,0 +1,50 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExecutionEvents(t *testing.T) {
+	s := NewUniversalState()
+
+	// A node's run is one event, from start to end
+	s.StartEvent("ChatModel")
+	if ev := s.RunningEvent("ChatModel"); ev == nil || ev.Seq != 1 || ev.Phase != PhaseRunning || ev.EndedAt != 0 {
+		t.Fatalf("running event = %+v", ev)
+	}
+	if ev := s.EndEvent("ChatModel", nil); ev == nil || ev.Phase != PhaseCompleted || ev.EndedAt < ev.StartedAt || ev.Duration != ev.EndedAt-ev.StartedAt {
+		t.Fatalf("ended event = %+v", ev)
+	}
+	if ev := s.RunningEvent("ChatModel"); ev != nil {
+		t.Fatalf("completed node still running: %+v", ev)
+	}
+	if ev := s.EndEvent("ChatModel", nil); ev != nil {
+		t.Fatalf("EndEvent of a node not running = %+v, want nil", ev)
+	}
+
+	// Starting a node that is still running closes its run as interrupted
+	s.StartEvent("ToolsNode")
+	s.StartEvent("ToolsNode")
+	if ev := s.NodeExecutionLog[1]; ev.Phase != PhaseInterrupted || ev.EndedAt == 0 {
+		t.Fatalf("restarted run = %+v, want interrupted", ev)
+	}
+	if ev := s.EndEvent("ToolsNode", errors.New("tool failed")); ev == nil || ev.Seq != 3 || ev.Phase != PhaseFailed || ev.Error != "tool failed" {
+		t.Fatalf("failed event = %+v", ev)
+	}
+
+	// Sequence numbers continue after deleted events
+	s.NodeExecutionLog = s.NodeExecutionLog[:1]
+	s.NodeExecutionLog = append(s.NodeExecutionLog, ExecutionEvent{Seq: 5, Node: "ChatModel", Phase: PhaseCompleted})
+	if ev := s.StartEvent("ChatModel"); ev.Seq != 6 {
+		t.Fatalf("seq after 5 = %d", ev.Seq)
+	}
+	var phases []string
+	for _, ev := range s.NodeExecutionLog {
+		phases = append(phases, ev.Phase)
+	}
+	if want := []string{PhaseCompleted, PhaseCompleted, PhaseRunning}; !reflect.DeepEqual(phases, want) {
+		t.Fatalf("phases = %v, want %v", phases, want)
+	}
+}
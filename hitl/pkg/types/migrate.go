@@ -0,0 +1,124 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CurrentSchemaVersion is the UniversalState schema version stamped on saved
+// states. Bump it together with registering the migration from the previous
+// version whenever a field is added, removed, renamed or changes type.
+const CurrentSchemaVersion = 1
+
+var (
+	// ErrNoMigration is returned when a state is stored at a version no
+	// registered migration upgrades
+	ErrNoMigration = errors.New("no state migration")
+	// ErrFutureSchema is returned for states written by a newer version
+	ErrFutureSchema = errors.New("state schema is newer than supported")
+)
+
+// StateDocument is a persisted UniversalState being migrated, in whichever
+// form it was stored. Fields are addressed by their Go name in the version
+// being migrated from, and may no longer exist in UniversalState.
+type StateDocument interface {
+	// Field decodes the field into v, reporting whether it is present
+	Field(name string, v any) (bool, error)
+	// SetField replaces the field with v, which must be serializable
+	SetField(name string, v any) error
+	// DeleteField removes the field
+	DeleteField(name string)
+}
+
+// Migration upgrades a persisted state from version From to From+1
+type Migration struct {
+	From        int
+	Description string
+	Migrate     func(doc StateDocument) error
+}
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = map[int]Migration{}
+)
+
+func init() {
+	RegisterMigration(Migration{
+		From:        0,
+		Description: "node execution log map to ordered execution events",
+		Migrate:     migrateEventLog,
+	})
+}
+
+// RegisterMigration registers the migration from m.From to m.From+1,
+// replacing any registered before
+func RegisterMigration(m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	migrations[m.From] = m
+}
+
+// Migrations returns the registered migrations ordered by version
+func Migrations() []Migration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	list := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].From < list[j].From })
+	return list
+}
+
+// MigrateState upgrades doc from the schema version it was saved with to
+// CurrentSchemaVersion and stamps the new version, returning the version it
+// started from. States saved before versioning are version 0.
+func MigrateState(doc StateDocument) (int, error) {
+	var version int
+	if _, err := doc.Field("SchemaVersion", &version); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	if version > CurrentSchemaVersion {
+		return version, fmt.Errorf("%w: version %d, supported %d", ErrFutureSchema, version, CurrentSchemaVersion)
+	}
+
+	for v := version; v < CurrentSchemaVersion; v++ {
+		migrationsMu.RLock()
+		m, ok := migrations[v]
+		migrationsMu.RUnlock()
+		if !ok {
+			return version, fmt.Errorf("%w from version %d", ErrNoMigration, v)
+		}
+		if err := m.Migrate(doc); err != nil {
+			return version, fmt.Errorf("migrate state from version %d (%s): %w", v, m.Description, err)
+		}
+	}
+
+	if version != CurrentSchemaVersion {
+		if err := doc.SetField("SchemaVersion", CurrentSchemaVersion); err != nil {
+			return version, fmt.Errorf("stamp schema version: %w", err)
+		}
+	}
+	return version, nil
+}
+
+// migrateEventLog converts the node execution log from the map it was before
+// version 1 to events. States saved unversioned but already holding events
+// are left alone.
+func migrateEventLog(doc StateDocument) error {
+	var legacy map[string]any
+	ok, err := doc.Field("NodeExecutionLog", &legacy)
+	if err != nil {
+		var events []ExecutionEvent
+		if ok, err := doc.Field("NodeExecutionLog", &events); ok && err == nil {
+			return nil
+		}
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return doc.SetField("NodeExecutionLog", EventsFromLegacyLog(legacy))
+}
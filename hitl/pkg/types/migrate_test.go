@@ -0,0 +1,199 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testDocument is a state saved as a JSON object, keyed by Go field name
+type testDocument map[string]json.RawMessage
+
+func (d testDocument) Field(name string, v any) (bool, error) {
+	raw, ok := d[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (d testDocument) SetField(name string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	d[name] = raw
+	return nil
+}
+
+func (d testDocument) DeleteField(name string) {
+	delete(d, name)
+}
+
+func parseDocument(t *testing.T, s string) testDocument {
+	t.Helper()
+	var d testDocument
+	if err := json.Unmarshal([]byte(s), &d); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// withMigrations replaces the registered migrations for the test
+func withMigrations(t *testing.T, list ...Migration) {
+	migrationsMu.Lock()
+	saved := migrations
+	migrations = map[int]Migration{}
+	migrationsMu.Unlock()
+	for _, m := range list {
+		RegisterMigration(m)
+	}
+	t.Cleanup(func() {
+		migrationsMu.Lock()
+		migrations = saved
+		migrationsMu.Unlock()
+	})
+}
+
+func TestMigrateEventLog(t *testing.T) {
+	events := []ExecutionEvent{
+		{Seq: 1, Node: "ChatTemplate", Phase: PhaseCompleted, StartedAt: 100, EndedAt: 150, Duration: 50},
+		{Seq: 2, Node: "ChatModel", Phase: PhaseCompleted, StartedAt: 200, EndedAt: 200},
+	}
+	eventsJSON, _ := json.Marshal(events)
+
+	tests := []struct {
+		name string
+		doc  string
+		// want is the log after migrating, nil when there is none
+		want []ExecutionEvent
+	}{
+		{
+			name: "map log",
+			doc:  `{"NodeExecutionLog": {"ChatModel": {"time": 200}, "ChatTemplate_output": {"time": 150}, "ChatTemplate_input": {"time": 100}}}`,
+			want: events,
+		},
+		{
+			// An output logged before its input cannot end before it started
+			name: "output before input",
+			doc:  `{"NodeExecutionLog": {"ChatModel_output": {"time": 100}, "ChatModel_input": {"time": 300}}}`,
+			want: []ExecutionEvent{{Seq: 1, Node: "ChatModel", Phase: PhaseCompleted, StartedAt: 300, EndedAt: 300}},
+		},
+		{
+			name: "entries without a time",
+			doc:  `{"NodeExecutionLog": {"ChatModel": {"output": "hi"}, "broken": "entry"}}`,
+			want: []ExecutionEvent{{Seq: 1, Node: "ChatModel", Phase: PhaseCompleted}},
+		},
+		{
+			name: "empty map",
+			doc:  `{"NodeExecutionLog": {}}`,
+			want: []ExecutionEvent{},
+		},
+		{
+			// Saved unversioned after the log became events
+			name: "already events",
+			doc:  `{"NodeExecutionLog": ` + string(eventsJSON) + `}`,
+			want: events,
+		},
+		{
+			name: "no log",
+			doc:  `{"Context": {}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseDocument(t, tt.doc)
+			if err := migrateEventLog(doc); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []ExecutionEvent
+			ok, err := doc.Field("NodeExecutionLog", &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("log added: %+v", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("log = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if err := migrateEventLog(parseDocument(t, `{"NodeExecutionLog": "ChatModel"}`)); err == nil {
+		t.Fatal("log of an unknown form accepted")
+	}
+}
+
+func TestMigrateState(t *testing.T) {
+	future := CurrentSchemaVersion + 1
+
+	tests := []struct {
+		name string
+		doc  string
+		from int
+		err  error
+	}{
+		{"unversioned", `{"NodeExecutionLog": {"ChatModel": {"time": 1}}}`, 0, nil},
+		{"version 0", `{"SchemaVersion": 0}`, 0, nil},
+		{"current", fmt.Sprintf(`{"SchemaVersion": %d}`, CurrentSchemaVersion), CurrentSchemaVersion, nil},
+		{"future", fmt.Sprintf(`{"SchemaVersion": %d}`, future), future, ErrFutureSchema},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseDocument(t, tt.doc)
+			from, err := MigrateState(doc)
+			if from != tt.from || !errors.Is(err, tt.err) {
+				t.Fatalf("MigrateState = %d, %v; want %d, %v", from, err, tt.from, tt.err)
+			}
+
+			var version int
+			doc.Field("SchemaVersion", &version)
+			want := CurrentSchemaVersion
+			if tt.err != nil {
+				want = from
+			}
+			if version != want {
+				t.Fatalf("schema version %d, want %d", version, want)
+			}
+		})
+	}
+
+	if _, err := MigrateState(parseDocument(t, `{"SchemaVersion": "one"}`)); err == nil {
+		t.Fatal("version of the wrong type accepted")
+	}
+}
+
+func TestMigrationRegistry(t *testing.T) {
+	// Every version before the current one has a migration
+	list := Migrations()
+	if len(list) != CurrentSchemaVersion {
+		t.Fatalf("%d migrations registered, want %d", len(list), CurrentSchemaVersion)
+	}
+	for i, m := range list {
+		if m.From != i || m.Migrate == nil || m.Description == "" {
+			t.Fatalf("migration %d = %+v", i, m)
+		}
+	}
+
+	withMigrations(t)
+	doc := parseDocument(t, `{}`)
+	if _, err := MigrateState(doc); !errors.Is(err, ErrNoMigration) {
+		t.Fatalf("MigrateState without migrations = %v, want ErrNoMigration", err)
+	}
+	if _, ok := doc["SchemaVersion"]; ok {
+		t.Fatal("version stamped on a state that was not migrated")
+	}
+
+	failed := errors.New("failed")
+	withMigrations(t, Migration{From: 0, Description: "fails", Migrate: func(StateDocument) error { return failed }})
+	if _, err := MigrateState(parseDocument(t, `{}`)); !errors.Is(err, failed) {
+		t.Fatalf("MigrateState = %v, want the migration's error", err)
+	}
+}
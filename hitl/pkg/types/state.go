@@ -1,6 +1,8 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/cloudwego/eino/compose"
@@ -10,22 +12,101 @@ import (
 func init() {
 	// Register UniversalState for serialization with compose framework
 	_ = compose.RegisterSerializableType[*UniversalState]("universal_state")
+	_ = compose.RegisterSerializableType[ExecutionEvent]("execution_event")
 }
 
 // UniversalState is the universal state structure that can save all context information
 type UniversalState struct {
 	MessageHistory   []*schema.Message `json:"message_history"`
 	Context          map[string]any    `json:"context"`
-	NodeExecutionLog map[string]any    `json:"node_execution_log"`
+	NodeExecutionLog []ExecutionEvent  `json:"node_execution_log"`
 	SavedAt          int64             `json:"saved_at"`
+	// SchemaVersion is the version of this structure the state was saved
+	// with; see MigrateState
+	SchemaVersion int `json:"schema_version"`
+}
+
+// State is implemented by the state types graphs run with. Custom state types
+// embed UniversalState, which provides it, next to their own fields, and are
+// registered with checkpoint.RegisterSerializableType:
+//
+//	type BookingState struct {
+//		types.UniversalState
+//		Booking *Booking
+//	}
+type State interface {
+	Universal() *UniversalState
 }
 
 // NewUniversalState creates a new universal state
 func NewUniversalState() *UniversalState {
-	return &UniversalState{
-		MessageHistory:   make([]*schema.Message, 0),
-		Context:          make(map[string]any),
-		NodeExecutionLog: make(map[string]any),
-		SavedAt:          time.Now().UnixNano(),
+	return (&UniversalState{}).Init()
+}
+
+// Init prepares a zero state the way NewUniversalState does, keeping fields
+// that are already set. Use it for a UniversalState embedded in a custom state.
+func (s *UniversalState) Init() *UniversalState {
+	if s.MessageHistory == nil {
+		s.MessageHistory = make([]*schema.Message, 0)
+	}
+	if s.Context == nil {
+		s.Context = make(map[string]any)
+	}
+	if s.NodeExecutionLog == nil {
+		s.NodeExecutionLog = make([]ExecutionEvent, 0)
+	}
+	if s.SavedAt == 0 {
+		s.SavedAt = time.Now().UnixNano()
+	}
+	if s.SchemaVersion == 0 {
+		s.SchemaVersion = CurrentSchemaVersion
+	}
+	return s
+}
+
+// Universal returns s; custom states embedding UniversalState inherit it
+func (s *UniversalState) Universal() *UniversalState {
+	return s
+}
+
+// Clone returns a deep copy of the state, made through its JSON encoding the
+// way a pending state is saved and loaded
+func (s *UniversalState) Clone() (*UniversalState, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("clone state: %w", err)
+	}
+	var c UniversalState
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("clone state: %w", err)
+	}
+	return &c, nil
+}
+
+// FindToolCall returns the tool call with the given ID, searching from the
+// most recent message
+func (s *UniversalState) FindToolCall(id string) *schema.ToolCall {
+	for i := len(s.MessageHistory) - 1; i >= 0; i-- {
+		msg := s.MessageHistory[i]
+		if msg == nil {
+			continue
+		}
+		for j := range msg.ToolCalls {
+			if msg.ToolCalls[j].ID == id {
+				return &msg.ToolCalls[j]
+			}
+		}
+	}
+	return nil
+}
+
+// LastToolCall returns the most recent tool call in the message history
+func (s *UniversalState) LastToolCall() *schema.ToolCall {
+	for i := len(s.MessageHistory) - 1; i >= 0; i-- {
+		msg := s.MessageHistory[i]
+		if msg != nil && len(msg.ToolCalls) > 0 {
+			return &msg.ToolCalls[len(msg.ToolCalls)-1]
+		}
 	}
+	return nil
 }
@@ -0,0 +1,38 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestCloneState(t *testing.T) {
+	s := NewUniversalState()
+	s.MessageHistory = []*schema.Message{
+		schema.UserMessage("Book a ticket"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+			{ID: "c1", Function: schema.FunctionCall{Name: "BookTicket", Arguments: `{"location":"Paris"}`}},
+		}},
+	}
+	s.Context["name"] = "Ada"
+	s.AppendEvent(ExecutionEvent{Node: "ChatModel", Phase: PhaseCompleted})
+
+	c, err := s.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, s) {
+		t.Fatalf("clone = %+v, want %+v", c, s)
+	}
+
+	// Changing the clone leaves the state as it was
+	edit := []ToolDecision{{ToolCallID: "c1", Action: DecisionEdit, Arguments: `{"location":"Rome"}`}}
+	if err := c.ApplyToolDecisions(edit); err != nil {
+		t.Fatal(err)
+	}
+	c.Context["name"] = "Grace"
+	if tc := s.FindToolCall("c1"); tc.Function.Arguments != `{"location":"Paris"}` || s.Context["name"] != "Ada" {
+		t.Fatalf("state changed with its clone: %+v, %v", tc, s.Context)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"eino_testing/hitl/pkg/auth"
+	"eino_testing/hitl/pkg/interaction"
+	"eino_testing/hitl/pkg/types"
+)
+
+// approverPrincipal is the actor of the configured approver's decisions in
+// the audit log
+var approverPrincipal = &auth.Principal{Subject: "approver"}
+
+// autoDecide asks the configured approver to decide the pending tool calls of
+// an interrupted execution, within the approval timeout. Decisions are written
+// like those of HandleConfirm; when every call is decided the execution
+// resumes, otherwise the remaining calls wait for a human. ctx is cancelled
+// when the server shuts down.
+func (s *Server) autoDecide(ctx context.Context, exec *Execution) {
+	// The decisions apply to the checkpoint as the approver saw it, and fail
+	// if a human or a resumed run has written it since
+	revision, err := s.store.Revision(ctx, exec.CheckpointID)
+	if err != nil {
+		log.Printf("[Execution %s] Failed to read checkpoint revision, waiting for a human: %v", exec.ID, err)
+		return
+	}
+	// Decisions replace the state of the execution, so the snapshot's is the
+	// state as interrupted throughout
+	exec, ok := s.execManager.Snapshot(exec.ID)
+	if !ok || exec.State == nil {
+		return
+	}
+	req := interaction.NewRequest(exec.CheckpointID, exec.State)
+	if len(req.ToolCalls) == 0 {
+		return
+	}
+
+	decideCtx := ctx
+	if s.approvalTimeout > 0 {
+		var cancel context.CancelFunc
+		decideCtx, cancel = context.WithTimeout(ctx, s.approvalTimeout)
+		defer cancel()
+	}
+	decisions, err := s.approver.Decide(decideCtx, req)
+	if err != nil {
+		log.Printf("[Execution %s] Approver failed, waiting for a human: %v", exec.ID, err)
+		return
+	}
+
+	if len(decisions) > 0 {
+		err := s.execManager.Decide(exec.ID, func(exec *Execution) error {
+			if err := s.applyDecisions(ctx, exec, decisions, revision); err != nil {
+				return err
+			}
+			if err := savePendingState(ctx, s.store, exec.CheckpointID, exec.State); err != nil {
+				err = fmt.Errorf("save pending state: %w", err)
+				s.auditDecisions(exec, req.ToolCalls, decisions, false, approverPrincipal, "", err)
+				return err
+			}
+			s.auditDecisions(exec, req.ToolCalls, decisions, false, approverPrincipal, "", nil)
+			return nil
+		})
+		if err != nil {
+			// A human may have decided, resumed or cancelled it meanwhile, or
+			// the state could not be saved
+			log.Printf("[Execution %s] Failed to apply approver decisions: %v", exec.ID, err)
+			return
+		}
+	}
+
+	undecided := interaction.Undecided(req, decisions)
+	log.Printf("[Execution %s] Approver decided %d of %d tool calls", exec.ID, len(req.ToolCalls)-len(undecided), len(req.ToolCalls))
+	if len(undecided) > 0 {
+		if len(decisions) > 0 {
+			s.execManager.BroadcastStateChange(s.hub, exec.ID)
+		}
+		return
+	}
+
+	// The run has its own timeout, and shutdown drains it
+	if err := s.execManager.Resume(context.WithoutCancel(ctx), exec.ID, s.hub, s.baseDir); err != nil {
+		log.Printf("[Execution %s] Failed to resume, waiting for a human: %v", exec.ID, err)
+		s.execManager.BroadcastStateChange(s.hub, exec.ID)
+	}
+}
+
+// applyDecisions writes decisions to the checkpoint of exec, then to its
+// state; run within ExecutionManager.Decide. The checkpoint is updated first
+// so a conflict leaves the execution untouched.
+func (s *Server) applyDecisions(ctx context.Context, exec *Execution, decisions []types.ToolDecision, revision int) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+	if exec.State == nil {
+		return errors.New("execution has no state")
+	}
+	if err := applyToolDecisions(ctx, s.store, exec.CheckpointID, decisions, revision); err != nil {
+		return err
+	}
+	if err := exec.State.ApplyToolDecisions(decisions); err != nil {
+		return fmt.Errorf("update tool calls: %w", err)
+	}
+	return nil
+}
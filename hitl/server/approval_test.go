@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"eino_testing/hitl/pkg/interaction"
+	"eino_testing/hitl/pkg/types"
+)
+
+// testApprover approves every call it is asked about, once released
+type testApprover struct {
+	asked   chan string
+	release chan struct{}
+}
+
+func newTestApprover() *testApprover {
+	return &testApprover{asked: make(chan string, 1), release: make(chan struct{})}
+}
+
+func (a *testApprover) Decide(ctx context.Context, req *interaction.Request) ([]types.ToolDecision, error) {
+	a.asked <- req.CheckpointID
+	select {
+	case <-a.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var decisions []types.ToolDecision
+	for _, tc := range req.ToolCalls {
+		decisions = append(decisions, types.ToolDecision{ToolCallID: tc.ID, Action: types.DecisionApprove})
+	}
+	return decisions, nil
+}
+
+func TestAutoDecide(t *testing.T) {
+	wf, bookTicket := testWorkflow("test", bookParis())
+	approver := newTestApprover()
+	cfg := testConfig(t, t.TempDir(), wf)
+	cfg.Approver = approver
+	ts := startTestServer(t, cfg)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	<-approver.asked
+	close(approver.release)
+	waitStatus(t, ts.execManager, exec.ID, "completed")
+
+	if ran := bookTicket.ranWith(); len(ran) != 1 {
+		t.Fatalf("BookTicket ran with %v, want once", ran)
+	}
+	entries, err := ts.audit.Read(AuditFilter{ExecutionID: exec.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "approver" || entries[0].Action != types.DecisionApprove || entries[0].Error != "" {
+		t.Fatalf("audit entries %+v, want the approver's approval", entries)
+	}
+}
+
+func TestAutoDecideAfterHuman(t *testing.T) {
+	wf, bookTicket := testWorkflow("test", bookParis())
+	approver := newTestApprover()
+	cfg := testConfig(t, t.TempDir(), wf)
+	cfg.Approver = approver
+	ts := startTestServer(t, cfg)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	<-approver.asked
+
+	// A human confirms and resumes while the approver decides
+	if code := ts.do(t, "POST", "/api/confirm", ConfirmRequest{ExecutionID: exec.ID, Action: "confirm"}, nil); code != http.StatusOK {
+		t.Fatalf("confirm: %d", code)
+	}
+	if code := ts.do(t, "POST", "/api/execute/"+exec.ID+"/resume", nil, nil); code != http.StatusOK {
+		t.Fatalf("resume: %d", code)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "completed")
+
+	// The approver's late decisions are dropped, and it resumes nothing
+	close(approver.release)
+	ts.stop(t)
+	if ran := bookTicket.ranWith(); len(ran) != 1 {
+		t.Fatalf("BookTicket ran with %v, want once", ran)
+	}
+	entries, err := ts.audit.Read(AuditFilter{ExecutionID: exec.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor == "approver" {
+		t.Fatalf("audit entries %+v, want the human's confirmation only", entries)
+	}
+}
+
+func TestAutoDecideAuditsSaveFailures(t *testing.T) {
+	wf, bookTicket := testWorkflow("test", bookParis())
+	approver := newTestApprover()
+	dir := t.TempDir()
+	cfg := testConfig(t, dir, wf)
+	cfg.Approver = approver
+	ts := startTestServer(t, cfg)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	<-approver.asked
+	blockPendingState(t, dir, exec.CheckpointID)
+	revision, err := ts.store.Revision(context.Background(), exec.CheckpointID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The decisions reach the checkpoint, but not the pending state: the
+	// execution waits for a human, and the failure is audited
+	close(approver.release)
+	waitFor(t, "the approver's decisions", func() bool {
+		rev, err := ts.store.Revision(context.Background(), exec.CheckpointID)
+		return err == nil && rev > revision
+	})
+	ts.stop(t)
+	if status := statusOf(ts.execManager, exec.ID); status != "interrupted" {
+		t.Fatalf("execution %s, want interrupted", status)
+	}
+	if ran := bookTicket.ranWith(); len(ran) != 0 {
+		t.Fatalf("BookTicket ran with %v", ran)
+	}
+	entries, err := ts.audit.Read(AuditFilter{ExecutionID: exec.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "approver" || entries[0].Error == "" {
+		t.Fatalf("audit entries %+v, want the approval with the save error", entries)
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"eino_testing/hitl/pkg/auth"
+	"eino_testing/hitl/pkg/types"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditEntry records a decision on a tool call: who made it, on which call,
+// and with which arguments
+type AuditEntry struct {
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor"`
+	// Role is empty for decisions of the configured approver
+	Role         auth.Role            `json:"role,omitempty"`
+	RemoteAddr   string               `json:"remote_addr,omitempty"`
+	ExecutionID  string               `json:"execution_id"`
+	CheckpointID string               `json:"checkpoint_id"`
+	ToolCallID   string               `json:"tool_call_id"`
+	ToolName     string               `json:"tool_name"`
+	Action       types.DecisionAction `json:"action"`
+	// Arguments are the arguments the model proposed, EditedArguments those an
+	// edit replaced them with
+	Arguments       string `json:"arguments"`
+	EditedArguments string `json:"edited_arguments,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	Answer          string `json:"answer,omitempty"`
+	// Error is set when the decision was written to the checkpoint but the
+	// pending state could not be saved
+	Error string `json:"error,omitempty"`
+}
+
+// AuditFilter selects audit entries; empty fields match every entry
+type AuditFilter struct {
+	ExecutionID string
+	Actor       string
+	// Limit keeps the last Limit matching entries when positive
+	Limit int
+}
+
+// AuditLog is an append-only log of tool call decisions, one JSON entry per
+// line. Entries are synced to disk before Append returns; nothing rewrites
+// or removes them.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenAuditLog opens the audit log in path, creating it if needed
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &AuditLog{path: path, file: f}, nil
+}
+
+// Append writes entries to the end of the log
+func (l *AuditLog) Append(entries ...AuditEntry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("encode audit entry: %w", err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errors.New("audit log is closed")
+	}
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// Read returns the entries matching filter, oldest first
+func (l *AuditLog) Read(filter AuditFilter) ([]AuditEntry, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		if filter.ExecutionID != "" && e.ExecutionID != filter.ExecutionID ||
+			filter.Actor != "" && e.Actor != filter.Actor {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+// Close closes the log; later appends fail
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// auditDecisions records the decisions of actor on the pending tool calls of
+// an execution, once saved; saveErr is the error saving the pending state.
+// With approveRest, pending calls without a decision are recorded as
+// approved, since they run as proposed.
+func (s *Server) auditDecisions(exec *Execution, pending []schema.ToolCall, decisions []types.ToolDecision, approveRest bool, actor *auth.Principal, remoteAddr string, saveErr error) {
+	if s.audit == nil {
+		return
+	}
+
+	byID := make(map[string]types.ToolDecision, len(decisions))
+	for _, d := range decisions {
+		byID[d.ToolCallID] = d
+	}
+
+	now := time.Now()
+	var entries []AuditEntry
+	for _, tc := range pending {
+		d, ok := byID[tc.ID]
+		if !ok {
+			if !approveRest {
+				continue
+			}
+			d = types.ToolDecision{ToolCallID: tc.ID, Action: types.DecisionApprove}
+		}
+		entry := AuditEntry{
+			Time:         now,
+			Actor:        actor.Subject,
+			Role:         actor.Role,
+			RemoteAddr:   remoteAddr,
+			ExecutionID:  exec.ID,
+			CheckpointID: exec.CheckpointID,
+			ToolCallID:   tc.ID,
+			ToolName:     tc.Function.Name,
+			Action:       d.Action,
+			Arguments:    tc.Function.Arguments,
+			Reason:       d.Reason,
+			Answer:       d.Answer,
+		}
+		if d.Action == types.DecisionEdit {
+			entry.EditedArguments = d.Arguments
+		}
+		if saveErr != nil {
+			entry.Error = saveErr.Error()
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	if err := s.audit.Append(entries...); err != nil {
+		log.Printf("[Execution %s] Failed to audit %d decisions of %s: %v", exec.ID, len(entries), actor.Subject, err)
+	}
+}
+
+// HandleListAudit lists the audit log entries, filtered by the execution_id
+// and actor query parameters and limited to the last limit (100 by default)
+func (s *Server) HandleListAudit(c *gin.Context) {
+	if s.audit == nil {
+		c.JSON(http.StatusOK, []AuditEntry{})
+		return
+	}
+
+	filter := AuditFilter{
+		ExecutionID: c.Query("execution_id"),
+		Actor:       c.Query("actor"),
+		Limit:       100,
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, APIError{Error: "Invalid limit", Details: v})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := s.audit.Read(filter)
+	if err != nil {
+		log.Printf("[Handler] Failed to read audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to read audit log",
+			Details: err.Error(),
+		})
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	c.JSON(http.StatusOK, entries)
+}
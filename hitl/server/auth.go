@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"eino_testing/hitl/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	principalKey = "principal"
+	// queryTokenKey holds the access_token query parameter of a request
+	queryTokenKey = "access_token"
+)
+
+// anonymous is the principal of every request when authentication is disabled
+var anonymous = &auth.Principal{Subject: "anonymous", Role: auth.RoleAdmin}
+
+// takeQueryToken moves the access_token query parameter, with which browsers
+// authenticate WebSockets, out of the URL before the request is logged
+func takeQueryToken(c *gin.Context) {
+	q := c.Request.URL.Query()
+	if token := q.Get(queryTokenKey); token != "" {
+		c.Set(queryTokenKey, token)
+		q.Del(queryTokenKey)
+		c.Request.URL.RawQuery = q.Encode()
+	}
+	c.Next()
+}
+
+// credentials returns the API key or token of a request: a bearer token, an
+// X-API-Key header or, for WebSockets, the access_token query parameter
+func credentials(c *gin.Context) string {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		return c.GetString(queryTokenKey)
+	}
+	return ""
+}
+
+// authenticate resolves the principal of a request, answering 401 when its
+// credentials are missing or invalid
+func (s *Server) authenticate(c *gin.Context) {
+	if s.authenticator == nil {
+		c.Set(principalKey, anonymous)
+		c.Next()
+		return
+	}
+
+	p, err := s.authenticator.Authenticate(c.Request.Context(), credentials(c))
+	if err != nil {
+		msg := "Authentication required"
+		if !errors.Is(err, auth.ErrNoCredentials) {
+			msg = "Invalid credentials"
+			log.Printf("[Auth] Rejected %s %s from %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="hitl"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, APIError{
+			Error:   msg,
+			Code:    "unauthenticated",
+			Details: err.Error(),
+		})
+		return
+	}
+	c.Set(principalKey, p)
+	c.Next()
+}
+
+// requireRole answers 403 to principals whose role does not allow role
+func requireRole(role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p := principalOf(c); !p.Role.Allows(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, APIError{
+				Error: fmt.Sprintf("This requires the %s role, %s has %q", role, p.Subject, p.Role),
+				Code:  "forbidden",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// principalOf returns the principal authenticate resolved for a request, one
+// without a role when there is none
+func principalOf(c *gin.Context) *auth.Principal {
+	v, _ := c.Get(principalKey)
+	if p, ok := v.(*auth.Principal); ok {
+		return p
+	}
+	return &auth.Principal{}
+}
+
+// checkOrigin accepts WebSockets from the server's own origin, from the
+// allowed origins, and from clients sending no Origin
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if slices.Contains(s.allowedOrigins, "*") || slices.Contains(s.allowedOrigins, origin) {
+		return true
+	}
+	log.Printf("[WS] Rejected origin %s", origin)
+	return false
+}
+
+// HandleMe returns the principal of the request and whether authentication
+// is enabled
+func (s *Server) HandleMe(c *gin.Context) {
+	p := principalOf(c)
+	c.JSON(http.StatusOK, MeResponse{
+		Subject:     p.Subject,
+		Role:        p.Role,
+		AuthEnabled: s.authenticator != nil,
+	})
+}
@@ -0,0 +1,463 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eino_testing/hitl/pkg/checkpoint"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleListRevisions lists the revision history of a checkpoint
+func (s *Server) HandleListRevisions(c *gin.Context) {
+	revs, err := s.store.ListRevisions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("[Handler] Failed to list revisions: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to list revisions",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, revs)
+}
+
+// HandleGetRevision returns the raw checkpoint saved as a revision
+func (s *Server) HandleGetRevision(c *gin.Context) {
+	rev, ok := parseRevision(c)
+	if !ok {
+		return
+	}
+
+	data, err := s.store.GetRevision(c.Request.Context(), c.Param("id"), rev)
+	if err != nil {
+		writeRevisionError(c, "Failed to load revision", err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// HandleForkRevision forks a revision into a new checkpoint and registers an
+// interrupted execution for it, so it can be replayed with /execute/:id/resume
+func (s *Server) HandleForkRevision(c *gin.Context) {
+	rev, ok := parseRevision(c)
+	if !ok {
+		return
+	}
+
+	var req ForkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, APIError{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+	if req.NewID == "" {
+		req.NewID = fmt.Sprintf("exec-%d", time.Now().UnixNano())
+	}
+
+	id := c.Param("id")
+	forked, err := s.store.Fork(c.Request.Context(), id, rev, req.NewID)
+	if err != nil {
+		writeRevisionError(c, "Failed to fork revision", err)
+		return
+	}
+
+	// The fork runs the workflow of the execution it was forked from
+	var workflowID string
+	if source, ok := s.execManager.FindByCheckpoint(id); ok {
+		workflowID = source.WorkflowID
+	}
+	runner, err := s.newRunner(c.Request.Context(), workflowID)
+	if err != nil {
+		log.Printf("[Handler] Failed to compose graph: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to create execution",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	exec, err := s.execManager.CreateExecution(c.Request.Context(), runner, workflowID, req.NewID, "", map[string]any{}, s.stream)
+	if err != nil {
+		writeSessionBusy(c, err)
+		return
+	}
+	s.execManager.UpdateExecutionState(exec.ID, "interrupted", forked.Node, nil)
+
+	c.JSON(http.StatusCreated, ForkResponse{
+		CheckpointID: req.NewID,
+		Revision:     forked,
+		Execution:    exec,
+	})
+}
+
+// HandleRollbackRevision makes an earlier revision the current checkpoint
+func (s *Server) HandleRollbackRevision(c *gin.Context) {
+	rev, ok := parseRevision(c)
+	if !ok {
+		return
+	}
+
+	restored, err := s.store.Rollback(c.Request.Context(), c.Param("id"), rev)
+	if err != nil {
+		writeRevisionError(c, "Failed to roll back checkpoint", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
+
+// parseRevision reads the :rev path parameter, writing a 400 on failure
+func parseRevision(c *gin.Context) (int, bool) {
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev <= 0 {
+		c.JSON(http.StatusBadRequest, APIError{Error: "Invalid revision number"})
+		return 0, false
+	}
+	return rev, true
+}
+
+// writeRevisionError maps revision errors to HTTP responses
+func writeRevisionError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, checkpoint.ErrRevisionNotFound):
+		c.JSON(http.StatusNotFound, APIError{Error: msg, Details: err.Error()})
+		return
+	case errors.Is(err, checkpoint.ErrConflict), errors.Is(err, checkpoint.ErrCheckpointExists):
+		c.JSON(http.StatusConflict, APIError{Error: msg, Code: "conflict", Details: err.Error()})
+		return
+	}
+	log.Printf("[Handler] %s: %v", msg, err)
+	c.JSON(http.StatusInternalServerError, APIError{Error: msg, Details: err.Error()})
+}
+
+// HandleDiffCheckpoint compares the current state of a checkpoint with
+// ?against= (a revision number, "pending", another checkpoint ID or <id>@<rev>),
+// defaulting to the previous revision
+func (s *Server) HandleDiffCheckpoint(c *gin.Context) {
+	diff, err := s.store.Diff(c.Request.Context(), c.Param("id"), c.Query("against"))
+	if err != nil {
+		switch {
+		case errors.Is(err, checkpoint.ErrCheckpointNotFound), errors.Is(err, checkpoint.ErrPendingStateNotFound):
+			c.JSON(http.StatusNotFound, APIError{Error: "Failed to diff checkpoint", Details: err.Error()})
+		default:
+			writeRevisionError(c, "Failed to diff checkpoint", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// HandleExportCheckpoint downloads a checkpoint bundle including its overlay
+// and the metadata of the execution using it
+func (s *Server) HandleExportCheckpoint(c *gin.Context) {
+	id := c.Param("id")
+
+	var execution any
+	var workflowID string
+	if exec, ok := s.execManager.FindByCheckpoint(id); ok {
+		execution = exec
+		workflowID = exec.WorkflowID
+	}
+	wf, ok := s.workflow(workflowID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIError{Error: fmt.Sprintf("Workflow %s of the checkpoint not found", workflowID)})
+		return
+	}
+
+	bundle, err := s.store.Export(c.Request.Context(), id, wf.Graph, execution)
+	if err != nil {
+		if errors.Is(err, checkpoint.ErrCheckpointNotFound) {
+			c.JSON(http.StatusNotFound, APIError{Error: "Checkpoint not found"})
+			return
+		}
+		log.Printf("[Handler] Failed to export checkpoint: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to export checkpoint",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	data, err := bundle.Bytes()
+	if err != nil {
+		log.Printf("[Handler] Failed to write bundle: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to export checkpoint",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".hitl.tar.gz"))
+	c.Data(http.StatusOK, "application/gzip", data)
+}
+
+// HandleImportCheckpoint imports a bundle from the request body and registers
+// an interrupted execution for it. ?id= stores it under a different ID and
+// ?overwrite=true replaces an existing checkpoint.
+func (s *Server) HandleImportCheckpoint(c *gin.Context) {
+	if id := c.Query("id"); id != "" {
+		if err := checkpoint.ValidateID(id); err != nil {
+			c.JSON(http.StatusBadRequest, APIError{
+				Error:   "Invalid checkpoint ID",
+				Details: err.Error(),
+			})
+			return
+		}
+	}
+
+	bundle, err := checkpoint.ReadBundle(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIError{
+			Error:   "Invalid bundle",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	overwrite, _ := strconv.ParseBool(c.Query("overwrite"))
+	ctx := c.Request.Context()
+
+	// Restore what the exporting server knew about the execution
+	var exported Execution
+	if bundle.Execution != nil {
+		if err := json.Unmarshal(bundle.Execution, &exported); err != nil {
+			log.Printf("[Handler] Ignoring unreadable execution metadata in bundle: %v", err)
+		}
+	}
+	if exported.Input == nil {
+		exported.Input = map[string]any{}
+	}
+
+	// The bundle is resumed by the workflow it was exported from
+	wf, ok := s.workflow(exported.WorkflowID)
+	if byGraph, found := s.workflows.ByGraph(bundle.Manifest.Graph.Name); exported.WorkflowID == "" && found {
+		wf, ok = byGraph, true
+	}
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, APIError{
+			Error:   "Failed to import checkpoint",
+			Details: fmt.Sprintf("%v: unknown workflow %s", checkpoint.ErrGraphMismatch, exported.WorkflowID),
+		})
+		return
+	}
+
+	id, err := s.store.Import(ctx, bundle, wf.Graph, c.Query("id"), overwrite)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, checkpoint.ErrInvalidID):
+			status = http.StatusBadRequest
+		case errors.Is(err, checkpoint.ErrGraphMismatch):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(err, checkpoint.ErrCheckpointExists):
+			status = http.StatusConflict
+		default:
+			log.Printf("[Handler] Failed to import checkpoint: %v", err)
+		}
+		c.JSON(status, APIError{
+			Error:   "Failed to import checkpoint",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	node := exported.CurrentNode
+	if len(bundle.Manifest.InterruptedNodes) > 0 {
+		node = bundle.Manifest.InterruptedNodes[0]
+	}
+
+	state, err := s.store.LoadPendingState(ctx, id)
+	if err != nil {
+		if cp, err := s.store.LoadCheckpoint(ctx, id); err == nil {
+			state = cp.State
+		}
+	}
+
+	runner, err := wf.NewRunner(ctx, s.store.ToComposeStore())
+	if err != nil {
+		log.Printf("[Handler] Failed to compose graph: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to create execution",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	exec, err := s.execManager.CreateExecution(ctx, runner, wf.ID, id, "", exported.Input, s.stream)
+	if err != nil {
+		writeSessionBusy(c, err)
+		return
+	}
+	s.execManager.UpdateExecutionState(exec.ID, "interrupted", node, state)
+	log.Printf("[Handler] Imported checkpoint %s (exported as %s) into execution %s", id, bundle.Manifest.CheckpointID, exec.ID)
+
+	c.JSON(http.StatusCreated, ImportResponse{
+		CheckpointID: id,
+		Manifest:     bundle.Manifest,
+		Execution:    exec,
+	})
+}
+
+// HandleGetRetention returns the checkpoint retention policy
+func (s *Server) HandleGetRetention(c *gin.Context) {
+	c.JSON(http.StatusOK, s.store.RetentionPolicy())
+}
+
+// HandleSweep applies the retention policy now; ?dry_run=true only reports
+// what would be removed
+func (s *Server) HandleSweep(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	report, err := s.store.Sweep(c.Request.Context(), dryRun)
+	if err != nil {
+		log.Printf("[Handler] Failed to sweep checkpoints: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to sweep checkpoints",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// HandleReencode rewrites all stored checkpoint data with the configured
+// codecs, e.g. after rotating the encryption key
+func (s *Server) HandleReencode(c *gin.Context) {
+	n, err := s.store.Reencode(c.Request.Context())
+	if err != nil {
+		log.Printf("[Handler] Failed to re-encode checkpoints: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to re-encode checkpoints",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rewritten": n})
+}
+
+// HandleVerify checks checkpoint integrity; ?mode=repair or ?mode=quarantine
+// also fixes or moves aside what it finds
+func (s *Server) HandleVerify(c *gin.Context) {
+	report, err := s.store.Verify(c.Request.Context(), checkpoint.VerifyMode(c.Query("mode")))
+	if err != nil {
+		log.Printf("[Handler] Failed to verify checkpoints: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to verify checkpoints",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// HandleSetLabels replaces the labels of a checkpoint with the JSON object in
+// the request body
+func (s *Server) HandleSetLabels(c *gin.Context) {
+	var labels map[string]string
+	if err := c.ShouldBindJSON(&labels); err != nil {
+		c.JSON(http.StatusBadRequest, APIError{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if err := s.store.SetLabels(ctx, id, labels); err != nil {
+		if errors.Is(err, checkpoint.ErrCheckpointNotFound) {
+			c.JSON(http.StatusNotFound, APIError{Error: "Checkpoint not found", Details: err.Error()})
+			return
+		}
+		log.Printf("[Handler] Failed to set labels: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to set labels",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	meta, err := s.store.GetMetadata(ctx, id)
+	if err != nil {
+		log.Printf("[Handler] Failed to load metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to load metadata",
+			Details: err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, meta)
+}
+
+// parseCheckpointQuery reads the checkpoint list query parameters:
+//
+//	graph, last_node, interrupted_before, tool, context_key  exact filters
+//	label=key:value (repeatable, key alone requires the key)  label filters
+//	pending=true|false                                        has a pending overlay
+//	q                                                         ID substring
+//	sort, order=asc|desc                                      ordering, default updated_at desc
+//	offset, limit                                             pagination
+func parseCheckpointQuery(c *gin.Context) (checkpoint.Query, error) {
+	q := checkpoint.Query{
+		GraphName:         c.Query("graph"),
+		LastNode:          c.Query("last_node"),
+		InterruptedBefore: c.Query("interrupted_before"),
+		Tool:              c.Query("tool"),
+		ContextKey:        c.Query("context_key"),
+		IDContains:        c.Query("q"),
+		SortBy:            c.Query("sort"),
+		Desc:              true,
+	}
+
+	switch c.Query("order") {
+	case "", "desc":
+	case "asc":
+		q.Desc = false
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	for _, label := range c.QueryArray("label") {
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		key, value, _ := strings.Cut(label, ":")
+		q.Labels[key] = value
+	}
+
+	if v := c.Query("pending"); v != "" {
+		pending, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid pending: %s", v)
+		}
+		q.HasPendingState = &pending
+	}
+
+	for name, dst := range map[string]*int{"offset": &q.Offset, "limit": &q.Limit} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("invalid %s: %s", name, v)
+			}
+			*dst = n
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportRejectsTraversalIDs(t *testing.T) {
+	wf, _ := testWorkflow("test", bookParis())
+	dir := filepath.Join(t.TempDir(), "store")
+	ts := newTestServer(t, dir, wf)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "interrupted")
+	bundle, err := ts.store.Export(context.Background(), exec.CheckpointID, wf.Graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Named by the query or by the bundle, nothing lands outside the store
+	escaped := filepath.Join(filepath.Dir(dir), "escaped.json")
+	archive, err := bundle.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr APIError
+	if code := ts.do(t, "POST", "/api/checkpoints/import?id=../escaped", archive, &apiErr); code != http.StatusBadRequest {
+		t.Fatalf("import as ../escaped: %d %+v", code, apiErr)
+	}
+	bundle.Manifest.CheckpointID = "../escaped"
+	if archive, err = bundle.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	apiErr = APIError{}
+	if code := ts.do(t, "POST", "/api/checkpoints/import", archive, &apiErr); code != http.StatusBadRequest {
+		t.Fatalf("import of a bundle of ../escaped: %d %+v", code, apiErr)
+	}
+	if _, err := os.Stat(escaped); !os.IsNotExist(err) {
+		t.Fatalf("import wrote %s: %v", escaped, err)
+	}
+}
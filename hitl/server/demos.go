@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"eino_testing/agent"
+	"eino_testing/hitl/pkg/graph"
+	"eino_testing/multi_agent"
+
+	"github.com/cloudwego/eino-ext/components/model/ark"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent/multiagent/host"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// gameWorkflow runs the agent demo: the model looks up a game's URL with the
+// get_game tool
+func gameWorkflow() *Workflow {
+	return chatWorkflow(
+		"game",
+		"Look up the URL of a game (the agent demo)",
+		stringInput("game"),
+		"You are a helpful assistant. Call the \"get_game\" tool to find the URL of a game.",
+		"请告诉我{game}的URL是什么",
+		func(context.Context) ([]tool.BaseTool, error) {
+			return []tool.BaseTool{agent.CreateTool(), graph.AskHumanTool()}, nil
+		},
+	)
+}
+
+// mathWorkflow runs the reAct demo: the model answers a math question and
+// rates its difficulty with the add, sub and analyze tools
+func mathWorkflow() *Workflow {
+	return chatWorkflow(
+		"math",
+		"Answer a math question and rate its difficulty (the reAct demo)",
+		stringInput("question"),
+		"#Character:\n你是一个幼儿园老师，会同时判断题目难易程度，给出问题的答案",
+		"{question}",
+		func(context.Context) ([]tool.BaseTool, error) {
+			return []tool.BaseTool{
+				&multi_agent.AddTool{},
+				&multi_agent.SubTool{},
+				&multi_agent.AnalyzeTool{ChatModelConfig: arkConfig()},
+				graph.AskHumanTool(),
+			}, nil
+		},
+	)
+}
+
+// multiAgentWorkflow runs the multi_agent demo: the host model hands the
+// question to the add, sub and analysis specialists, each call approved by a
+// human
+func multiAgentWorkflow() *Workflow {
+	return chatWorkflow(
+		"multi_agent",
+		"Hand a math question to add, sub and analysis specialists (the multi_agent demo)",
+		stringInput("question"),
+		"你是一个智能助手，你可以调用不同的专家同时计算加法和减法，也可以调用相关专家分析问题。你可以根据需要并行或者分步骤多次调用专家。",
+		"{question}",
+		func(ctx context.Context) ([]tool.BaseTool, error) {
+			cfg := arkConfig()
+			add, err := multi_agent.NewAddSpecialist(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+			sub, err := multi_agent.NewSubSpecialist(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+			analyze, err := multi_agent.NewAnalyzeSpecialist(ctx, cfg, cfg)
+			if err != nil {
+				return nil, err
+			}
+			return []tool.BaseTool{
+				&specialistTool{add},
+				&specialistTool{sub},
+				&specialistTool{analyze},
+				graph.AskHumanTool(),
+			}, nil
+		},
+	)
+}
+
+// chatWorkflow is a workflow running the HITL chat loop: a system prompt, a
+// user message formatted from the input, and the chat model calling tools
+func chatWorkflow(id, description string, input *openapi3.Schema, system, user string, tools func(ctx context.Context) ([]tool.BaseTool, error)) *Workflow {
+	return &Workflow{
+		ID:          id,
+		Description: description,
+		InputSchema: input,
+		Tools:       tools,
+		Build: func(ctx context.Context, tools []tool.BaseTool, store compose.CheckPointStore) (compose.Runnable[map[string]any, *schema.Message], error) {
+			tpl := prompt.FromMessages(schema.FString,
+				schema.SystemMessage(system),
+				schema.UserMessage(user),
+			)
+			return composeGraph[map[string]any, *schema.Message](
+				ctx,
+				id,
+				tpl,
+				newChatModel(ctx, tools),
+				newToolsNode(ctx, tools),
+				store,
+			)
+		},
+		Graph: graph.Info(graph.Config{Name: id}),
+	}
+}
+
+// stringInput is the schema of an input made of one required, non-empty
+// string property
+func stringInput(name string) *openapi3.Schema {
+	input := openapi3.NewObjectSchema().WithProperty(name, openapi3.NewStringSchema().WithMinLength(1))
+	input.Required = []string{name}
+	return input
+}
+
+// arkConfig is the Ark chat model configuration of the demos
+func arkConfig() *ark.ChatModelConfig {
+	return &ark.ChatModelConfig{
+		BaseURL: os.Getenv("API_URL"),
+		APIKey:  os.Getenv("ARK_API_KEY"),
+		Model:   os.Getenv("MODEL"),
+	}
+}
+
+// specialistTool exposes a multi_agent specialist as a tool, so the model
+// hands it a question the way the multi_agent host does
+type specialistTool struct {
+	specialist *host.Specialist
+}
+
+type specialistInput struct {
+	Question string `json:"question"`
+}
+
+func (t *specialistTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: t.specialist.Name,
+		Desc: t.specialist.IntendedUse,
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"question": {
+				Type:     schema.String,
+				Desc:     "the question to hand to the specialist",
+				Required: true,
+			},
+		}),
+	}, nil
+}
+
+func (t *specialistTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var in specialistInput
+	if err := json.Unmarshal([]byte(argumentsInJSON), &in); err != nil {
+		return "", fmt.Errorf("%s: invalid arguments: %w", t.specialist.Name, err)
+	}
+
+	msg, err := t.specialist.Invokable(ctx, []*schema.Message{schema.UserMessage(in.Question)})
+	if err != nil {
+		return "", err
+	}
+	return msg.Content, nil
+}
@@ -2,73 +2,245 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/graph"
+	"eino_testing/hitl/pkg/types"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
-	"eino_testing/hitl/pkg/types"
 )
 
 // ExecutionManager manages concurrent executions
 type ExecutionManager struct {
-	mu         sync.RWMutex
-	executions map[string]*Execution
-	nextID     int
+	mu          sync.RWMutex
+	executions  map[string]*Execution
+	store       *checkpoint.Store
+	onInterrupt func(ctx context.Context, exec *Execution)
+	timeout     time.Duration
+	// ctx is cancelled when Shutdown starts; interrupt handlers run with it
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// Worker pool, see StartWorkers and Shutdown
+	queue    chan *job
+	workers  sync.WaitGroup
+	inflight sync.WaitGroup // runs started without a pool, interrupt handlers
+	drain    chan struct{}
+	draining bool
 }
 
 // Execution represents a single execution instance
 type Execution struct {
-	ID         string         `json:"id"`
-	Status     string         `json:"status"` // "running", "interrupted", "completed", "error"
-	CheckpointID string        `json:"checkpoint_id"`
-	Input      map[string]any `json:"input"`
-	Result     string         `json:"result,omitempty"`
-	Error      string         `json:"error,omitempty"`
-	State      *types.UniversalState `json:"state,omitempty"`
-	CurrentNode string        `json:"current_node"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	Runner     compose.Runnable[map[string]any, *schema.Message] `json:"-"`
-	CancelFunc context.CancelFunc `json:"-"`
-}
-
-// NewExecutionManager creates a new execution manager
-func NewExecutionManager() *ExecutionManager {
+	ID           string                                            `json:"id"`
+	Status       string                                            `json:"status"` // "queued", "running", "interrupted", "completed", "error", "cancelled"
+	CheckpointID string                                            `json:"checkpoint_id"`
+	WorkflowID   string                                            `json:"workflow_id"`
+	SessionID    string                                            `json:"session_id"` // the conversation the execution is a turn of
+	Input        map[string]any                                    `json:"input"`
+	Result       string                                            `json:"result,omitempty"`
+	Error        string                                            `json:"error,omitempty"`
+	State        *types.UniversalState                             `json:"state,omitempty"`
+	CurrentNode  string                                            `json:"current_node"`
+	Stream       bool                                              `json:"stream"` // run with the graph's Stream, relaying chunks
+	CreatedAt    time.Time                                         `json:"created_at"`
+	UpdatedAt    time.Time                                         `json:"updated_at"`
+	Deadline     time.Time                                         `json:"deadline,omitzero"` // when the current run times out
+	Runner       compose.Runnable[map[string]any, *schema.Message] `json:"-"`
+	CancelFunc   context.CancelCauseFunc                           `json:"-"` // set while running, see Cancel
+}
+
+// NewExecutionManager creates a new execution manager saving a record of
+// every execution next to its checkpoint in store; see Restore. A nil store
+// keeps executions in memory only.
+func NewExecutionManager(store *checkpoint.Store) *ExecutionManager {
+	ctx, cancel := context.WithCancelCause(context.Background())
 	return &ExecutionManager{
 		executions: make(map[string]*Execution),
-		nextID:     1,
+		store:      store,
+		drain:      make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Restore loads the executions saved in the store, building their runners
+// with newRunner from their workflow ID. Interrupted executions reload their
+// state from the checkpoint and can be resumed; executions that were running
+// when the server stopped are interrupted at their last checkpoint, or failed
+// without one. Queued executions stay queued; see Queued.
+func (em *ExecutionManager) Restore(ctx context.Context, newRunner func(ctx context.Context, workflowID string) (compose.Runnable[map[string]any, *schema.Message], error)) (int, error) {
+	if em.store == nil {
+		return 0, nil
+	}
+	records, err := em.store.LoadExecutions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	restored := 0
+	for checkpointID, data := range records {
+		var exec Execution
+		if err := json.Unmarshal(data, &exec); err != nil {
+			log.Printf("[Execution] Ignoring unreadable record of checkpoint %s: %v", checkpointID, err)
+			continue
+		}
+		if exec.ID == "" || exec.CheckpointID != checkpointID {
+			log.Printf("[Execution] Ignoring record of checkpoint %s naming checkpoint %q", checkpointID, exec.CheckpointID)
+			continue
+		}
+		if exec.Runner, err = newRunner(ctx, exec.WorkflowID); err != nil {
+			return restored, fmt.Errorf("build runner of execution %s: %w", exec.ID, err)
+		}
+
+		if exec.Status == "running" || exec.Status == "interrupted" {
+			em.reloadState(ctx, &exec)
+		}
+		em.executions[exec.ID] = &exec
+		restored++
 	}
+	return restored, nil
 }
 
-// CreateExecution creates a new execution instance
+// reloadState replaces the state of an interrupted or running execution with
+// the state of its checkpoint, which the execution resumes from
+func (em *ExecutionManager) reloadState(ctx context.Context, exec *Execution) {
+	state, err := em.store.LoadPendingState(ctx, exec.CheckpointID)
+	if err != nil {
+		cp, cpErr := em.store.LoadCheckpoint(ctx, exec.CheckpointID)
+		if cpErr != nil {
+			exec.Status = "error"
+			exec.Error = "Server stopped before the execution saved a checkpoint"
+			exec.UpdatedAt = time.Now()
+			em.persist(exec)
+			log.Printf("[Execution %s] Failed on restore: no checkpoint: %v", exec.ID, cpErr)
+			return
+		}
+		state = cp.State
+	}
+
+	exec.State = state
+	if exec.Status == "running" {
+		exec.Status = "interrupted"
+		if meta, err := em.store.GetMetadata(ctx, exec.CheckpointID); err == nil && len(meta.InterruptedBefore) > 0 {
+			exec.CurrentNode = meta.InterruptedBefore[0]
+		}
+		exec.UpdatedAt = time.Now()
+		em.persist(exec)
+		log.Printf("[Execution %s] Was running when the server stopped, interrupted at %s", exec.ID, exec.CurrentNode)
+	}
+}
+
+// persist saves the record of exec; em.mu must be held
+func (em *ExecutionManager) persist(exec *Execution) {
+	if em.store == nil {
+		return
+	}
+	data, err := json.Marshal(exec)
+	if err == nil {
+		err = em.store.SaveExecution(context.Background(), exec.CheckpointID, data)
+	}
+	if err != nil {
+		log.Printf("[Execution %s] Failed to save record: %v", exec.ID, err)
+	}
+}
+
+// newID returns an ID for a new execution: distinct from checkpoint IDs, and
+// unique across restarts; em.mu must be held
+func (em *ExecutionManager) newID() string {
+	for {
+		id := fmt.Sprintf("run-%d", time.Now().UnixNano())
+		if _, ok := em.executions[id]; !ok {
+			return id
+		}
+	}
+}
+
+// SetInterruptHandler sets a function called after an execution is
+// interrupted and its state broadcast. It runs on its own goroutine, so the
+// worker is free for the next execution, with a context cancelled when
+// Shutdown starts; Shutdown waits for it to return.
+func (em *ExecutionManager) SetInterruptHandler(fn func(ctx context.Context, exec *Execution)) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.onInterrupt = fn
+}
+
+// CreateExecution creates a new execution instance of a workflow, a turn of
+// the session sessionID; an empty sessionID starts a session named after the
+// execution. The execution holds its session from then on: while it is
+// queued, running or waiting for a human, further turns fail with
+// ErrSessionBusy.
 func (em *ExecutionManager) CreateExecution(
 	ctx context.Context,
 	runner compose.Runnable[map[string]any, *schema.Message],
+	workflowID string,
 	checkpointID string,
+	sessionID string,
 	input map[string]any,
-) *Execution {
+	stream bool,
+) (*Execution, error) {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
-	id := fmt.Sprintf("exec-%d", em.nextID)
-	em.nextID++
+	if err := em.checkSessionIdle(sessionID); err != nil {
+		return nil, err
+	}
+	id := em.newID()
+	if sessionID == "" {
+		sessionID = id
+	}
 
 	exec := &Execution{
-		ID:          id,
-		Status:      "running",
+		ID:           id,
+		Status:       "running",
 		CheckpointID: checkpointID,
-		Input:       input,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-		Runner:      runner,
-		CurrentNode: "ChatTemplate",
+		WorkflowID:   workflowID,
+		SessionID:    sessionID,
+		Input:        input,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		Runner:       runner,
+		CurrentNode:  "ChatTemplate",
+		Stream:       stream,
 	}
 
 	em.executions[id] = exec
-	return exec
+	em.persist(exec)
+	return exec, nil
+}
+
+// CheckSessionIdle returns ErrSessionBusy while an execution of the session
+// is queued, running or waiting for a human
+func (em *ExecutionManager) CheckSessionIdle(sessionID string) error {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	return em.checkSessionIdle(sessionID)
+}
+
+// checkSessionIdle is CheckSessionIdle with em.mu held
+func (em *ExecutionManager) checkSessionIdle(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	for _, exec := range em.executions {
+		if exec.SessionID != sessionID {
+			continue
+		}
+		if exec.Status == "queued" || exec.Status == "running" || exec.Status == "interrupted" {
+			return fmt.Errorf("%w: execution %s of the session is %s", ErrSessionBusy, exec.ID, exec.Status)
+		}
+	}
+	return nil
 }
 
 // GetExecution retrieves an execution by ID
@@ -80,6 +252,20 @@ func (em *ExecutionManager) GetExecution(id string) (*Execution, bool) {
 	return exec, ok
 }
 
+// Snapshot returns a copy of an execution taken under the lock, which can be
+// read and encoded while the execution runs
+func (em *ExecutionManager) Snapshot(id string) (*Execution, bool) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	exec, ok := em.executions[id]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *exec
+	return &snapshot, true
+}
+
 // UpdateExecutionState updates the execution state
 func (em *ExecutionManager) UpdateExecutionState(id, status, currentNode string, state *types.UniversalState) {
 	em.mu.Lock()
@@ -90,82 +276,172 @@ func (em *ExecutionManager) UpdateExecutionState(id, status, currentNode string,
 		exec.State = state
 		exec.CurrentNode = currentNode
 		exec.UpdatedAt = time.Now()
+		em.persist(exec)
 	}
 }
 
-// CompleteExecution marks an execution as completed
-func (em *ExecutionManager) CompleteExecution(id, result string) {
+// finishExecution ends an execution with status and its error message, if any
+func (em *ExecutionManager) finishExecution(id, status, errMsg string) {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
 	if exec, ok := em.executions[id]; ok {
-		exec.Status = "completed"
-		exec.Result = result
+		exec.Status = status
+		exec.Error = errMsg
 		exec.UpdatedAt = time.Now()
+		em.persist(exec)
 	}
 }
 
-// ErrorExecution marks an execution as errored
-func (em *ExecutionManager) ErrorExecution(id, errMsg string) {
+// CompleteExecution marks an execution as completed with its final state,
+// kept when state is nil
+func (em *ExecutionManager) CompleteExecution(id, result string, state *types.UniversalState) {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
 	if exec, ok := em.executions[id]; ok {
-		exec.Status = "error"
-		exec.Error = errMsg
+		exec.Status = "completed"
+		exec.Result = result
+		if state != nil {
+			exec.State = state
+		}
 		exec.UpdatedAt = time.Now()
+		em.persist(exec)
 	}
 }
 
-// UpdateToolCalls updates the tool calls in the execution state
-func (em *ExecutionManager) UpdateToolCalls(id string, newArgs string) error {
+// ErrorExecution marks an execution as errored
+func (em *ExecutionManager) ErrorExecution(id, errMsg string) {
+	em.finishExecution(id, "error", errMsg)
+}
+
+// Decide runs decide on an interrupted execution with the manager locked, so
+// the execution is neither resumed nor cancelled while its tool calls are
+// decided, and saves its record when decide succeeds. decide changes a copy
+// of the execution's state, which replaces the state on success; snapshots
+// taken before never change. It fails with ErrNotInterrupted when the
+// execution is not interrupted.
+func (em *ExecutionManager) Decide(id string, decide func(exec *Execution) error) error {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
 	exec, ok := em.executions[id]
 	if !ok {
-		return fmt.Errorf("execution not found: %s", id)
+		return ErrExecutionNotFound
 	}
-
-	if exec.State == nil || len(exec.State.MessageHistory) == 0 {
-		return fmt.Errorf("no state or message history")
+	if exec.Status != "interrupted" {
+		return fmt.Errorf("%w: execution is %s", ErrNotInterrupted, exec.Status)
 	}
 
-	lastMsg := exec.State.MessageHistory[len(exec.State.MessageHistory)-1]
-	if len(lastMsg.ToolCalls) == 0 {
-		return fmt.Errorf("no tool calls to update")
+	state := exec.State
+	if state != nil {
+		clone, err := state.Clone()
+		if err != nil {
+			return err
+		}
+		exec.State = clone
+	}
+	if err := decide(exec); err != nil {
+		exec.State = state
+		return err
 	}
-
-	// Update the first tool call's arguments
-	lastMsg.ToolCalls[0].Function.Arguments = newArgs
 	exec.UpdatedAt = time.Now()
+	em.persist(exec)
+	return nil
+}
 
+// Resume runs an interrupted execution again from its checkpoint (see
+// RunExecution). The execution leaves "interrupted" under the lock, so of
+// concurrent resumes only the first runs it; the others, and resumes of
+// executions not interrupted, fail with ErrNotInterrupted. When the run
+// cannot start the execution stays interrupted.
+func (em *ExecutionManager) Resume(ctx context.Context, id string, hub *WSHub, baseDir string) error {
+	em.mu.Lock()
+	exec, ok := em.executions[id]
+	if !ok {
+		em.mu.Unlock()
+		return ErrExecutionNotFound
+	}
+	if status := exec.Status; status != "interrupted" {
+		em.mu.Unlock()
+		return fmt.Errorf("%w: execution is %s", ErrNotInterrupted, status)
+	}
+	queued, err := em.start(ctx, exec, hub, baseDir)
+	em.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if queued {
+		em.BroadcastStateChange(hub, id)
+	}
 	return nil
 }
 
-// ListExecutions returns all executions
+// FindByCheckpoint returns the execution using the given checkpoint ID
+func (em *ExecutionManager) FindByCheckpoint(checkpointID string) (*Execution, bool) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	for _, exec := range em.executions {
+		if exec.CheckpointID == checkpointID {
+			return exec, true
+		}
+	}
+	return nil, false
+}
+
+// ListSession returns snapshots of the executions of a session, oldest first
+func (em *ExecutionManager) ListSession(sessionID string) []*Execution {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	var executions []*Execution
+	for _, exec := range em.executions {
+		if exec.SessionID == sessionID {
+			snapshot := *exec
+			executions = append(executions, &snapshot)
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].CreatedAt.Before(executions[j].CreatedAt)
+	})
+	return executions
+}
+
+// ListExecutions returns snapshots of all executions
 func (em *ExecutionManager) ListExecutions() []*Execution {
 	em.mu.RLock()
 	defer em.mu.RUnlock()
 
 	executions := make([]*Execution, 0, len(em.executions))
 	for _, exec := range em.executions {
-		executions = append(executions, exec)
+		snapshot := *exec
+		executions = append(executions, &snapshot)
 	}
 	return executions
 }
 
-// DeleteExecution removes an execution
+// DeleteExecution removes an execution and its record
 func (em *ExecutionManager) DeleteExecution(id string) {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
+	exec, ok := em.executions[id]
+	if !ok {
+		return
+	}
 	delete(em.executions, id)
+	if em.store != nil {
+		if err := em.store.DeleteExecution(context.Background(), exec.CheckpointID); err != nil {
+			log.Printf("[Execution %s] Failed to delete record: %v", id, err)
+		}
+	}
 }
 
 // BroadcastStateChange broadcasts a state change to all connected WebSocket clients
 func (em *ExecutionManager) BroadcastStateChange(hub *WSHub, execID string) {
-	exec, ok := em.GetExecution(execID)
+	exec, ok := em.Snapshot(execID)
 	if !ok {
 		return
 	}
@@ -181,9 +457,14 @@ func (em *ExecutionManager) BroadcastStateChange(hub *WSHub, execID string) {
 
 // BroadcastExecutionStarted broadcasts an execution started event
 func (em *ExecutionManager) BroadcastExecutionStarted(hub *WSHub, exec *Execution) {
+	snapshot, ok := em.Snapshot(exec.ID)
+	if !ok {
+		return
+	}
+
 	event := WebSocketEvent{
 		Type:      "execution_started",
-		Data:      exec,
+		Data:      snapshot,
 		Timestamp: time.Now().UnixNano(),
 	}
 
@@ -192,7 +473,7 @@ func (em *ExecutionManager) BroadcastExecutionStarted(hub *WSHub, exec *Executio
 
 // BroadcastExecutionCompleted broadcasts an execution completed event
 func (em *ExecutionManager) BroadcastExecutionCompleted(hub *WSHub, execID string) {
-	exec, ok := em.GetExecution(execID)
+	exec, ok := em.Snapshot(execID)
 	if !ok {
 		return
 	}
@@ -206,6 +487,17 @@ func (em *ExecutionManager) BroadcastExecutionCompleted(hub *WSHub, execID strin
 	hub.Broadcast(execID, event)
 }
 
+// BroadcastStreamEvent broadcasts a token or tool call delta of a streaming execution
+func (em *ExecutionManager) BroadcastStreamEvent(hub *WSHub, execID string, ev graph.StreamEvent) {
+	event := WebSocketEvent{
+		Type:      ev.Kind,
+		Data:      ev,
+		Timestamp: time.Now().UnixNano(),
+	}
+
+	hub.Broadcast(execID, event)
+}
+
 // BroadcastError broadcasts an error event
 func (em *ExecutionManager) BroadcastError(hub *WSHub, execID, errMsg string) {
 	event := WebSocketEvent{
@@ -217,60 +509,214 @@ func (em *ExecutionManager) BroadcastError(hub *WSHub, execID, errMsg string) {
 	hub.Broadcast(execID, event)
 }
 
-// RunExecution runs the execution asynchronously
+// RunExecution runs the execution asynchronously on the worker pool (see
+// StartWorkers), where it waits with status "queued" until a worker is free.
+// It fails with ErrQueueFull when the queue is full and ErrShuttingDown once
+// Shutdown has been called, leaving the execution unchanged.
 func (em *ExecutionManager) RunExecution(
 	ctx context.Context,
 	exec *Execution,
 	hub *WSHub,
 	baseDir string,
-) {
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				errMsg := fmt.Sprintf("Execution panic: %v", r)
-				log.Printf("[Execution %s] %s", exec.ID, errMsg)
-				em.ErrorExecution(exec.ID, errMsg)
-				em.BroadcastError(hub, exec.ID, errMsg)
-			}
+) error {
+	em.mu.Lock()
+	queued, err := em.start(ctx, exec, hub, baseDir)
+	em.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if queued {
+		em.BroadcastStateChange(hub, exec.ID)
+	}
+	return nil
+}
+
+// start runs exec on a goroutine, or queues it when there is a worker pool,
+// and returns whether it was queued; em.mu must be held. On error the
+// execution is left unchanged.
+func (em *ExecutionManager) start(ctx context.Context, exec *Execution, hub *WSHub, baseDir string) (bool, error) {
+	if em.draining {
+		return false, ErrShuttingDown
+	}
+
+	if em.queue == nil {
+		exec.Status = "running"
+		exec.UpdatedAt = time.Now()
+		em.persist(exec)
+		em.inflight.Add(1)
+
+		go func() {
+			defer em.inflight.Done()
+			em.run(ctx, exec, hub, baseDir)
 		}()
+		return false, nil
+	}
 
-		em.BroadcastExecutionStarted(hub, exec)
+	select {
+	case em.queue <- &job{ctx: ctx, exec: exec, hub: hub, baseDir: baseDir}:
+	default:
+		return false, ErrQueueFull
+	}
+	exec.Status = "queued"
+	exec.UpdatedAt = time.Now()
+	em.persist(exec)
+	return true, nil
+}
 
-		opts := buildWebInvokeOptions(exec, baseDir)
+// run runs the execution until it completes, fails or is interrupted, within
+// the execution timeout. Cancel stops it with status "cancelled"; Shutdown
+// drains it, interrupting it at a checkpoint it resumes from after a restart.
+func (em *ExecutionManager) run(ctx context.Context, exec *Execution, hub *WSHub, baseDir string) {
+	em.mu.RLock()
+	timeout := em.timeout
+	em.mu.RUnlock()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, timeout, errTimeout)
+		defer cancelTimeout()
+	}
+	ctx = graph.WithDrain(ctx, em.drain)
 
-		result, err := exec.Runner.Invoke(ctx, exec.Input, opts...)
-		if err == nil {
-			em.CompleteExecution(exec.ID, result.Content)
-			em.BroadcastExecutionCompleted(hub, exec.ID)
-			log.Printf("[Execution %s] Completed with result: %s", exec.ID, result.Content)
-			return
-		}
+	em.mu.Lock()
+	if exec.Status != "queued" && exec.Status != "running" {
+		// Cancelled while queued
+		em.mu.Unlock()
+		return
+	}
+	exec.Status = "running"
+	exec.CancelFunc = cancel
+	exec.Deadline, _ = ctx.Deadline()
+	exec.UpdatedAt = time.Now()
+	em.persist(exec)
+	em.mu.Unlock()
+
+	defer func() {
+		em.mu.Lock()
+		exec.CancelFunc = nil
+		em.mu.Unlock()
+	}()
 
-		// Extract interrupt info
-		info, ok := compose.ExtractInterruptInfo(err)
-		if !ok {
-			errMsg := fmt.Sprintf("Execution error: %v", err)
+	defer func() {
+		if r := recover(); r != nil {
+			errMsg := fmt.Sprintf("Execution panic: %v", r)
 			log.Printf("[Execution %s] %s", exec.ID, errMsg)
 			em.ErrorExecution(exec.ID, errMsg)
 			em.BroadcastError(hub, exec.ID, errMsg)
-			return
 		}
+	}()
 
-		state, ok := info.State.(*types.UniversalState)
-		if !ok {
-			errMsg := fmt.Sprintf("Unexpected state type: %T", info.State)
-			log.Printf("[Execution %s] %s", exec.ID, errMsg)
-			em.ErrorExecution(exec.ID, errMsg)
-			em.BroadcastError(hub, exec.ID, errMsg)
+	em.BroadcastExecutionStarted(hub, exec)
+
+	opts := buildWebInvokeOptions(exec, baseDir)
+	var final *types.UniversalState
+	opts = append(opts, graph.WithCompletionHandler(func(_ context.Context, st types.State) {
+		final = st.Universal()
+	}))
+
+	var result *schema.Message
+	var err error
+	if exec.Stream {
+		result, err = em.streamExecution(ctx, exec, hub, opts)
+	} else {
+		result, err = exec.Runner.Invoke(ctx, exec.Input, opts...)
+	}
+	if err == nil {
+		em.CompleteExecution(exec.ID, result.Content, final)
+		em.BroadcastExecutionCompleted(hub, exec.ID)
+		log.Printf("[Execution %s] Completed with result: %s", exec.ID, result.Content)
+		return
+	}
+
+	// Extract interrupt info
+	info, ok := compose.ExtractInterruptInfo(err)
+	if !ok {
+		errMsg := fmt.Sprintf("Execution error: %v", err)
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, errCancelled):
+			em.finishExecution(exec.ID, "cancelled", "")
+			em.BroadcastStateChange(hub, exec.ID)
+			log.Printf("[Execution %s] Cancelled", exec.ID)
+			return
+		case errors.Is(cause, errShutdown):
+			// Left running: Restore interrupts it at its last checkpoint
+			log.Printf("[Execution %s] Stopped by shutdown: %v", exec.ID, err)
 			return
+		case errors.Is(cause, errTimeout):
+			errMsg = fmt.Sprintf("Execution timed out after %s", timeout)
 		}
+		log.Printf("[Execution %s] %s", exec.ID, errMsg)
+		em.ErrorExecution(exec.ID, errMsg)
+		em.BroadcastError(hub, exec.ID, errMsg)
+		return
+	}
 
-		em.UpdateExecutionState(exec.ID, "interrupted", "ToolsNode", state)
-		em.BroadcastStateChange(hub, exec.ID)
-		log.Printf("[Execution %s] Interrupted at ToolsNode", exec.ID)
+	st, ok := info.State.(types.State)
+	if !ok {
+		errMsg := fmt.Sprintf("Unexpected state type: %T", info.State)
+		log.Printf("[Execution %s] %s", exec.ID, errMsg)
+		em.ErrorExecution(exec.ID, errMsg)
+		em.BroadcastError(hub, exec.ID, errMsg)
+		return
+	}
+
+	node := interruptedNode(info)
+	em.UpdateExecutionState(exec.ID, "interrupted", node, st.Universal())
+	em.BroadcastStateChange(hub, exec.ID)
+	if graph.IsDrained(info) {
+		// Nobody decides anything before the server restarts
+		log.Printf("[Execution %s] Checkpointed at %s for shutdown", exec.ID, node)
+		return
+	}
+	log.Printf("[Execution %s] Interrupted at %s", exec.ID, node)
+
+	em.mu.Lock()
+	onInterrupt := em.onInterrupt
+	if onInterrupt == nil || em.draining {
+		em.mu.Unlock()
+		return
+	}
+	em.inflight.Add(1)
+	em.mu.Unlock()
+
+	go func() {
+		defer em.inflight.Done()
+		onInterrupt(em.ctx, exec)
 	}()
 }
 
+// streamExecution runs the execution with the graph's Stream, broadcasting
+// chat model chunks as they arrive, and returns the concatenated result.
+// Interrupts are returned as errors, the same as with Invoke.
+func (em *ExecutionManager) streamExecution(ctx context.Context, exec *Execution, hub *WSHub, opts []compose.Option) (*schema.Message, error) {
+	opts = append(opts, graph.WithStreamHandler(func(ctx context.Context, ev graph.StreamEvent) {
+		em.BroadcastStreamEvent(hub, exec.ID, ev)
+	}))
+
+	sr, err := exec.Runner.Stream(ctx, exec.Input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.ConcatMessageStream(sr)
+}
+
+// interruptedNode names the node an interrupt stopped at: the node about to
+// run, or the node that just ran for interrupts after a node
+func interruptedNode(info *compose.InterruptInfo) string {
+	switch {
+	case len(info.BeforeNodes) > 0:
+		return info.BeforeNodes[0]
+	case len(info.AfterNodes) > 0:
+		return info.AfterNodes[0]
+	case len(info.RerunNodes) > 0:
+		return info.RerunNodes[0]
+	}
+	return "ToolsNode"
+}
+
 // buildWebInvokeOptions builds invoke options for web mode
 func buildWebInvokeOptions(exec *Execution, baseDir string) []compose.Option {
 	return []compose.Option{
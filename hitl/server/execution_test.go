@@ -0,0 +1,650 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/graph"
+	"eino_testing/hitl/pkg/types"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeChatModel answers with its replies in order, then with "done"
+type fakeChatModel struct {
+	mu      sync.Mutex
+	replies []*schema.Message
+}
+
+func (m *fakeChatModel) Generate(context.Context, []*schema.Message, ...model.Option) (*schema.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.replies) == 0 {
+		return schema.AssistantMessage("done", nil), nil
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	return reply, nil
+}
+
+// Stream streams the next reply's content word by word, then its tool calls
+func (m *fakeChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []*schema.Message
+	for _, word := range strings.SplitAfter(msg.Content, " ") {
+		if word != "" {
+			chunks = append(chunks, schema.AssistantMessage(word, nil))
+		}
+	}
+	if len(msg.ToolCalls) > 0 {
+		chunks = append(chunks, schema.AssistantMessage("", msg.ToolCalls))
+	}
+	return schema.StreamReaderFromArray(chunks), nil
+}
+
+func (m *fakeChatModel) WithTools([]*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+// fakeTool records the arguments it runs with
+type fakeTool struct {
+	name string
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (t *fakeTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name, Desc: "records its calls"}, nil
+}
+
+func (t *fakeTool) InvokableRun(_ context.Context, args string, _ ...tool.Option) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, args)
+	return t.name + " ran with " + args, nil
+}
+
+func (t *fakeTool) ranWith() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.calls...)
+}
+
+// bookParis is a model reply calling BookTicket for Paris
+func bookParis() *schema.Message {
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       "call-1",
+		Type:     "function",
+		Function: schema.FunctionCall{Name: "BookTicket", Arguments: `{"location":"Paris"}`},
+	}})
+}
+
+// testWorkflow is a workflow whose fake chat model answers replies, then
+// "done", and whose BookTicket tool records its calls. It interrupts before
+// the tools node, like the built-in workflows.
+func testWorkflow(id string, replies ...*schema.Message) (*Workflow, *fakeTool) {
+	cm := &fakeChatModel{replies: replies}
+	bookTicket := &fakeTool{name: "BookTicket"}
+	return &Workflow{
+		ID:          id,
+		Description: "Books tickets with fakes",
+		Tools: func(context.Context) ([]tool.BaseTool, error) {
+			return []tool.BaseTool{bookTicket}, nil
+		},
+		Build: func(ctx context.Context, tools []tool.BaseTool, store compose.CheckPointStore) (compose.Runnable[map[string]any, *schema.Message], error) {
+			tn, err := compose.NewToolNode(ctx, &compose.ToolsNodeConfig{Tools: tools})
+			if err != nil {
+				return nil, err
+			}
+			return graph.NewGraph[map[string]any, *schema.Message](ctx, graph.Config{
+				Name:                 id,
+				ChatTemplate:         prompt.FromMessages(schema.FString, schema.UserMessage("Book a ticket for {name}")),
+				ChatModel:            cm,
+				ToolsNode:            tn,
+				CheckPointStore:      store,
+				InterruptBeforeNodes: []string{"ToolsNode"},
+			})
+		},
+		Graph: graph.Info(graph.Config{Name: id}),
+	}, bookTicket
+}
+
+// testServer is a server over the checkpoints in a directory, serving its API
+// from an httptest server
+type testServer struct {
+	*Server
+	http     *httptest.Server
+	stopOnce sync.Once
+}
+
+// newTestServer starts a server keeping its checkpoints in dir, with the
+// extra workflows wfs and no authentication; it stops when the test ends
+func newTestServer(t *testing.T, dir string, wfs ...*Workflow) *testServer {
+	t.Helper()
+	return startTestServer(t, testConfig(t, dir, wfs...))
+}
+
+// testConfig is the config of newTestServer, for tests changing it
+func testConfig(t *testing.T, dir string, wfs ...*Workflow) Config {
+	t.Setenv("HITL_AUTH", "")
+
+	cfg := DefaultConfig()
+	cfg.BaseDir = dir
+	cfg.DistDir = t.TempDir()
+	cfg.Workflows = wfs
+	return cfg
+}
+
+// startTestServer starts a server with cfg; it stops when the test ends
+func startTestServer(t *testing.T, cfg Config) *testServer {
+	t.Helper()
+	srv, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{Server: srv, http: httptest.NewServer(srv.engine)}
+	t.Cleanup(func() { ts.stop(t) })
+	return ts
+}
+
+// stop shuts the server down, as on SIGTERM
+func (ts *testServer) stop(t *testing.T) {
+	t.Helper()
+	ts.stopOnce.Do(func() {
+		ts.http.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := ts.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+	})
+}
+
+// do sends a request to the API, body encoded as JSON unless it is raw
+// bytes, and decodes the response into out, when it is not nil, returning the
+// status code
+func (ts *testServer) do(t *testing.T, method, path string, body, out any) int {
+	t.Helper()
+	var r *bytes.Reader
+	if data, ok := body.([]byte); ok {
+		// Sent as is, as checkpoint bundles are
+		r = bytes.NewReader(data)
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	} else {
+		r = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, ts.http.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// statusOf returns the status of an execution, read under the manager's lock
+func statusOf(em *ExecutionManager, id string) string {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	if exec, ok := em.executions[id]; ok {
+		return exec.Status
+	}
+	return ""
+}
+
+func waitStatus(t *testing.T, em *ExecutionManager, id, status string) {
+	t.Helper()
+	waitFor(t, fmt.Sprintf("execution %s to be %s", id, status), func() bool {
+		return statusOf(em, id) == status
+	})
+}
+
+// interruptedCheckpoint runs wf until it interrupts before its tools node,
+// saving the checkpoint checkpointID to store
+func interruptedCheckpoint(t *testing.T, wf *Workflow, store *checkpoint.Store, checkpointID string) {
+	t.Helper()
+	ctx := context.Background()
+	runner, err := wf.NewRunner(ctx, store.ToComposeStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runner.Invoke(ctx, map[string]any{"name": "Ada"}, compose.WithCheckPointID(checkpointID))
+	if info, ok := compose.ExtractInterruptInfo(err); !ok || len(info.BeforeNodes) == 0 {
+		t.Fatalf("run = %v, want an interrupt before ToolsNode", err)
+	}
+}
+
+// saveRecord saves the record of an execution as a server would
+func saveRecord(t *testing.T, store *checkpoint.Store, checkpointID string, exec *Execution) {
+	t.Helper()
+	data, err := json.Marshal(exec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveExecution(context.Background(), checkpointID, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreExecutions(t *testing.T) {
+	ctx := context.Background()
+	store := checkpoint.NewStore(t.TempDir())
+	wf, _ := testWorkflow("test", bookParis(), bookParis(), bookParis())
+	interruptedCheckpoint(t, wf, store, "cp-interrupted")
+	interruptedCheckpoint(t, wf, store, "cp-running")
+	interruptedCheckpoint(t, wf, store, "cp-overlay")
+
+	// A human edited the call of cp-overlay before the server stopped
+	overlay, err := store.LoadCheckpoint(ctx, "cp-overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit := []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":"Rome"}`}}
+	if err := overlay.State.ApplyToolDecisions(edit); err != nil {
+		t.Fatal(err)
+	}
+	if err := savePendingState(ctx, store, "cp-overlay", overlay.State); err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(id, checkpointID, status string) *Execution {
+		return &Execution{ID: id, Status: status, CheckpointID: checkpointID, WorkflowID: "test", CurrentNode: "ChatModel", Input: map[string]any{"name": "Ada"}}
+	}
+	saveRecord(t, store, "cp-interrupted", record("run-interrupted", "cp-interrupted", "interrupted"))
+	saveRecord(t, store, "cp-running", record("run-running", "cp-running", "running"))
+	saveRecord(t, store, "cp-overlay", record("run-overlay", "cp-overlay", "interrupted"))
+	saveRecord(t, store, "cp-lost", record("run-lost", "cp-lost", "running"))
+	saveRecord(t, store, "cp-queued", record("run-queued", "cp-queued", "queued"))
+	saveRecord(t, store, "cp-completed", record("run-completed", "cp-completed", "completed"))
+	saveRecord(t, store, "cp-other", record("run-other", "cp-elsewhere", "interrupted"))
+	if err := store.SaveExecution(ctx, "cp-unreadable", []byte("{not json")); err != nil {
+		t.Fatal(err)
+	}
+
+	em := NewExecutionManager(store)
+	var built []string
+	restored, err := em.Restore(ctx, func(ctx context.Context, workflowID string) (compose.Runnable[map[string]any, *schema.Message], error) {
+		built = append(built, workflowID)
+		return wf.NewRunner(ctx, store.ToComposeStore())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 6 || len(built) != 6 {
+		t.Fatalf("restored %d executions building %d runners, want 6", restored, len(built))
+	}
+
+	pendingArgs := func(exec *Execution) string {
+		if exec.State == nil {
+			return ""
+		}
+		_, pending := exec.State.PendingToolCalls()
+		if len(pending) != 1 {
+			return fmt.Sprint(len(pending), " calls")
+		}
+		return pending[0].Function.Arguments
+	}
+	tests := []struct {
+		id     string
+		status string
+		node   string
+		args   string
+	}{
+		{"run-interrupted", "interrupted", "ChatModel", `{"location":"Paris"}`},
+		// Interrupted where its last checkpoint stopped
+		{"run-running", "interrupted", "ToolsNode", `{"location":"Paris"}`},
+		// The pending state wins over the checkpoint
+		{"run-overlay", "interrupted", "ChatModel", `{"location":"Rome"}`},
+		{"run-lost", "error", "ChatModel", ""},
+		{"run-queued", "queued", "ChatModel", ""},
+		{"run-completed", "completed", "ChatModel", ""},
+	}
+	for _, tt := range tests {
+		exec, ok := em.GetExecution(tt.id)
+		if !ok {
+			t.Errorf("%s not restored", tt.id)
+			continue
+		}
+		if exec.Status != tt.status || exec.CurrentNode != tt.node || pendingArgs(exec) != tt.args {
+			t.Errorf("%s: %s at %s pending %q; want %s at %s pending %q", tt.id, exec.Status, exec.CurrentNode, pendingArgs(exec), tt.status, tt.node, tt.args)
+		}
+		if exec.Runner == nil {
+			t.Errorf("%s: no runner", tt.id)
+		}
+	}
+	if _, ok := em.GetExecution("run-other"); ok {
+		t.Error("record naming another checkpoint restored")
+	}
+	if queued := em.Queued(); len(queued) != 1 || queued[0].ID != "run-queued" {
+		t.Errorf("queued = %v, want run-queued", queued)
+	}
+
+	// What changed on restore is saved, so it holds across a second restart
+	again := NewExecutionManager(store)
+	if _, err := again.Restore(ctx, func(ctx context.Context, _ string) (compose.Runnable[map[string]any, *schema.Message], error) {
+		return wf.NewRunner(ctx, store.ToComposeStore())
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for id, status := range map[string]string{"run-running": "interrupted", "run-lost": "error"} {
+		if got := statusOf(again, id); got != status {
+			t.Errorf("%s after a second restart: %s, want %s", id, got, status)
+		}
+	}
+
+	// An execution whose runner cannot be built fails the restore
+	failed := errors.New("no such workflow")
+	_, err = NewExecutionManager(store).Restore(ctx, func(context.Context, string) (compose.Runnable[map[string]any, *schema.Message], error) {
+		return nil, failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Restore = %v, want the runner's error", err)
+	}
+}
+
+func TestServerResumesExecutionsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	wf, bookTicket := testWorkflow("test", bookParis())
+
+	first := newTestServer(t, dir, wf)
+	var exec Execution
+	if code := first.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	waitStatus(t, first.execManager, exec.ID, "interrupted")
+	first.stop(t)
+
+	// Restarted on the same directory, the execution still waits for its
+	// tool call to be confirmed
+	second := newTestServer(t, dir, wf)
+	var state StateResponse
+	if code := second.do(t, "GET", "/api/state/"+exec.ID, nil, &state); code != http.StatusOK {
+		t.Fatalf("state: %d", code)
+	}
+	if state.Status != "interrupted" || state.CurrentNode != "ToolsNode" {
+		t.Fatalf("restored %s at %s, want interrupted at ToolsNode", state.Status, state.CurrentNode)
+	}
+	if code := second.do(t, "POST", "/api/confirm", ConfirmRequest{ExecutionID: exec.ID, Action: "confirm"}, nil); code != http.StatusOK {
+		t.Fatalf("confirm: %d", code)
+	}
+	if code := second.do(t, "POST", "/api/execute/"+exec.ID+"/resume", nil, nil); code != http.StatusOK {
+		t.Fatalf("resume: %d", code)
+	}
+	waitStatus(t, second.execManager, exec.ID, "completed")
+
+	if ran := bookTicket.ranWith(); len(ran) != 1 || ran[0] != `{"location":"Paris"}` {
+		t.Fatalf("BookTicket ran with %v, want Paris once", ran)
+	}
+	second.execManager.mu.RLock()
+	result := second.execManager.executions[exec.ID].Result
+	second.execManager.mu.RUnlock()
+	if result != "done" {
+		t.Fatalf("result %q, want done", result)
+	}
+}
+
+func TestServerRunsQueuedExecutionsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	wf, _ := testWorkflow("test")
+
+	// Queued when the server stopped, before it ran
+	store := checkpoint.NewStore(dir)
+	saveRecord(t, store, "cp-queued", &Execution{
+		ID: "run-queued", Status: "queued", CheckpointID: "cp-queued", WorkflowID: "test",
+		SessionID: "run-queued", Input: map[string]any{"name": "Ada"}, CurrentNode: "ChatTemplate",
+	})
+
+	srv := newTestServer(t, dir, wf)
+	waitStatus(t, srv.execManager, "run-queued", "completed")
+}
+
+// interruptedExecution runs an execution of wf on em until it interrupts
+// before its tools node
+func interruptedExecution(t *testing.T, em *ExecutionManager, hub *WSHub, wf *Workflow, store *checkpoint.Store, checkpointID string) *Execution {
+	t.Helper()
+	ctx := context.Background()
+	runner, err := wf.NewRunner(ctx, store.ToComposeStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec, err := em.CreateExecution(ctx, runner, wf.ID, checkpointID, "", map[string]any{"name": "Ada"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := em.RunExecution(ctx, exec, hub, ""); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, em, exec.ID, "interrupted")
+	return exec
+}
+
+// newTestManager is an execution manager saving to a store in a temporary
+// directory, with a hub; both stop when the test ends
+func newTestManager(t *testing.T) (*ExecutionManager, *WSHub, *checkpoint.Store) {
+	store := checkpoint.NewStore(t.TempDir())
+	em := NewExecutionManager(store)
+	hub := NewWSHub()
+	hub.Run()
+	t.Cleanup(func() {
+		em.Shutdown(context.Background())
+		hub.Close()
+	})
+	return em, hub, store
+}
+
+func TestResume(t *testing.T) {
+	ctx := context.Background()
+	em, hub, store := newTestManager(t)
+	// A workflow for each execution, as their model replies are shared
+	wf, bookTicket := testWorkflow("test", bookParis())
+
+	// Of concurrent resumes of a confirmed execution exactly one runs it
+	exec := interruptedExecution(t, em, hub, wf, store, "cp-1")
+	err := em.Decide(exec.ID, func(exec *Execution) error {
+		return savePendingState(ctx, store, exec.CheckpointID, exec.State)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	resumed := 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := em.Resume(ctx, exec.ID, hub, "")
+			if err != nil && !errors.Is(err, ErrNotInterrupted) {
+				t.Errorf("Resume = %v, want ErrNotInterrupted", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				resumed++
+			}
+		}()
+	}
+	wg.Wait()
+	if resumed != 1 {
+		t.Fatalf("%d resumes ran the execution, want 1", resumed)
+	}
+	waitStatus(t, em, exec.ID, "completed")
+	if ran := bookTicket.ranWith(); len(ran) != 1 {
+		t.Fatalf("BookTicket ran with %v, want once", ran)
+	}
+	if err := em.Resume(ctx, exec.ID, hub, ""); !errors.Is(err, ErrNotInterrupted) {
+		t.Fatalf("Resume of a completed execution = %v, want ErrNotInterrupted", err)
+	}
+	if err := em.Resume(ctx, "unknown", hub, ""); !errors.Is(err, ErrExecutionNotFound) {
+		t.Fatalf("Resume of an unknown execution = %v, want ErrExecutionNotFound", err)
+	}
+
+	// A cancelled execution is not resumed
+	wf, _ = testWorkflow("test", bookParis())
+	cancelled := interruptedExecution(t, em, hub, wf, store, "cp-2")
+	if running, err := em.Cancel(cancelled.ID); running || err != nil {
+		t.Fatalf("Cancel = %v, %v", running, err)
+	}
+	if err := em.Resume(ctx, cancelled.ID, hub, ""); !errors.Is(err, ErrNotInterrupted) {
+		t.Fatalf("Resume of a cancelled execution = %v, want ErrNotInterrupted", err)
+	}
+	if status := statusOf(em, cancelled.ID); status != "cancelled" {
+		t.Fatalf("cancelled execution is %s", status)
+	}
+
+	// An execution that cannot start stays interrupted
+	wf, _ = testWorkflow("test", bookParis())
+	waiting := interruptedExecution(t, em, hub, wf, store, "cp-3")
+	if err := em.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := em.Resume(ctx, waiting.ID, hub, ""); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("Resume after shutdown = %v, want ErrShuttingDown", err)
+	}
+	if status := statusOf(em, waiting.ID); status != "interrupted" {
+		t.Fatalf("execution that could not resume is %s", status)
+	}
+}
+
+func TestDecide(t *testing.T) {
+	ctx := context.Background()
+	em, hub, store := newTestManager(t)
+	wf, _ := testWorkflow("test", bookParis())
+	exec := interruptedExecution(t, em, hub, wf, store, "cp")
+
+	// A failed decision leaves the record as it was
+	failed := errors.New("failed")
+	if err := em.Decide(exec.ID, func(*Execution) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("Decide = %v, want the decision's error", err)
+	}
+
+	edit := []types.ToolDecision{{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":"Rome"}`}}
+	err := em.Decide(exec.ID, func(exec *Execution) error {
+		return exec.State.ApplyToolDecisions(edit)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.LoadExecutions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Execution
+	if err := json.Unmarshal(records["cp"], &saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, pending := saved.State.PendingToolCalls(); len(pending) != 1 || pending[0].Function.Arguments != `{"location":"Rome"}` {
+		t.Fatalf("saved pending calls %+v, want the edit", pending)
+	}
+
+	if running, err := em.Cancel(exec.ID); running || err != nil {
+		t.Fatalf("Cancel = %v, %v", running, err)
+	}
+	err = em.Decide(exec.ID, func(*Execution) error {
+		t.Fatal("decided a cancelled execution")
+		return nil
+	})
+	if !errors.Is(err, ErrNotInterrupted) {
+		t.Fatalf("Decide of a cancelled execution = %v, want ErrNotInterrupted", err)
+	}
+	if err := em.Decide("unknown", func(*Execution) error { return nil }); !errors.Is(err, ErrExecutionNotFound) {
+		t.Fatalf("Decide of an unknown execution = %v, want ErrExecutionNotFound", err)
+	}
+}
+
+func TestStreamExecution(t *testing.T) {
+	reply := bookParis()
+	reply.Content = "Booking for Ada"
+	wf, _ := testWorkflow("test", reply)
+	ts := newTestServer(t, t.TempDir(), wf)
+
+	stream := true
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}, Stream: &stream}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+
+	// The chunks arrive in order, before the interrupt's state update; the
+	// hub replays those sent before the client connected
+	conn := dial(t, ts.http, exec.ID, "")
+	var got []graph.StreamEvent
+	for {
+		msg := readMessage(t, conn)
+		var ev struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(msg.Data, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Type == graph.StreamToken || ev.Type == graph.StreamToolCallDelta {
+			var se graph.StreamEvent
+			if err := json.Unmarshal(ev.Data, &se); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, se)
+			continue
+		}
+		var snapshot Execution
+		if ev.Type == "state_update" && json.Unmarshal(ev.Data, &snapshot) == nil && snapshot.Status == "interrupted" {
+			break
+		}
+	}
+
+	want := []graph.StreamEvent{
+		{Kind: graph.StreamToken, Node: "ChatModel", Content: "Booking "},
+		{Kind: graph.StreamToken, Node: "ChatModel", Content: "for "},
+		{Kind: graph.StreamToken, Node: "ChatModel", Content: "Ada"},
+		{Kind: graph.StreamToolCallDelta, Node: "ChatModel", ToolCallID: "call-1", ToolName: "BookTicket", Arguments: `{"location":"Paris"}`},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("stream events %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("stream event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// The interrupted state holds the whole message
+	cp, err := ts.store.LoadCheckpoint(context.Background(), exec.CheckpointID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := cp.State.MessageHistory[len(cp.State.MessageHistory)-1]; msg.Content != "Booking for Ada" || len(msg.ToolCalls) != 1 {
+		t.Fatalf("checkpointed message %+v, want the concatenated reply", msg)
+	}
+}
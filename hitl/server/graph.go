@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"eino_testing/hitl/pkg/graph"
 	"github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/prompt"
@@ -13,8 +14,7 @@ import (
 	"github.com/cloudwego/eino/components/tool/utils"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
-	"eino_testing/hitl/pkg/checkpoint"
-	"eino_testing/hitl/pkg/graph"
+	"github.com/getkin/kin-openapi/openapi3"
 )
 
 type bookInput struct {
@@ -25,6 +25,7 @@ type bookInput struct {
 
 func composeGraph[I, O any](
 	ctx context.Context,
+	name string,
 	tpl prompt.ChatTemplate,
 	cm model.ToolCallingChatModel,
 	tn *compose.ToolsNode,
@@ -32,22 +33,76 @@ func composeGraph[I, O any](
 ) (compose.Runnable[I, O], error) {
 	// 使用新的graph包创建工作流图
 	return graph.NewGraph[I, O](ctx, graph.Config{
-		ChatTemplate: tpl,
-		ChatModel:    cm,
-		ToolsNode:    tn,
-		CheckPointStore: store,
+		Name:                 name,
+		ChatTemplate:         tpl,
+		ChatModel:            cm,
+		ToolsNode:            tn,
+		CheckPointStore:      store,
 		InterruptBeforeNodes: []string{"ToolsNode"},
 	})
 }
 
+// bookingWorkflow is the BookTicket workflow, built from def when it is not
+// nil. Its graph keeps the default name so checkpoints and bundles of
+// earlier versions of the server still match it.
+func bookingWorkflow(def *graph.Definition) *Workflow {
+	input := openapi3.NewObjectSchema().
+		WithProperty("name", openapi3.NewStringSchema().WithMinLength(1)).
+		WithProperty("location", openapi3.NewStringSchema().WithMinLength(1))
+	input.Required = []string{"name", "location"}
+
+	return &Workflow{
+		ID:          DefaultWorkflowID,
+		Description: "Book a ticket to a location, confirming the booking with a human",
+		InputSchema: input,
+		Tools: func(context.Context) ([]tool.BaseTool, error) {
+			return getTools(), nil
+		},
+		Build: func(ctx context.Context, tools []tool.BaseTool, store compose.CheckPointStore) (compose.Runnable[map[string]any, *schema.Message], error) {
+			if def != nil {
+				return graph.NewGraph[map[string]any, *schema.Message](ctx, graph.Config{
+					Definition:      def,
+					Registry:        newRegistry(ctx, tools),
+					CheckPointStore: store,
+				})
+			}
+			return composeGraph[map[string]any, *schema.Message](
+				ctx,
+				"",
+				newChatTemplate(ctx),
+				newChatModel(ctx, tools),
+				newToolsNode(ctx, tools),
+				store,
+			)
+		},
+		Graph: graph.Info(graph.Config{Definition: def}),
+	}
+}
+
+// newRegistry registers the server's components for declarative graphs: the
+// "booking" chat template, the "openai" chat model and the tools
+func newRegistry(ctx context.Context, tools []tool.BaseTool) *graph.Registry {
+	reg := graph.NewRegistry()
+	reg.RegisterChatTemplate("booking", newChatTemplate(ctx))
+	reg.RegisterChatModel("openai", newChatModel(ctx, tools))
+	for _, t := range tools {
+		if err := reg.RegisterTool(ctx, t); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return reg
+}
+
 func newChatTemplate(_ context.Context) prompt.ChatTemplate {
 	return prompt.FromMessages(schema.FString,
-		schema.SystemMessage("You are a helpful assistant. If the user asks about the booking, call the \"BookTicket\" tool to book ticket."),
+		schema.SystemMessage("You are a helpful assistant. If the user asks about the booking, call the \"BookTicket\" tool to book ticket. "+
+			"If you need information you do not have, such as the passenger's phone number, ask the user with the \"ask_human\" tool."),
 		schema.UserMessage("I'm {name}. Help me book a ticket to {location}"),
 	)
 }
 
-func newChatModel(ctx context.Context) model.ToolCallingChatModel {
+// newChatModel creates the OpenAI chat model with tools bound, if any
+func newChatModel(ctx context.Context, tools []tool.BaseTool) model.ToolCallingChatModel {
 	cm, err := openai.NewChatModel(ctx, &openai.ChatModelConfig{
 		APIKey:  os.Getenv("OPENAI_API_KEY"),
 		Model:   os.Getenv("OPENAI_MODEL"),
@@ -57,7 +112,10 @@ func newChatModel(ctx context.Context) model.ToolCallingChatModel {
 		log.Fatal(err)
 	}
 
-	tools := getTools()
+	if len(tools) == 0 {
+		return cm
+	}
+
 	var toolsInfo []*schema.ToolInfo
 	for _, t := range tools {
 		info, err := t.Info(ctx)
@@ -73,9 +131,7 @@ func newChatModel(ctx context.Context) model.ToolCallingChatModel {
 	return cm
 }
 
-func newToolsNode(ctx context.Context) *compose.ToolsNode {
-	tools := getTools()
-
+func newToolsNode(ctx context.Context, tools []tool.BaseTool) *compose.ToolsNode {
 	tn, err := compose.NewToolNode(ctx, &compose.ToolsNodeConfig{Tools: tools})
 	if err != nil {
 		log.Fatal(err)
@@ -95,11 +151,5 @@ func getTools() []tool.BaseTool {
 		log.Fatal(err)
 	}
 
-	return []tool.BaseTool{toolBookTicket}
+	return []tool.BaseTool{toolBookTicket, graph.AskHumanTool()}
 }
-
-// 新的检查点存储创建函数
-func newCheckPointStore(ctx context.Context, baseDir string) compose.CheckPointStore {
-	store := checkpoint.NewStore(baseDir)
-	return store.ToComposeStore()
-}
\ No newline at end of file
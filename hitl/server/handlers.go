@@ -2,19 +2,25 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/graph"
+	"eino_testing/hitl/pkg/types"
 
+	"github.com/cloudwego/eino/schema"
 	"github.com/gin-gonic/gin"
 )
 
-// HandleExecute starts a new execution
+// HandleExecute starts a new execution of the default booking workflow
 func (s *Server) HandleExecute(c *gin.Context) {
 	var req ExecuteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,15 +38,28 @@ func (s *Server) HandleExecute(c *gin.Context) {
 		return
 	}
 
+	wf, ok := s.workflow(DefaultWorkflowID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIError{Error: "Workflow not found"})
+		return
+	}
+
 	input := map[string]any{
 		"name":     req.Name,
 		"location": req.Location,
 	}
 
+	s.executeWorkflow(c, wf, input, req.SessionID, req.Stream)
+}
+
+// startExecution runs a new execution of wf in the session sessionID (a new
+// session when empty), continuing the conversation history when it is not
+// empty, and answers with the execution
+func (s *Server) startExecution(c *gin.Context, wf *Workflow, sessionID string, input map[string]any, history []*schema.Message, stream bool) {
 	checkpointID := fmt.Sprintf("exec-%d", time.Now().UnixNano())
 
 	// Create runner
-	runner, err := s.composeGraph(context.Background())
+	runner, err := wf.NewRunner(context.Background(), s.store.ToComposeStore())
 	if err != nil {
 		log.Printf("[Handler] Failed to compose graph: %v", err)
 		c.JSON(http.StatusInternalServerError, APIError{
@@ -50,43 +69,103 @@ func (s *Server) HandleExecute(c *gin.Context) {
 		return
 	}
 
-	// Create execution
-	exec := s.execManager.CreateExecution(
+	// Create execution, reserving the session
+	exec, err := s.execManager.CreateExecution(
 		context.Background(),
 		runner,
+		wf.ID,
 		checkpointID,
+		sessionID,
 		input,
+		stream,
 	)
+	if err != nil {
+		writeSessionBusy(c, err)
+		return
+	}
 
 	// Run execution asynchronously
-	s.execManager.RunExecution(context.Background(), exec, s.hub, s.baseDir)
+	ctx := context.Background()
+	if len(history) > 0 {
+		ctx = graph.WithHistory(ctx, history)
+	}
+	if err := s.execManager.RunExecution(ctx, exec, s.hub, s.baseDir); err != nil {
+		s.execManager.DeleteExecution(exec.ID)
+		writeRunError(c, err)
+		return
+	}
 
-	c.JSON(http.StatusCreated, exec)
+	snapshot, _ := s.execManager.Snapshot(exec.ID)
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// writeRunError answers a request whose execution could not be started
+func writeRunError(c *gin.Context, err error) {
+	c.JSON(http.StatusServiceUnavailable, APIError{
+		Error:   "Failed to start execution",
+		Code:    "unavailable",
+		Details: err.Error(),
+	})
 }
 
-// HandleResume resumes an execution from checkpoint
+// HandleResume resumes an execution from checkpoint. Only interrupted
+// executions resume; of concurrent resumes the first wins, the others get 409.
 func (s *Server) HandleResume(c *gin.Context) {
 	execID := c.Param("id")
 
-	exec, ok := s.execManager.GetExecution(execID)
-	if !ok {
+	err := s.execManager.Resume(context.Background(), execID, s.hub, s.baseDir)
+	switch {
+	case errors.Is(err, ErrExecutionNotFound):
 		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
 		return
+	case errors.Is(err, ErrNotInterrupted):
+		writeNotInterrupted(c, "resume", err)
+		return
+	case err != nil:
+		writeRunError(c, err)
+		return
 	}
 
-	if exec.Status != "interrupted" {
-		c.JSON(http.StatusBadRequest, APIError{
-			Error: fmt.Sprintf("Cannot resume execution in status: %s", exec.Status),
+	snapshot, _ := s.execManager.Snapshot(execID)
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// writeNotInterrupted answers a request to act on an execution that is not
+// waiting for a human
+func writeNotInterrupted(c *gin.Context, action string, err error) {
+	c.JSON(http.StatusConflict, APIError{
+		Error:   fmt.Sprintf("Cannot %s an execution that is not interrupted", action),
+		Code:    "not_interrupted",
+		Details: err.Error(),
+	})
+}
+
+// HandleCancel cancels an execution: a running execution stops (202, it is
+// marked "cancelled" once its run returns), a queued or interrupted one is
+// marked at once (200)
+func (s *Server) HandleCancel(c *gin.Context) {
+	execID := c.Param("id")
+
+	running, err := s.execManager.Cancel(execID)
+	switch {
+	case errors.Is(err, ErrExecutionNotFound):
+		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
+		return
+	case errors.Is(err, ErrNotCancellable):
+		exec, _ := s.execManager.Snapshot(execID)
+		c.JSON(http.StatusConflict, APIError{
+			Error: fmt.Sprintf("Cannot cancel execution in status: %s", exec.Status),
+			Code:  "not_cancellable",
 		})
 		return
 	}
 
-	// Update execution status
-	s.execManager.UpdateExecutionState(execID, "running", "ChatModel", exec.State)
-
-	// Run execution again
-	s.execManager.RunExecution(context.Background(), exec, s.hub, s.baseDir)
-
+	exec, _ := s.execManager.Snapshot(execID)
+	if running {
+		c.JSON(http.StatusAccepted, exec)
+		return
+	}
+	s.execManager.BroadcastStateChange(s.hub, execID)
 	c.JSON(http.StatusOK, exec)
 }
 
@@ -94,7 +173,7 @@ func (s *Server) HandleResume(c *gin.Context) {
 func (s *Server) HandleGetState(c *gin.Context) {
 	execID := c.Param("id")
 
-	exec, ok := s.execManager.GetExecution(execID)
+	exec, ok := s.execManager.Snapshot(execID)
 	if !ok {
 		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
 		return
@@ -114,11 +193,21 @@ func (s *Server) HandleGetState(c *gin.Context) {
 			Error:       exec.Error,
 		}
 	}
+	if rev, err := s.store.Revision(c.Request.Context(), exec.CheckpointID); err == nil {
+		resp.Revision = rev
+	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
-// HandleConfirm handles tool call confirmation
+// Confirmations the pending tool calls of an execution do not allow
+var (
+	errUnansweredQuestions = errors.New("pending questions must be answered")
+	errAmbiguousToolCall   = errors.New("several tool calls are pending")
+)
+
+// HandleConfirm handles tool call confirmation. The execution must be
+// interrupted until its calls are decided, or the request fails with 409.
 func (s *Server) HandleConfirm(c *gin.Context) {
 	var req ConfirmRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -129,83 +218,151 @@ func (s *Server) HandleConfirm(c *gin.Context) {
 		return
 	}
 
-	exec, ok := s.execManager.GetExecution(req.ExecutionID)
-	if !ok {
-		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
-		return
-	}
-
-	if exec.Status != "interrupted" {
-		c.JSON(http.StatusBadRequest, APIError{
-			Error: fmt.Sprintf("Cannot confirm execution in status: %s", exec.Status),
-		})
-		return
-	}
-
 	switch req.Action {
 	case "confirm":
-		// Save pending state for resume
-		if exec.State != nil {
-			if err := savePendingState(s.baseDir, exec.CheckpointID, exec.State); err != nil {
-				log.Printf("[Handler] Failed to save pending state: %v", err)
-				c.JSON(http.StatusInternalServerError, APIError{
-					Error:   "Failed to save pending state",
-					Details: err.Error(),
-				})
-				return
-			}
-		}
-		c.JSON(http.StatusOK, gin.H{"status": "confirmed"})
-
 	case "reject":
 		if req.NewArgs == "" {
 			c.JSON(http.StatusBadRequest, APIError{Error: "new_args required for reject action"})
 			return
 		}
-
-		// Update tool call arguments
-		if err := s.execManager.UpdateToolCalls(req.ExecutionID, req.NewArgs); err != nil {
-			log.Printf("[Handler] Failed to update tool calls: %v", err)
-			c.JSON(http.StatusInternalServerError, APIError{
-				Error:   "Failed to update tool calls",
-				Details: err.Error(),
-			})
+	case "decide":
+		if len(req.Decisions) == 0 {
+			c.JSON(http.StatusBadRequest, APIError{Error: "decisions required for decide action"})
 			return
 		}
+	default:
+		c.JSON(http.StatusBadRequest, APIError{Error: fmt.Sprintf("Unknown action: %s", req.Action)})
+		return
+	}
 
-		// Update checkpoint arguments
-		if err := updateCheckpointArguments(s.baseDir, exec.CheckpointID, req.NewArgs); err != nil {
-			log.Printf("[Handler] Failed to update checkpoint: %v", err)
-			c.JSON(http.StatusInternalServerError, APIError{
-				Error:   "Failed to update checkpoint",
-				Details: err.Error(),
-			})
-			return
+	// The execution cannot be resumed or cancelled while its calls are decided
+	var (
+		checkpointID string
+		decisions    []types.ToolDecision
+		hasState     bool
+		stillPending []ToolCallResponse
+	)
+	err := s.execManager.Decide(req.ExecutionID, func(exec *Execution) error {
+		checkpointID = exec.CheckpointID
+		switch req.Action {
+		case "confirm":
+			// Every pending call runs as proposed, which questions cannot
+			if exec.State != nil && len(exec.State.PendingQuestions()) > 0 {
+				return errUnansweredQuestions
+			}
+		case "reject":
+			id := req.ToolCallID
+			if id == "" && exec.State != nil {
+				if _, pending := exec.State.PendingToolCalls(); len(pending) == 1 {
+					id = pending[0].ID
+				}
+			}
+			if id == "" {
+				return errAmbiguousToolCall
+			}
+			decisions = []types.ToolDecision{{ToolCallID: id, Action: types.DecisionEdit, Arguments: req.NewArgs}}
+		default:
+			decisions = req.Decisions
 		}
 
-		// Save pending state
+		// The calls as the model proposed them, for the audit log
+		var pending []schema.ToolCall
 		if exec.State != nil {
-			if err := savePendingState(s.baseDir, exec.CheckpointID, exec.State); err != nil {
-				log.Printf("[Handler] Failed to save pending state: %v", err)
-				c.JSON(http.StatusInternalServerError, APIError{
-					Error:   "Failed to save pending state",
-					Details: err.Error(),
-				})
-				return
-			}
+			_, pending = exec.State.PendingToolCalls()
 		}
 
-		c.JSON(http.StatusOK, gin.H{"status": "rejected", "new_args": req.NewArgs})
+		if err := s.applyDecisions(c.Request.Context(), exec, decisions, req.Revision); err != nil {
+			return err
+		}
 
+		// Save pending state for resume
+		if exec.State != nil {
+			if err := savePendingState(c.Request.Context(), s.store, exec.CheckpointID, exec.State); err != nil {
+				err = fmt.Errorf("save pending state: %w", err)
+				s.auditDecisions(exec, pending, decisions, true, principalOf(c), c.ClientIP(), err)
+				return err
+			}
+			hasState = true
+			stillPending = pendingToolCalls(exec.State)
+		}
+		s.auditDecisions(exec, pending, decisions, true, principalOf(c), c.ClientIP(), nil)
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrExecutionNotFound):
+		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
+		return
+	case errors.Is(err, ErrNotInterrupted):
+		writeNotInterrupted(c, "confirm", err)
+		return
+	case errors.Is(err, errUnansweredQuestions):
+		c.JSON(http.StatusBadRequest, APIError{
+			Error: "Pending questions must be answered with the decide action",
+			Code:  "unanswered_questions",
+		})
+		return
+	case errors.Is(err, errAmbiguousToolCall):
+		c.JSON(http.StatusBadRequest, APIError{Error: "tool_call_id required when several tool calls are pending"})
+		return
+	case errors.Is(err, checkpoint.ErrConflict):
+		c.JSON(http.StatusConflict, APIError{
+			Error:   "Checkpoint was modified concurrently",
+			Code:    "conflict",
+			Details: err.Error(),
+		})
+		return
+	case errors.Is(err, types.ErrInvalidDecision):
+		c.JSON(http.StatusBadRequest, APIError{
+			Error:   "Invalid tool decisions",
+			Code:    "invalid_decision",
+			Details: err.Error(),
+		})
+		return
 	default:
-		c.JSON(http.StatusBadRequest, APIError{Error: fmt.Sprintf("Unknown action: %s", req.Action)})
+		log.Printf("[Handler] Failed to decide tool calls of execution %s: %v", req.ExecutionID, err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to decide tool calls",
+			Details: err.Error(),
+		})
 		return
 	}
+
+	var resp gin.H
+	switch req.Action {
+	case "confirm":
+		c.JSON(http.StatusOK, gin.H{"status": "confirmed"})
+		return
+	case "reject":
+		resp = gin.H{"status": "rejected", "new_args": req.NewArgs}
+	default:
+		resp = gin.H{"status": "decided", "decisions": decisions}
+		if hasState {
+			resp["pending_tool_calls"] = stillPending
+		}
+	}
+	// Record what the human changed relative to the model's proposal
+	if diff, err := s.store.Diff(c.Request.Context(), checkpointID, ""); err == nil {
+		resp["diff"] = diff
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-// HandleListCheckpoints lists all checkpoints
+// HandleListCheckpoints lists checkpoints with their index metadata,
+// filtered, sorted and paginated by the query parameters (see
+// parseCheckpointQuery). The number of matches is sent in X-Total-Count.
 func (s *Server) HandleListCheckpoints(c *gin.Context) {
-	checkpoints, err := checkpoint.ListCheckpoints(s.baseDir)
+	q, err := parseCheckpointQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIError{Error: "Invalid query", Details: err.Error()})
+		return
+	}
+
+	page, err := s.store.Query(c.Request.Context(), q)
+	if errors.Is(err, checkpoint.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, APIError{Error: "Invalid query", Details: err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("[Handler] Failed to list checkpoints: %v", err)
 		c.JSON(http.StatusInternalServerError, APIError{
@@ -215,14 +372,15 @@ func (s *Server) HandleListCheckpoints(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, checkpoints)
+	c.Header("X-Total-Count", strconv.Itoa(page.Total))
+	c.JSON(http.StatusOK, page.Items)
 }
 
 // HandleDeleteCheckpoint deletes a checkpoint
 func (s *Server) HandleDeleteCheckpoint(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := checkpoint.DeleteCheckpoint(s.baseDir, id); err != nil {
+	if err := s.store.Delete(c.Request.Context(), id); err != nil {
 		log.Printf("[Handler] Failed to delete checkpoint: %v", err)
 		c.JSON(http.StatusInternalServerError, APIError{
 			Error:   "Failed to delete checkpoint",
@@ -244,7 +402,7 @@ func (s *Server) HandleListExecutions(c *gin.Context) {
 func (s *Server) HandleGetExecution(c *gin.Context) {
 	id := c.Param("id")
 
-	exec, ok := s.execManager.GetExecution(id)
+	exec, ok := s.execManager.Snapshot(id)
 	if !ok {
 		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
 		return
@@ -253,38 +411,89 @@ func (s *Server) HandleGetExecution(c *gin.Context) {
 	c.JSON(http.StatusOK, exec)
 }
 
-// HandleLogs streams execution logs (returns current state for now)
+// HandleLogs returns the execution timeline: every node run recorded in the
+// execution state, in order
 func (s *Server) HandleLogs(c *gin.Context) {
 	execID := c.Param("id")
 
-	exec, ok := s.execManager.GetExecution(execID)
+	exec, ok := s.execManager.Snapshot(execID)
 	if !ok {
 		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
 		return
 	}
 
-	// Return execution info as logs
-	logs := []map[string]any{
-		{
-			"timestamp": exec.CreatedAt.Format(time.RFC3339),
-			"message":   fmt.Sprintf("Execution %s started", exec.ID),
-			"level":     "info",
-		},
-	}
+	logs := []LogEntry{{
+		Timestamp: exec.CreatedAt.Format(time.RFC3339Nano),
+		Message:   fmt.Sprintf("Execution %s started", exec.ID),
+		Level:     "info",
+	}}
 
 	if exec.State != nil {
-		for node, logData := range exec.State.NodeExecutionLog {
-			logs = append(logs, map[string]any{
-				"timestamp": time.Unix(0, exec.State.SavedAt).Format(time.RFC3339),
-				"message":   fmt.Sprintf("Node %s executed: %+v", node, logData),
-				"level":     "info",
-			})
+		for i := range exec.State.NodeExecutionLog {
+			logs = append(logs, eventLogEntry(&exec.State.NodeExecutionLog[i]))
 		}
 	}
 
+	switch exec.Status {
+	case "interrupted":
+		logs = append(logs, LogEntry{
+			Timestamp: exec.UpdatedAt.Format(time.RFC3339Nano),
+			Message:   fmt.Sprintf("Execution interrupted at %s", exec.CurrentNode),
+			Level:     "warn",
+		})
+	case "completed":
+		logs = append(logs, LogEntry{
+			Timestamp: exec.UpdatedAt.Format(time.RFC3339Nano),
+			Message:   "Execution completed",
+			Level:     "info",
+		})
+	case "cancelled":
+		logs = append(logs, LogEntry{
+			Timestamp: exec.UpdatedAt.Format(time.RFC3339Nano),
+			Message:   "Execution cancelled",
+			Level:     "warn",
+		})
+	case "error":
+		logs = append(logs, LogEntry{
+			Timestamp: exec.UpdatedAt.Format(time.RFC3339Nano),
+			Message:   exec.Error,
+			Level:     "error",
+		})
+	}
+
 	c.JSON(http.StatusOK, logs)
 }
 
+// eventLogEntry describes a node run as a timeline entry
+func eventLogEntry(ev *types.ExecutionEvent) LogEntry {
+	entry := LogEntry{
+		Timestamp: time.Unix(0, ev.StartedAt).Format(time.RFC3339Nano),
+		Level:     "info",
+		Event:     ev,
+	}
+
+	msg := fmt.Sprintf("#%d %s %s", ev.Seq, ev.Node, ev.Phase)
+	if ev.EndedAt != 0 {
+		msg += fmt.Sprintf(" in %s", time.Duration(ev.Duration))
+	}
+	if len(ev.Tools) > 0 {
+		msg += fmt.Sprintf(", tools: %s", strings.Join(ev.Tools, ", "))
+	}
+	if ev.Usage != nil {
+		msg += fmt.Sprintf(", tokens: %d (prompt %d, completion %d)",
+			ev.Usage.TotalTokens, ev.Usage.PromptTokens, ev.Usage.CompletionTokens)
+	}
+	switch ev.Phase {
+	case types.PhaseFailed:
+		msg += ": " + ev.Error
+		entry.Level = "error"
+	case types.PhaseInterrupted:
+		entry.Level = "warn"
+	}
+	entry.Message = msg
+	return entry
+}
+
 // HandleServeStatic serves the frontend static files
 func (s *Server) HandleServeStatic(c *gin.Context) {
 	// Try to serve from dist directory
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"eino_testing/hitl/pkg/types"
+)
+
+func TestResumeConflicts(t *testing.T) {
+	wf, bookTicket := testWorkflow("test", bookParis())
+	ts := newTestServer(t, t.TempDir(), wf)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "interrupted")
+	if code := ts.do(t, "POST", "/api/confirm", ConfirmRequest{ExecutionID: exec.ID, Action: "confirm"}, nil); code != http.StatusOK {
+		t.Fatalf("confirm: %d", code)
+	}
+
+	// Of concurrent resumes the first wins, the others get 409
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	errs := make([]APIError, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = ts.do(t, "POST", "/api/execute/"+exec.ID+"/resume", nil, &errs[i])
+		}()
+	}
+	wg.Wait()
+	won := 0
+	for i, code := range codes {
+		switch {
+		case code == http.StatusOK:
+			won++
+		case code != http.StatusConflict || errs[i].Code != "not_interrupted":
+			t.Errorf("resume: %d %+v, want 409 not_interrupted", code, errs[i])
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d resumes won, want 1", won)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "completed")
+	if ran := bookTicket.ranWith(); len(ran) != 1 {
+		t.Fatalf("BookTicket ran with %v, want once", ran)
+	}
+
+	// Nothing is left to confirm or cancel
+	var apiErr APIError
+	if code := ts.do(t, "POST", "/api/confirm", ConfirmRequest{ExecutionID: exec.ID, Action: "confirm"}, &apiErr); code != http.StatusConflict || apiErr.Code != "not_interrupted" {
+		t.Fatalf("confirm of a completed execution: %d %+v", code, apiErr)
+	}
+	apiErr = APIError{}
+	if code := ts.do(t, "POST", "/api/executions/"+exec.ID+"/cancel", nil, &apiErr); code != http.StatusConflict || apiErr.Code != "not_cancellable" {
+		t.Fatalf("cancel of a completed execution: %d %+v", code, apiErr)
+	}
+	if code := ts.do(t, "POST", "/api/execute/unknown/resume", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("resume of an unknown execution: %d", code)
+	}
+}
+
+func TestCancelBeforeResume(t *testing.T) {
+	wf, bookTicket := testWorkflow("test", bookParis())
+	ts := newTestServer(t, t.TempDir(), wf)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "interrupted")
+
+	var cancelled Execution
+	if code := ts.do(t, "POST", "/api/executions/"+exec.ID+"/cancel", nil, &cancelled); code != http.StatusOK || cancelled.Status != "cancelled" {
+		t.Fatalf("cancel: %d %s", code, cancelled.Status)
+	}
+	var apiErr APIError
+	if code := ts.do(t, "POST", "/api/execute/"+exec.ID+"/resume", nil, &apiErr); code != http.StatusConflict || apiErr.Code != "not_interrupted" {
+		t.Fatalf("resume of a cancelled execution: %d %+v", code, apiErr)
+	}
+	apiErr = APIError{}
+	if code := ts.do(t, "POST", "/api/confirm", ConfirmRequest{ExecutionID: exec.ID, Action: "confirm"}, &apiErr); code != http.StatusConflict {
+		t.Fatalf("confirm of a cancelled execution: %d %+v", code, apiErr)
+	}
+	if status := statusOf(ts.execManager, exec.ID); status != "cancelled" {
+		t.Fatalf("cancelled execution is %s", status)
+	}
+	if ran := bookTicket.ranWith(); len(ran) != 0 {
+		t.Fatalf("BookTicket ran with %v", ran)
+	}
+}
+
+// blockPendingState makes saving the pending state of checkpointID to the
+// file store in dir fail, until the returned function is called
+func blockPendingState(t *testing.T, dir, checkpointID string) func() {
+	t.Helper()
+	// A directory, not empty, cannot be replaced by the state file
+	path := filepath.Join(dir, checkpointID+".confirm.json")
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConfirmAuditsSaveFailures(t *testing.T) {
+	wf, _ := testWorkflow("test", bookParis())
+	dir := t.TempDir()
+	ts := newTestServer(t, dir, wf)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "interrupted")
+
+	// A decision whose pending state is not saved is audited with the error,
+	// and leaves the execution undecided
+	unblock := blockPendingState(t, dir, exec.CheckpointID)
+	edit := ConfirmRequest{ExecutionID: exec.ID, Action: "decide", Decisions: []types.ToolDecision{
+		{ToolCallID: "call-1", Action: types.DecisionEdit, Arguments: `{"location":"Rome"}`},
+	}}
+	if code := ts.do(t, "POST", "/api/confirm", edit, nil); code != http.StatusInternalServerError {
+		t.Fatalf("confirm with a failing save: %d", code)
+	}
+	entries, err := ts.audit.Read(AuditFilter{ExecutionID: exec.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != types.DecisionEdit || entries[0].Error == "" {
+		t.Fatalf("audit entries %+v, want the edit with the save error", entries)
+	}
+	snap, _ := ts.execManager.Snapshot(exec.ID)
+	if _, pending := snap.State.PendingToolCalls(); snap.Status != "interrupted" || len(pending) != 1 || pending[0].Function.Arguments != `{"location":"Paris"}` {
+		t.Fatalf("execution %s with pending calls %+v after a failed save", snap.Status, pending)
+	}
+
+	unblock()
+	if code := ts.do(t, "POST", "/api/confirm", edit, nil); code != http.StatusOK {
+		t.Fatalf("confirm: %d", code)
+	}
+	entries, err = ts.audit.Read(AuditFilter{ExecutionID: exec.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Action != types.DecisionEdit || entries[1].EditedArguments != `{"location":"Rome"}` || entries[1].Error != "" {
+		t.Fatalf("audit entries %+v, want the saved edit last", entries)
+	}
+}
+
+func TestLogsAcrossResume(t *testing.T) {
+	wf, _ := testWorkflow("test", bookParis())
+	ts := newTestServer(t, t.TempDir(), wf)
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "interrupted")
+
+	// logs fetches the timeline as "level: message", without durations
+	logs := func() []string {
+		t.Helper()
+		var entries []LogEntry
+		if code := ts.do(t, "GET", "/api/logs/"+exec.ID, nil, &entries); code != http.StatusOK {
+			t.Fatalf("logs: %d", code)
+		}
+		var lines []string
+		for _, e := range entries {
+			msg, _, _ := strings.Cut(e.Message, " in ")
+			if e.Event != nil && e.Event.Phase == types.PhaseCompleted && e.Event.EndedAt < e.Event.StartedAt {
+				t.Errorf("event %d ended before it started", e.Event.Seq)
+			}
+			lines = append(lines, e.Level+": "+msg)
+		}
+		return lines
+	}
+	started := "info: Execution " + exec.ID + " started"
+	want := []string{started, "info: #1 ChatTemplate completed", "info: #2 ChatModel completed", "warn: Execution interrupted at ToolsNode"}
+	if got := logs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("interrupted timeline %q, want %q", got, want)
+	}
+
+	if code := ts.do(t, "POST", "/api/confirm", ConfirmRequest{ExecutionID: exec.ID, Action: "confirm"}, nil); code != http.StatusOK {
+		t.Fatalf("confirm: %d", code)
+	}
+	if code := ts.do(t, "POST", "/api/execute/"+exec.ID+"/resume", nil, nil); code != http.StatusOK {
+		t.Fatalf("resume: %d", code)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "completed")
+
+	// The resumed run continues the timeline without repeating it
+	want = []string{started, "info: #1 ChatTemplate completed", "info: #2 ChatModel completed",
+		"info: #3 ToolsNode completed", "info: #4 ChatModel completed", "info: Execution completed"}
+	if got := logs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("completed timeline %q, want %q", got, want)
+	}
+}
+
+func TestEventLogEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		ev    types.ExecutionEvent
+		level string
+		msg   string
+	}{
+		{"running", types.ExecutionEvent{Seq: 1, Node: "ToolsNode", Phase: types.PhaseRunning, StartedAt: 1}, "info", "#1 ToolsNode running"},
+		{"interrupted", types.ExecutionEvent{Seq: 2, Node: "ToolsNode", Phase: types.PhaseInterrupted, StartedAt: 1, EndedAt: 3, Duration: 2}, "warn", "#2 ToolsNode interrupted in 2ns"},
+		{"failed", types.ExecutionEvent{Seq: 3, Node: "ToolsNode", Phase: types.PhaseFailed, StartedAt: 1, EndedAt: 3, Duration: 2, Error: "boom"}, "error", "#3 ToolsNode failed in 2ns: boom"},
+	}
+	for _, tt := range tests {
+		if e := eventLogEntry(&tt.ev); e.Level != tt.level || e.Message != tt.msg || e.Event != &tt.ev {
+			t.Errorf("%s: entry = %+v, want %s %q", tt.name, e, tt.level, tt.msg)
+		}
+	}
+}
@@ -2,43 +2,136 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/cloudwego/eino/compose"
-	"github.com/cloudwego/eino/schema"
+	"eino_testing/hitl/pkg/auth"
+	"eino_testing/hitl/pkg/checkpoint"
+	"eino_testing/hitl/pkg/graph"
+	"eino_testing/hitl/pkg/interaction"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
 )
 
 // Server represents the web server
 type Server struct {
 	engine      *gin.Engine
+	httpServer  *http.Server
 	hub         *WSHub
 	execManager *ExecutionManager
-	baseDir     string
-	distDir     string
-	port        int
+	store       *checkpoint.Store
+	stopSweeper func()
+	workflows   *WorkflowRegistry
+	approver    interaction.Approver
+	// approvalTimeout bounds each call of the approver, none when zero
+	approvalTimeout time.Duration
+	// authenticator is nil when authentication is disabled
+	authenticator  auth.Authenticator
+	allowedOrigins []string
+	upgrader       websocket.Upgrader
+	audit          *AuditLog
+	// historyWindow bounds the conversation carried into a session's next turn
+	historyWindow   graph.HistoryWindow
+	stream          bool
+	shutdownTimeout time.Duration
+	baseDir         string
+	distDir         string
+	port            int
 }
 
 // Config holds server configuration
 type Config struct {
-	Port        int
-	BaseDir     string
-	DistDir     string
-	EnableCORS  bool
+	Port       int
+	BaseDir    string
+	DistDir    string
+	EnableCORS bool
+	// Store selects the checkpoint backend; an empty Type means files under BaseDir
+	Store checkpoint.BackendConfig
+	// Codecs compresses and encrypts checkpoint data at rest; empty fields fall
+	// back to HITL_COMPRESSION, HITL_MAX_DECODED_SIZE and HITL_ENCRYPTION_KEYS
+	Codecs checkpoint.CodecConfig
+	// Retention is applied by the background sweeper every SweepInterval
+	// (disabled when zero) and by the admin sweep endpoint
+	Retention     checkpoint.RetentionPolicy
+	SweepInterval time.Duration
+	// VerifyOnStart runs an integrity check of the store before serving;
+	// empty falls back to HITL_VERIFY_ON_START (report, repair or quarantine)
+	VerifyOnStart checkpoint.VerifyMode
+	// GraphFile is a YAML or JSON graph definition (see graph.Definition) built
+	// from the server's component registry instead of the default booking
+	// graph; empty falls back to HITL_GRAPH_FILE
+	GraphFile string
+	// Workflows are served next to the built-in booking, game, math and
+	// multi_agent workflows
+	Workflows []*Workflow
+	// Workers run executions; up to QueueSize more wait with status
+	// "queued", and further executions are refused with 503. Each run of an
+	// execution, up to its next interrupt, fails after ExecutionTimeout
+	// (no limit when zero). HITL_WORKERS, HITL_QUEUE_SIZE and
+	// HITL_EXECUTION_TIMEOUT override them.
+	Workers          int
+	QueueSize        int
+	ExecutionTimeout time.Duration
+	// ShutdownTimeout bounds the graceful shutdown on SIGINT or SIGTERM, in
+	// which running executions are checkpointed; HITL_SHUTDOWN_TIMEOUT
+	// overrides it
+	ShutdownTimeout time.Duration
+	// Stream runs executions with the graph's Stream, relaying chat model
+	// tokens and tool call deltas over the WebSocket as they arrive.
+	// Requests may override it; HITL_STREAM=true also enables it.
+	Stream bool
+	// Approver decides pending tool calls as soon as an execution is
+	// interrupted; the execution resumes when every call is decided, and
+	// waits for a human in the UI otherwise. Nil falls back to the policy
+	// file in HITL_APPROVAL_POLICY and the URL in HITL_APPROVAL_WEBHOOK
+	// (asked for the calls the policy leaves to a human).
+	Approver interaction.Approver
+	// ApprovalTimeout bounds each call of the Approver (no limit when zero);
+	// the calls it was asked about then wait for a human.
+	// HITL_APPROVAL_TIMEOUT overrides it.
+	ApprovalTimeout time.Duration
+	// History bounds the conversation a session carries into its next turn.
+	// A zero MaxMessages falls back to HITL_HISTORY_MAX_MESSAGES, and
+	// HITL_HISTORY_SUMMARIZE=true summarizes the dropped messages with the
+	// chat model when Summarize is nil.
+	History graph.HistoryWindow
+	// Authenticator checks the API key or token of every API and WebSocket
+	// request and assigns its role; nil falls back to HITL_AUTH (see
+	// auth.FromEnv). Without one, authentication is disabled and every
+	// request acts as an admin.
+	Authenticator auth.Authenticator
+	// AllowedOrigins are the origins allowed by CORS and for WebSockets next
+	// to the server's own; nil falls back to the comma-separated
+	// HITL_CORS_ORIGINS, and to every origin when authentication is disabled
+	AllowedOrigins []string
+	// AuditLog is the file every tool call decision is appended to; empty
+	// falls back to HITL_AUDIT_LOG, then to audit.jsonl in BaseDir
+	AuditLog string
 }
 
 // DefaultConfig returns default server configuration
 func DefaultConfig() Config {
 	return Config{
-		Port:       8080,
-		BaseDir:    "./checkpoints_data",
-		DistDir:    "./ui/dist",
-		EnableCORS: true,
+		Port:            8080,
+		BaseDir:         "./checkpoints_data",
+		DistDir:         "./ui/dist",
+		EnableCORS:      true,
+		Workers:         4,
+		QueueSize:       64,
+		ShutdownTimeout: 30 * time.Second,
+		ApprovalTimeout: time.Minute,
 	}
 }
 
@@ -54,6 +147,92 @@ func NewServer(cfg Config) (*Server, error) {
 		return nil, fmt.Errorf("create base directory: %w", err)
 	}
 
+	// Load graph definition
+	if cfg.GraphFile == "" {
+		cfg.GraphFile = os.Getenv("HITL_GRAPH_FILE")
+	}
+	var graphDef *graph.Definition
+	if cfg.GraphFile != "" {
+		def, err := graph.LoadDefinition(cfg.GraphFile)
+		if err != nil {
+			return nil, err
+		}
+		graphDef = def
+		log.Printf("[Server] Using graph %q from %s", def.Info().Name, cfg.GraphFile)
+	}
+
+	if !cfg.Stream {
+		cfg.Stream, _ = strconv.ParseBool(os.Getenv("HITL_STREAM"))
+	}
+
+	if cfg.Approver == nil {
+		approver, err := newApprover()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Approver = approver
+	}
+	if v, err := time.ParseDuration(os.Getenv("HITL_APPROVAL_TIMEOUT")); err == nil {
+		cfg.ApprovalTimeout = v
+	}
+
+	if cfg.History.MaxMessages == 0 {
+		cfg.History.MaxMessages, _ = strconv.Atoi(os.Getenv("HITL_HISTORY_MAX_MESSAGES"))
+	}
+	if summarize, _ := strconv.ParseBool(os.Getenv("HITL_HISTORY_SUMMARIZE")); summarize && cfg.History.Summarize == nil {
+		cfg.History.Summarize = graph.ModelSummarizer(newChatModel(context.Background(), nil))
+	}
+
+	// Register workflows
+	workflows := NewWorkflowRegistry()
+	builtin := []*Workflow{bookingWorkflow(graphDef), gameWorkflow(), mathWorkflow(), multiAgentWorkflow()}
+	for _, wf := range append(builtin, cfg.Workflows...) {
+		if err := workflows.Register(wf); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set up authentication
+	if cfg.Authenticator == nil {
+		authenticator, err := auth.FromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("configure authentication: %w", err)
+		}
+		cfg.Authenticator = authenticator
+	}
+	if cfg.Authenticator == nil {
+		log.Printf("[Server] Authentication disabled, every request acts as admin; set HITL_AUTH to enable it")
+	}
+	if cfg.AllowedOrigins == nil {
+		for _, origin := range strings.Split(os.Getenv("HITL_CORS_ORIGINS"), ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+			}
+		}
+	}
+	if len(cfg.AllowedOrigins) == 0 && cfg.Authenticator == nil {
+		cfg.AllowedOrigins = []string{"*"}
+	}
+
+	// Open the audit log
+	if cfg.AuditLog == "" {
+		cfg.AuditLog = os.Getenv("HITL_AUDIT_LOG")
+	}
+	if cfg.AuditLog == "" {
+		cfg.AuditLog = filepath.Join(cfg.BaseDir, "audit.jsonl")
+	}
+	audit, err := OpenAuditLog(cfg.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Server] Audit log: %s", cfg.AuditLog)
+
+	// Open checkpoint store
+	store, err := newStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create checkpoint store: %w", err)
+	}
+
 	// Create Gin engine
 	if cfg.EnableCORS {
 		gin.SetMode(gin.DebugMode)
@@ -63,17 +242,17 @@ func NewServer(cfg Config) (*Server, error) {
 
 	engine := gin.New()
 	engine.Use(gin.Recovery())
+	engine.Use(takeQueryToken)
 	engine.Use(gin.Logger())
 
-	// Setup CORS
-	if cfg.EnableCORS {
+	// Setup CORS; credentials travel in headers, not cookies
+	if cfg.EnableCORS && len(cfg.AllowedOrigins) > 0 {
 		engine.Use(cors.New(cors.Config{
-			AllowOrigins:     []string{"*"},
-			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-			ExposeHeaders:    []string{"Content-Length"},
-			AllowCredentials: true,
-			MaxAge:           12 * time.Hour,
+			AllowOrigins:  cfg.AllowedOrigins,
+			AllowMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowHeaders:  []string{"Origin", "Content-Type", "Authorization", "X-API-Key"},
+			ExposeHeaders: []string{"Content-Length", "X-Total-Count"},
+			MaxAge:        12 * time.Hour,
 		}))
 	}
 
@@ -81,15 +260,80 @@ func NewServer(cfg Config) (*Server, error) {
 	hub := NewWSHub()
 	hub.Run()
 
-	execManager := NewExecutionManager()
+	execManager := NewExecutionManager(store)
 
 	server := &Server{
-		engine:      engine,
-		hub:         hub,
-		execManager: execManager,
-		baseDir:     cfg.BaseDir,
-		distDir:     cfg.DistDir,
-		port:        cfg.Port,
+		engine:          engine,
+		hub:             hub,
+		execManager:     execManager,
+		store:           store,
+		workflows:       workflows,
+		approver:        cfg.Approver,
+		approvalTimeout: cfg.ApprovalTimeout,
+		historyWindow:   cfg.History,
+		authenticator:   cfg.Authenticator,
+		allowedOrigins:  cfg.AllowedOrigins,
+		audit:           audit,
+		stream:          cfg.Stream,
+		shutdownTimeout: cfg.ShutdownTimeout,
+		baseDir:         cfg.BaseDir,
+		distDir:         cfg.DistDir,
+		port:            cfg.Port,
+	}
+
+	server.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     server.checkOrigin,
+	}
+
+	if server.approver != nil {
+		execManager.SetInterruptHandler(server.autoDecide)
+	}
+
+	// Check checkpoint integrity
+	if cfg.VerifyOnStart == "" {
+		cfg.VerifyOnStart = checkpoint.VerifyMode(os.Getenv("HITL_VERIFY_ON_START"))
+	}
+	if cfg.VerifyOnStart != "" {
+		report, err := store.Verify(context.Background(), cfg.VerifyOnStart)
+		if err != nil {
+			return nil, fmt.Errorf("verify checkpoints: %w", err)
+		}
+		for _, issue := range report.Issues {
+			log.Printf("[Server] Checkpoint %s %s: %s %s %s", issue.CheckpointID, issue.Kind, issue.Problem, issue.Detail, issue.Action)
+		}
+		log.Printf("[Server] Verified %d checkpoints, %d issues", report.Checked, len(report.Issues))
+	}
+
+	// Restore the executions of earlier runs of the server
+	restored, err := execManager.Restore(context.Background(), server.newRunner)
+	if err != nil {
+		return nil, fmt.Errorf("restore executions: %w", err)
+	}
+	if restored > 0 {
+		log.Printf("[Server] Restored %d executions", restored)
+	}
+
+	// Start the worker pool and run the executions left queued
+	applyExecutionEnv(&cfg)
+	execManager.SetTimeout(cfg.ExecutionTimeout)
+	if cfg.Workers > 0 {
+		execManager.StartWorkers(cfg.Workers, cfg.QueueSize)
+		log.Printf("[Server] %d workers, queue of %d", cfg.Workers, cfg.QueueSize)
+	}
+	server.requeueExecutions()
+
+	// Apply checkpoint retention
+	applyRetentionEnv(&cfg)
+	retention := cfg.Retention
+	if retention.IsInterrupted == nil {
+		retention.IsInterrupted = server.isCheckpointInterrupted
+	}
+	store.SetRetentionPolicy(retention)
+	if cfg.SweepInterval > 0 {
+		server.stopSweeper = store.StartSweeper(cfg.SweepInterval)
+		log.Printf("[Server] Checkpoint sweeper running every %s", cfg.SweepInterval)
 	}
 
 	// Setup routes
@@ -98,28 +342,57 @@ func NewServer(cfg Config) (*Server, error) {
 	return server, nil
 }
 
-// setupRoutes configures all server routes
+// setupRoutes configures all server routes. Viewers may read, approvers may
+// also run executions and decide their tool calls, and admins may also
+// change checkpoints and read the audit log.
 func (s *Server) setupRoutes() {
-	api := s.engine.Group("/api")
+	api := s.engine.Group("/api", s.authenticate)
+	viewer := api.Group("", requireRole(auth.RoleViewer))
+	approver := api.Group("", requireRole(auth.RoleApprover))
+	admin := api.Group("", requireRole(auth.RoleAdmin))
 	{
+		viewer.GET("/me", s.HandleMe)
+
 		// Execution routes
-		api.POST("/execute", s.HandleExecute)
-		api.POST("/execute/:id/resume", s.HandleResume)
-		api.GET("/executions", s.HandleListExecutions)
-		api.GET("/executions/:id", s.HandleGetExecution)
-		api.GET("/state/:id", s.HandleGetState)
-		api.GET("/logs/:id", s.HandleLogs)
+		approver.POST("/execute", s.HandleExecute)
+		viewer.GET("/workflows", s.HandleListWorkflows)
+		approver.POST("/workflows/:wf/execute", s.HandleExecuteWorkflow)
+		approver.POST("/execute/:id/resume", s.HandleResume)
+		viewer.GET("/executions", s.HandleListExecutions)
+		viewer.GET("/executions/:id", s.HandleGetExecution)
+		approver.POST("/executions/:id/cancel", s.HandleCancel)
+		viewer.GET("/state/:id", s.HandleGetState)
+		viewer.GET("/logs/:id", s.HandleLogs)
+
+		// Session routes
+		approver.POST("/executions/:id/messages", s.HandleSendMessage)
+		viewer.GET("/sessions/:id", s.HandleGetSession)
 
 		// Tool call confirmation
-		api.POST("/confirm", s.HandleConfirm)
+		approver.POST("/confirm", s.HandleConfirm)
 
 		// Checkpoint routes
-		api.GET("/checkpoints", s.HandleListCheckpoints)
-		api.DELETE("/checkpoints/:id", s.HandleDeleteCheckpoint)
+		viewer.GET("/checkpoints", s.HandleListCheckpoints)
+		admin.DELETE("/checkpoints/:id", s.HandleDeleteCheckpoint)
+		approver.PUT("/checkpoints/:id/labels", s.HandleSetLabels)
+		viewer.GET("/checkpoints/:id/diff", s.HandleDiffCheckpoint)
+		viewer.GET("/checkpoints/:id/export", s.HandleExportCheckpoint)
+		admin.POST("/checkpoints/import", s.HandleImportCheckpoint)
+		viewer.GET("/checkpoints/:id/revisions", s.HandleListRevisions)
+		viewer.GET("/checkpoints/:id/revisions/:rev", s.HandleGetRevision)
+		approver.POST("/checkpoints/:id/revisions/:rev/fork", s.HandleForkRevision)
+		admin.POST("/checkpoints/:id/revisions/:rev/rollback", s.HandleRollbackRevision)
+
+		// Admin routes
+		admin.GET("/admin/retention", s.HandleGetRetention)
+		admin.POST("/admin/sweep", s.HandleSweep)
+		admin.POST("/admin/reencode", s.HandleReencode)
+		admin.POST("/admin/verify", s.HandleVerify)
+		admin.GET("/admin/audit", s.HandleListAudit)
 	}
 
 	// WebSocket route
-	s.engine.GET("/ws/events/:id", s.HandleWebSocket)
+	s.engine.GET("/ws/events/:id", s.authenticate, requireRole(auth.RoleViewer), s.HandleWebSocket)
 
 	// Health check
 	s.engine.GET("/api/health", s.HandleHealth)
@@ -134,29 +407,196 @@ func (s *Server) setupRoutes() {
 	s.engine.NoRoute(s.HandleServeStatic)
 }
 
-// Run starts the server
+// Run starts the server and serves until SIGINT or SIGTERM, then shuts down
+// gracefully within the shutdown timeout
 func (s *Server) Run() error {
 	addr := fmt.Sprintf(":%d", s.port)
 	log.Printf("[Server] Starting HITL web server on %s", addr)
 	log.Printf("[Server] Base directory: %s", s.baseDir)
 	log.Printf("[Server] Static files: %s", s.distDir)
 
-	if err := s.engine.Run(addr); err != nil {
-		return fmt.Errorf("server error: %w", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.httpServer = &http.Server{Addr: addr, Handler: s.engine}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server error: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Printf("[Server] Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// Shutdown stops accepting requests, checkpoints the running executions (see
+// ExecutionManager.Shutdown), disconnects WebSocket clients and stops the
+// checkpoint sweeper
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop http server: %w", err))
+		}
+	}
+	if err := s.execManager.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stop executions: %w", err))
+	}
+	s.hub.Close()
+	if s.stopSweeper != nil {
+		s.stopSweeper()
+	}
+	if err := s.audit.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close audit log: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// requeueExecutions runs the executions left queued by an earlier run of the
+// server; turns of a session that never ran continue its conversation
+func (s *Server) requeueExecutions() {
+	for _, exec := range s.execManager.Queued() {
+		ctx := context.Background()
+		if exec.State == nil {
+			history, err := s.turnHistory(ctx, exec)
+			if err != nil {
+				s.execManager.ErrorExecution(exec.ID, fmt.Sprintf("Failed to prepare the conversation history: %v", err))
+				continue
+			}
+			if len(history) > 0 {
+				ctx = graph.WithHistory(ctx, history)
+			}
+		}
+		if err := s.execManager.RunExecution(ctx, exec, s.hub, s.baseDir); err != nil {
+			s.execManager.ErrorExecution(exec.ID, fmt.Sprintf("Failed to requeue after restart: %v", err))
+			continue
+		}
+		log.Printf("[Server] Requeued execution %s", exec.ID)
+	}
+}
+
+// newStore opens the checkpoint store selected by cfg.Store, falling back to
+// the HITL_STORE_* environment variables when no backend type is configured.
+func newStore(cfg Config) (*checkpoint.Store, error) {
+	storeCfg := cfg.Store
+	if storeCfg.Type == "" {
+		storeCfg = checkpoint.BackendConfigFromEnv()
+	}
+	if storeCfg.Dir == "" {
+		storeCfg.Dir = cfg.BaseDir
+	}
+
+	codecCfg := cfg.Codecs
+	env := checkpoint.CodecConfigFromEnv()
+	if codecCfg.Compression == "" {
+		codecCfg.Compression = env.Compression
+	}
+	if codecCfg.MaxDecodedSize == 0 {
+		codecCfg.MaxDecodedSize = env.MaxDecodedSize
+	}
+	if codecCfg.Keys == "" {
+		codecCfg.Keys = env.Keys
+	}
+
+	store, err := checkpoint.OpenStore(storeCfg, codecCfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Server] Checkpoint backend: %s", backendName(storeCfg.Type))
+	if cb, ok := store.Backend().(*checkpoint.CodecBackend); ok {
+		log.Printf("[Server] Checkpoint codecs: %s", strings.Join(cb.Names(), ", "))
+	}
+
+	return store, nil
+}
+
+// newApprover builds the approver configured by HITL_APPROVAL_POLICY and
+// HITL_APPROVAL_WEBHOOK, nil when neither is set
+func newApprover() (interaction.Approver, error) {
+	var webhook interaction.Approver
+	if url := os.Getenv("HITL_APPROVAL_WEBHOOK"); url != "" {
+		webhook = &interaction.Webhook{URL: url}
+		log.Printf("[Server] Approval webhook: %s", url)
+	}
+
+	file := os.Getenv("HITL_APPROVAL_POLICY")
+	if file == "" {
+		return webhook, nil
+	}
+	policy, err := interaction.LoadPolicy(file)
+	if err != nil {
+		return nil, err
+	}
+	policy.Fallback = webhook
+	log.Printf("[Server] Approval policy: %d rules from %s", len(policy.Rules), file)
+	return policy, nil
+}
+
+// applyRetentionEnv overrides retention settings with the HITL_RETENTION_*
+// and HITL_SWEEP_INTERVAL environment variables when they are set
+func applyRetentionEnv(cfg *Config) {
+	if v, err := time.ParseDuration(os.Getenv("HITL_RETENTION_MAX_AGE")); err == nil {
+		cfg.Retention.MaxAge = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("HITL_RETENTION_MAX_COUNT")); err == nil {
+		cfg.Retention.MaxCount = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("HITL_RETENTION_MAX_BYTES"), 10, 64); err == nil {
+		cfg.Retention.MaxTotalBytes = v
 	}
+	if v, err := strconv.Atoi(os.Getenv("HITL_RETENTION_MAX_REVISIONS")); err == nil {
+		cfg.Retention.MaxRevisions = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("HITL_RETENTION_KEEP_INTERRUPTED")); err == nil {
+		cfg.Retention.KeepInterrupted = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("HITL_SWEEP_INTERVAL")); err == nil {
+		cfg.SweepInterval = v
+	}
+}
+
+// applyExecutionEnv overrides the worker pool and timeout settings with the
+// HITL_WORKERS, HITL_QUEUE_SIZE, HITL_EXECUTION_TIMEOUT and
+// HITL_SHUTDOWN_TIMEOUT environment variables when they are set
+func applyExecutionEnv(cfg *Config) {
+	if v, err := strconv.Atoi(os.Getenv("HITL_WORKERS")); err == nil {
+		cfg.Workers = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("HITL_QUEUE_SIZE")); err == nil {
+		cfg.QueueSize = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("HITL_EXECUTION_TIMEOUT")); err == nil {
+		cfg.ExecutionTimeout = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("HITL_SHUTDOWN_TIMEOUT")); err == nil {
+		cfg.ShutdownTimeout = v
+	}
+}
 
-	return nil
+// isCheckpointInterrupted reports whether a checkpoint still waits for a human,
+// either through a known interrupted execution or a pending overlay
+func (s *Server) isCheckpointInterrupted(ctx context.Context, checkpointID string) bool {
+	if exec, ok := s.execManager.FindByCheckpoint(checkpointID); ok && exec.Status == "interrupted" {
+		return true
+	}
+	return s.store.HasPendingState(ctx, checkpointID)
 }
 
-// composeGraph creates the execution graph
-func (s *Server) composeGraph(ctx context.Context) (compose.Runnable[map[string]any, *schema.Message], error) {
-	return composeGraph[map[string]any, *schema.Message](
-		ctx,
-		newChatTemplate(ctx),
-		newChatModel(ctx),
-		newToolsNode(ctx),
-		newCheckPointStore(ctx, s.baseDir),
-	)
+func backendName(t string) string {
+	if t == "" {
+		return checkpoint.BackendFile
+	}
+	return t
 }
 
 // RunServer is the main entry point for the web server
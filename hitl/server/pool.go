@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned by RunExecution when every worker is busy and
+	// the queue is full
+	ErrQueueFull = errors.New("execution queue is full")
+	// ErrShuttingDown is returned by RunExecution once Shutdown has been called
+	ErrShuttingDown = errors.New("server is shutting down")
+	// ErrExecutionNotFound is returned for unknown execution IDs
+	ErrExecutionNotFound = errors.New("execution not found")
+	// ErrNotCancellable is returned by Cancel for executions that are over
+	ErrNotCancellable = errors.New("execution cannot be cancelled")
+	// ErrNotInterrupted is returned by Resume and Decide for executions not
+	// waiting for a human, e.g. because another request resumed them first
+	ErrNotInterrupted = errors.New("execution is not interrupted")
+	// ErrSessionBusy is returned by CreateExecution while another execution
+	// of the session has not finished
+	ErrSessionBusy = errors.New("session is busy")
+
+	// Causes of the cancellation of a run's context
+	errCancelled = errors.New("execution cancelled")
+	errTimeout   = errors.New("execution timed out")
+	errShutdown  = errors.New("server shut down")
+)
+
+// job is a queued run of an execution
+type job struct {
+	ctx     context.Context
+	exec    *Execution
+	hub     *WSHub
+	baseDir string
+}
+
+// SetTimeout bounds every run of an execution, from its start or resume to
+// its next interrupt or its end; zero means no timeout. Runs over time fail.
+func (em *ExecutionManager) SetTimeout(d time.Duration) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.timeout = d
+}
+
+// StartWorkers runs executions on n workers, with up to queueSize more
+// waiting in a queue. Without workers every execution runs right away.
+func (em *ExecutionManager) StartWorkers(n, queueSize int) {
+	em.mu.Lock()
+	em.queue = make(chan *job, queueSize)
+	em.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		em.workers.Add(1)
+		go em.work()
+	}
+}
+
+// work runs queued executions until Shutdown
+func (em *ExecutionManager) work() {
+	defer em.workers.Done()
+	for {
+		select {
+		case <-em.drain:
+			return
+		case j := <-em.queue:
+			select {
+			case <-em.drain:
+				// Stays queued for the next start of the server
+				return
+			default:
+			}
+			em.run(j.ctx, j.exec, j.hub, j.baseDir)
+		}
+	}
+}
+
+// Queued returns the queued executions, oldest first
+func (em *ExecutionManager) Queued() []*Execution {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	var queued []*Execution
+	for _, exec := range em.executions {
+		if exec.Status == "queued" {
+			queued = append(queued, exec)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].CreatedAt.Before(queued[j].CreatedAt)
+	})
+	return queued
+}
+
+// Cancel cancels an execution. A running execution is stopped and marked
+// "cancelled" once its run returns; queued and interrupted executions are
+// marked at once. It returns whether the execution was running.
+func (em *ExecutionManager) Cancel(id string) (bool, error) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	exec, ok := em.executions[id]
+	if !ok {
+		return false, ErrExecutionNotFound
+	}
+
+	switch exec.Status {
+	case "running":
+		if exec.CancelFunc != nil {
+			exec.CancelFunc(errCancelled)
+			return true, nil
+		}
+	case "queued", "interrupted":
+	default:
+		return false, ErrNotCancellable
+	}
+
+	exec.Status = "cancelled"
+	exec.UpdatedAt = time.Now()
+	em.persist(exec)
+	return false, nil
+}
+
+// Shutdown stops the worker pool. Running executions stop at their next chat
+// model or tools node and are interrupted there, with a checkpoint to resume
+// from after a restart (see graph.WithDrain); queued executions stay queued.
+// The contexts of interrupt handlers are cancelled. Runs still going when ctx
+// is done are cancelled, which Restore turns into an interrupt at their last
+// checkpoint.
+func (em *ExecutionManager) Shutdown(ctx context.Context) error {
+	em.mu.Lock()
+	if !em.draining {
+		em.draining = true
+		close(em.drain)
+		em.cancel(errShutdown)
+	}
+	em.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		em.workers.Wait()
+		em.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	em.mu.Lock()
+	for _, exec := range em.executions {
+		if exec.CancelFunc != nil {
+			log.Printf("[Execution %s] Cancelled by shutdown", exec.ID)
+			exec.CancelFunc(errShutdown)
+		}
+	}
+	em.mu.Unlock()
+	return ctx.Err()
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"strings"
+
+	"eino_testing/hitl/pkg/graph"
+	"github.com/cloudwego/eino/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleSendMessage posts a follow-up user message to a completed execution:
+// a new execution of the same session continues its conversation
+func (s *Server) HandleSendMessage(c *gin.Context) {
+	var req MessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIError{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, APIError{Error: "content is required"})
+		return
+	}
+
+	exec, ok := s.execManager.Snapshot(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIError{Error: "Execution not found"})
+		return
+	}
+	if exec.Status != "completed" || exec.State == nil {
+		c.JSON(http.StatusBadRequest, APIError{
+			Error: fmt.Sprintf("Cannot continue execution in status: %s", exec.Status),
+		})
+		return
+	}
+	if !s.checkSessionIdle(c, exec.SessionID) {
+		return
+	}
+
+	history, ok := s.windowHistory(c, exec.State.MessageHistory)
+	if !ok {
+		return
+	}
+
+	input := maps.Clone(exec.Input)
+	if input == nil {
+		input = map[string]any{}
+	}
+	input[graph.UserMessageKey] = req.Content
+
+	stream := exec.Stream
+	if req.Stream != nil {
+		stream = *req.Stream
+	}
+
+	wf, ok := s.workflow(exec.WorkflowID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIError{
+			Error: fmt.Sprintf("Workflow %s of the execution not found", exec.WorkflowID),
+		})
+		return
+	}
+
+	s.startExecution(c, wf, exec.SessionID, input, history, stream)
+}
+
+// HandleGetSession returns the executions of a session and its conversation
+func (s *Server) HandleGetSession(c *gin.Context) {
+	id := c.Param("id")
+
+	executions := s.execManager.ListSession(id)
+	if len(executions) == 0 {
+		c.JSON(http.StatusNotFound, APIError{Error: "Session not found"})
+		return
+	}
+
+	resp := SessionResponse{ID: id, Executions: executions, MessageHistory: []MessageResponse{}}
+	for i := len(executions) - 1; i >= 0; i-- {
+		if st := executions[i].State; st != nil {
+			for _, msg := range st.MessageHistory {
+				resp.MessageHistory = append(resp.MessageHistory, messageToResponse(msg))
+			}
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// sessionHistory returns the conversation a new turn of a session of the
+// workflow workflowID continues: the windowed history of its last completed
+// execution, none for a new session. It answers the request and returns false
+// when the session cannot take a new turn, e.g. when it runs another workflow.
+func (s *Server) sessionHistory(c *gin.Context, sessionID, workflowID string) ([]*schema.Message, bool) {
+	if !s.checkSessionIdle(c, sessionID) {
+		return nil, false
+	}
+
+	executions := s.execManager.ListSession(sessionID)
+	for _, exec := range executions {
+		if wf, ok := s.workflow(exec.WorkflowID); !ok || wf.ID != workflowID {
+			c.JSON(http.StatusConflict, APIError{
+				Error: fmt.Sprintf("Session %s runs workflow %s", sessionID, exec.WorkflowID),
+				Code:  "session_workflow",
+			})
+			return nil, false
+		}
+	}
+	for i := len(executions) - 1; i >= 0; i-- {
+		if exec := executions[i]; exec.Status == "completed" && exec.State != nil {
+			return s.windowHistory(c, exec.State.MessageHistory)
+		}
+	}
+	return nil, true
+}
+
+// turnHistory returns the conversation a turn of a session continues: the
+// windowed history of the last execution of the session completed before it
+func (s *Server) turnHistory(ctx context.Context, exec *Execution) ([]*schema.Message, error) {
+	if exec.SessionID == "" {
+		return nil, nil
+	}
+	executions := s.execManager.ListSession(exec.SessionID)
+	for i := len(executions) - 1; i >= 0; i-- {
+		prev := executions[i]
+		if prev.CreatedAt.Before(exec.CreatedAt) && prev.Status == "completed" && prev.State != nil {
+			return s.historyWindow.Apply(ctx, prev.State.MessageHistory)
+		}
+	}
+	return nil, nil
+}
+
+// checkSessionIdle answers the request with 409 and returns false while an
+// execution of the session is queued, running or waiting for a human. It saves
+// preparing a turn that cannot start; CreateExecution checks again when the
+// turn is created.
+func (s *Server) checkSessionIdle(c *gin.Context, sessionID string) bool {
+	if err := s.execManager.CheckSessionIdle(sessionID); err != nil {
+		writeSessionBusy(c, err)
+		return false
+	}
+	return true
+}
+
+// writeSessionBusy answers a request for a new turn of a busy session
+func writeSessionBusy(c *gin.Context, err error) {
+	c.JSON(http.StatusConflict, APIError{
+		Error:   "Session is busy",
+		Code:    "session_busy",
+		Details: err.Error(),
+	})
+}
+
+// windowHistory applies the server's history window
+func (s *Server) windowHistory(c *gin.Context, history []*schema.Message) ([]*schema.Message, bool) {
+	windowed, err := s.historyWindow.Apply(c.Request.Context(), history)
+	if err != nil {
+		log.Printf("[Handler] Failed to window history: %v", err)
+		c.JSON(http.StatusInternalServerError, APIError{
+			Error:   "Failed to prepare the conversation history",
+			Details: err.Error(),
+		})
+		return nil, false
+	}
+	return windowed, true
+}
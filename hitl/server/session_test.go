@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCreateExecutionReservesSession(t *testing.T) {
+	em := NewExecutionManager(nil)
+	first, err := em.CreateExecution(context.Background(), nil, "booking", "cp-1", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	em.CompleteExecution(first.ID, "done", nil)
+
+	// Concurrent follow-ups of the same session: exactly one starts
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var started []*Execution
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exec, err := em.CreateExecution(context.Background(), nil, "booking", "cp", first.SessionID, nil, false)
+			if err != nil {
+				if !errors.Is(err, ErrSessionBusy) {
+					t.Errorf("CreateExecution = %v, want ErrSessionBusy", err)
+				}
+				return
+			}
+			mu.Lock()
+			started = append(started, exec)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(started) != 1 {
+		t.Fatalf("%d turns started, want 1", len(started))
+	}
+	if err := em.CheckSessionIdle(first.SessionID); !errors.Is(err, ErrSessionBusy) {
+		t.Fatalf("CheckSessionIdle = %v, want ErrSessionBusy", err)
+	}
+
+	// Other sessions are not held up
+	if _, err := em.CreateExecution(context.Background(), nil, "booking", "cp-2", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting for a human holds the session too; finishing releases it
+	turn := started[0]
+	em.UpdateExecutionState(turn.ID, "interrupted", "ToolsNode", nil)
+	if _, err := em.CreateExecution(context.Background(), nil, "booking", "cp-3", first.SessionID, nil, false); !errors.Is(err, ErrSessionBusy) {
+		t.Fatalf("CreateExecution while interrupted = %v, want ErrSessionBusy", err)
+	}
+	em.ErrorExecution(turn.ID, "failed")
+	if _, err := em.CreateExecution(context.Background(), nil, "booking", "cp-3", first.SessionID, nil, false); err != nil {
+		t.Fatalf("CreateExecution after the turn failed = %v", err)
+	}
+}
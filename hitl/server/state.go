@@ -1,31 +1,37 @@
 package server
 
 import (
+	"context"
+
 	"eino_testing/hitl/pkg/checkpoint"
 	"eino_testing/hitl/pkg/types"
 )
 
 // savePendingState 保存待处理状态（使用新的checkpoint包）
-func savePendingState(baseDir, checkpointID string, s *types.UniversalState) error {
-	return checkpoint.SavePendingState(baseDir, checkpointID, s)
+func savePendingState(ctx context.Context, store *checkpoint.Store, checkpointID string, s *types.UniversalState) error {
+	return store.SavePendingState(ctx, checkpointID, s)
 }
 
 // loadPendingState 加载待处理状态（使用新的checkpoint包）
-func loadPendingState(baseDir, checkpointID string) (*types.UniversalState, error) {
-	return checkpoint.LoadPendingState(baseDir, checkpointID)
+func loadPendingState(ctx context.Context, store *checkpoint.Store, checkpointID string) (*types.UniversalState, error) {
+	return store.LoadPendingState(ctx, checkpointID)
 }
 
-// updateCheckpointArguments 更新检查点参数（使用新的checkpoint包）
-func updateCheckpointArguments(baseDir, checkpointID, newArgs string) error {
-	return checkpoint.UpdateCheckpointArguments(baseDir, checkpointID, newArgs)
+// applyToolDecisions 按工具调用 ID 将审批决定写入检查点（使用新的checkpoint包）
+// revision 为客户端看到的检查点版本，0 表示不检查
+func applyToolDecisions(ctx context.Context, store *checkpoint.Store, checkpointID string, decisions []types.ToolDecision, revision int) error {
+	if revision <= 0 {
+		revision = checkpoint.AnyRevision
+	}
+	return store.ApplyToolDecisions(ctx, checkpointID, decisions, revision)
 }
 
 // removePendingState 移除待处理状态（使用新的checkpoint包）
-func removePendingState(baseDir, checkpointID string) error {
-	return checkpoint.RemovePendingState(baseDir, checkpointID)
+func removePendingState(ctx context.Context, store *checkpoint.Store, checkpointID string) error {
+	return store.RemovePendingState(ctx, checkpointID)
 }
 
 // hasPendingState 检查是否有待处理状态（使用新的checkpoint包）
-func hasPendingState(baseDir, checkpointID string) bool {
-	return checkpoint.HasPendingState(baseDir, checkpointID)
+func hasPendingState(ctx context.Context, store *checkpoint.Store, checkpointID string) bool {
+	return store.HasPendingState(ctx, checkpointID)
 }
@@ -3,49 +3,128 @@ package server
 import (
 	"time"
 
-	"github.com/cloudwego/eino/schema"
+	"eino_testing/hitl/pkg/auth"
+	"eino_testing/hitl/pkg/checkpoint"
 	"eino_testing/hitl/pkg/types"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
 )
 
-// ExecuteRequest is the input parameters for new execution
+// ExecuteRequest is the input parameters for new execution of the default
+// booking workflow; see WorkflowExecuteRequest for the other workflows
 type ExecuteRequest struct {
 	Name     string `json:"name"`
 	Location string `json:"location"`
+	// Stream overrides the server's streaming default for this execution
+	Stream *bool `json:"stream,omitempty"`
+	// SessionID makes the execution the next turn of a session, continuing the
+	// conversation of its last completed execution; a new ID starts a session
+	SessionID string `json:"session_id,omitempty"`
 }
 
-// ConfirmRequest is the tool call confirmation payload
+// WorkflowExecuteRequest is the input of a new execution of a workflow
+type WorkflowExecuteRequest struct {
+	// Input must match the workflow's input schema
+	Input map[string]any `json:"input"`
+	// Stream overrides the server's streaming default for this execution
+	Stream *bool `json:"stream,omitempty"`
+	// SessionID makes the execution the next turn of a session of the same
+	// workflow; a new ID starts a session
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// WorkflowResponse describes a workflow the server can run
+type WorkflowResponse struct {
+	ID          string               `json:"id"`
+	Description string               `json:"description"`
+	InputSchema *openapi3.Schema     `json:"input_schema,omitempty"`
+	Tools       []ToolResponse       `json:"tools"`
+	Graph       checkpoint.GraphInfo `json:"graph"`
+}
+
+// ToolResponse describes a tool a workflow's chat model may call
+type ToolResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// MeResponse is the principal of a request
+type MeResponse struct {
+	Subject     string    `json:"sub"`
+	Role        auth.Role `json:"role"`
+	AuthEnabled bool      `json:"auth_enabled"`
+}
+
+// MessageRequest is a follow-up user message to a completed execution
+type MessageRequest struct {
+	Content string `json:"content"`
+	// Stream overrides the server's streaming default for the next turn
+	Stream *bool `json:"stream,omitempty"`
+}
+
+// SessionResponse describes a session: its executions, oldest first, and the
+// conversation of the latest one
+type SessionResponse struct {
+	ID             string            `json:"id"`
+	Executions     []*Execution      `json:"executions"`
+	MessageHistory []MessageResponse `json:"message_history"`
+}
+
+// ConfirmRequest is the tool call confirmation payload. "decide" applies a
+// decision per pending tool call; "confirm" runs every pending call as
+// proposed and "reject" replaces the arguments of one call with NewArgs.
 type ConfirmRequest struct {
 	ExecutionID string `json:"execution_id"`
-	Action      string `json:"action"` // "confirm" or "reject"
+	Action      string `json:"action"` // "confirm", "reject" or "decide"
 	NewArgs     string `json:"new_args,omitempty"`
+	// ToolCallID is the call "reject" edits, optional when only one is pending
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Decisions are applied by "decide"; pending calls without one run as proposed
+	Decisions []types.ToolDecision `json:"decisions,omitempty"`
+	// Revision is the checkpoint revision the client last saw; when set, the
+	// edit fails with 409 if the checkpoint has been written since
+	Revision int `json:"revision,omitempty"`
 }
 
 // StateResponse is the UniversalState API representation
 type StateResponse struct {
-	ExecutionID       string            `json:"execution_id"`
-	Status            string            `json:"status"` // "running", "interrupted", "completed", "error"
-	MessageHistory    []MessageResponse `json:"message_history"`
-	Context           map[string]any    `json:"context"`
-	NodeExecutionLog  map[string]any    `json:"node_execution_log"`
-	SavedAt           int64             `json:"saved_at"`
-	CurrentNode       string            `json:"current_node"`
-	PendingToolCalls  []ToolCallResponse `json:"pending_tool_calls,omitempty"`
-	Result            string            `json:"result,omitempty"`
-	Error             string            `json:"error,omitempty"`
+	ExecutionID      string                 `json:"execution_id"`
+	Status           string                 `json:"status"` // "running", "interrupted", "completed", "error"
+	MessageHistory   []MessageResponse      `json:"message_history"`
+	Context          map[string]any         `json:"context"`
+	NodeExecutionLog []types.ExecutionEvent `json:"node_execution_log"`
+	SavedAt          int64                  `json:"saved_at"`
+	CurrentNode      string                 `json:"current_node"`
+	Revision         int                    `json:"revision,omitempty"` // checkpoint revision, for ConfirmRequest.Revision
+	PendingToolCalls []ToolCallResponse     `json:"pending_tool_calls,omitempty"`
+	Result           string                 `json:"result,omitempty"`
+	Error            string                 `json:"error,omitempty"`
+}
+
+// LogEntry is an entry of the execution timeline; entries for node runs
+// carry the execution event
+type LogEntry struct {
+	Timestamp string                `json:"timestamp"`
+	Message   string                `json:"message"`
+	Level     string                `json:"level"` // "info", "warn", "error"
+	Event     *types.ExecutionEvent `json:"event,omitempty"`
 }
 
 // MessageResponse is the API representation of a message
 type MessageResponse struct {
-	Role      string            `json:"role"`
-	Content   string            `json:"content"`
-	ToolCalls []ToolCallResponse `json:"tool_calls,omitempty"`
+	Role       string             `json:"role"`
+	Content    string             `json:"content"`
+	ToolCalls  []ToolCallResponse `json:"tool_calls,omitempty"`
+	ToolCallID string             `json:"tool_call_id,omitempty"` // the call a tool message answers
 }
 
 // ToolCallResponse is the API representation of a tool call
 type ToolCallResponse struct {
-	ID   string            `json:"id"`
-	Name string            `json:"name"`
-	Args string            `json:"args"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Args string `json:"args"`
+	// Question is set for ask_human calls, answered with an "answer" decision
+	Question *types.Question `json:"question,omitempty"`
 }
 
 // CheckpointSummary is the checkpoint metadata
@@ -55,21 +134,41 @@ type CheckpointSummary struct {
 	Size      int64     `json:"size"`
 }
 
+// ForkRequest is the payload for forking a checkpoint revision
+type ForkRequest struct {
+	NewID string `json:"new_id,omitempty"`
+}
+
+// ForkResponse describes a forked checkpoint and the execution created to replay it
+type ForkResponse struct {
+	CheckpointID string               `json:"checkpoint_id"`
+	Revision     *checkpoint.Revision `json:"revision"`
+	Execution    *Execution           `json:"execution"`
+}
+
+// ImportResponse describes an imported checkpoint bundle and the execution
+// created to resume it
+type ImportResponse struct {
+	CheckpointID string              `json:"checkpoint_id"`
+	Manifest     checkpoint.Manifest `json:"manifest"`
+	Execution    *Execution          `json:"execution"`
+}
+
 // ExecutionInfo contains information about a running execution
 type ExecutionInfo struct {
-	ID           string              `json:"id"`
-	Status       string              `json:"status"`
-	CreatedAt    time.Time           `json:"created_at"`
-	UpdatedAt    time.Time           `json:"updated_at"`
-	CheckpointID string              `json:"checkpoint_id"`
-	Input        map[string]any      `json:"input"`
+	ID           string         `json:"id"`
+	Status       string         `json:"status"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	CheckpointID string         `json:"checkpoint_id"`
+	Input        map[string]any `json:"input"`
 }
 
 // WebSocketEvent represents a real-time event sent to clients
 type WebSocketEvent struct {
-	Type      string        `json:"type"` // "state_update", "execution_started", "execution_completed", "error"
-	Data      any           `json:"data"`
-	Timestamp int64         `json:"timestamp"`
+	Type      string `json:"type"` // "state_update", "execution_started", "execution_completed", "error", "token", "tool_call_delta"
+	Data      any    `json:"data"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 // APIError is a standard error response
@@ -83,8 +182,9 @@ type APIError struct {
 
 func messageToResponse(msg *schema.Message) MessageResponse {
 	resp := MessageResponse{
-		Role:    string(msg.Role),
-		Content: msg.Content,
+		Role:       string(msg.Role),
+		Content:    msg.Content,
+		ToolCallID: msg.ToolCallID,
 	}
 
 	for _, tc := range msg.ToolCalls {
@@ -114,19 +214,26 @@ func stateToResponse(execID string, status, currentNode string, state *types.Uni
 		resp.MessageHistory = append(resp.MessageHistory, messageToResponse(msg))
 	}
 
-	// Extract pending tool calls from the last message if it's an assistant message with tool calls
-	if len(state.MessageHistory) > 0 {
-		lastMsg := state.MessageHistory[len(state.MessageHistory)-1]
-		if lastMsg.Role == schema.Assistant && len(lastMsg.ToolCalls) > 0 {
-			for _, tc := range lastMsg.ToolCalls {
-				resp.PendingToolCalls = append(resp.PendingToolCalls, ToolCallResponse{
-					ID:   tc.ID,
-					Name: tc.Function.Name,
-					Args: tc.Function.Arguments,
-				})
-			}
-		}
-	}
+	resp.PendingToolCalls = pendingToolCalls(state)
 
 	return resp
 }
+
+// pendingToolCalls lists the tool calls of the last assistant message that
+// are neither run nor rejected yet
+func pendingToolCalls(state *types.UniversalState) []ToolCallResponse {
+	_, pending := state.PendingToolCalls()
+	var calls []ToolCallResponse
+	for _, tc := range pending {
+		call := ToolCallResponse{
+			ID:   tc.ID,
+			Name: tc.Function.Name,
+			Args: tc.Function.Arguments,
+		}
+		if q, ok := types.QuestionFromToolCall(tc); ok {
+			call.Question = &q
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,112 +13,149 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins in development
-	},
-}
-
-// WSMessage represents a WebSocket message
+// WSMessage represents a WebSocket message. Events of an execution are sent
+// as "update" messages numbered by Seq, from 1, in the order they were
+// broadcast. A client that connects with ?since=<seq> receives the events
+// after seq. When some of them are no longer kept it first receives a "gap"
+// message, and when seq is unknown to the server (e.g. after a restart) a
+// "reset" message; both mean the client should reload the execution's state.
 type WSMessage struct {
 	Type string      `json:"type"`
+	Seq  uint64      `json:"seq,omitempty"`
 	Data interface{} `json:"data"`
 }
 
+// WSGap is the data of a "gap" message: the events From to To were missed
+type WSGap struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
 // WSClient represents a WebSocket client
 type WSClient struct {
 	ID     string
 	Conn   *websocket.Conn
-	Send   chan WSMessage
 	Hub    *WSHub
- ExecID string
+	ExecID string
+
+	// lastSeq is the last event written to the client
+	lastSeq uint64
+	// done is closed when the client goes away or the hub closes
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// stop makes the client's WritePump close the connection
+func (c *WSClient) stop() {
+	c.stopOnce.Do(func() { close(c.done) })
+}
+
+// eventLog holds the last events of an execution and its clients
+type eventLog struct {
+	// events are encoded WSMessages; events[i] has seq first+i
+	events [][]byte
+	first  uint64
+	next   uint64
+	// notify is closed, and replaced, when an event is appended
+	notify  chan struct{}
+	clients map[*WSClient]struct{}
+	updated time.Time
 }
 
-// WSHub manages WebSocket connections
+// WSHub keeps an event log per execution and serves it to WebSocket clients.
+// Broadcast never blocks on clients: each client reads the log at its own
+// pace, and one that falls behind the kept events is told what it missed.
 type WSHub struct {
-	clients    map[string][]*WSClient // execID -> clients
-	register   chan *WSClient
-	unregister chan *WSClient
-	broadcast  chan WSMessage
-	mu         sync.RWMutex
+	mu   sync.Mutex
+	logs map[string]*eventLog
+
+	// maxEvents is the number of events kept per execution
+	maxEvents int
+	// idleTTL is how long the log of an execution without clients is kept
+	// after its last event
+	idleTTL time.Duration
+	// pingInterval is the time between pings, pongWait the time a client has
+	// to answer one, and writeWait the time a write may take before the
+	// client is dropped (it reconnects and replays what it missed)
+	pingInterval time.Duration
+	pongWait     time.Duration
+	writeWait    time.Duration
+
+	quit     chan struct{}
+	quitOnce sync.Once
 }
 
 // NewWSHub creates a new WebSocket hub
 func NewWSHub() *WSHub {
 	return &WSHub{
-		clients:    make(map[string][]*WSClient),
-		register:   make(chan *WSClient),
-		unregister: make(chan *WSClient),
-		broadcast:  make(chan WSMessage),
+		logs:         make(map[string]*eventLog),
+		maxEvents:    1000,
+		idleTTL:      time.Hour,
+		pingInterval: 30 * time.Second,
+		pongWait:     60 * time.Second,
+		writeWait:    10 * time.Second,
+		quit:         make(chan struct{}),
 	}
 }
 
-// Run starts the hub's message processing loop
+// Run starts dropping the event logs of executions idle for idleTTL
 func (h *WSHub) Run() {
 	go func() {
+		ticker := time.NewTicker(h.idleTTL / 4)
+		defer ticker.Stop()
 		for {
 			select {
-			case client := <-h.register:
-				h.mu.Lock()
-				h.clients[client.ExecID] = append(h.clients[client.ExecID], client)
-				h.mu.Unlock()
-				log.Printf("[WSHub] Client %s registered for execution %s", client.ID, client.ExecID)
-
-			case client := <-h.unregister:
-				h.mu.Lock()
-				clients := h.clients[client.ExecID]
-				for i, c := range clients {
-					if c == client {
-						h.clients[client.ExecID] = append(clients[:i], clients[i+1:]...)
-						break
-					}
-				}
-				if len(h.clients[client.ExecID]) == 0 {
-					delete(h.clients, client.ExecID)
-				}
-				h.mu.Unlock()
-				close(client.Send)
-				log.Printf("[WSHub] Client %s unregistered from execution %s", client.ID, client.ExecID)
-
-			case message := <-h.broadcast:
-				// Broadcast to all clients or specific execution
-				h.mu.RLock()
-				var targetClients []*WSClient
-
-				// Try to extract execution_id from message data
-				var execID string
-				if dataMap, ok := message.Data.(map[string]interface{}); ok {
-					if id, ok := dataMap["execution_id"].(string); ok {
-						execID = id
-					}
-				}
-
-				if execID != "" {
-					targetClients = h.clients[execID]
-				} else {
-					// Broadcast to all clients
-					for _, clients := range h.clients {
-						targetClients = append(targetClients, clients...)
-					}
-				}
-				h.mu.RUnlock()
-
-				for _, client := range targetClients {
-					select {
-					case client.Send <- message:
-					default:
-						close(client.Send)
-						h.unregister <- client
-					}
-				}
+			case <-h.quit:
+				return
+			case <-ticker.C:
+				h.dropIdle(time.Now().Add(-h.idleTTL))
 			}
 		}
 	}()
 }
 
-// Broadcast sends a message to all clients subscribed to an execution
+// Close disconnects every client and stops Run
+func (h *WSHub) Close() {
+	h.quitOnce.Do(func() { close(h.quit) })
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, l := range h.logs {
+		for c := range l.clients {
+			c.stop()
+		}
+	}
+}
+
+// dropIdle drops the logs without clients last updated before cutoff
+func (h *WSHub) dropIdle(cutoff time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for execID, l := range h.logs {
+		if len(l.clients) == 0 && l.updated.Before(cutoff) {
+			delete(h.logs, execID)
+		}
+	}
+}
+
+// eventLog returns the log of an execution, creating it; h.mu must be held
+func (h *WSHub) eventLog(execID string) *eventLog {
+	l, ok := h.logs[execID]
+	if !ok {
+		l = &eventLog{
+			first:   1,
+			next:    1,
+			notify:  make(chan struct{}),
+			clients: make(map[*WSClient]struct{}),
+			updated: time.Now(),
+		}
+		h.logs[execID] = l
+	}
+	return l
+}
+
+// Broadcast appends an event to the log of an execution, from which it is
+// sent to the execution's clients
 func (h *WSHub) Broadcast(execID string, event interface{}) {
 	message := WSMessage{
 		Type: "update",
@@ -133,30 +171,112 @@ func (h *WSHub) Broadcast(execID string, event interface{}) {
 			json.Unmarshal(b, &dataMap)
 		}
 		if dataMap != nil {
-			if dataMap["ID"] == nil {
+			if dataMap["execution_id"] == nil {
 				dataMap["execution_id"] = execID
 			}
 			message.Data = map[string]interface{}{
-				"type": evt.Type,
-				"data": dataMap,
+				"type":      evt.Type,
+				"data":      dataMap,
 				"timestamp": evt.Timestamp,
 			}
 		}
 	}
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	l := h.eventLog(execID)
+	message.Seq = l.next
+	// Encoded now, so later changes to the data are not sent
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("[WSHub] Failed to encode event for execution %s: %v", execID, err)
+		return
+	}
+
+	l.events = append(l.events, data)
+	l.next++
+	if drop := len(l.events) - h.maxEvents; drop > 0 {
+		l.events = append([][]byte(nil), l.events[drop:]...)
+		l.first += uint64(drop)
+	}
+	l.updated = time.Now()
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// eventsSince returns the events of an execution after seq, the seq of the
+// last one, and a channel closed when more arrive. A "gap" or "reset"
+// message comes first when the client cannot continue from seq.
+func (h *WSHub) eventsSince(execID string, seq uint64) (events [][]byte, last uint64, notify <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	l := h.eventLog(execID)
+	last = l.next - 1
+	switch {
+	case seq == last:
+		return nil, last, l.notify
+	case seq > last:
+		// The client saw events this log never had, e.g. before a restart
+		reset, _ := json.Marshal(WSMessage{Type: "reset", Data: map[string]uint64{"next_seq": l.next}})
+		events = append(events, reset)
+		seq = l.first - 1
+	case seq+1 < l.first:
+		gap, _ := json.Marshal(WSMessage{Type: "gap", Data: WSGap{From: seq + 1, To: l.first - 1}})
+		events = append(events, gap)
+		seq = l.first - 1
+	}
+	return append(events, l.events[seq+1-l.first:]...), last, l.notify
+}
+
+// register adds a client to the log of its execution
+func (h *WSHub) register(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	select {
-	case h.broadcast <- message:
+	case <-h.quit:
+		c.stop()
+		return
 	default:
-		log.Printf("[WSHub] Broadcast channel full, dropping message")
 	}
+	h.eventLog(c.ExecID).clients[c] = struct{}{}
+	log.Printf("[WSHub] Client %s registered for execution %s", c.ID, c.ExecID)
+}
+
+// unregister removes a client from the log of its execution
+func (h *WSHub) unregister(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if l, ok := h.logs[c.ExecID]; ok {
+		delete(l.clients, c)
+	}
+	log.Printf("[WSHub] Client %s unregistered from execution %s", c.ID, c.ExecID)
+}
+
+// clientCount returns the number of clients of an execution
+func (h *WSHub) clientCount(execID string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if l, ok := h.logs[execID]; ok {
+		return len(l.clients)
+	}
+	return 0
 }
 
-// ReadPump pumps messages from the WebSocket connection to the hub
+// ReadPump reads from the WebSocket connection until it fails, answering
+// pings and extending the read deadline on every pong
 func (c *WSClient) ReadPump() {
-	defer func() {
-		c.Hub.unregister <- c
-		c.Conn.Close()
-	}()
+	defer c.stop()
+
+	c.Conn.SetReadLimit(4096)
+	c.Conn.SetReadDeadline(time.Now().Add(c.Hub.pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(c.Hub.pongWait))
+	})
 
 	for {
 		_, message, err := c.Conn.ReadMessage()
@@ -164,7 +284,7 @@ func (c *WSClient) ReadPump() {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("[WSClient %s] WebSocket error: %v", c.ID, err)
 			}
-			break
+			return
 		}
 
 		// Handle incoming messages if needed
@@ -172,29 +292,46 @@ func (c *WSClient) ReadPump() {
 	}
 }
 
-// WritePump pumps messages from the hub to the WebSocket connection
+// WritePump writes the events of the client's execution to the WebSocket
+// connection as they arrive, and pings the client, until the client goes away
 func (c *WSClient) WritePump() {
-	defer c.Conn.Close()
+	ticker := time.NewTicker(c.Hub.pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Hub.unregister(c)
+		c.Conn.Close()
+	}()
 
 	for {
-		select {
-		case message, ok := <-c.Send:
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+		events, last, notify := c.Hub.eventsSince(c.ExecID, c.lastSeq)
+		for _, data := range events {
+			c.Conn.SetWriteDeadline(time.Now().Add(c.Hub.writeWait))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("[WSClient %s] Write error: %v", c.ID, err)
 				return
 			}
+		}
+		c.lastSeq = last
 
-			// Set write deadline (10 seconds)
-			// c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.Conn.WriteJSON(message); err != nil {
-				log.Printf("[WSClient %s] Write error: %v", c.ID, err)
+		select {
+		case <-notify:
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(c.Hub.writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-c.done:
+			c.Conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(c.Hub.writeWait))
+			return
 		}
 	}
 }
 
-// HandleWebSocket handles WebSocket connections
+// HandleWebSocket handles WebSocket connections. The since query parameter
+// is the last event seq the client received; without it, the client receives
+// every event kept for the execution.
 func (s *Server) HandleWebSocket(c *gin.Context) {
 	execID := c.Param("id")
 	if execID == "" {
@@ -202,21 +339,31 @@ func (s *Server) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	var since uint64
+	if v := c.Query("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, APIError{Error: "Invalid since", Details: err.Error()})
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("[WS] Failed to upgrade connection: %v", err)
 		return
 	}
 
 	client := &WSClient{
-		ID:     generateClientID(),
-		Conn:   conn,
-		Send:   make(chan WSMessage, 256),
-		Hub:    s.hub,
-		ExecID: execID,
+		ID:      generateClientID(),
+		Conn:    conn,
+		Hub:     s.hub,
+		ExecID:  execID,
+		lastSeq: since,
+		done:    make(chan struct{}),
 	}
 
-	client.Hub.register <- client
+	client.Hub.register(client)
 
 	go client.ReadPump()
 	go client.WritePump()
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// newTestHub serves hub on /ws/events/:id of a test server
+func newTestHub(t *testing.T, hub *WSHub) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	s := &Server{hub: hub}
+	s.upgrader = websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	engine := gin.New()
+	engine.GET("/ws/events/:id", s.HandleWebSocket)
+
+	srv := httptest.NewServer(engine)
+	t.Cleanup(func() {
+		hub.Close()
+		srv.Close()
+	})
+	return srv
+}
+
+// dial connects to the events of execID, after since when it is not empty
+func dial(t *testing.T, srv *httptest.Server, execID, since string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/events/" + execID
+	if since != "" {
+		url += "?since=" + since
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// testMessage is a WSMessage as a client decodes it
+type testMessage struct {
+	Type string          `json:"type"`
+	Seq  uint64          `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) testMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg testMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+// readSeqs reads n update messages and returns their seqs
+func readSeqs(t *testing.T, conn *websocket.Conn, n int) []uint64 {
+	t.Helper()
+	seqs := make([]uint64, 0, n)
+	for len(seqs) < n {
+		msg := readMessage(t, conn)
+		if msg.Type != "update" {
+			t.Fatalf("got %s message, want update", msg.Type)
+		}
+		seqs = append(seqs, msg.Seq)
+	}
+	return seqs
+}
+
+func broadcastN(hub *WSHub, execID string, n int) {
+	for i := 0; i < n; i++ {
+		hub.Broadcast(execID, WebSocketEvent{Type: "token", Data: map[string]any{"n": i}})
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func wantSeqs(t *testing.T, got []uint64, from, to uint64) {
+	t.Helper()
+	var want []uint64
+	for seq := from; seq <= to; seq++ {
+		want = append(want, seq)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got seqs %v, want %v", got, want)
+	}
+}
+
+func TestWSHubReplaysEarlierEventsToLateClients(t *testing.T) {
+	hub := NewWSHub()
+	srv := newTestHub(t, hub)
+
+	hub.Broadcast("run-1", WebSocketEvent{Type: "execution_started", Data: map[string]any{"id": "run-1"}})
+	broadcastN(hub, "run-1", 2)
+	broadcastN(hub, "run-2", 1)
+
+	conn := dial(t, srv, "run-1", "")
+	msg := readMessage(t, conn)
+	var event struct {
+		Type string         `json:"type"`
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Seq != 1 || event.Type != "execution_started" || event.Data["execution_id"] != "run-1" {
+		t.Fatalf("first message = seq %d %s %v, want seq 1 execution_started of run-1", msg.Seq, event.Type, event.Data)
+	}
+	wantSeqs(t, readSeqs(t, conn, 2), 2, 3)
+}
+
+func TestWSHubResumesAfterLastSeq(t *testing.T) {
+	hub := NewWSHub()
+	srv := newTestHub(t, hub)
+	broadcastN(hub, "run-1", 4)
+
+	conn := dial(t, srv, "run-1", "2")
+	wantSeqs(t, readSeqs(t, conn, 2), 3, 4)
+
+	broadcastN(hub, "run-1", 1)
+	wantSeqs(t, readSeqs(t, conn, 1), 5, 5)
+}
+
+func TestWSHubDeliversConcurrentEventsInOrder(t *testing.T) {
+	hub := NewWSHub()
+	srv := newTestHub(t, hub)
+	broadcastN(hub, "run-1", 10)
+
+	conns := []*websocket.Conn{dial(t, srv, "run-1", ""), dial(t, srv, "run-1", "5")}
+	waitFor(t, "clients", func() bool { return hub.clientCount("run-1") == 2 })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			broadcastN(hub, "run-1", 50)
+		}()
+	}
+	wg.Wait()
+
+	wantSeqs(t, readSeqs(t, conns[0], 210), 1, 210)
+	wantSeqs(t, readSeqs(t, conns[1], 205), 6, 210)
+}
+
+func TestWSHubReportsGapWhenEventsWereDropped(t *testing.T) {
+	hub := NewWSHub()
+	hub.maxEvents = 3
+	srv := newTestHub(t, hub)
+	broadcastN(hub, "run-1", 5)
+
+	conn := dial(t, srv, "run-1", "")
+	msg := readMessage(t, conn)
+	var gap WSGap
+	if err := json.Unmarshal(msg.Data, &gap); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "gap" || gap != (WSGap{From: 1, To: 2}) {
+		t.Fatalf("got %s %+v, want gap from 1 to 2", msg.Type, gap)
+	}
+	wantSeqs(t, readSeqs(t, conn, 3), 3, 5)
+}
+
+func TestWSHubResetsClientsAheadOfTheLog(t *testing.T) {
+	hub := NewWSHub()
+	srv := newTestHub(t, hub)
+	broadcastN(hub, "run-1", 2)
+
+	// e.g. a client of the server before it restarted
+	conn := dial(t, srv, "run-1", "40")
+	if msg := readMessage(t, conn); msg.Type != "reset" {
+		t.Fatalf("got %s message, want reset", msg.Type)
+	}
+	wantSeqs(t, readSeqs(t, conn, 2), 1, 2)
+}
+
+func TestWSHubSlowClientDoesNotBlockBroadcast(t *testing.T) {
+	hub := NewWSHub()
+	hub.maxEvents = 100
+	srv := newTestHub(t, hub)
+
+	// The client reads nothing until every event is broadcast
+	conn := dial(t, srv, "run-1", "")
+	waitFor(t, "client", func() bool { return hub.clientCount("run-1") == 1 })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broadcastN(hub, "run-1", 5000)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast blocked on a slow client")
+	}
+
+	// It receives what it had read ahead, then learns what it missed, and
+	// ends with the last event
+	var last uint64
+	for last != 5000 {
+		msg := readMessage(t, conn)
+		switch msg.Type {
+		case "update":
+			if msg.Seq <= last {
+				t.Fatalf("seq %d after %d", msg.Seq, last)
+			}
+			if last != 0 && msg.Seq != last+1 {
+				t.Fatalf("seq %d after %d without a gap", msg.Seq, last)
+			}
+			last = msg.Seq
+		case "gap":
+			var gap WSGap
+			json.Unmarshal(msg.Data, &gap)
+			if gap.From != last+1 {
+				t.Fatalf("gap from %d after seq %d", gap.From, last)
+			}
+			last = gap.To
+		default:
+			t.Fatalf("unexpected %s message", msg.Type)
+		}
+	}
+}
+
+func TestWSHubPingsClients(t *testing.T) {
+	hub := NewWSHub()
+	hub.pingInterval = 20 * time.Millisecond
+	srv := newTestHub(t, hub)
+
+	conn := dial(t, srv, "run-1", "")
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-pings:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d pings, want 3", i)
+		}
+	}
+	if n := hub.clientCount("run-1"); n != 1 {
+		t.Fatalf("got %d clients, want the answering client to stay", n)
+	}
+}
+
+func TestWSHubDropsClientsThatStopAnswering(t *testing.T) {
+	hub := NewWSHub()
+	hub.pingInterval = 20 * time.Millisecond
+	hub.pongWait = 100 * time.Millisecond
+	srv := newTestHub(t, hub)
+
+	// Pings are only answered while reading, which this client never does
+	dial(t, srv, "run-1", "")
+	waitFor(t, "client", func() bool { return hub.clientCount("run-1") == 1 })
+	waitFor(t, "client to be dropped", func() bool { return hub.clientCount("run-1") == 0 })
+}
+
+func TestWSHubCloseDisconnectsClients(t *testing.T) {
+	hub := NewWSHub()
+	srv := newTestHub(t, hub)
+
+	conn := dial(t, srv, "run-1", "")
+	waitFor(t, "client", func() bool { return hub.clientCount("run-1") == 1 })
+	hub.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("got %v, want a normal close", err)
+	}
+}
+
+func TestWSHubRejectsInvalidSince(t *testing.T) {
+	srv := newTestHub(t, NewWSHub())
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/events/run-1?since=abc"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != 400 {
+		t.Fatalf("got %v, want 400", err)
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"eino_testing/hitl/pkg/checkpoint"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultWorkflowID is the workflow run by /api/execute, and by executions
+// recorded before the server had several workflows
+const DefaultWorkflowID = "booking"
+
+// Workflow is a graph the server can run behind the HITL UI
+type Workflow struct {
+	ID          string
+	Description string
+	// InputSchema is the JSON schema the input of an execution must match;
+	// its properties are the variables of the workflow's chat template
+	InputSchema *openapi3.Schema
+	// Tools returns the tools the workflow's chat model may call
+	Tools func(ctx context.Context) ([]tool.BaseTool, error)
+	// Build builds the workflow's graph around tools, saving checkpoints to store
+	Build func(ctx context.Context, tools []tool.BaseTool, store compose.CheckPointStore) (compose.Runnable[map[string]any, *schema.Message], error)
+	// Graph identifies the graph Build returns in checkpoint bundles
+	Graph checkpoint.GraphInfo
+}
+
+// NewRunner builds a runner of the workflow saving checkpoints to store
+func (wf *Workflow) NewRunner(ctx context.Context, store compose.CheckPointStore) (compose.Runnable[map[string]any, *schema.Message], error) {
+	tools, err := wf.Tools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tools of workflow %s: %w", wf.ID, err)
+	}
+	return wf.Build(ctx, tools, store)
+}
+
+// ValidateInput checks input against the workflow's input schema
+func (wf *Workflow) ValidateInput(input map[string]any) error {
+	if wf.InputSchema == nil {
+		return nil
+	}
+	return wf.InputSchema.VisitJSON(input)
+}
+
+// WorkflowRegistry holds the workflows of the server by ID
+type WorkflowRegistry struct {
+	mu        sync.RWMutex
+	workflows map[string]*Workflow
+	order     []string
+}
+
+// NewWorkflowRegistry creates an empty workflow registry
+func NewWorkflowRegistry() *WorkflowRegistry {
+	return &WorkflowRegistry{workflows: make(map[string]*Workflow)}
+}
+
+// Register adds a workflow; IDs must be unique
+func (r *WorkflowRegistry) Register(wf *Workflow) error {
+	if wf.ID == "" || wf.Tools == nil || wf.Build == nil {
+		return fmt.Errorf("workflow %q: ID, Tools and Build are required", wf.ID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.workflows[wf.ID]; ok {
+		return fmt.Errorf("workflow %q already registered", wf.ID)
+	}
+	r.workflows[wf.ID] = wf
+	r.order = append(r.order, wf.ID)
+	return nil
+}
+
+// Get returns the workflow with the given ID
+func (r *WorkflowRegistry) Get(id string) (*Workflow, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wf, ok := r.workflows[id]
+	return wf, ok
+}
+
+// List returns the workflows in registration order
+func (r *WorkflowRegistry) List() []*Workflow {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	workflows := make([]*Workflow, 0, len(r.order))
+	for _, id := range r.order {
+		workflows = append(workflows, r.workflows[id])
+	}
+	return workflows
+}
+
+// ByGraph returns the workflow building the named graph
+func (r *WorkflowRegistry) ByGraph(name string) (*Workflow, bool) {
+	for _, wf := range r.List() {
+		if wf.Graph.Name == name {
+			return wf, true
+		}
+	}
+	return nil, false
+}
+
+// workflow returns the workflow with the given ID, the default one when id is
+// empty
+func (s *Server) workflow(id string) (*Workflow, bool) {
+	if id == "" {
+		id = DefaultWorkflowID
+	}
+	return s.workflows.Get(id)
+}
+
+// newRunner builds a runner of the workflow with the given ID
+func (s *Server) newRunner(ctx context.Context, workflowID string) (compose.Runnable[map[string]any, *schema.Message], error) {
+	wf, ok := s.workflow(workflowID)
+	if !ok {
+		return nil, fmt.Errorf("unknown workflow %q", workflowID)
+	}
+	return wf.NewRunner(ctx, s.store.ToComposeStore())
+}
+
+// HandleListWorkflows lists the workflows the server can run
+func (s *Server) HandleListWorkflows(c *gin.Context) {
+	workflows := s.workflows.List()
+	resp := make([]WorkflowResponse, 0, len(workflows))
+	for _, wf := range workflows {
+		item := WorkflowResponse{
+			ID:          wf.ID,
+			Description: wf.Description,
+			InputSchema: wf.InputSchema,
+			Graph:       wf.Graph,
+			Tools:       []ToolResponse{},
+		}
+
+		tools, err := wf.Tools(c.Request.Context())
+		if err != nil {
+			log.Printf("[Handler] Failed to list tools of workflow %s: %v", wf.ID, err)
+		}
+		for _, t := range tools {
+			info, err := t.Info(c.Request.Context())
+			if err != nil {
+				continue
+			}
+			item.Tools = append(item.Tools, ToolResponse{Name: info.Name, Description: info.Desc})
+		}
+		resp = append(resp, item)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleExecuteWorkflow starts an execution of the workflow :wf with the
+// input of the request, which must match the workflow's input schema
+func (s *Server) HandleExecuteWorkflow(c *gin.Context) {
+	wf, ok := s.workflows.Get(c.Param("wf"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIError{Error: "Workflow not found"})
+		return
+	}
+
+	var req WorkflowExecuteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIError{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+	if req.Input == nil {
+		req.Input = map[string]any{}
+	}
+
+	s.executeWorkflow(c, wf, req.Input, req.SessionID, req.Stream)
+}
+
+// executeWorkflow validates input and starts an execution of wf, the next
+// turn of the session sessionID when it is not empty
+func (s *Server) executeWorkflow(c *gin.Context, wf *Workflow, input map[string]any, sessionID string, streamOverride *bool) {
+	if err := wf.ValidateInput(input); err != nil {
+		c.JSON(http.StatusBadRequest, APIError{
+			Error:   fmt.Sprintf("Invalid input for workflow %s", wf.ID),
+			Code:    "invalid_input",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	stream := s.stream
+	if streamOverride != nil {
+		stream = *streamOverride
+	}
+
+	var history []*schema.Message
+	if sessionID != "" {
+		var ok bool
+		if history, ok = s.sessionHistory(c, sessionID, wf.ID); !ok {
+			return
+		}
+	}
+
+	s.startExecution(c, wf, sessionID, input, history, stream)
+}
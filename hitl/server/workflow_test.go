@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"eino_testing/hitl/pkg/checkpoint"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestWorkflowRegistry(t *testing.T) {
+	r := NewWorkflowRegistry()
+	first, _ := testWorkflow("first")
+	second, _ := testWorkflow("second")
+	for _, wf := range []*Workflow{first, second} {
+		if err := r.Register(wf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invalid := map[string]*Workflow{
+		"no ID":     {Tools: first.Tools, Build: first.Build},
+		"no tools":  {ID: "third", Build: first.Build},
+		"no build":  {ID: "third", Tools: first.Tools},
+		"duplicate": {ID: "first", Tools: first.Tools, Build: first.Build},
+	}
+	for name, wf := range invalid {
+		if err := r.Register(wf); err == nil {
+			t.Errorf("%s: registered", name)
+		}
+	}
+	if wf, ok := r.Get("first"); !ok || wf != first {
+		t.Fatalf("Get(first) = %v, %v", wf, ok)
+	}
+	if _, ok := r.Get("third"); ok {
+		t.Fatal("Get found an invalid workflow")
+	}
+
+	// Registration order, untouched by the failed registrations
+	list := r.List()
+	if len(list) != 2 || list[0] != first || list[1] != second {
+		t.Fatalf("List = %v, want first and second", list)
+	}
+
+	if wf, ok := r.ByGraph("second"); !ok || wf != second {
+		t.Fatalf("ByGraph(second) = %v, %v", wf, ok)
+	}
+	if _, ok := r.ByGraph("unknown"); ok {
+		t.Fatal("ByGraph found an unknown graph")
+	}
+}
+
+func TestWorkflowValidateInput(t *testing.T) {
+	booking := bookingWorkflow(nil)
+	tests := []struct {
+		name  string
+		input map[string]any
+		ok    bool
+	}{
+		{"valid", map[string]any{"name": "Ada", "location": "Paris"}, true},
+		{"missing location", map[string]any{"name": "Ada"}, false},
+		{"empty name", map[string]any{"name": "", "location": "Paris"}, false},
+		{"wrong type", map[string]any{"name": "Ada", "location": 7}, false},
+	}
+	for _, tt := range tests {
+		if err := booking.ValidateInput(tt.input); (err == nil) != tt.ok {
+			t.Errorf("%s: ValidateInput = %v", tt.name, err)
+		}
+	}
+
+	// Without a schema any input goes
+	wf, _ := testWorkflow("test")
+	if err := wf.ValidateInput(map[string]any{"anything": true}); err != nil {
+		t.Fatalf("ValidateInput without a schema = %v", err)
+	}
+}
+
+func TestWorkflowNewRunner(t *testing.T) {
+	ctx := context.Background()
+	store := checkpoint.NewStore(t.TempDir())
+
+	wf, _ := testWorkflow("test")
+	runner, err := wf.NewRunner(ctx, store.ToComposeStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := runner.Invoke(ctx, map[string]any{"name": "Ada"}, compose.WithCheckPointID("cp"))
+	if err != nil || out.Content != "done" {
+		t.Fatalf("Invoke = %v, %v", out, err)
+	}
+
+	// The tools are built before the graph, whose builder sees them
+	failed := errors.New("no tools")
+	broken := &Workflow{
+		ID:    "broken",
+		Tools: func(context.Context) ([]tool.BaseTool, error) { return nil, failed },
+		Build: func(context.Context, []tool.BaseTool, compose.CheckPointStore) (compose.Runnable[map[string]any, *schema.Message], error) {
+			t.Fatal("built without tools")
+			return nil, nil
+		},
+	}
+	if _, err := broken.NewRunner(ctx, store.ToComposeStore()); !errors.Is(err, failed) || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("NewRunner = %v, want the tools' error naming the workflow", err)
+	}
+}
+
+func TestWorkflowRoutes(t *testing.T) {
+	wf, _ := testWorkflow("test", bookParis())
+	ts := newTestServer(t, t.TempDir(), wf)
+
+	var workflows []WorkflowResponse
+	if code := ts.do(t, "GET", "/api/workflows", nil, &workflows); code != http.StatusOK {
+		t.Fatalf("list: %d", code)
+	}
+	var ids []string
+	for _, w := range workflows {
+		ids = append(ids, w.ID)
+	}
+	// Built-in workflows first, then those of the config
+	if got := strings.Join(ids, ","); got != "booking,game,math,multi_agent,test" {
+		t.Fatalf("workflows %s", got)
+	}
+	if last := workflows[len(workflows)-1]; len(last.Tools) != 1 || last.Tools[0].Name != "BookTicket" || last.Graph.Name != "test" {
+		t.Fatalf("test workflow listed as %+v", last)
+	}
+
+	var apiErr APIError
+	if code := ts.do(t, "POST", "/api/workflows/unknown/execute", WorkflowExecuteRequest{}, &apiErr); code != http.StatusNotFound {
+		t.Fatalf("unknown workflow: %d %+v", code, apiErr)
+	}
+	apiErr = APIError{}
+	if code := ts.do(t, "POST", "/api/workflows/booking/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &apiErr); code != http.StatusBadRequest || apiErr.Code != "invalid_input" {
+		t.Fatalf("invalid input: %d %+v", code, apiErr)
+	}
+
+	var exec Execution
+	if code := ts.do(t, "POST", "/api/workflows/test/execute", WorkflowExecuteRequest{Input: map[string]any{"name": "Ada"}}, &exec); code != http.StatusCreated {
+		t.Fatalf("execute: %d", code)
+	}
+	if exec.WorkflowID != "test" {
+		t.Fatalf("execution of workflow %q", exec.WorkflowID)
+	}
+	waitStatus(t, ts.execManager, exec.ID, "interrupted")
+}
@@ -1,14 +1,45 @@
 import {
   ExecuteRequest,
+  WorkflowExecuteRequest,
+  WorkflowInfo,
   ConfirmRequest,
+  ConfirmResponse,
   StateResponse,
   CheckpointSummary,
+  CheckpointQuery,
   ExecutionInfo,
+  LogEntry,
+  MessageRequest,
+  SessionResponse,
+  MeInfo,
+  AuditEntry,
   APIError,
 } from './types';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || '/api';
 
+// TOKEN_KEY is where the API key or token of the user is kept
+const TOKEN_KEY = 'hitl_token';
+
+export function getToken(): string | null {
+  return localStorage.getItem(TOKEN_KEY);
+}
+
+export function setToken(token: string | null): void {
+  if (token) {
+    localStorage.setItem(TOKEN_KEY, token);
+  } else {
+    localStorage.removeItem(TOKEN_KEY);
+  }
+}
+
+// RequestError is a failed API request with its HTTP status
+export class RequestError extends Error {
+  constructor(message: string, public status: number, public code?: string) {
+    super(message);
+  }
+}
+
 class APIClient {
   private baseURL: string;
 
@@ -21,10 +52,12 @@ class APIClient {
     options: RequestInit = {}
   ): Promise<T> {
     const url = `${this.baseURL}${endpoint}`;
+    const token = getToken();
     const response = await fetch(url, {
       ...options,
       headers: {
         'Content-Type': 'application/json',
+        ...(token ? { Authorization: `Bearer ${token}` } : {}),
         ...options.headers,
       },
     });
@@ -33,7 +66,7 @@ class APIClient {
       const error: APIError = await response.json().catch(() => ({
         error: 'Unknown error',
       }));
-      throw new Error(error.error || error.details || 'Request failed');
+      throw new RequestError(error.error || error.details || 'Request failed', response.status, error.code);
     }
 
     return response.json();
@@ -47,18 +80,51 @@ class APIClient {
     });
   }
 
+  // Workflow endpoints
+  async listWorkflows(): Promise<WorkflowInfo[]> {
+    const result = await this.request<WorkflowInfo[]>('/workflows');
+    return Array.isArray(result) ? result : [];
+  }
+
+  async executeWorkflow(workflowId: string, request: WorkflowExecuteRequest): Promise<ExecutionInfo> {
+    return this.request<ExecutionInfo>(`/workflows/${workflowId}/execute`, {
+      method: 'POST',
+      body: JSON.stringify(request),
+    });
+  }
+
   async resumeExecution(executionId: string): Promise<ExecutionInfo> {
     return this.request<ExecutionInfo>(`/execute/${executionId}/resume`, {
       method: 'POST',
     });
   }
 
+  // cancelExecution stops a queued, running or interrupted execution
+  async cancelExecution(executionId: string): Promise<{ status: string }> {
+    return this.request<{ status: string }>(`/executions/${executionId}/cancel`, {
+      method: 'POST',
+    });
+  }
+
+  // sendMessage continues a completed execution with a follow-up message,
+  // returning the execution of the next turn
+  async sendMessage(executionId: string, request: MessageRequest): Promise<ExecutionInfo> {
+    return this.request<ExecutionInfo>(`/executions/${executionId}/messages`, {
+      method: 'POST',
+      body: JSON.stringify(request),
+    });
+  }
+
+  async getSession(sessionId: string): Promise<SessionResponse> {
+    return this.request<SessionResponse>(`/sessions/${sessionId}`);
+  }
+
   async getState(executionId: string): Promise<StateResponse> {
     return this.request<StateResponse>(`/state/${executionId}`);
   }
 
-  async confirm(request: ConfirmRequest): Promise<{ status: string; new_args?: string }> {
-    return this.request<{ status: string; new_args?: string }>('/confirm', {
+  async confirm(request: ConfirmRequest): Promise<ConfirmResponse> {
+    return this.request<ConfirmResponse>('/confirm', {
       method: 'POST',
       body: JSON.stringify(request),
     });
@@ -74,17 +140,33 @@ class APIClient {
     return this.request<ExecutionInfo>(`/executions/${executionId}`);
   }
 
-  async getLogs(executionId: string): Promise<Array<{ timestamp: string; message: string; level: string }>> {
-    return this.request<Array<{ timestamp: string; message: string; level: string }>>(`/logs/${executionId}`);
+  async getLogs(executionId: string): Promise<LogEntry[]> {
+    return this.request<LogEntry[]>(`/logs/${executionId}`);
   }
 
   // Checkpoint endpoints
-  async listCheckpoints(): Promise<CheckpointSummary[]> {
-    const result = await this.request<CheckpointSummary[]>('/checkpoints');
+  async listCheckpoints(query: CheckpointQuery = {}): Promise<CheckpointSummary[]> {
+    const params = new URLSearchParams();
+    for (const [key, value] of Object.entries(query)) {
+      if (Array.isArray(value)) {
+        value.forEach((v) => params.append(key, v));
+      } else if (value !== undefined && value !== '') {
+        params.append(key, String(value));
+      }
+    }
+    const qs = params.toString();
+    const result = await this.request<CheckpointSummary[]>(`/checkpoints${qs ? `?${qs}` : ''}`);
     // Ensure we always return an array
     return Array.isArray(result) ? result : [];
   }
 
+  async setCheckpointLabels(checkpointId: string, labels: Record<string, string>): Promise<CheckpointSummary> {
+    return this.request<CheckpointSummary>(`/checkpoints/${checkpointId}/labels`, {
+      method: 'PUT',
+      body: JSON.stringify(labels),
+    });
+  }
+
   async deleteCheckpoint(checkpointId: string): Promise<{ status: string }> {
     return this.request<{ status: string }>(`/checkpoints/${checkpointId}`, {
       method: 'DELETE',
@@ -92,6 +174,17 @@ class APIClient {
   }
 
   // Health check
+  // getMe returns the user of the token in use; it fails with status 401
+  // when authentication is enabled and the token is missing or invalid
+  async getMe(): Promise<MeInfo> {
+    return this.request<MeInfo>('/me');
+  }
+
+  async listAudit(executionId?: string): Promise<AuditEntry[]> {
+    const query = executionId ? `?execution_id=${encodeURIComponent(executionId)}` : '';
+    return this.request<AuditEntry[]>(`/admin/audit${query}`);
+  }
+
   async healthCheck(): Promise<{ status: string; time: number }> {
     return this.request<{ status: string; time: number }>('/health');
   }
@@ -3,32 +3,123 @@
 export interface ExecuteRequest {
   name: string;
   location: string;
+  stream?: boolean;
+  // session_id makes the execution the next turn of a session
+  session_id?: string;
+}
+
+// WorkflowExecuteRequest starts an execution of a workflow; input must match
+// the workflow's input_schema
+export interface WorkflowExecuteRequest {
+  input: Record<string, unknown>;
+  stream?: boolean;
+  session_id?: string;
+}
+
+// WorkflowInfo describes a workflow the server can run
+export interface WorkflowInfo {
+  id: string;
+  description: string;
+  input_schema?: {
+    type?: string;
+    properties?: Record<string, { type?: string; description?: string }>;
+    required?: string[];
+  };
+  tools: { name: string; description: string }[];
+  graph: { name: string; nodes: string[] };
+}
+
+// MessageRequest is a follow-up user message to a completed execution
+export interface MessageRequest {
+  content: string;
+  stream?: boolean;
+}
+
+export type DecisionAction = 'approve' | 'edit' | 'reject' | 'answer';
+
+// ToolDecision approves, edits, rejects or answers one pending tool call by ID
+export interface ToolDecision {
+  tool_call_id: string;
+  action: DecisionAction;
+  arguments?: string;
+  reason?: string;
+  answer?: string;
+}
+
+// ASK_HUMAN_TOOL is the tool a model calls to ask the user a question; its
+// calls are answered, not approved
+export const ASK_HUMAN_TOOL = 'ask_human';
+
+export interface Question {
+  tool_call_id: string;
+  question: string;
+  options?: string[];
 }
 
 export interface ConfirmRequest {
   execution_id: string;
-  action: 'confirm' | 'reject';
+  action: 'confirm' | 'reject' | 'decide';
   new_args?: string;
+  tool_call_id?: string;
+  decisions?: ToolDecision[];
+  revision?: number;
+}
+
+export interface ConfirmResponse {
+  status: string;
+  new_args?: string;
+  decisions?: ToolDecision[];
+  pending_tool_calls?: ToolCallResponse[];
 }
 
 export interface ToolCallResponse {
   id: string;
   name: string;
   args: string;
+  question?: Question;
 }
 
 export interface MessageResponse {
   role: string;
   content: string;
   tool_calls?: ToolCallResponse[];
+  tool_call_id?: string;
+}
+
+export type ExecutionPhase = 'running' | 'completed' | 'failed' | 'interrupted';
+
+export interface TokenUsage {
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+}
+
+// ExecutionEvent records one run of a graph node
+export interface ExecutionEvent {
+  seq: number;
+  node: string;
+  phase: ExecutionPhase;
+  started_at: number; // unix nanoseconds
+  ended_at?: number;
+  duration_ns?: number;
+  usage?: TokenUsage;
+  tools?: string[];
+  error?: string;
+}
+
+export interface LogEntry {
+  timestamp: string;
+  message: string;
+  level: 'info' | 'warn' | 'error';
+  event?: ExecutionEvent;
 }
 
 export interface StateResponse {
   execution_id: string;
-  status: 'running' | 'interrupted' | 'completed' | 'error';
+  status: 'queued' | 'running' | 'interrupted' | 'completed' | 'error' | 'cancelled';
   message_history: MessageResponse[];
   context: Record<string, unknown>;
-  node_execution_log: Record<string, unknown>;
+  node_execution_log: ExecutionEvent[];
   saved_at: number;
   current_node: string;
   pending_tool_calls?: ToolCallResponse[];
@@ -40,6 +131,31 @@ export interface CheckpointSummary {
   id: string;
   created_at: string;
   size: number;
+  updated_at?: string;
+  revision?: number;
+  graph_name?: string;
+  last_node?: string;
+  interrupted_before?: string[];
+  pending_tools?: string[];
+  message_count?: number;
+  context_keys?: string[];
+  labels?: Record<string, string>;
+  has_pending_state?: boolean;
+}
+
+export interface CheckpointQuery {
+  graph?: string;
+  last_node?: string;
+  interrupted_before?: string;
+  tool?: string;
+  context_key?: string;
+  label?: string[];
+  pending?: boolean;
+  q?: string;
+  sort?: string;
+  order?: 'asc' | 'desc';
+  offset?: number;
+  limit?: number;
 }
 
 export interface ExecutionInfo {
@@ -48,17 +164,73 @@ export interface ExecutionInfo {
   created_at: string;
   updated_at: string;
   checkpoint_id: string;
+  workflow_id?: string;
+  session_id?: string;
   input: Record<string, unknown>;
+  stream?: boolean;
+}
+
+// SessionResponse lists the executions of a session, oldest first, with the
+// conversation of the latest one
+export interface SessionResponse {
+  id: string;
+  executions: ExecutionInfo[];
+  message_history: MessageResponse[];
+}
+
+// StreamEvent is a chunk of chat model output relayed while an execution streams
+export interface StreamEvent {
+  execution_id: string;
+  kind: 'token' | 'tool_call_delta';
+  node: string;
+  content?: string;
+  index?: number;
+  tool_call_id?: string;
+  tool_name?: string;
+  arguments?: string;
 }
 
 export interface WebSocketEvent {
-  type: 'state_update' | 'execution_started' | 'execution_completed' | 'error';
-  data: ExecutionInfo | StateResponse | { error: string };
+  // 'resync' is raised by WebSocketClient when events were missed
+  type: 'state_update' | 'execution_started' | 'execution_completed' | 'error' | 'token' | 'tool_call_delta' | 'resync';
+  data: ExecutionInfo | StateResponse | StreamEvent | { error: string } | WSGap | { next_seq: number };
   timestamp: number;
 }
 
+// WSGap is the range of events a WebSocket client missed
+export interface WSGap {
+  from: number;
+  to: number;
+}
+
 export interface APIError {
   error: string;
   code?: string;
   details?: string;
 }
+
+export type Role = 'viewer' | 'approver' | 'admin';
+
+// MeInfo is the user the API key or token in use authenticates
+export interface MeInfo {
+  sub: string;
+  role: Role;
+  auth_enabled: boolean;
+}
+
+// AuditEntry records a decision on a tool call
+export interface AuditEntry {
+  time: string;
+  actor: string;
+  role?: Role;
+  remote_addr?: string;
+  execution_id: string;
+  checkpoint_id: string;
+  tool_call_id: string;
+  tool_name: string;
+  action: 'approve' | 'edit' | 'reject' | 'answer';
+  arguments: string;
+  edited_arguments?: string;
+  reason?: string;
+  answer?: string;
+}
@@ -1,4 +1,5 @@
 import { WebSocketEvent } from './types';
+import { getToken } from './client';
 
 export type WebSocketEventHandler = (event: WebSocketEvent) => void;
 
@@ -10,6 +11,8 @@ export class WebSocketClient {
   private reconnectDelay = 1000;
   private handlers: Set<WebSocketEventHandler> = new Set();
   private manualClose = false;
+  // Seq of the last event received, from which a reconnect resumes
+  private lastSeq = 0;
 
   constructor(executionId: string) {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
@@ -23,7 +26,17 @@ export class WebSocketClient {
     }
 
     try {
-      this.ws = new WebSocket(this.url);
+      // Browsers cannot set headers on WebSockets, so the token goes in the URL
+      const params = new URLSearchParams();
+      if (this.lastSeq > 0) {
+        params.set('since', String(this.lastSeq));
+      }
+      const token = getToken();
+      if (token) {
+        params.set('access_token', token);
+      }
+      const query = params.toString();
+      this.ws = new WebSocket(query ? `${this.url}?${query}` : this.url);
 
       this.ws.onopen = () => {
         console.log('[WebSocket] Connected');
@@ -33,6 +46,23 @@ export class WebSocketClient {
       this.ws.onmessage = (event) => {
         try {
           const data = JSON.parse(event.data);
+          // The hub wraps events as {type: 'update', seq, data: event}
+          if (data.type === 'update') {
+            if (data.seq) {
+              this.lastSeq = data.seq;
+            }
+            this.notifyHandlers(data.data);
+            return;
+          }
+          // Some events were missed ('gap'), or the server no longer knows the
+          // last seq ('reset'): handlers should reload the execution
+          if (data.type === 'gap' || data.type === 'reset') {
+            if (data.type === 'reset') {
+              this.lastSeq = 0;
+            }
+            this.notifyHandlers({ type: 'resync', data: data.data, timestamp: Date.now() });
+            return;
+          }
           this.notifyHandlers(data);
         } catch (error) {
           console.error('[WebSocket] Failed to parse message:', error);
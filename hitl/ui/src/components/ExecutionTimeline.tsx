@@ -0,0 +1,73 @@
+import { ExecutionEvent, ExecutionPhase } from '../api/types';
+import { Badge, Card, Icons } from './ui';
+import { theme, type Status } from '../theme';
+
+const phaseStatus: Record<ExecutionPhase, Status> = {
+  running: 'info',
+  completed: 'success',
+  failed: 'error',
+  interrupted: 'warning',
+};
+
+// formatDuration renders a duration in nanoseconds
+export function formatDuration(ns: number): string {
+  if (ns < 1e6) return `${(ns / 1e3).toFixed(0)}µs`;
+  if (ns < 1e9) return `${(ns / 1e6).toFixed(1)}ms`;
+  return `${(ns / 1e9).toFixed(2)}s`;
+}
+
+interface ExecutionTimelineProps {
+  events: ExecutionEvent[];
+  // compact hides the node name, for the timeline of a single node
+  compact?: boolean;
+}
+
+export function ExecutionTimeline({ events, compact = false }: ExecutionTimelineProps) {
+  if (!events || events.length === 0) {
+    return (
+      <div className={`text-slate-400 text-center py-8`}>
+        <Icons.Clipboard className="mx-auto mb-2 opacity-30 w-6 h-6" />
+        <p className="text-sm">No execution events</p>
+      </div>
+    );
+  }
+
+  return (
+    <ol className="space-y-2">
+      {events.map((ev) => (
+        <li key={ev.seq}>
+          <Card padding="sm" className="bg-slate-900/50">
+            <div className="flex items-center gap-3">
+              <span className={`text-slate-500 text-xs font-mono w-8`}>#{ev.seq}</span>
+              {!compact && (
+                <span className={`text-white ${theme.fontWeight.medium}`}>{ev.node}</span>
+              )}
+              <Badge status={phaseStatus[ev.phase] || 'neutral'}>{ev.phase}</Badge>
+              <span className={`text-slate-500 text-xs ml-auto font-mono`}>
+                {new Date(ev.started_at / 1e6).toLocaleTimeString()}
+                {ev.ended_at ? ` · ${formatDuration(ev.duration_ns || 0)}` : ''}
+              </span>
+            </div>
+            {(ev.tools?.length || ev.usage) && (
+              <div className={`mt-2 flex flex-wrap gap-4 text-xs text-slate-400`}>
+                {ev.tools && ev.tools.length > 0 && (
+                  <span>
+                    Tools: <span className="text-blue-400">{ev.tools.join(', ')}</span>
+                  </span>
+                )}
+                {ev.usage && (
+                  <span>
+                    Tokens: {ev.usage.total_tokens} ({ev.usage.prompt_tokens} prompt, {ev.usage.completion_tokens} completion)
+                  </span>
+                )}
+              </div>
+            )}
+            {ev.error && (
+              <pre className={`mt-2 text-xs text-red-300 whitespace-pre-wrap font-mono`}>{ev.error}</pre>
+            )}
+          </Card>
+        </li>
+      ))}
+    </ol>
+  );
+}
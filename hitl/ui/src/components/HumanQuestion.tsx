@@ -0,0 +1,73 @@
+import { useState } from 'react';
+import { Question, ToolCallResponse } from '../api/types';
+import { Button, Icons, Input } from './ui';
+import { theme } from '../theme';
+
+// questionOf returns the question of an ask_human call, parsing its arguments
+// when the server did not send it
+export function questionOf(toolCall: ToolCallResponse): Question {
+  if (toolCall.question) return toolCall.question;
+  try {
+    const args = JSON.parse(toolCall.args);
+    if (typeof args.question === 'string' && args.question) {
+      return { tool_call_id: toolCall.id, question: args.question, options: args.options };
+    }
+  } catch {
+    // Shown as is below
+  }
+  return { tool_call_id: toolCall.id, question: toolCall.args };
+}
+
+interface HumanQuestionProps {
+  toolCall: ToolCallResponse;
+  disabled?: boolean;
+  onAnswer: (answer: string) => void;
+  onDecline: () => void;
+}
+
+export function HumanQuestion({ toolCall, disabled = false, onAnswer, onDecline }: HumanQuestionProps) {
+  const [answer, setAnswer] = useState('');
+  const question = questionOf(toolCall);
+
+  const submit = () => {
+    if (answer.trim()) onAnswer(answer.trim());
+  };
+
+  return (
+    <div>
+      <div className="flex items-center gap-2 mb-3">
+        <Icons.Message className="w-4 h-4 text-blue-400" />
+        <h5 className={`text-white ${theme.fontWeight.semibold}`}>The model asks</h5>
+      </div>
+      <p className="text-slate-100 mb-4 whitespace-pre-wrap">{question.question}</p>
+
+      {question.options && question.options.length > 0 && (
+        <div className="flex flex-wrap gap-2 mb-4">
+          {question.options.map((option) => (
+            <Button key={option} variant="secondary" size="sm" disabled={disabled} onClick={() => onAnswer(option)}>
+              {option}
+            </Button>
+          ))}
+        </div>
+      )}
+
+      <div className="flex gap-2 items-start">
+        <div className="flex-1">
+          <Input
+            value={answer}
+            placeholder={question.options?.length ? 'Or type another answer' : 'Your answer'}
+            disabled={disabled}
+            onChange={(e) => setAnswer(e.target.value)}
+            onKeyDown={(e) => e.key === 'Enter' && submit()}
+          />
+        </div>
+        <Button variant="primary" disabled={disabled || !answer.trim()} onClick={submit}>
+          Answer
+        </Button>
+        <Button variant="danger" disabled={disabled} onClick={onDecline}>
+          Decline
+        </Button>
+      </div>
+    </div>
+  );
+}
@@ -1,6 +1,7 @@
 import { useState } from 'react';
 import { StateResponse } from '../api/types';
 import { Card, Icons, StatusBadge } from './ui';
+import { ExecutionTimeline } from './ExecutionTimeline';
 import { theme } from '../theme';
 
 interface StateInspectorProps {
@@ -140,32 +141,12 @@ export function StateInspector({ state }: StateInspectorProps) {
     </div>
   );
 
-  const renderLogs = () => (
-    <div className="space-y-2">
-      {!state.node_execution_log || Object.keys(state.node_execution_log).length === 0 ? (
-        <div className={`text-slate-400 text-center py-8`}>
-          <Icons.Clipboard className="mx-auto mb-2 opacity-30 w-6 h-6" />
-          <p className="text-sm">No execution logs</p>
-        </div>
-      ) : (
-        Object.entries(state.node_execution_log).map(([node, log]) => (
-          <Card key={node} padding="sm" hoverable>
-            <div className="flex items-center justify-between">
-              <span className={`text-white ${theme.fontWeight.medium}`}>{node}</span>
-            </div>
-            <pre className={`mt-3 text-sm text-slate-300 overflow-x-auto font-mono bg-slate-900/50 p-3 rounded border border-slate-700/50`}>
-              {renderJSON(log)}
-            </pre>
-          </Card>
-        ))
-      )}
-    </div>
-  );
+  const renderLogs = () => <ExecutionTimeline events={state.node_execution_log} />;
 
   const tabs: { id: Tab; label: string; count?: number }[] = [
     { id: 'context', label: 'Context' },
     { id: 'messages', label: 'Messages', count: state.message_history?.length || 0 },
-    { id: 'logs', label: 'Node Logs' },
+    { id: 'logs', label: 'Timeline', count: state.node_execution_log?.length || 0 },
   ];
 
   return (
@@ -0,0 +1,66 @@
+import { StreamEvent } from '../api/types';
+import { Card, Icons } from './ui';
+import { theme } from '../theme';
+
+export interface StreamedToolCall {
+  id?: string;
+  name?: string;
+  args: string;
+}
+
+export interface StreamedOutput {
+  node: string;
+  content: string;
+  toolCalls: StreamedToolCall[];
+}
+
+export const emptyStreamedOutput: StreamedOutput = { node: '', content: '', toolCalls: [] };
+
+// appendStreamEvent merges a token or tool call delta into the output so far
+export function appendStreamEvent(out: StreamedOutput, ev: StreamEvent): StreamedOutput {
+  if (ev.kind === 'token') {
+    return { ...out, node: ev.node, content: out.content + (ev.content || '') };
+  }
+  const index = ev.index || 0;
+  const toolCalls = [...out.toolCalls];
+  const prev = toolCalls[index] || { args: '' };
+  toolCalls[index] = {
+    id: prev.id || ev.tool_call_id,
+    name: prev.name || ev.tool_name,
+    args: prev.args + (ev.arguments || ''),
+  };
+  return { ...out, node: ev.node, toolCalls };
+}
+
+interface StreamingOutputProps {
+  output: StreamedOutput;
+}
+
+export function StreamingOutput({ output }: StreamingOutputProps) {
+  if (!output.content && output.toolCalls.length === 0) {
+    return null;
+  }
+
+  return (
+    <Card>
+      <div className="flex items-center gap-3 mb-4">
+        <Icons.Loading className="text-blue-400 w-5 h-5" />
+        <h3 className={`text-white ${theme.fontWeight.semibold}`}>Streaming</h3>
+        <span className={'text-slate-500 text-sm ml-auto'}>{output.node}</span>
+      </div>
+
+      {output.content && (
+        <p className="text-slate-100 whitespace-pre-wrap">{output.content}</p>
+      )}
+
+      {output.toolCalls.map((tc, index) => tc && (
+        <div key={tc.id || index} className="mt-3">
+          <div className={`text-slate-300 text-sm ${theme.fontWeight.medium} mb-1`}>{tc.name || 'tool call'}</div>
+          <pre className="bg-slate-900 text-slate-100 font-mono text-sm p-3 rounded-lg overflow-x-auto border border-slate-700">
+            {tc.args}
+          </pre>
+        </div>
+      ))}
+    </Card>
+  );
+}
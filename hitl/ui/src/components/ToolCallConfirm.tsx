@@ -1,6 +1,7 @@
 import { useState, useEffect } from 'react';
-import { ToolCallResponse } from '../api/types';
+import { ASK_HUMAN_TOOL, ToolCallResponse, ToolDecision } from '../api/types';
 import { apiClient } from '../api/client';
+import { HumanQuestion } from './HumanQuestion';
 
 interface ToolCallConfirmProps {
   executionId: string;
@@ -38,37 +39,44 @@ export function ToolCallConfirm({ executionId, toolCalls, onConfirmed, onRejecte
     setEditingStates(initialStates);
   }, [toolCalls]);
 
-  const handleConfirm = async (index: number) => {
+  const decide = async (decision: ToolDecision) => {
     setIsLoading(true);
     setError(null);
 
     try {
-      const state = editingStates[index];
-      if (state.isEditing && state.editedArgs !== state.originalArgs) {
-        await apiClient.confirm({
-          execution_id: executionId,
-          action: 'reject',
-          new_args: state.editedArgs,
-        });
-      } else {
-        await apiClient.confirm({
-          execution_id: executionId,
-          action: 'confirm',
-        });
-      }
+      await apiClient.confirm({
+        execution_id: executionId,
+        action: 'decide',
+        decisions: [decision],
+      });
 
-      if (state.isEditing && state.editedArgs !== state.originalArgs) {
-        onRejected();
-      } else {
+      if (decision.action === 'approve') {
         onConfirmed();
+      } else {
+        onRejected();
       }
     } catch (err) {
-      setError(err instanceof Error ? err.message : 'Failed to submit confirmation');
+      setError(err instanceof Error ? err.message : 'Failed to submit decision');
     } finally {
       setIsLoading(false);
     }
   };
 
+  const handleConfirm = (index: number) => {
+    const state = editingStates[index];
+    const toolCallId = toolCalls[index].id;
+    if (state.isEditing && state.editedArgs !== state.originalArgs) {
+      return decide({ tool_call_id: toolCallId, action: 'edit', arguments: state.editedArgs });
+    }
+    return decide({ tool_call_id: toolCallId, action: 'approve' });
+  };
+
+  const handleReject = (index: number) => {
+    const reason = window.prompt('Reason for rejecting (sent to the model, optional):');
+    if (reason === null) return;
+    return decide({ tool_call_id: toolCalls[index].id, action: 'reject', reason });
+  };
+
   const startEditing = (index: number) => {
     setEditingStates(prev => ({
       ...prev,
@@ -151,6 +159,19 @@ export function ToolCallConfirm({ executionId, toolCalls, onConfirmed, onRejecte
             const hasChangesMade = hasChanges(index);
             const isCurrentValid = isValid(index);
 
+            if (toolCall.name === ASK_HUMAN_TOOL) {
+              return (
+                <div key={toolCall.id || index} className="bg-gray-700 rounded-lg p-4">
+                  <HumanQuestion
+                    toolCall={toolCall}
+                    disabled={isLoading}
+                    onAnswer={(answer) => decide({ tool_call_id: toolCall.id, action: 'answer', answer })}
+                    onDecline={() => handleReject(index)}
+                  />
+                </div>
+              );
+            }
+
             return (
               <div key={toolCall.id || index} className="bg-gray-700 rounded-lg p-4">
                 <div className="flex items-center justify-between mb-2">
@@ -219,7 +240,7 @@ export function ToolCallConfirm({ executionId, toolCalls, onConfirmed, onRejecte
                         disabled={isLoading}
                         className="px-4 py-2 bg-green-600 text-white rounded hover:bg-green-700 disabled:bg-gray-600 disabled:cursor-not-allowed"
                       >
-                        {isLoading ? 'Confirming...' : 'Confirm'}
+                        {isLoading ? 'Approving...' : 'Approve'}
                       </button>
                       <button
                         onClick={() => startEditing(index)}
@@ -228,6 +249,13 @@ export function ToolCallConfirm({ executionId, toolCalls, onConfirmed, onRejecte
                       >
                         Edit
                       </button>
+                      <button
+                        onClick={() => handleReject(index)}
+                        disabled={isLoading}
+                        className="px-4 py-2 bg-red-600 text-white rounded hover:bg-red-700 disabled:bg-gray-600"
+                      >
+                        Reject
+                      </button>
                     </>
                   )}
                 </div>
@@ -1,14 +1,16 @@
-import { useState, useEffect, useCallback } from 'react';
-import { MessageResponse, ToolCallResponse } from '../api/types';
+import { useState, useEffect, useCallback, useMemo } from 'react';
+import { ASK_HUMAN_TOOL, ExecutionEvent, MessageResponse, ToolCallResponse, ToolDecision } from '../api/types';
 import { apiClient } from '../api/client';
 import { Card, Button, Icons, NodeStatusIndicator } from './ui';
+import { ExecutionTimeline } from './ExecutionTimeline';
+import { HumanQuestion } from './HumanQuestion';
 import { theme } from '../theme';
 
 interface WorkflowGraphProps {
   currentNode: string;
   status: string;
   messageHistory: MessageResponse[];
-  nodeExecutionLog: Record<string, unknown>;
+  nodeExecutionLog: ExecutionEvent[];
   executionId?: string;
   result?: string;
   error?: string;
@@ -59,16 +61,24 @@ export function WorkflowGraph({
 
   const isEditing = externalIsEditing || internalIsEditing;
 
-  const getToolCalls = (): ToolCallResponse[] => {
+  // Pending calls are those of the last assistant message that no tool
+  // message answers yet; rejected calls are answered when rejected
+  const toolCalls = useMemo((): ToolCallResponse[] => {
     if (!messageHistory || messageHistory.length === 0) return [];
-    const lastMsg = messageHistory[messageHistory.length - 1];
-    if (lastMsg.role === 'assistant' && lastMsg.tool_calls) {
-      return lastMsg.tool_calls;
+    const answered = new Set<string>();
+    for (let i = messageHistory.length - 1; i >= 0; i--) {
+      const msg = messageHistory[i];
+      if (msg.role === 'tool') {
+        if (msg.tool_call_id) answered.add(msg.tool_call_id);
+        continue;
+      }
+      if (msg.role === 'assistant' && msg.tool_calls) {
+        return msg.tool_calls.filter(tc => !answered.has(tc.id));
+      }
+      return [];
     }
     return [];
-  };
-
-  const toolCalls = getToolCalls();
+  }, [messageHistory]);
 
   useEffect(() => {
     const initialStates: {
@@ -170,39 +180,14 @@ export function WorkflowGraph({
     return false;
   }, [status, messageHistory, getNodeStatus]);
 
+  const getNodeEvents = (nodeId: string) =>
+    (nodeExecutionLog || []).filter(ev => ev.node === nodeId);
+
   const hasLogs = (nodeId: string) => {
     if (nodeId === 'END') {
       return status === 'completed' && (result !== undefined || error !== undefined);
     }
-    if (!nodeExecutionLog) return false;
-    return Object.keys(nodeExecutionLog).some(key => key.includes(nodeId));
-  };
-
-  const renderJSON = (data: unknown): string => {
-    if (data === null) return 'null';
-    if (typeof data === 'boolean') return String(data);
-    if (typeof data === 'number') return String(data);
-    if (typeof data === 'string') return `"${data}"`;
-    if (Array.isArray(data)) return `Array(${data.length})`;
-    if (typeof data === 'object') {
-      const obj = data as Record<string, unknown>;
-      return JSON.stringify(obj, null, 2);
-    }
-    return String(data);
-  };
-
-  const getNodeLogs = (nodeId: string) => {
-    const logs: Array<{ key: string; value: unknown }> = [];
-
-    if (!nodeExecutionLog) return logs;
-
-    Object.entries(nodeExecutionLog).forEach(([key, value]) => {
-      if (key.includes(nodeId) || nodeId === 'ChatModel' && key.includes('ChatModel')) {
-        logs.push({ key, value });
-      }
-    });
-
-    return logs;
+    return getNodeEvents(nodeId).length > 0;
   };
 
   const formatJSON = (jsonString: string) => {
@@ -273,31 +258,23 @@ export function WorkflowGraph({
     }));
   }, []);
 
-  const handleConfirm = useCallback(async (index: number) => {
+  const decide = useCallback(async (index: number, decision: ToolDecision) => {
     if (!executionId) return;
 
     setIsLoading(true);
     setNodeError(null);
 
     try {
-      const state = editingStates[index];
-      if (state.isEditing && state.editedArgs !== state.originalArgs) {
-        await apiClient.confirm({
-          execution_id: executionId,
-          action: 'reject',
-          new_args: state.editedArgs,
-        });
-      } else {
-        await apiClient.confirm({
-          execution_id: executionId,
-          action: 'confirm',
-        });
-      }
+      await apiClient.confirm({
+        execution_id: executionId,
+        action: 'decide',
+        decisions: [decision],
+      });
 
-      if (state.isEditing && state.editedArgs !== state.originalArgs) {
-        onToolRejected?.();
-      } else {
+      if (decision.action === 'approve') {
         onToolConfirmed?.();
+      } else {
+        onToolRejected?.();
       }
 
       setEditingStates(prev => ({
@@ -310,11 +287,30 @@ export function WorkflowGraph({
       setInternalIsEditing(false);
       onEditingChange?.(false);
     } catch (err) {
-      setNodeError(err instanceof Error ? err.message : 'Failed to submit confirmation');
+      setNodeError(err instanceof Error ? err.message : 'Failed to submit decision');
     } finally {
       setIsLoading(false);
     }
-  }, [executionId, editingStates, onToolConfirmed, onToolRejected, onEditingChange]);
+  }, [executionId, onToolConfirmed, onToolRejected, onEditingChange]);
+
+  const handleConfirm = useCallback((index: number) => {
+    const state = editingStates[index];
+    const toolCallId = toolCalls[index].id;
+    if (state.isEditing && state.editedArgs !== state.originalArgs) {
+      return decide(index, { tool_call_id: toolCallId, action: 'edit', arguments: state.editedArgs });
+    }
+    return decide(index, { tool_call_id: toolCallId, action: 'approve' });
+  }, [editingStates, toolCalls, decide]);
+
+  const handleReject = useCallback((index: number) => {
+    const reason = window.prompt('Reason for rejecting (sent to the model, optional):');
+    if (reason === null) return;
+    return decide(index, { tool_call_id: toolCalls[index].id, action: 'reject', reason });
+  }, [toolCalls, decide]);
+
+  const handleAnswer = useCallback((index: number, answer: string) => {
+    return decide(index, { tool_call_id: toolCalls[index].id, action: 'answer', answer });
+  }, [toolCalls, decide]);
 
   const renderToolCalls = () => {
     if (toolCalls.length === 0) {
@@ -336,6 +332,19 @@ export function WorkflowGraph({
           const hasChangesMade = hasChanges(index);
           const isCurrentValid = isValid(index);
 
+          if (toolCall.name === ASK_HUMAN_TOOL) {
+            return (
+              <Card key={toolCall.id || index} padding="lg" className="border-blue-700">
+                <HumanQuestion
+                  toolCall={toolCall}
+                  disabled={isLoading || isCompleted}
+                  onAnswer={(answer) => handleAnswer(index, answer)}
+                  onDecline={() => handleReject(index)}
+                />
+              </Card>
+            );
+          }
+
           return (
             <Card key={toolCall.id || index} padding="lg">
               <div className="flex items-center justify-between mb-3">
@@ -413,7 +422,7 @@ export function WorkflowGraph({
                         onClick={() => handleConfirm(index)}
                         disabled={isLoading}
                       >
-                        {isLoading ? 'Confirming...' : 'Confirm'}
+                        {isLoading ? 'Approving...' : 'Approve'}
                       </Button>
                       <Button
                         variant="warning"
@@ -425,6 +434,13 @@ export function WorkflowGraph({
                           Edit
                         </div>
                       </Button>
+                      <Button
+                        variant="danger"
+                        onClick={() => handleReject(index)}
+                        disabled={isLoading}
+                      >
+                        Reject
+                      </Button>
                     </>
                   )}
                 </div>
@@ -471,23 +487,12 @@ export function WorkflowGraph({
       return renderToolCalls();
     }
 
-    const logs = getNodeLogs(nodeId);
-    if (logs.length === 0) {
+    const events = getNodeEvents(nodeId);
+    if (events.length === 0) {
       return <p className={`text-slate-500 text-sm`}>No logs available for this node</p>;
     }
 
-    return (
-      <div className="space-y-2">
-        {logs.map((log, idx) => (
-          <Card key={idx} padding="sm" className="bg-slate-900/50">
-            <div className={`text-slate-400 text-xs mb-2 font-mono`}>{log.key}</div>
-            <pre className={`text-sm text-slate-300 overflow-x-auto font-mono`}>
-              {renderJSON(log.value)}
-            </pre>
-          </Card>
-        ))}
-      </div>
-    );
+    return <ExecutionTimeline events={events} compact />;
   };
 
   const nodeStatus = getNodeStatus();
@@ -10,6 +10,9 @@ export { WorkflowGraph } from './WorkflowGraph';
 export { StateInspector } from './StateInspector';
 export { CheckpointList } from './CheckpointList';
 export { MessageHistory } from './MessageHistory';
+export { StreamingOutput } from './StreamingOutput';
+export { ExecutionTimeline } from './ExecutionTimeline';
+export { HumanQuestion } from './HumanQuestion';
 
 // Theme
 export * from '../theme';
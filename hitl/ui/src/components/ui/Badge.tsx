@@ -25,7 +25,7 @@ export const Badge = ({ status, children, className = '' }: BadgeProps) => {
 
 // Status badge with predefined labels
 export interface StatusBadgeProps {
-  status: 'completed' | 'error' | 'interrupted' | 'pending' | 'running';
+  status: 'completed' | 'error' | 'interrupted' | 'pending' | 'running' | 'queued' | 'cancelled';
   className?: string;
 }
 
@@ -36,6 +36,8 @@ export const StatusBadge = ({ status, className = '' }: StatusBadgeProps) => {
     interrupted: 'warning',
     pending: 'pending',
     running: 'info',
+    queued: 'pending',
+    cancelled: 'error',
   };
 
   return (
@@ -1,11 +1,12 @@
 import { useState, useEffect } from 'react';
-import { ExecutionInfo, StateResponse, WebSocketEvent } from '../api/types';
-import { apiClient } from '../api/client';
+import { ExecutionInfo, MeInfo, StateResponse, StreamEvent, WebSocketEvent, WorkflowInfo } from '../api/types';
+import { apiClient, RequestError, getToken, setToken } from '../api/client';
 import { WebSocketClient } from '../api/websocket';
 import { WorkflowGraph } from '../components/WorkflowGraph';
 import { StateInspector } from '../components/StateInspector';
 import { CheckpointList } from '../components/CheckpointList';
 import { MessageHistory } from '../components/MessageHistory';
+import { StreamingOutput, StreamedOutput, appendStreamEvent, emptyStreamedOutput } from '../components/StreamingOutput';
 import { Button, Card, Input, StatusBadge, Icons } from '../components/ui';
 import { theme } from '../theme';
 
@@ -14,11 +15,50 @@ export function Dashboard() {
   const [selectedExecution, setSelectedExecution] = useState<string | null>(null);
   const [state, setState] = useState<StateResponse | null>(null);
   const [isCreating, setIsCreating] = useState(false);
-  const [name, setName] = useState('Megumin');
-  const [location, setLocation] = useState('Beijing');
+  const [workflows, setWorkflows] = useState<WorkflowInfo[]>([]);
+  const [workflowId, setWorkflowId] = useState('booking');
+  const [inputs, setInputs] = useState<Record<string, string>>({ name: 'Megumin', location: 'Beijing' });
+  const [stream, setStream] = useState(true);
+  const [streamed, setStreamed] = useState<StreamedOutput>(emptyStreamedOutput);
   const [error, setError] = useState<string | null>(null);
+  const [followUp, setFollowUp] = useState('');
+  const [isSending, setIsSending] = useState(false);
   const [isEditing, setIsEditing] = useState(false);
   const [pollInterval, setPollInterval] = useState<ReturnType<typeof setInterval> | null>(null);
+  const [me, setMe] = useState<MeInfo | null>(null);
+  const [signInRequired, setSignInRequired] = useState(false);
+  const [tokenInput, setTokenInput] = useState('');
+
+  // Viewers may watch executions; approvers may also run them and decide tool calls
+  const canApprove = me?.role === 'approver' || me?.role === 'admin';
+
+  const loadMe = async () => {
+    try {
+      setMe(await apiClient.getMe());
+      setSignInRequired(false);
+    } catch (err) {
+      setMe(null);
+      setSignInRequired(err instanceof RequestError && err.status === 401);
+    }
+  };
+
+  const handleSignIn = async () => {
+    if (!tokenInput.trim()) return;
+    setToken(tokenInput.trim());
+    setTokenInput('');
+    setError(null);
+    await loadMe();
+    loadWorkflows();
+    loadExecutions();
+  };
+
+  const handleSignOut = () => {
+    setToken(null);
+    setMe(null);
+    setSignInRequired(true);
+    setExecutions([]);
+    setSelectedExecution(null);
+  };
 
   const loadExecutions = async () => {
     try {
@@ -39,14 +79,32 @@ export function Dashboard() {
     }
   };
 
+  const loadWorkflows = async () => {
+    try {
+      setWorkflows(await apiClient.listWorkflows());
+    } catch (err) {
+      console.error('Failed to load workflows:', err);
+    }
+  };
+
+  // The input fields of the selected workflow, from its input schema
+  const workflow = workflows.find((wf) => wf.id === workflowId);
+  const inputFields = Object.keys(workflow?.input_schema?.properties ?? { name: {}, location: {} });
+  const requiredFields = workflow?.input_schema?.required ?? inputFields;
+  const inputsComplete = requiredFields.every((field) => (inputs[field] ?? '') !== '');
+
   const handleCreateExecution = async () => {
-    if (!name || !location) return;
+    if (!inputsComplete) return;
 
     setIsCreating(true);
     setError(null);
 
     try {
-      const exec = await apiClient.execute({ name, location });
+      const input: Record<string, unknown> = {};
+      inputFields.forEach((field) => {
+        if (inputs[field]) input[field] = inputs[field];
+      });
+      const exec = await apiClient.executeWorkflow(workflowId, { input, stream });
       setSelectedExecution(exec.id);
       loadState(exec.id);
       loadExecutions();
@@ -57,6 +115,25 @@ export function Dashboard() {
     }
   };
 
+  const handleSendMessage = async () => {
+    if (!selectedExecution || !followUp.trim()) return;
+
+    setIsSending(true);
+    setError(null);
+
+    try {
+      const exec = await apiClient.sendMessage(selectedExecution, { content: followUp, stream });
+      setFollowUp('');
+      setSelectedExecution(exec.id);
+      loadState(exec.id);
+      loadExecutions();
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Failed to send message');
+    } finally {
+      setIsSending(false);
+    }
+  };
+
   const handleResume = async () => {
     if (!selectedExecution) return;
 
@@ -69,6 +146,18 @@ export function Dashboard() {
     }
   };
 
+  const handleCancel = async () => {
+    if (!selectedExecution) return;
+
+    try {
+      await apiClient.cancelExecution(selectedExecution);
+      loadExecutions();
+      loadState(selectedExecution);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Failed to cancel execution');
+    }
+  };
+
   const handleEditingChange = (editing: boolean) => {
     setIsEditing(editing);
     if (editing && pollInterval) {
@@ -77,8 +166,12 @@ export function Dashboard() {
     }
   };
 
+  // Listen while the execution can still change; running executions may stream
+  const live = state?.status === 'queued' || state?.status === 'interrupted' || state?.status === 'running';
+
   useEffect(() => {
-    if (selectedExecution && state?.status === 'interrupted' && !isEditing) {
+    if (selectedExecution && live && !isEditing) {
+      setStreamed(emptyStreamedOutput);
       const client = new WebSocketClient(selectedExecution);
       client.connect();
 
@@ -93,7 +186,14 @@ export function Dashboard() {
           }
         }
 
-        if (event.type === 'execution_started' || event.type === 'execution_completed') {
+        if (event.type === 'token' || event.type === 'tool_call_delta') {
+          const ev = event.data as StreamEvent;
+          setStreamed(prev => appendStreamEvent(prev, ev));
+        }
+
+        // Streamed output may be missing events, so it restarts from the state
+        if (event.type === 'execution_started' || event.type === 'execution_completed' || event.type === 'resync') {
+          setStreamed(emptyStreamedOutput);
           loadExecutions();
           loadState(selectedExecution);
         }
@@ -108,7 +208,7 @@ export function Dashboard() {
         client.disconnect();
       };
     }
-  }, [selectedExecution, state?.status, isEditing]);
+  }, [selectedExecution, live, isEditing]);
 
   useEffect(() => {
     if (selectedExecution && !isEditing) {
@@ -125,6 +225,11 @@ export function Dashboard() {
     }
   }, [selectedExecution, isEditing]);
 
+  useEffect(() => {
+    loadMe();
+    loadWorkflows();
+  }, []);
+
   useEffect(() => {
     loadExecutions();
     const interval = setInterval(loadExecutions, 5000);
@@ -160,15 +265,51 @@ export function Dashboard() {
                 <p className={`text-slate-400 text-sm`}>Human-In-The-Loop AI Agent Workflow</p>
               </div>
             </div>
-            {isEditing && (
-              <div className="inline-flex items-center gap-2 px-3 py-1.5 bg-amber-500/10 border border-amber-500/30 rounded-lg">
-                <Icons.Alert className="text-amber-400 w-4 h-4" />
-                <span className="text-amber-400 text-sm font-medium">Editing mode - polling paused</span>
-              </div>
-            )}
+            <div className="flex items-center gap-3">
+              {isEditing && (
+                <div className="inline-flex items-center gap-2 px-3 py-1.5 bg-amber-500/10 border border-amber-500/30 rounded-lg">
+                  <Icons.Alert className="text-amber-400 w-4 h-4" />
+                  <span className="text-amber-400 text-sm font-medium">Editing mode - polling paused</span>
+                </div>
+              )}
+              {me?.auth_enabled && (
+                <div className="flex items-center gap-2 text-sm text-slate-300">
+                  <span>
+                    {me.sub} <span className="text-slate-500">({me.role})</span>
+                  </span>
+                  {getToken() && (
+                    <Button variant="secondary" size="sm" onClick={handleSignOut}>
+                      Sign out
+                    </Button>
+                  )}
+                </div>
+              )}
+            </div>
           </div>
         </header>
 
+        {/* Sign In */}
+        {signInRequired && (
+          <div className="mb-6">
+            <Card padding="md">
+              <div className="flex items-end gap-3">
+                <div className="flex-1">
+                  <Input
+                    label="API key or token"
+                    type="password"
+                    value={tokenInput}
+                    onChange={(e) => setTokenInput(e.target.value)}
+                    placeholder="Sign in to use the dashboard"
+                  />
+                </div>
+                <Button variant="primary" onClick={handleSignIn} disabled={!tokenInput.trim()}>
+                  Sign in
+                </Button>
+              </div>
+            </Card>
+          </div>
+        )}
+
         {/* Error Alert */}
         {error && (
           <div className="mb-6">
@@ -198,25 +339,46 @@ export function Dashboard() {
               <h2 className={`text-xl ${theme.fontWeight.semibold} text-white`}>New Execution</h2>
             </div>
             <div className="space-y-4">
-              <Input
-                label="Name"
-                value={name}
-                onChange={(e) => setName(e.target.value)}
-                placeholder="Enter name"
-                disabled={isEditing}
-              />
-              <Input
-                label="Location"
-                value={location}
-                onChange={(e) => setLocation(e.target.value)}
-                placeholder="Enter location"
-                disabled={isEditing}
-              />
+              <div className="space-y-2">
+                <label className="block text-slate-300 text-sm font-medium">Workflow</label>
+                <select
+                  value={workflowId}
+                  onChange={(e) => setWorkflowId(e.target.value)}
+                  disabled={isEditing}
+                  className="w-full bg-slate-700/50 text-white rounded-lg border border-slate-600 px-4 py-2.5 focus:outline-none focus:border-blue-500"
+                >
+                  {(workflows.length > 0 ? workflows : [{ id: 'booking', description: '' }]).map((wf) => (
+                    <option key={wf.id} value={wf.id}>
+                      {wf.id}
+                    </option>
+                  ))}
+                </select>
+                {workflow?.description && <p className="text-slate-400 text-xs">{workflow.description}</p>}
+              </div>
+              {inputFields.map((field) => (
+                <Input
+                  key={`${workflowId}-${field}`}
+                  label={field.charAt(0).toUpperCase() + field.slice(1).replace(/_/g, ' ')}
+                  value={inputs[field] ?? ''}
+                  onChange={(e) => setInputs({ ...inputs, [field]: e.target.value })}
+                  placeholder={workflow?.input_schema?.properties?.[field]?.description ?? `Enter ${field}`}
+                  disabled={isEditing}
+                />
+              ))}
+              <label className="flex items-center gap-2 text-slate-300 text-sm">
+                <input
+                  type="checkbox"
+                  checked={stream}
+                  onChange={(e) => setStream(e.target.checked)}
+                  disabled={isEditing}
+                />
+                Stream model output
+              </label>
               <Button
                 variant="primary"
                 onClick={handleCreateExecution}
                 loading={isCreating}
-                disabled={!name || !location || isEditing}
+                disabled={!inputsComplete || isEditing || !canApprove}
                 fullWidth
               >
                 {isCreating ? 'Creating...' : 'Start Execution'}
@@ -249,10 +411,12 @@ export function Dashboard() {
                   >
                     <div className="flex items-center justify-between mb-1">
                       <span className={`text-white ${theme.fontWeight.medium} text-sm`}>{exec.id}</span>
-                      <StatusBadge status={exec.status as 'completed' | 'error' | 'interrupted' | 'pending' | 'running'} />
+                      <StatusBadge status={exec.status as 'completed' | 'error' | 'interrupted' | 'pending' | 'running' | 'queued' | 'cancelled'} />
                     </div>
                     <div className={'text-slate-400 text-xs'}>
                       {new Date(exec.created_at).toLocaleString()}
+                      {exec.workflow_id && ` · ${exec.workflow_id}`}
+                      {exec.session_id && exec.session_id !== exec.id && ` · session ${exec.session_id}`}
                     </div>
                   </div>
                 ))
@@ -285,14 +449,24 @@ export function Dashboard() {
                   )}
                 </div>
               </div>
-              {state?.status === 'interrupted' && !isEditing && (
-                <Button variant="success" onClick={handleResume}>
-                  <div className="flex items-center gap-2">
-                    <Icons.Play />
-                    Resume Execution
-                  </div>
-                </Button>
-              )}
+              <div className="flex items-center gap-2">
+                {state?.status === 'interrupted' && !isEditing && canApprove && (
+                  <Button variant="success" onClick={handleResume}>
+                    <div className="flex items-center gap-2">
+                      <Icons.Play />
+                      Resume Execution
+                    </div>
+                  </Button>
+                )}
+                {(state?.status === 'queued' || state?.status === 'running' || state?.status === 'interrupted') && !isEditing && canApprove && (
+                  <Button variant="danger" onClick={handleCancel}>
+                    <div className="flex items-center gap-2">
+                      <Icons.X />
+                      Cancel
+                    </div>
+                  </Button>
+                )}
+              </div>
             </Card>
 
             {!state ? (
@@ -318,6 +492,31 @@ export function Dashboard() {
                   onEditingChange={handleEditingChange}
                 />
 
+                {state.status === 'running' && <StreamingOutput output={streamed} />}
+
+                {state.status === 'completed' && (
+                  <Card padding="lg">
+                    <div className="flex items-center gap-2 mb-4">
+                      <Icons.Message className="text-blue-400" />
+                      <h3 className={`text-lg ${theme.fontWeight.semibold} text-white`}>Continue the Conversation</h3>
+                    </div>
+                    <div className="flex gap-2 items-start">
+                      <div className="flex-1">
+                        <Input
+                          value={followUp}
+                          onChange={(e) => setFollowUp(e.target.value)}
+                          onKeyDown={(e) => e.key === 'Enter' && handleSendMessage()}
+                          placeholder="Send a follow-up message"
+                          disabled={isSending}
+                        />
+                      </div>
+                      <Button variant="primary" onClick={handleSendMessage} loading={isSending} disabled={!followUp.trim() || !canApprove}>
+                        Send
+                      </Button>
+                    </div>
+                  </Card>
+                )}
+
                 <div className="grid grid-cols-1 lg:grid-cols-2 gap-6">
                   <MessageHistory messages={state.message_history} />
                   <StateInspector state={state} />